@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+type APIScope string
+
+const (
+	APIScopeTeams    APIScope = "teams:read"
+	APIScopeStudents APIScope = "students:read"
+	APIScopeTeachers APIScope = "teachers:read"
+	APIScopeSchools  APIScope = "schools:read"
+	APIScopeCheckIns APIScope = "checkins:read"
+	APIScopeStats    APIScope = "stats:read"
+)
+
+var APIScopes = []APIScope{APIScopeTeams, APIScopeStudents, APIScopeTeachers, APIScopeSchools, APIScopeCheckIns, APIScopeStats}
+
+type APIToken struct {
+	ID   int64
+	Name string
+	// TokenHash is the hex-encoded SHA-256 hash of the token. The token itself
+	// is only shown once when it is created.
+	TokenHash string
+	Scopes    []APIScope
+	CreatedBy string
+	CreatedTS time.Time
+	// ExpiresTS is zero if the token does not expire.
+	ExpiresTS  time.Time
+	RevokedTS  time.Time
+	LastUsedTS time.Time
+}
+
+func (t *APIToken) HasScope(scope APIScope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t *APIToken) Expired() bool {
+	return !t.ExpiresTS.IsZero() && time.Now().After(t.ExpiresTS)
+}
+
+func (t *APIToken) Revoked() bool {
+	return !t.RevokedTS.IsZero()
+}
+
+// Active reports whether the token can be used.
+func (t *APIToken) Active() bool {
+	return !t.Revoked() && !t.Expired()
+}
+
+const apiTokenColumns = `id, name, tokenhash, scopes, createdby, created_ts, expires_ts, revoked_ts, lastused_ts`
+
+func (d *Database) scanAPIToken(row dbutil.Scannable) (*APIToken, error) {
+	var token APIToken
+	var scopes string
+	var createdTS, expiresTS, revokedTS, lastUsedTS int64
+	err := row.Scan(&token.ID, &token.Name, &token.TokenHash, &scopes, &token.CreatedBy, &createdTS, &expiresTS, &revokedTS, &lastUsedTS)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope != "" {
+			token.Scopes = append(token.Scopes, APIScope(scope))
+		}
+	}
+	token.CreatedTS = time.UnixMilli(createdTS)
+	if expiresTS > 0 {
+		token.ExpiresTS = time.UnixMilli(expiresTS)
+	}
+	if revokedTS > 0 {
+		token.RevokedTS = time.UnixMilli(revokedTS)
+	}
+	if lastUsedTS > 0 {
+		token.LastUsedTS = time.UnixMilli(lastUsedTS)
+	}
+	return &token, nil
+}
+
+func (d *Database) CreateAPIToken(ctx context.Context, token *APIToken) error {
+	if token.CreatedTS.IsZero() {
+		token.CreatedTS = time.Now()
+	}
+	var expiresTS int64
+	if !token.ExpiresTS.IsZero() {
+		expiresTS = token.ExpiresTS.UnixMilli()
+	}
+	scopes := make([]string, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = string(scope)
+	}
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO api_tokens (name, tokenhash, scopes, createdby, created_ts, expires_ts)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, token.Name, token.TokenHash, strings.Join(scopes, ","), token.CreatedBy, token.CreatedTS.UnixMilli(), expiresTS).Scan(&token.ID)
+}
+
+// GetAPITokens returns all of the tokens, newest first.
+func (d *Database) GetAPITokens(ctx context.Context) ([]*APIToken, error) {
+	rows, err := d.DB.Query(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		token, err := d.scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// GetAPITokenByHash returns the token with the hash, or nil if there is none.
+func (d *Database) GetAPITokenByHash(ctx context.Context, tokenHash string) (*APIToken, error) {
+	rows, err := d.DB.Query(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE tokenhash = ?`, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return d.scanAPIToken(rows)
+}
+
+func (d *Database) RevokeAPIToken(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE api_tokens
+		SET revoked_ts = ?
+		WHERE id = ? AND revoked_ts = 0
+	`, time.Now().UnixMilli(), id)
+	return err
+}
+
+func (d *Database) MarkAPITokenUsed(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `UPDATE api_tokens SET lastused_ts = ? WHERE id = ?`, time.Now().UnixMilli(), id)
+	return err
+}
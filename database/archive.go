@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type ArchiveLink struct {
+	ID    int64
+	Year  int
+	URL   string
+	Title string
+}
+
+type ArchiveWinner struct {
+	ID       int64
+	ResultID int64
+	Place    int
+	TeamName string
+	School   string
+	Location string
+	// TeamID is the registered team that won, or uuid.Nil if the winner is
+	// not linked to a team.
+	TeamID uuid.UUID
+}
+
+// ArchiveResult is one set of placements, such as the overall winners or the
+// winners of a division.
+type ArchiveResult struct {
+	ID      int64
+	Year    int
+	Name    string
+	Winners []*ArchiveWinner
+}
+
+type ArchiveYear struct {
+	Year    int
+	Recap   string
+	Links   []*ArchiveLink
+	Results []*ArchiveResult
+}
+
+// RecapParagraphs splits the recap into paragraphs at blank lines.
+func (y *ArchiveYear) RecapParagraphs() []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(y.Recap, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// GetArchive returns all of the archive years, newest first, with their links
+// and results.
+func (d *Database) GetArchive(ctx context.Context) ([]*ArchiveYear, error) {
+	rows, err := d.DB.Query(ctx, `SELECT year, recap FROM archive_years ORDER BY year DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var years []*ArchiveYear
+	yearsByYear := map[int]*ArchiveYear{}
+	for rows.Next() {
+		var year ArchiveYear
+		if err := rows.Scan(&year.Year, &year.Recap); err != nil {
+			return nil, err
+		}
+		years = append(years, &year)
+		yearsByYear[year.Year] = &year
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	links, err := d.getArchiveLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if year, ok := yearsByYear[link.Year]; ok {
+			year.Links = append(year.Links, link)
+		}
+	}
+	results, err := d.getArchiveResults(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if year, ok := yearsByYear[result.Year]; ok {
+			year.Results = append(year.Results, result)
+		}
+	}
+	return years, nil
+}
+
+// GetArchiveYear returns the archive year, or nil if there is none.
+func (d *Database) GetArchiveYear(ctx context.Context, year int) (*ArchiveYear, error) {
+	years, err := d.GetArchive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, archiveYear := range years {
+		if archiveYear.Year == year {
+			return archiveYear, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *Database) getArchiveLinks(ctx context.Context) ([]*ArchiveLink, error) {
+	rows, err := d.DB.Query(ctx, `SELECT id, year, url, title FROM archive_links ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []*ArchiveLink
+	for rows.Next() {
+		var link ArchiveLink
+		if err := rows.Scan(&link.ID, &link.Year, &link.URL, &link.Title); err != nil {
+			return nil, err
+		}
+		links = append(links, &link)
+	}
+	return links, rows.Err()
+}
+
+func (d *Database) getArchiveResults(ctx context.Context) ([]*ArchiveResult, error) {
+	rows, err := d.DB.Query(ctx, `SELECT id, year, name FROM archive_results ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []*ArchiveResult
+	resultsByID := map[int64]*ArchiveResult{}
+	for rows.Next() {
+		var result ArchiveResult
+		if err := rows.Scan(&result.ID, &result.Year, &result.Name); err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+		resultsByID[result.ID] = &result
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	winnerRows, err := d.DB.Query(ctx, `
+		SELECT id, resultid, place, teamname, school, location, teamid
+		FROM archive_winners
+		ORDER BY place, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer winnerRows.Close()
+	for winnerRows.Next() {
+		var winner ArchiveWinner
+		if err := winnerRows.Scan(&winner.ID, &winner.ResultID, &winner.Place, &winner.TeamName, &winner.School, &winner.Location, &winner.TeamID); err != nil {
+			return nil, err
+		}
+		if result, ok := resultsByID[winner.ResultID]; ok {
+			result.Winners = append(result.Winners, &winner)
+		}
+	}
+	return results, winnerRows.Err()
+}
+
+// SaveArchiveYear creates the archive year or updates its recap.
+func (d *Database) SaveArchiveYear(ctx context.Context, year int, recap string) error {
+	_, err := d.DB.Exec(ctx, `
+		INSERT INTO archive_years (year, recap) VALUES (?, ?)
+		ON CONFLICT (year) DO UPDATE SET recap = excluded.recap
+	`, year, recap)
+	return err
+}
+
+// DeleteArchiveYear deletes the archive year with all of its links and
+// results.
+func (d *Database) DeleteArchiveYear(ctx context.Context, year int) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		for _, query := range []string{
+			`DELETE FROM archive_winners WHERE resultid IN (SELECT id FROM archive_results WHERE year = ?)`,
+			`DELETE FROM archive_results WHERE year = ?`,
+			`DELETE FROM archive_links WHERE year = ?`,
+			`DELETE FROM archive_years WHERE year = ?`,
+		} {
+			if _, err := d.DB.Exec(ctx, query, year); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Database) AddArchiveLink(ctx context.Context, link *ArchiveLink) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO archive_links (year, url, title) VALUES (?, ?, ?)
+		RETURNING id
+	`, link.Year, link.URL, link.Title).Scan(&link.ID)
+}
+
+func (d *Database) DeleteArchiveLink(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `DELETE FROM archive_links WHERE id = ?`, id)
+	return err
+}
+
+func (d *Database) AddArchiveResult(ctx context.Context, result *ArchiveResult) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO archive_results (year, name) VALUES (?, ?)
+		RETURNING id
+	`, result.Year, result.Name).Scan(&result.ID)
+}
+
+func (d *Database) RenameArchiveResult(ctx context.Context, id int64, name string) error {
+	_, err := d.DB.Exec(ctx, `UPDATE archive_results SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+func (d *Database) DeleteArchiveResult(ctx context.Context, id int64) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM archive_winners WHERE resultid = ?`, id); err != nil {
+			return err
+		}
+		_, err := d.DB.Exec(ctx, `DELETE FROM archive_results WHERE id = ?`, id)
+		return err
+	})
+}
+
+func archiveTeamID(teamID uuid.UUID) string {
+	if teamID == uuid.Nil {
+		return ""
+	}
+	return teamID.String()
+}
+
+func (d *Database) AddArchiveWinner(ctx context.Context, winner *ArchiveWinner) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO archive_winners (resultid, place, teamname, school, location, teamid)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, winner.ResultID, winner.Place, winner.TeamName, winner.School, winner.Location, archiveTeamID(winner.TeamID)).Scan(&winner.ID)
+}
+
+func (d *Database) UpdateArchiveWinner(ctx context.Context, winner *ArchiveWinner) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE archive_winners
+		SET place = ?, teamname = ?, school = ?, location = ?, teamid = ?
+		WHERE id = ?
+	`, winner.Place, winner.TeamName, winner.School, winner.Location, archiveTeamID(winner.TeamID), winner.ID)
+	return err
+}
+
+func (d *Database) DeleteArchiveWinner(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `DELETE FROM archive_winners WHERE id = ?`, id)
+	return err
+}
+
+// PublishArchiveResults adds the results and their winners to the archive
+// year, creating the year if it does not exist yet.
+func (d *Database) PublishArchiveResults(ctx context.Context, year int, results []*ArchiveResult) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `INSERT INTO archive_years (year) VALUES (?) ON CONFLICT (year) DO NOTHING`, year); err != nil {
+			return err
+		}
+		for _, result := range results {
+			result.Year = year
+			if err := d.AddArchiveResult(ctx, result); err != nil {
+				return err
+			}
+			for _, winner := range result.Winners {
+				winner.ResultID = result.ID
+				if err := d.AddArchiveWinner(ctx, winner); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
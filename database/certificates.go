@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// CertificateSettings are the parts of the participation certificates that
+// admins can change.
+type CertificateSettings struct {
+	Title string
+	// Body is a text/template that is executed with the student's details.
+	Body        string
+	SignerName  string
+	SignerTitle string
+	// Signature is an image of the signature as uploaded, or nil if there is
+	// no signature image.
+	Signature []byte
+	// Released is true once teachers can download their students'
+	// certificates.
+	Released  bool
+	UpdatedTS time.Time
+}
+
+func (d *Database) GetCertificateSettings(ctx context.Context) (*CertificateSettings, error) {
+	var settings CertificateSettings
+	var updatedTS int64
+	err := d.DB.QueryRow(ctx, `
+		SELECT title, body, signername, signertitle, signature, released, updated_ts
+		FROM certificate_settings
+		WHERE id = 1
+	`).Scan(&settings.Title, &settings.Body, &settings.SignerName, &settings.SignerTitle,
+		&settings.Signature, &settings.Released, &updatedTS)
+	if err != nil {
+		return nil, err
+	}
+	if updatedTS > 0 {
+		settings.UpdatedTS = time.UnixMilli(updatedTS)
+	}
+	return &settings, nil
+}
+
+// SaveCertificateSettings saves everything except the signature image, which
+// is changed with SetCertificateSignature.
+func (d *Database) SaveCertificateSettings(ctx context.Context, settings *CertificateSettings) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE certificate_settings
+		SET title = ?, body = ?, signername = ?, signertitle = ?, released = ?, updated_ts = ?
+		WHERE id = 1
+	`, settings.Title, settings.Body, settings.SignerName, settings.SignerTitle, settings.Released, time.Now().UnixMilli())
+	return err
+}
+
+// SetCertificateSignature replaces the signature image. A nil image removes
+// it.
+func (d *Database) SetCertificateSignature(ctx context.Context, signature []byte) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE certificate_settings SET signature = ?, updated_ts = ? WHERE id = 1
+	`, signature, time.Now().UnixMilli())
+	return err
+}
+
+// GetCertificatesSent returns when each student was last emailed their
+// certificate, by student email.
+func (d *Database) GetCertificatesSent(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := d.DB.Query(ctx, `SELECT email, certificatesent_ts FROM students WHERE certificatesent_ts > 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sent := map[string]time.Time{}
+	for rows.Next() {
+		var email string
+		var ts int64
+		if err := rows.Scan(&email, &ts); err != nil {
+			return nil, err
+		}
+		sent[email] = time.UnixMilli(ts)
+	}
+	return sent, rows.Err()
+}
+
+func (d *Database) MarkCertificateSent(ctx context.Context, email string) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE students SET certificatesent_ts = ? WHERE email = ?
+	`, time.Now().UnixMilli(), email)
+	return err
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+// Chaperone is an adult that comes to campus with a teacher's teams. The
+// teacher registers themself as a chaperone too if they are coming.
+type Chaperone struct {
+	ID           int64
+	Season       int
+	TeacherEmail string
+	// IsTeacher is whether this is the teacher themself rather than an
+	// additional chaperone that they registered.
+	IsTeacher         bool
+	Name              string
+	Email             string
+	Phone             string
+	DietaryCategories []int64
+	DietaryNote       string
+	ParkingPermit     bool
+	RegisteredTS      time.Time
+	TicketSent        bool
+
+	CheckedIn        bool
+	CheckedInTS      time.Time
+	CheckInVolunteer string
+}
+
+// ChaperoneWithTeacher is a chaperone with the teacher that registered them.
+type ChaperoneWithTeacher struct {
+	*Chaperone
+	TeacherName string
+	SchoolName  string
+}
+
+const chaperoneColumns = `
+	c.id, c.season, c.teacheremail, c.isteacher, c.name, c.email, c.phone, c.dietarycategories,
+	c.dietarynote, c.parkingpermit, c.registered_ts, c.ticketsent, c.checkedin_ts, c.checkin_volunteer
+`
+
+func scanChaperone(row dbutil.Scannable, extra ...any) (*Chaperone, error) {
+	var chaperone Chaperone
+	var categories string
+	var registeredTS int64
+	var checkedInTS sql.NullInt64
+	err := row.Scan(append([]any{
+		&chaperone.ID, &chaperone.Season, &chaperone.TeacherEmail, &chaperone.IsTeacher, &chaperone.Name,
+		&chaperone.Email, &chaperone.Phone, &categories, &chaperone.DietaryNote, &chaperone.ParkingPermit,
+		&registeredTS, &chaperone.TicketSent, &checkedInTS, &chaperone.CheckInVolunteer,
+	}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	chaperone.DietaryCategories = splitDietaryCategories(categories)
+	chaperone.RegisteredTS = time.UnixMilli(registeredTS)
+	if checkedInTS.Valid {
+		chaperone.CheckedIn = true
+		chaperone.CheckedInTS = time.UnixMilli(checkedInTS.Int64)
+	}
+	return &chaperone, nil
+}
+
+// GetChaperones returns everyone that is registered to come with a teacher in
+// the season, grouped by school with each teacher first.
+func (d *Database) GetChaperones(ctx context.Context, season int) ([]*ChaperoneWithTeacher, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+chaperoneColumns+`, COALESCE(t.name, ''), COALESCE(t.schoolname, '')
+		FROM chaperones c
+			LEFT JOIN teachers t ON t.email = c.teacheremail
+		WHERE c.season = ?
+		ORDER BY t.schoolname, c.teacheremail, c.isteacher DESC, c.id
+	`, season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chaperones []*ChaperoneWithTeacher
+	for rows.Next() {
+		var withTeacher ChaperoneWithTeacher
+		withTeacher.Chaperone, err = scanChaperone(rows, &withTeacher.TeacherName, &withTeacher.SchoolName)
+		if err != nil {
+			return nil, err
+		}
+		chaperones = append(chaperones, &withTeacher)
+	}
+	return chaperones, rows.Err()
+}
+
+// GetTeacherChaperones returns the chaperones that the teacher registered for
+// the season, with the teacher themself first if they are coming.
+func (d *Database) GetTeacherChaperones(ctx context.Context, season int, teacherEmail string) ([]*Chaperone, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+chaperoneColumns+`
+		FROM chaperones c
+		WHERE c.season = ? AND c.teacheremail = ?
+		ORDER BY c.isteacher DESC, c.id
+	`, season, teacherEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chaperones []*Chaperone
+	for rows.Next() {
+		chaperone, err := scanChaperone(rows)
+		if err != nil {
+			return nil, err
+		}
+		chaperones = append(chaperones, chaperone)
+	}
+	return chaperones, rows.Err()
+}
+
+// GetChaperone returns the chaperone, or nil if there is no chaperone with
+// the ID.
+func (d *Database) GetChaperone(ctx context.Context, id int64) (*Chaperone, error) {
+	chaperone, err := scanChaperone(d.DB.QueryRow(ctx, `
+		SELECT `+chaperoneColumns+`
+		FROM chaperones c
+		WHERE c.id = ?
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return chaperone, err
+}
+
+// AddChaperone registers the chaperone and sets its ID. Each email can only
+// be registered once per season.
+func (d *Database) AddChaperone(ctx context.Context, chaperone *Chaperone) error {
+	chaperone.RegisteredTS = time.Now()
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO chaperones (
+			season, teacheremail, isteacher, name, email, phone, dietarycategories, dietarynote,
+			parkingpermit, registered_ts
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, chaperone.Season, chaperone.TeacherEmail, chaperone.IsTeacher, chaperone.Name, chaperone.Email,
+		chaperone.Phone, joinDietaryCategories(chaperone.DietaryCategories), chaperone.DietaryNote,
+		chaperone.ParkingPermit, chaperone.RegisteredTS.UnixMilli()).Scan(&chaperone.ID)
+}
+
+// UpdateChaperone saves the chaperone's details. Changing the email does not
+// change their ticket.
+func (d *Database) UpdateChaperone(ctx context.Context, chaperone *Chaperone) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE chaperones
+		SET name = ?, email = ?, phone = ?, dietarycategories = ?, dietarynote = ?, parkingpermit = ?
+		WHERE id = ?
+	`, chaperone.Name, chaperone.Email, chaperone.Phone, joinDietaryCategories(chaperone.DietaryCategories),
+		chaperone.DietaryNote, chaperone.ParkingPermit, chaperone.ID)
+	return err
+}
+
+func (d *Database) DeleteChaperone(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `DELETE FROM chaperones WHERE id = ?`, id)
+	return err
+}
+
+func (d *Database) MarkChaperoneTicketSent(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `UPDATE chaperones SET ticketsent = TRUE WHERE id = ?`, id)
+	return err
+}
+
+// CheckInChaperone records that the chaperone arrived on campus. If they were
+// already checked in, nothing is changed and false is returned.
+func (d *Database) CheckInChaperone(ctx context.Context, id int64, ts time.Time, volunteer string) (bool, error) {
+	res, err := d.DB.Exec(ctx, `
+		UPDATE chaperones
+		SET checkedin_ts = ?, checkin_volunteer = ?
+		WHERE id = ? AND checkedin_ts IS NULL
+	`, ts.UnixMilli(), volunteer, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
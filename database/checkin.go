@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type CheckInDirection string
+
+const (
+	CheckInDirectionIn  CheckInDirection = "in"
+	CheckInDirectionOut CheckInDirection = "out"
+)
+
+type CheckInEvent struct {
+	ID           int64
+	StudentEmail string
+	Direction    CheckInDirection
+	TS           time.Time
+	// Volunteer is the volunteer or admin that scanned the student.
+	Volunteer string
+	// Station is where the student was scanned, for example a kiosk ID.
+	Station string
+}
+
+// RecordCheckInEvent records that the student arrived or left at the time of
+// the event. Events may be recorded out of order, for example when an offline
+// kiosk syncs.
+//
+// If the student was already in the given state at that time, nothing is
+// recorded and false is returned. If the next event after the new one is in the
+// same direction, it is now redundant and is removed, so that the earliest of
+// several check-ins is kept.
+func (d *Database) RecordCheckInEvent(ctx context.Context, event *CheckInEvent) (recorded bool, err error) {
+	if event.TS.IsZero() {
+		event.TS = time.Now()
+	}
+	err = d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		var previous CheckInDirection
+		err := d.DB.QueryRow(ctx, `
+			SELECT direction
+			FROM checkin_events
+			WHERE studentemail = ?
+				AND ts <= ?
+			ORDER BY ts DESC, id DESC
+			LIMIT 1
+		`, event.StudentEmail, event.TS.UnixMilli()).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			previous = CheckInDirectionOut
+		} else if err != nil {
+			return err
+		}
+		if previous == event.Direction {
+			return nil
+		}
+
+		err = d.DB.QueryRow(ctx, `
+			INSERT INTO checkin_events (studentemail, direction, ts, volunteer, station)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING id
+		`, event.StudentEmail, event.Direction, event.TS.UnixMilli(), event.Volunteer, event.Station).Scan(&event.ID)
+		if err != nil {
+			return err
+		}
+		recorded = true
+
+		var nextID int64
+		var next CheckInDirection
+		err = d.DB.QueryRow(ctx, `
+			SELECT id, direction
+			FROM checkin_events
+			WHERE studentemail = ?
+				AND ts > ?
+			ORDER BY ts, id
+			LIMIT 1
+		`, event.StudentEmail, event.TS.UnixMilli()).Scan(&nextID, &next)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if next == event.Direction {
+			_, err = d.DB.Exec(ctx, `DELETE FROM checkin_events WHERE id = ?`, nextID)
+		}
+		return err
+	})
+	return
+}
+
+// CheckInStudent records that the student arrived at the given time.
+func (d *Database) CheckInStudent(ctx context.Context, email string, ts time.Time, volunteer, station string) (bool, error) {
+	return d.RecordCheckInEvent(ctx, &CheckInEvent{
+		StudentEmail: email,
+		Direction:    CheckInDirectionIn,
+		TS:           ts,
+		Volunteer:    volunteer,
+		Station:      station,
+	})
+}
+
+// CheckOutStudent records that the student left at the given time.
+func (d *Database) CheckOutStudent(ctx context.Context, email string, ts time.Time, volunteer, station string) (bool, error) {
+	return d.RecordCheckInEvent(ctx, &CheckInEvent{
+		StudentEmail: email,
+		Direction:    CheckInDirectionOut,
+		TS:           ts,
+		Volunteer:    volunteer,
+		Station:      station,
+	})
+}
+
+type CheckInEventWithStudent struct {
+	CheckInEvent
+	StudentName string
+	StudentAge  int
+	TeamName    string
+}
+
+// GetCheckInEvents returns the check-in events of the non-withdrawn students,
+// newest first. If studentEmail is not empty, only that student's events are
+// returned.
+func (d *Database) GetCheckInEvents(ctx context.Context, studentEmail string) ([]*CheckInEventWithStudent, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT e.id, e.studentemail, e.direction, e.ts, e.volunteer, e.station,
+			s.name, s.age, t.name
+		FROM checkin_events e
+		JOIN students s ON s.email = e.studentemail
+		JOIN teams t ON t.id = s.teamid
+		WHERE s.withdrawn_ts = 0
+			AND ($1 = '' OR e.studentemail = $1)
+		ORDER BY e.ts DESC, e.id DESC
+	`, studentEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*CheckInEventWithStudent
+	for rows.Next() {
+		var event CheckInEventWithStudent
+		var ts int64
+		err = rows.Scan(&event.ID, &event.StudentEmail, &event.Direction, &ts, &event.Volunteer, &event.Station,
+			&event.StudentName, &event.StudentAge, &event.TeamName)
+		if err != nil {
+			return nil, err
+		}
+		event.TS = time.UnixMilli(ts)
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// GetCheckedInStudentEmails returns the emails of every student that has ever
+// been checked in, even if they have checked out since.
+func (d *Database) GetCheckedInStudentEmails(ctx context.Context) (map[string]bool, error) {
+	rows, err := d.DB.Query(ctx, `SELECT DISTINCT studentemail FROM checkin_events WHERE direction = ?`, CheckInDirectionIn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := map[string]bool{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails[email] = true
+	}
+	return emails, rows.Err()
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// DietaryCategory is a dietary restriction that can be chosen, such as
+// vegetarian. Each season has its own categories.
+type DietaryCategory struct {
+	ID     int64
+	Season int
+	Name   string
+}
+
+// DietaryChoice is the dietary restrictions that a teacher or volunteer chose.
+type DietaryChoice struct {
+	Email      string
+	Name       string
+	Categories []int64
+	Note       string
+}
+
+func joinDietaryCategories(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func splitDietaryCategories(ids string) []int64 {
+	var parsed []int64
+	for _, part := range strings.Split(ids, ",") {
+		if id, err := strconv.ParseInt(part, 10, 64); err == nil {
+			parsed = append(parsed, id)
+		}
+	}
+	return parsed
+}
+
+func (d *Database) GetDietaryCategories(ctx context.Context, season int) ([]*DietaryCategory, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT id, season, name
+		FROM dietary_categories
+		WHERE season = ?
+		ORDER BY id
+	`, season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []*DietaryCategory
+	for rows.Next() {
+		var category DietaryCategory
+		if err := rows.Scan(&category.ID, &category.Season, &category.Name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+	return categories, rows.Err()
+}
+
+// GetLatestDietaryCategorySeason returns the most recent season before the
+// given one that has dietary categories, or 0 if there is none.
+func (d *Database) GetLatestDietaryCategorySeason(ctx context.Context, before int) (int, error) {
+	var season sql.NullInt64
+	err := d.DB.QueryRow(ctx, `SELECT MAX(season) FROM dietary_categories WHERE season < ?`, before).Scan(&season)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return int(season.Int64), err
+}
+
+// AddDietaryCategory adds the category and sets its ID.
+func (d *Database) AddDietaryCategory(ctx context.Context, category *DietaryCategory) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO dietary_categories (season, name) VALUES (?, ?) RETURNING id
+	`, category.Season, category.Name).Scan(&category.ID)
+}
+
+func (d *Database) RenameDietaryCategory(ctx context.Context, id int64, name string) error {
+	_, err := d.DB.Exec(ctx, `UPDATE dietary_categories SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+// DeleteDietaryCategory deletes the category. Anyone that chose it no longer
+// has it counted, but their choice is not changed.
+func (d *Database) DeleteDietaryCategory(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `DELETE FROM dietary_categories WHERE id = ?`, id)
+	return err
+}
+
+func (d *Database) SetStudentDietaryCategories(ctx context.Context, email string, categories []int64) error {
+	_, err := d.DB.Exec(ctx, `UPDATE students SET dietarycategories = ? WHERE email = ?`, joinDietaryCategories(categories), email)
+	return err
+}
+
+func (d *Database) SetTeacherDietaryChoice(ctx context.Context, email string, categories []int64, note string) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE teachers SET dietarycategories = ?, dietarynote = ? WHERE email = ?
+	`, joinDietaryCategories(categories), note, email)
+	return err
+}
+
+func (d *Database) SetVolunteerDietaryChoice(ctx context.Context, email string, categories []int64, note string) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE volunteers SET dietarycategories = ?, dietarynote = ? WHERE email = ?
+	`, joinDietaryCategories(categories), note, email)
+	return err
+}
+
+// GetVolunteerDietaryChoices returns the dietary restrictions of every
+// volunteer, ordered by email. Volunteers don't have names, so Name is empty.
+func (d *Database) GetVolunteerDietaryChoices(ctx context.Context) ([]*DietaryChoice, error) {
+	rows, err := d.DB.Query(ctx, `SELECT email, dietarycategories, dietarynote FROM volunteers ORDER BY email`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var choices []*DietaryChoice
+	for rows.Next() {
+		var choice DietaryChoice
+		var categories string
+		if err := rows.Scan(&choice.Email, &categories, &choice.Note); err != nil {
+			return nil, err
+		}
+		choice.Categories = splitDietaryCategories(categories)
+		choices = append(choices, &choice)
+	}
+	return choices, rows.Err()
+}
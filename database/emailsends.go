@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+type EmailKind string
+
+const (
+	EmailKindStudentVerify EmailKind = "student_verify"
+	EmailKindParentForms   EmailKind = "parent_forms"
+	EmailKindCertificate   EmailKind = "certificate"
+)
+
+// EmailSource is who caused the email to be sent. Only emails sent by the
+// teacher count against their email send budget.
+type EmailSource string
+
+const (
+	EmailSourceTeacher EmailSource = "teacher"
+	EmailSourceStudent EmailSource = "student"
+	EmailSourceAdmin   EmailSource = "admin"
+)
+
+type EmailStatus string
+
+const (
+	EmailStatusAccepted EmailStatus = "accepted"
+	EmailStatusFailed   EmailStatus = "failed"
+)
+
+type EmailSend struct {
+	TeacherEmail string
+	StudentEmail string
+	Recipient    string
+	Kind         EmailKind
+	Source       EmailSource
+	Resend       bool
+	Status       EmailStatus
+	TS           time.Time
+}
+
+// RecordEmailSend logs an email that was sent regarding one of the teacher's
+// students.
+func (d *Database) RecordEmailSend(ctx context.Context, send *EmailSend) error {
+	if send.TS.IsZero() {
+		send.TS = time.Now()
+	}
+	_, err := d.DB.Exec(ctx, `
+		INSERT INTO email_sends (teacheremail, studentemail, recipient, kind, source, resend, status, ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, send.TeacherEmail, send.StudentEmail, send.Recipient, send.Kind, send.Source, send.Resend, send.Status, send.TS.UnixMilli())
+	return err
+}
+
+// CountEmailSends returns the number of first sends and resends that the
+// teacher has sent since the given time. Refunded and failed sends, and sends
+// caused by anyone other than the teacher, are not counted.
+func (d *Database) CountEmailSends(ctx context.Context, teacherEmail string, since time.Time) (firstSends, resends int, err error) {
+	err = d.DB.QueryRow(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN resend THEN 0 ELSE 1 END), 0),
+			COALESCE(SUM(CASE WHEN resend THEN 1 ELSE 0 END), 0)
+		FROM email_sends
+		WHERE teacheremail = ?
+			AND ts >= ?
+			AND source = ?
+			AND status = ?
+			AND NOT refunded
+	`, teacherEmail, since.UnixMilli(), EmailSourceTeacher, EmailStatusAccepted).Scan(&firstSends, &resends)
+	return
+}
+
+// RefundEmailSends marks all of the sends regarding the student as refunded
+// so that they no longer count against the teacher's budget.
+func (d *Database) RefundEmailSends(ctx context.Context, teacherEmail, studentEmail string) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE email_sends
+		SET refunded = TRUE
+		WHERE teacheremail = ?
+			AND studentemail = ?
+	`, teacherEmail, studentEmail)
+	return err
+}
+
+func (d *Database) scanEmailSend(row dbutil.Scannable) (*EmailSend, error) {
+	var send EmailSend
+	var ts int64
+	err := row.Scan(&send.TeacherEmail, &send.StudentEmail, &send.Recipient, &send.Kind, &send.Source, &send.Resend, &send.Status, &ts)
+	send.TS = time.UnixMilli(ts)
+	return &send, err
+}
+
+// GetLatestEmailSend returns the most recent send of the given kind regarding
+// the student, or nil if there has not been one.
+func (d *Database) GetLatestEmailSend(ctx context.Context, studentEmail string, kind EmailKind) (*EmailSend, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT teacheremail, studentemail, recipient, kind, source, resend, status, ts
+		FROM email_sends
+		WHERE studentemail = ?
+			AND kind = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, studentEmail, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return d.scanEmailSend(rows)
+}
+
+// GetLatestEmailSendsForTeacher returns the most recent send of each kind for
+// each of the teacher's students.
+func (d *Database) GetLatestEmailSendsForTeacher(ctx context.Context, teacherEmail string) ([]*EmailSend, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT teacheremail, studentemail, recipient, kind, source, resend, status, ts
+		FROM email_sends
+		WHERE id IN (
+			SELECT MAX(id)
+			FROM email_sends
+			WHERE teacheremail = ?
+			GROUP BY studentemail, kind
+		)
+	`, teacherEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sends []*EmailSend
+	for rows.Next() {
+		send, err := d.scanEmailSend(rows)
+		if err != nil {
+			return nil, err
+		}
+		sends = append(sends, send)
+	}
+	return sends, rows.Err()
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+// EmergencyInfo is the emergency contact and medical information for an
+// in-person student. It is only shown to the volunteers scanning the student
+// and to the admins that are allowed to see it.
+type EmergencyInfo struct {
+	StudentEmail   string
+	ContactName    string
+	ContactPhone   string
+	MedicalNotes   string
+	Accommodations string
+	Updated        time.Time
+}
+
+// StudentEmergencyInfo is a student's emergency information along with who
+// they are, for listing all of it at once.
+type StudentEmergencyInfo struct {
+	EmergencyInfo
+	StudentName string
+	TeamName    string
+	ParentEmail string
+}
+
+// IsEmpty reports whether nothing was entered.
+func (info *EmergencyInfo) IsEmpty() bool {
+	return info.ContactName == "" && info.ContactPhone == "" && info.MedicalNotes == "" && info.Accommodations == ""
+}
+
+const emergencyInfoColumns = `e.studentemail, e.contactname, e.contactphone, e.medicalnotes, e.accommodations, e.updated_ts`
+
+func scanEmergencyInfo(row dbutil.Scannable, info *EmergencyInfo, extra ...any) error {
+	var updated int64
+	dest := append([]any{&info.StudentEmail, &info.ContactName, &info.ContactPhone, &info.MedicalNotes, &info.Accommodations, &updated}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	info.Updated = time.UnixMilli(updated)
+	return nil
+}
+
+// GetEmergencyInfo returns the student's emergency information, or nil if
+// there is none.
+func (d *Database) GetEmergencyInfo(ctx context.Context, studentEmail string) (*EmergencyInfo, error) {
+	var info EmergencyInfo
+	err := scanEmergencyInfo(d.DB.QueryRow(ctx, `
+		SELECT `+emergencyInfoColumns+`
+		FROM student_emergency_info e
+		WHERE e.studentemail = ?
+	`, studentEmail), &info)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetAllEmergencyInfo returns the emergency information of all of the
+// students that are still registered, ordered by team and name.
+func (d *Database) GetAllEmergencyInfo(ctx context.Context) ([]*StudentEmergencyInfo, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+emergencyInfoColumns+`, s.name, t.name, COALESCE(s.parentemail, '')
+		FROM student_emergency_info e
+			JOIN students s ON s.email = e.studentemail
+			JOIN teams t ON t.id = s.teamid
+		WHERE s.withdrawn_ts = 0
+		ORDER BY t.name, s.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var infos []*StudentEmergencyInfo
+	for rows.Next() {
+		var info StudentEmergencyInfo
+		if err := scanEmergencyInfo(rows, &info.EmergencyInfo, &info.StudentName, &info.TeamName, &info.ParentEmail); err != nil {
+			return nil, err
+		}
+		infos = append(infos, &info)
+	}
+	return infos, rows.Err()
+}
+
+// SaveEmergencyInfo creates or replaces the student's emergency information.
+func (d *Database) SaveEmergencyInfo(ctx context.Context, info *EmergencyInfo) error {
+	if info.Updated.IsZero() {
+		info.Updated = time.Now()
+	}
+	_, err := d.DB.Exec(ctx, `
+		INSERT INTO student_emergency_info (studentemail, contactname, contactphone, medicalnotes, accommodations, updated_ts)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (studentemail) DO UPDATE
+		SET contactname = excluded.contactname,
+			contactphone = excluded.contactphone,
+			medicalnotes = excluded.medicalnotes,
+			accommodations = excluded.accommodations,
+			updated_ts = excluded.updated_ts
+	`, info.StudentEmail, info.ContactName, info.ContactPhone, info.MedicalNotes, info.Accommodations, info.Updated.UnixMilli())
+	return err
+}
+
+// PurgeEmergencyInfo deletes all of the emergency information and returns how
+// many students' information was deleted.
+func (d *Database) PurgeEmergencyInfo(ctx context.Context) (int64, error) {
+	res, err := d.DB.Exec(ctx, `DELETE FROM student_emergency_info`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ParticipationRecord is a student who competed in a past season.
+type ParticipationRecord struct {
+	Year        int
+	Email       string
+	Name        string
+	TeamName    string
+	Division    Division
+	SchoolName  string
+	SchoolCity  string
+	SchoolState string
+}
+
+// ParticipationSeason summarizes the participation history of one season.
+type ParticipationSeason struct {
+	Year     int
+	Students int
+	Teams    int
+	Schools  int
+}
+
+func (d *Database) GetParticipationHistory(ctx context.Context) ([]*ParticipationRecord, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT year, email, name, teamname, division, schoolname, schoolcity, schoolstate
+		FROM participation_history
+		ORDER BY year, schoolname, teamname, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []*ParticipationRecord
+	for rows.Next() {
+		var record ParticipationRecord
+		err := rows.Scan(&record.Year, &record.Email, &record.Name, &record.TeamName, &record.Division,
+			&record.SchoolName, &record.SchoolCity, &record.SchoolState)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+// GetParticipationSeasons returns the seasons that have participation history,
+// newest first.
+func (d *Database) GetParticipationSeasons(ctx context.Context) ([]*ParticipationSeason, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT year, COUNT(*), COUNT(DISTINCT LOWER(schoolname) || '|' || LOWER(teamname)), COUNT(DISTINCT LOWER(schoolname))
+		FROM participation_history
+		GROUP BY year
+		ORDER BY year DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var seasons []*ParticipationSeason
+	for rows.Next() {
+		var season ParticipationSeason
+		if err := rows.Scan(&season.Year, &season.Students, &season.Teams, &season.Schools); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, &season)
+	}
+	return seasons, rows.Err()
+}
+
+// ReplaceParticipationSeason replaces all of the participation history for the
+// year with the records.
+func (d *Database) ReplaceParticipationSeason(ctx context.Context, year int, records []*ParticipationRecord) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM participation_history WHERE year = ?`, year); err != nil {
+			return err
+		}
+		for _, record := range records {
+			record.Year = year
+			record.Email = strings.ToLower(strings.TrimSpace(record.Email))
+			_, err := d.DB.Exec(ctx, `
+				INSERT INTO participation_history (year, email, name, teamname, division, schoolname, schoolcity, schoolstate)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (year, email) DO NOTHING
+			`, record.Year, record.Email, record.Name, record.TeamName, record.Division,
+				record.SchoolName, record.SchoolCity, record.SchoolState)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *Database) DeleteParticipationSeason(ctx context.Context, year int) error {
+	_, err := d.DB.Exec(ctx, `DELETE FROM participation_history WHERE year = ?`, year)
+	return err
+}
+
+// SetStudentPreviouslyParticipated changes whether the student is treated as
+// having competed before. If reviewed is true, the value was confirmed by an
+// admin and is not changed by the participation history again.
+func (d *Database) SetStudentPreviouslyParticipated(ctx context.Context, email string, previouslyParticipated, reviewed bool) error {
+	var reviewedTS int64
+	if reviewed {
+		reviewedTS = time.Now().UnixMilli()
+	}
+	_, err := d.DB.Exec(ctx, `
+		UPDATE students
+		SET previouslyparticipated = ?, participationreviewed_ts = ?
+		WHERE email = ?
+	`, previouslyParticipated, reviewedTS, email)
+	return err
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+)
+
+var ErrSeatTaken = errors.New("seat is already assigned to another team")
+
+type Room struct {
+	ID    int64
+	Name  string
+	Seats int
+	// Accessible is true if the room has seats suitable for teams with
+	// accessibility needs.
+	Accessible bool
+	Notes      string
+}
+
+func (d *Database) GetRooms(ctx context.Context) ([]*Room, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT id, name, seats, accessible, notes
+		FROM rooms
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []*Room
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(&room.ID, &room.Name, &room.Seats, &room.Accessible, &room.Notes); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+	return rooms, rows.Err()
+}
+
+func (d *Database) AddRoom(ctx context.Context, room *Room) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO rooms (name, seats, accessible, notes)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, room.Name, room.Seats, room.Accessible, room.Notes).Scan(&room.ID)
+}
+
+// UpdateRoom saves the room. Any teams in seats that no longer exist are
+// unassigned.
+func (d *Database) UpdateRoom(ctx context.Context, room *Room) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		_, err := d.DB.Exec(ctx, `
+			UPDATE rooms
+			SET name = ?, seats = ?, accessible = ?, notes = ?
+			WHERE id = ?
+		`, room.Name, room.Seats, room.Accessible, room.Notes, room.ID)
+		if err != nil {
+			return err
+		}
+		_, err = d.DB.Exec(ctx, `DELETE FROM team_seats WHERE roomid = ? AND seat > ?`, room.ID, room.Seats)
+		return err
+	})
+}
+
+// DeleteRoom deletes the room and unassigns the teams in it.
+func (d *Database) DeleteRoom(ctx context.Context, roomID int64) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM team_seats WHERE roomid = ?`, roomID); err != nil {
+			return err
+		}
+		_, err := d.DB.Exec(ctx, `DELETE FROM rooms WHERE id = ?`, roomID)
+		return err
+	})
+}
+
+type TeamSeat struct {
+	TeamID   uuid.UUID
+	RoomID   int64
+	RoomName string
+	Seat     int
+	// Manual is true if an admin chose the seat. Manual seats are kept when
+	// seats are automatically assigned.
+	Manual bool
+}
+
+const teamSeatColumns = `ts.teamid, ts.roomid, r.name, ts.seat, ts.manual`
+
+// GetTeamSeats returns the seat assignments of all teams, by team ID.
+func (d *Database) GetTeamSeats(ctx context.Context) (map[uuid.UUID]*TeamSeat, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+teamSeatColumns+`
+		FROM team_seats ts
+		JOIN rooms r ON r.id = ts.roomid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seats := map[uuid.UUID]*TeamSeat{}
+	for rows.Next() {
+		var seat TeamSeat
+		if err := rows.Scan(&seat.TeamID, &seat.RoomID, &seat.RoomName, &seat.Seat, &seat.Manual); err != nil {
+			return nil, err
+		}
+		seats[seat.TeamID] = &seat
+	}
+	return seats, rows.Err()
+}
+
+// GetTeamSeat returns the team's seat assignment, or nil if it does not have
+// one.
+func (d *Database) GetTeamSeat(ctx context.Context, teamID uuid.UUID) (*TeamSeat, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+teamSeatColumns+`
+		FROM team_seats ts
+		JOIN rooms r ON r.id = ts.roomid
+		WHERE ts.teamid = ?
+	`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var seat TeamSeat
+	err = rows.Scan(&seat.TeamID, &seat.RoomID, &seat.RoomName, &seat.Seat, &seat.Manual)
+	return &seat, err
+}
+
+func isUniqueConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// SetTeamSeat assigns the team to the seat, replacing any previous assignment.
+// ErrSeatTaken is returned if another team is in the seat.
+func (d *Database) SetTeamSeat(ctx context.Context, seat *TeamSeat) error {
+	_, err := d.DB.Exec(ctx, `
+		INSERT INTO team_seats (teamid, roomid, seat, manual)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (teamid) DO UPDATE
+		SET roomid = excluded.roomid, seat = excluded.seat, manual = excluded.manual
+	`, seat.TeamID, seat.RoomID, seat.Seat, seat.Manual)
+	if isUniqueConstraintError(err) {
+		return ErrSeatTaken
+	}
+	return err
+}
+
+func (d *Database) ClearTeamSeat(ctx context.Context, teamID uuid.UUID) error {
+	_, err := d.DB.Exec(ctx, `DELETE FROM team_seats WHERE teamid = ?`, teamID)
+	return err
+}
+
+// ReplaceAutomaticTeamSeats removes all of the seats that were not chosen
+// manually and saves the given seats instead.
+func (d *Database) ReplaceAutomaticTeamSeats(ctx context.Context, seats []*TeamSeat) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM team_seats WHERE NOT manual`); err != nil {
+			return err
+		}
+		for _, seat := range seats {
+			if err := d.SetTeamSeat(ctx, seat); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
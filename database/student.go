@@ -3,24 +3,51 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
+
+	"go.mau.fi/util/dbutil"
 )
 
-func (d *Database) GetStudentByEmail(ctx context.Context, email string) (*Student, error) {
+// latestCheckInEvent selects a column of the student's most recent check-in
+// event.
+const latestCheckInEvent = `
+	FROM checkin_events e
+	WHERE e.studentemail = s.email
+	ORDER BY e.ts DESC, e.id DESC
+	LIMIT 1
+`
+
+// studentColumns are the columns scanned by scanStudent. Whether the student
+// is checked in is derived from their latest check-in event.
+const studentColumns = `
+	s.teamid, s.email, s.name, s.age, s.parentemail, s.signatory, s.previouslyparticipated,
+	s.selfreportedparticipation, s.participationreviewed_ts, s.emailconfirmed, s.liabilitywaiver, s.computerusewaiver,
+	s.campustour, s.dietaryrestrictions, s.qrcodesent, s.signformsnonce, s.withdrawn_ts, s.language,
+	s.dietarycategories,
+	(SELECT e.direction ` + latestCheckInEvent + `),
+	(SELECT e.ts ` + latestCheckInEvent + `),
+	(SELECT e.volunteer ` + latestCheckInEvent + `)
+`
+
+// scanStudent scans the columns in studentColumns. Any extra destinations are
+// scanned from the columns following them.
+func (d *Database) scanStudent(row dbutil.Scannable, extra ...any) (*Student, error) {
 	var student Student
 	var parentEmail, signatory, dietaryRestrictions sql.NullString
 	var campusTour sql.NullBool
-	err := d.DB.QueryRow(ctx, `
-		SELECT teamid, email, name, age, parentemail, signatory, previouslyparticipated,
-			emailconfirmed, liabilitywaiver, computerusewaiver,
-			campustour, dietaryrestrictions, qrcodesent, checkedin
-		FROM students
-		WHERE email = $1
-	`, email).Scan(&student.TeamID, &student.Email, &student.Name, &student.Age,
-		&parentEmail, &signatory, &student.PreviouslyParticipated, &student.EmailConfirmed,
+	var withdrawnTS, participationReviewedTS int64
+	var dietaryCategories string
+	var checkInDirection, checkInVolunteer sql.NullString
+	var checkInTS sql.NullInt64
+	dest := []any{&student.TeamID, &student.Email, &student.Name, &student.Age,
+		&parentEmail, &signatory, &student.PreviouslyParticipated, &student.SelfReportedParticipation,
+		&participationReviewedTS, &student.EmailConfirmed,
 		&student.LiabilitySigned, &student.ComputerUseWaiverSigned,
-		&campusTour, &dietaryRestrictions, &student.QRCodeSent, &student.CheckedIn)
-	if err != nil {
+		&campusTour, &dietaryRestrictions, &student.QRCodeSent,
+		&student.SignFormsNonce, &withdrawnTS, &student.Language, &dietaryCategories, &checkInDirection, &checkInTS, &checkInVolunteer}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
 
@@ -36,11 +63,38 @@ func (d *Database) GetStudentByEmail(ctx context.Context, email string) (*Studen
 		student.DietaryRestrictions = dietaryRestrictions.String
 	}
 
+	student.DietaryCategories = splitDietaryCategories(dietaryCategories)
+
 	if campusTour.Valid {
 		student.CampusTour = campusTour.Bool
 	}
 
-	return &student, err
+	if withdrawnTS > 0 {
+		student.WithdrawnTS = time.UnixMilli(withdrawnTS)
+	}
+
+	if participationReviewedTS > 0 {
+		student.ParticipationReviewedTS = time.UnixMilli(participationReviewedTS)
+	}
+
+	if CheckInDirection(checkInDirection.String) == CheckInDirectionIn {
+		student.CheckedIn = true
+		if checkInTS.Int64 > 0 {
+			student.CheckedInTS = time.UnixMilli(checkInTS.Int64)
+		}
+		student.CheckedInBy = checkInVolunteer.String
+	}
+
+	return &student, nil
+}
+
+func (d *Database) GetStudentByEmail(ctx context.Context, email string) (*Student, error) {
+	return d.scanStudent(d.DB.QueryRow(ctx, `
+		SELECT `+studentColumns+`
+		FROM students s
+		WHERE s.email = $1
+			AND s.withdrawn_ts = 0
+	`, email))
 }
 
 func (d *Database) ConfirmStudent(ctx context.Context, email string, campusTour bool, dietaryRestrictions, parentEmail string) error {
@@ -71,6 +125,7 @@ func (d *Database) GetAllDietaryRestrictions(ctx context.Context) ([]string, err
 		SELECT dietaryrestrictions
 		FROM students
 		WHERE dietaryrestrictions != '' AND dietaryrestrictions IS NOT NULL
+			AND withdrawn_ts = 0
 	`)
 	if err != nil {
 		return nil, err
@@ -96,16 +151,80 @@ func (d *Database) MarkQRCodeSent(ctx context.Context, email string) error {
 	return err
 }
 
-func (d *Database) CheckInStudent(ctx context.Context, email string) error {
+func (d *Database) UpdateStudentName(ctx context.Context, email, name string) error {
+	_, err := d.DB.Exec(ctx, `UPDATE students SET name = $1 WHERE email = $2`, name, email)
+	return err
+}
+
+// SetStudentParentEmail changes the parent email for the student and rotates
+// the sign forms nonce so that any sign forms link sent to the previous
+// address stops working.
+func (d *Database) SetStudentParentEmail(ctx context.Context, email, parentEmail, signFormsNonce string) error {
 	_, err := d.DB.Exec(ctx, `
 		UPDATE students
-		SET checkedin = true
-		WHERE email = $1
-	`, email)
+		SET parentemail = $1, signformsnonce = $2
+		WHERE email = $3
+	`, parentEmail, signFormsNonce, email)
 	return err
 }
 
-func (d *Database) UncheckInStudent(ctx context.Context, email string) error {
-	_, err := d.DB.Exec(ctx, `UPDATE students SET checkedin = false WHERE email = $1`, email)
+// SetStudentLanguage changes the language that emails to the student and
+// their parent are sent in.
+func (d *Database) SetStudentLanguage(ctx context.Context, email, language string) error {
+	_, err := d.DB.Exec(ctx, "UPDATE students SET language = $1 WHERE email = $2", language, email)
 	return err
 }
+
+// WithdrawStudent marks the student as withdrawn. The row is kept so that
+// withdrawals can be reported on, but their emergency info is deleted.
+func (d *Database) WithdrawStudent(ctx context.Context, email string) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		res, err := d.DB.Exec(ctx, `
+			UPDATE students
+			SET withdrawn_ts = $1
+			WHERE email = $2
+				AND withdrawn_ts = 0
+		`, time.Now().UnixMilli(), email)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected != 1 {
+			return errors.New("incorrect number of rows affected on withdraw from students table")
+		}
+		_, err = d.DB.Exec(ctx, `DELETE FROM student_emergency_info WHERE studentemail = $1`, email)
+		return err
+	})
+}
+
+type WithdrawnStudent struct {
+	*Student
+	TeamName     string
+	TeacherEmail string
+}
+
+func (d *Database) GetWithdrawnStudents(ctx context.Context) ([]*WithdrawnStudent, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+studentColumns+`, t.name, t.teacheremail
+		FROM students s
+		JOIN teams t ON t.id = s.teamid
+		WHERE s.withdrawn_ts != 0
+		ORDER BY s.withdrawn_ts DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []*WithdrawnStudent
+	for rows.Next() {
+		var ws WithdrawnStudent
+		ws.Student, err = d.scanStudent(rows, &ws.TeamName, &ws.TeacherEmail)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, &ws)
+	}
+	return students, rows.Err()
+}
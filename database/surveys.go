@@ -0,0 +1,376 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+// SurveyRole is who a survey is sent to.
+type SurveyRole string
+
+const (
+	SurveyRoleStudent   SurveyRole = "student"
+	SurveyRoleTeacher   SurveyRole = "teacher"
+	SurveyRoleVolunteer SurveyRole = "volunteer"
+)
+
+var SurveyRoles = []SurveyRole{SurveyRoleStudent, SurveyRoleTeacher, SurveyRoleVolunteer}
+
+type SurveyQuestionKind string
+
+const (
+	// SurveyQuestionRating is answered with a number from 1 to 5.
+	SurveyQuestionRating SurveyQuestionKind = "rating"
+	// SurveyQuestionChoice is answered with one of the question's choices.
+	SurveyQuestionChoice SurveyQuestionKind = "choice"
+	SurveyQuestionText   SurveyQuestionKind = "text"
+)
+
+var SurveyQuestionKinds = []SurveyQuestionKind{SurveyQuestionRating, SurveyQuestionChoice, SurveyQuestionText}
+
+type SurveyQuestion struct {
+	ID       int64
+	Position int
+	Kind     SurveyQuestionKind
+	Prompt   string
+	Choices  []string
+	Roles    []SurveyRole
+	Required bool
+}
+
+func (q *SurveyQuestion) AsksRole(role SurveyRole) bool {
+	return slices.Contains(q.Roles, role)
+}
+
+// SurveyInvitation is a survey link that was sent to someone. Division,
+// Experience and Attendance describe the respondent when they were invited and
+// are empty if they don't apply.
+type SurveyInvitation struct {
+	Season     int
+	Role       SurveyRole
+	Email      string
+	Name       string
+	Division   Division
+	Experience string
+	Attendance string
+	SentTS     time.Time
+}
+
+type SurveyResponse struct {
+	ID          int64
+	Season      int
+	Role        SurveyRole
+	Email       string
+	SubmittedTS time.Time
+	// Answers are keyed by question ID.
+	Answers map[int64]string
+}
+
+func joinSurveyRoles(roles []SurveyRole) string {
+	parts := make([]string, len(roles))
+	for i, role := range roles {
+		parts[i] = string(role)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d *Database) scanSurveyQuestion(row dbutil.Scannable) (*SurveyQuestion, error) {
+	var question SurveyQuestion
+	var choices, roles string
+	err := row.Scan(&question.ID, &question.Position, &question.Kind, &question.Prompt, &choices, &roles, &question.Required)
+	if err != nil {
+		return nil, err
+	}
+	for _, choice := range strings.Split(choices, "\n") {
+		if choice != "" {
+			question.Choices = append(question.Choices, choice)
+		}
+	}
+	for _, role := range strings.Split(roles, ",") {
+		if role != "" {
+			question.Roles = append(question.Roles, SurveyRole(role))
+		}
+	}
+	return &question, nil
+}
+
+func (d *Database) GetSurveyQuestions(ctx context.Context) ([]*SurveyQuestion, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT id, position, kind, prompt, choices, roles, required
+		FROM survey_questions
+		ORDER BY position, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var questions []*SurveyQuestion
+	for rows.Next() {
+		question, err := d.scanSurveyQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+	return questions, rows.Err()
+}
+
+// AddSurveyQuestion adds the question after all of the existing questions and
+// sets its ID and position.
+func (d *Database) AddSurveyQuestion(ctx context.Context, question *SurveyQuestion) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO survey_questions (position, kind, prompt, choices, roles, required)
+		VALUES ((SELECT COALESCE(MAX(position), 0) + 1 FROM survey_questions), ?, ?, ?, ?, ?)
+		RETURNING id, position
+	`, question.Kind, question.Prompt, strings.Join(question.Choices, "\n"), joinSurveyRoles(question.Roles), question.Required,
+	).Scan(&question.ID, &question.Position)
+}
+
+func (d *Database) UpdateSurveyQuestion(ctx context.Context, question *SurveyQuestion) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE survey_questions
+		SET kind = ?, prompt = ?, choices = ?, roles = ?, required = ?
+		WHERE id = ?
+	`, question.Kind, question.Prompt, strings.Join(question.Choices, "\n"), joinSurveyRoles(question.Roles), question.Required, question.ID)
+	return err
+}
+
+// DeleteSurveyQuestion deletes the question and all of its answers.
+func (d *Database) DeleteSurveyQuestion(ctx context.Context, id int64) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM survey_answers WHERE questionid = ?`, id); err != nil {
+			return err
+		}
+		_, err := d.DB.Exec(ctx, `DELETE FROM survey_questions WHERE id = ?`, id)
+		return err
+	})
+}
+
+// MoveSurveyQuestion swaps the question with the one before it if up is true,
+// or with the one after it otherwise. Moving the first question up or the last
+// question down does nothing.
+func (d *Database) MoveSurveyQuestion(ctx context.Context, id int64, up bool) error {
+	questions, err := d.GetSurveyQuestions(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(questions, func(q *SurveyQuestion) bool { return q.ID == id })
+	j := i + 1
+	if up {
+		j = i - 1
+	}
+	if i < 0 || j < 0 || j >= len(questions) {
+		return nil
+	}
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		// The positions are renumbered so that questions with the same
+		// position are still swapped.
+		for k, question := range questions {
+			position := k + 1
+			if k == i {
+				position = j + 1
+			} else if k == j {
+				position = i + 1
+			}
+			if _, err := d.DB.Exec(ctx, `UPDATE survey_questions SET position = ? WHERE id = ?`, position, question.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const surveyInvitationColumns = `season, role, email, name, division, experience, attendance, sent_ts`
+
+func (d *Database) scanSurveyInvitation(row dbutil.Scannable) (*SurveyInvitation, error) {
+	var invitation SurveyInvitation
+	var sentTS int64
+	err := row.Scan(&invitation.Season, &invitation.Role, &invitation.Email, &invitation.Name,
+		&invitation.Division, &invitation.Experience, &invitation.Attendance, &sentTS)
+	if err != nil {
+		return nil, err
+	}
+	if sentTS > 0 {
+		invitation.SentTS = time.UnixMilli(sentTS)
+	}
+	return &invitation, nil
+}
+
+// UpsertSurveyInvitation adds the invitation or updates the details of an
+// existing one. When it was sent is not changed.
+func (d *Database) UpsertSurveyInvitation(ctx context.Context, invitation *SurveyInvitation) error {
+	_, err := d.DB.Exec(ctx, `
+		INSERT INTO survey_invitations (season, role, email, name, division, experience, attendance)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (season, role, email) DO UPDATE
+			SET name = excluded.name, division = excluded.division,
+				experience = excluded.experience, attendance = excluded.attendance
+	`, invitation.Season, invitation.Role, invitation.Email, invitation.Name,
+		invitation.Division, invitation.Experience, invitation.Attendance)
+	return err
+}
+
+func (d *Database) MarkSurveyInvitationSent(ctx context.Context, season int, role SurveyRole, email string) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE survey_invitations SET sent_ts = ? WHERE season = ? AND role = ? AND email = ?
+	`, time.Now().UnixMilli(), season, role, email)
+	return err
+}
+
+func (d *Database) GetSurveyInvitations(ctx context.Context, season int) ([]*SurveyInvitation, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+surveyInvitationColumns+`
+		FROM survey_invitations
+		WHERE season = ?
+		ORDER BY role, name
+	`, season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var invitations []*SurveyInvitation
+	for rows.Next() {
+		invitation, err := d.scanSurveyInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// GetSurveyInvitation returns the invitation, or nil if there is not one.
+func (d *Database) GetSurveyInvitation(ctx context.Context, season int, role SurveyRole, email string) (*SurveyInvitation, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+surveyInvitationColumns+`
+		FROM survey_invitations
+		WHERE season = ? AND role = ? AND email = ?
+	`, season, role, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return d.scanSurveyInvitation(rows)
+}
+
+// SaveSurveyResponse saves the respondent's answers, replacing any answers
+// that they submitted before.
+func (d *Database) SaveSurveyResponse(ctx context.Context, response *SurveyResponse) error {
+	response.SubmittedTS = time.Now()
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		err := d.DB.QueryRow(ctx, `
+			INSERT INTO survey_responses (season, role, email, submitted_ts)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (season, role, email) DO UPDATE SET submitted_ts = excluded.submitted_ts
+			RETURNING id
+		`, response.Season, response.Role, response.Email, response.SubmittedTS.UnixMilli()).Scan(&response.ID)
+		if err != nil {
+			return err
+		}
+		if _, err := d.DB.Exec(ctx, `DELETE FROM survey_answers WHERE responseid = ?`, response.ID); err != nil {
+			return err
+		}
+		for questionID, value := range response.Answers {
+			_, err := d.DB.Exec(ctx, `
+				INSERT INTO survey_answers (responseid, questionid, value) VALUES (?, ?, ?)
+			`, response.ID, questionID, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSurveyResponses returns all of the responses for the season with their
+// answers.
+func (d *Database) GetSurveyResponses(ctx context.Context, season int) ([]*SurveyResponse, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT id, season, role, email, submitted_ts
+		FROM survey_responses
+		WHERE season = ?
+		ORDER BY submitted_ts
+	`, season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var responses []*SurveyResponse
+	byID := map[int64]*SurveyResponse{}
+	for rows.Next() {
+		response := SurveyResponse{Answers: map[int64]string{}}
+		var submittedTS int64
+		if err := rows.Scan(&response.ID, &response.Season, &response.Role, &response.Email, &submittedTS); err != nil {
+			return nil, err
+		}
+		response.SubmittedTS = time.UnixMilli(submittedTS)
+		responses = append(responses, &response)
+		byID[response.ID] = &response
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	answerRows, err := d.DB.Query(ctx, `
+		SELECT a.responseid, a.questionid, a.value
+		FROM survey_answers a
+		JOIN survey_responses r ON r.id = a.responseid
+		WHERE r.season = ?
+	`, season)
+	if err != nil {
+		return nil, err
+	}
+	defer answerRows.Close()
+	for answerRows.Next() {
+		var responseID, questionID int64
+		var value string
+		if err := answerRows.Scan(&responseID, &questionID, &value); err != nil {
+			return nil, err
+		}
+		if response, ok := byID[responseID]; ok {
+			response.Answers[questionID] = value
+		}
+	}
+	return responses, answerRows.Err()
+}
+
+// GetSurveyResponse returns the respondent's response, or nil if they have not
+// responded.
+func (d *Database) GetSurveyResponse(ctx context.Context, season int, role SurveyRole, email string) (*SurveyResponse, error) {
+	response := SurveyResponse{Season: season, Role: role, Email: email, Answers: map[int64]string{}}
+	var submittedTS int64
+	err := d.DB.QueryRow(ctx, `
+		SELECT id, submitted_ts FROM survey_responses WHERE season = ? AND role = ? AND email = ?
+	`, season, role, email).Scan(&response.ID, &submittedTS)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	response.SubmittedTS = time.UnixMilli(submittedTS)
+
+	rows, err := d.DB.Query(ctx, `SELECT questionid, value FROM survey_answers WHERE responseid = ?`, response.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var questionID int64
+		var value string
+		if err := rows.Scan(&questionID, &value); err != nil {
+			return nil, err
+		}
+		response.Answers[questionID] = value
+	}
+	return &response, rows.Err()
+}
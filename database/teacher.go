@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 	"go.mau.fi/util/dbutil"
@@ -12,12 +13,27 @@ type Teacher struct {
 	Name           string
 	Email          string
 	EmailConfirmed bool
-	EmailAllowance int
 	SchoolName     string
 	SchoolCity     string
 	SchoolState    string
+
+	EmailFlaggedTS  time.Time
+	EmailFlagReason string
+	EmailSuspended  bool
+
+	DietaryCategories []int64
+	DietaryNote       string
+}
+
+func (t *Teacher) EmailFlagged() bool {
+	return !t.EmailFlaggedTS.IsZero()
 }
 
+const teacherColumns = `
+	t.name, t.email, t.emailconfirmed, t.schoolname, t.schoolcity, t.schoolstate,
+	t.emailflagged_ts, t.emailflagreason, t.emailsuspended, t.dietarycategories, t.dietarynote
+`
+
 func (d *Database) NewTeacher(ctx context.Context, name, email string) error {
 	_, err := d.DB.Exec(ctx, "INSERT INTO teachers (name, email) VALUES (?, ?)", name, email)
 	return err
@@ -31,9 +47,16 @@ func (d *Database) SetEmailConfirmed(ctx context.Context, email string) error {
 func (d *Database) scanTeacher(row dbutil.Scannable) (*Teacher, error) {
 	var schoolName, schoolCity, schoolState sql.NullString
 	var t Teacher
-	if err := row.Scan(&t.Name, &t.Email, &t.EmailConfirmed, &t.EmailAllowance, &schoolName, &schoolCity, &schoolState); err != nil {
+	var flaggedTS int64
+	var dietaryCategories string
+	if err := row.Scan(&t.Name, &t.Email, &t.EmailConfirmed, &schoolName, &schoolCity, &schoolState,
+		&flaggedTS, &t.EmailFlagReason, &t.EmailSuspended, &dietaryCategories, &t.DietaryNote); err != nil {
 		return nil, err
 	}
+	t.DietaryCategories = splitDietaryCategories(dietaryCategories)
+	if flaggedTS > 0 {
+		t.EmailFlaggedTS = time.UnixMilli(flaggedTS)
+	}
 
 	if schoolName.Valid {
 		t.SchoolName = schoolName.String
@@ -50,7 +73,7 @@ func (d *Database) scanTeacher(row dbutil.Scannable) (*Teacher, error) {
 
 func (d *Database) GetAllTeachers(ctx context.Context) ([]*Teacher, error) {
 	rows, err := d.DB.Query(ctx, `
-		SELECT t.name, t.email, t.emailconfirmed, t.emailallowance, t.schoolname, t.schoolcity, t.schoolstate
+		SELECT `+teacherColumns+`
 		FROM teachers t
 		ORDER BY t.name
 	`)
@@ -70,18 +93,9 @@ func (d *Database) GetAllTeachers(ctx context.Context) ([]*Teacher, error) {
 	return teachers, rows.Err()
 }
 
-func (d *Database) SetEmailAllowance(ctx context.Context, email string, allowance int) error {
-	_, err := d.DB.Exec(ctx, `
-		UPDATE teachers
-		SET emailallowance = ?
-		WHERE email = ?
-	`, allowance, email)
-	return err
-}
-
 func (d *Database) GetTeacherByEmail(ctx context.Context, email string) (*Teacher, error) {
 	row := d.DB.QueryRow(ctx, `
-		SELECT t.name, t.email, t.emailconfirmed, t.emailallowance, t.schoolname, t.schoolcity, t.schoolstate
+		SELECT `+teacherColumns+`
 		FROM teachers t
 		WHERE t.email = ?
 	`, email)
@@ -90,7 +104,7 @@ func (d *Database) GetTeacherByEmail(ctx context.Context, email string) (*Teache
 
 func (d *Database) GetTeacherForTeam(ctx context.Context, teamID uuid.UUID) (*Teacher, error) {
 	row := d.DB.QueryRow(ctx, `
-		SELECT t.name, t.email, t.emailconfirmed, t.emailallowance, t.schoolname, t.schoolcity, t.schoolstate
+		SELECT `+teacherColumns+`
 		FROM teachers t
 		JOIN teams tea ON tea.teacheremail = t.email
 		WHERE tea.id = ?
@@ -107,11 +121,36 @@ func (d *Database) SetTeacherSchoolInfo(ctx context.Context, email, schoolName,
 	return err
 }
 
-func (d *Database) DecrementEmailAllowance(ctx context.Context, email string) error {
+// FlagTeacherEmail flags the teacher's account for admin review. It returns
+// true if the account was not already flagged.
+func (d *Database) FlagTeacherEmail(ctx context.Context, email, reason string) (bool, error) {
+	res, err := d.DB.Exec(ctx, `
+		UPDATE teachers
+		SET emailflagged_ts = ?, emailflagreason = ?
+		WHERE email = ?
+			AND emailflagged_ts = 0
+	`, time.Now().UnixMilli(), reason, email)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+func (d *Database) ClearTeacherEmailFlag(ctx context.Context, email string) error {
 	_, err := d.DB.Exec(ctx, `
 		UPDATE teachers
-		SET emailallowance = emailallowance - 1
+		SET emailflagged_ts = 0, emailflagreason = ''
 		WHERE email = ?
 	`, email)
 	return err
 }
+
+func (d *Database) SetTeacherEmailSuspended(ctx context.Context, email string, suspended bool) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE teachers
+		SET emailsuspended = ?
+		WHERE email = ?
+	`, suspended, email)
+	return err
+}
@@ -36,9 +36,12 @@ type Team struct {
 	Division            Division
 	DivisionExplanation string
 	InPerson            bool
-	Members             []Student
-	SchoolName          string
-	RegistrationTS      time.Time
+	// AccessibilityNotes are the teacher's notes on any accessibility needs
+	// that should be considered when assigning the team a seat.
+	AccessibilityNotes string
+	Members            []Student
+	SchoolName         string
+	RegistrationTS     time.Time
 }
 
 type TeamWithTeacherName struct {
@@ -47,28 +50,52 @@ type TeamWithTeacherName struct {
 }
 
 type Student struct {
-	TeamID                  uuid.UUID
-	Email                   string
-	Name                    string
-	Age                     int
-	ParentEmail             string
-	Signatory               string
-	PreviouslyParticipated  bool
+	TeamID                 uuid.UUID
+	Email                  string
+	Name                   string
+	Age                    int
+	ParentEmail            string
+	Signatory              string
+	PreviouslyParticipated bool
+	// SelfReportedParticipation is what the teacher answered when adding the
+	// student. PreviouslyParticipated may differ from it if it was corrected
+	// using the participation history.
+	SelfReportedParticipation bool
+	// ParticipationReviewedTS is when an admin confirmed the student's
+	// PreviouslyParticipated value.
+	ParticipationReviewedTS time.Time
 	EmailConfirmed          bool
 	LiabilitySigned         bool
 	ComputerUseWaiverSigned bool
 
-	CampusTour          bool
+	CampusTour bool
+	// DietaryCategories are the IDs of the chosen dietary categories and
+	// DietaryRestrictions is a note for anything else.
+	DietaryCategories   []int64
 	DietaryRestrictions string
 
 	QRCodeSent bool
-	CheckedIn  bool
+	// CheckedIn is true if the student's latest check-in event is a check-in.
+	// CheckedInTS and CheckedInBy describe that event.
+	CheckedIn   bool
+	CheckedInTS time.Time
+	CheckedInBy string
+
+	SignFormsNonce string
+	WithdrawnTS    time.Time
+	// Language is the locale that emails to the student and their parent
+	// are sent in.
+	Language string
+}
+
+func (s *Student) Withdrawn() bool {
+	return !s.WithdrawnTS.IsZero()
 }
 
 func (d *Database) scanTeam(row dbutil.Scannable) (*Team, error) {
 	var team Team
 	var registrationTS int64
-	err := row.Scan(&team.ID, &team.TeacherEmail, &team.Name, &team.Division, &team.InPerson, &team.DivisionExplanation, &team.SchoolName, &registrationTS)
+	err := row.Scan(&team.ID, &team.TeacherEmail, &team.Name, &team.Division, &team.InPerson, &team.DivisionExplanation, &team.AccessibilityNotes, &team.SchoolName, &registrationTS)
 	team.RegistrationTS = time.UnixMilli(registrationTS)
 	return &team, err
 }
@@ -77,7 +104,7 @@ func (d *Database) scanTeamWithTeacherName(row dbutil.Scannable) (*TeamWithTeach
 	var team Team
 	var teamWithTeacherName TeamWithTeacherName
 	var registrationTS int64
-	err := row.Scan(&team.ID, &team.TeacherEmail, &team.Name, &team.Division, &team.InPerson, &team.DivisionExplanation, &team.SchoolName, &registrationTS, &teamWithTeacherName.TeacherName)
+	err := row.Scan(&team.ID, &team.TeacherEmail, &team.Name, &team.Division, &team.InPerson, &team.DivisionExplanation, &team.AccessibilityNotes, &team.SchoolName, &registrationTS, &teamWithTeacherName.TeacherName)
 	team.RegistrationTS = time.UnixMilli(registrationTS)
 	teamWithTeacherName.Team = &team
 	return &teamWithTeacherName, err
@@ -85,43 +112,23 @@ func (d *Database) scanTeamWithTeacherName(row dbutil.Scannable) (*TeamWithTeach
 
 func (d *Database) scanTeamStudents(ctx context.Context, team *Team) error {
 	studentRows, err := d.DB.Query(ctx, `
-		SELECT s.email, s.name, s.age, s.parentemail, s.signatory, s.previouslyparticipated, s.emailconfirmed,
-			s.liabilitywaiver, s.computerusewaiver, s.campustour, s.dietaryrestrictions, s.qrcodesent, s.checkedin
+		SELECT `+studentColumns+`
 		FROM students s
 		WHERE s.teamid = ?
+			AND s.withdrawn_ts = 0
 	`, team.ID)
 	if err != nil {
 		return err
 	}
 	defer studentRows.Close()
 	for studentRows.Next() {
-		var s Student
-		var parentEmail, signatory, dietaryRestrictions sql.NullString
-		var campusTour sql.NullBool
-		if err := studentRows.Scan(&s.Email, &s.Name, &s.Age, &parentEmail, &signatory, &s.PreviouslyParticipated, &s.EmailConfirmed,
-			&s.LiabilitySigned, &s.ComputerUseWaiverSigned, &campusTour, &dietaryRestrictions, &s.QRCodeSent, &s.CheckedIn); err != nil {
+		s, err := d.scanStudent(studentRows)
+		if err != nil {
 			return err
 		}
-
-		if parentEmail.Valid {
-			s.ParentEmail = parentEmail.String
-		}
-
-		if signatory.Valid {
-			s.Signatory = signatory.String
-		}
-
-		if dietaryRestrictions.Valid {
-			s.DietaryRestrictions = dietaryRestrictions.String
-		}
-
-		if campusTour.Valid {
-			s.CampusTour = campusTour.Bool
-		}
-
-		team.Members = append(team.Members, s)
+		team.Members = append(team.Members, *s)
 	}
-	return nil
+	return studentRows.Err()
 }
 
 func (d *Database) scanTeamWithStudents(ctx context.Context, row dbutil.Scannable) (*Team, error) {
@@ -137,25 +144,13 @@ func (d *Database) scanTeamWithStudents(ctx context.Context, row dbutil.Scannabl
 	return team, err
 }
 
-func (d *Database) scanTeamWithStudentsAndTeacherName(ctx context.Context, row dbutil.Scannable) (*TeamWithTeacherName, error) {
-	teamWithTeacherName, err := d.scanTeamWithTeacherName(row)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := d.scanTeamStudents(ctx, teamWithTeacherName.Team); err != nil {
-		return nil, err
-	}
-
-	return teamWithTeacherName, err
-}
-
 func (d *Database) GetTeacherTeams(ctx context.Context, email string) ([]*Team, error) {
 	rows, err := d.DB.Query(ctx, `
-		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, tt.schoolname, t.registration_ts
+		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, t.accessibilitynotes, tt.schoolname, t.registration_ts
 		FROM teams t
 		JOIN teachers tt ON tt.email = t.teacheremail
 		WHERE tt.email = ?
+			AND t.withdrawn_ts = 0
 	`, email)
 	if err != nil {
 		return nil, err
@@ -163,23 +158,34 @@ func (d *Database) GetTeacherTeams(ctx context.Context, email string) ([]*Team,
 	defer rows.Close()
 
 	var teams []*Team
-
 	for rows.Next() {
-		team, err := d.scanTeamWithStudents(ctx, rows)
+		team, err := d.scanTeam(rows)
 		if err != nil {
 			return nil, err
 		}
 		teams = append(teams, team)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-	return teams, err
+	// Members are queried once the team rows are closed so that this does not
+	// need more than one connection.
+	for _, team := range teams {
+		if err := d.scanTeamStudents(ctx, team); err != nil {
+			return nil, err
+		}
+	}
+	return teams, nil
 }
 
 func (d *Database) GetAdminTeamsWithTeacherName(ctx context.Context) ([]*TeamWithTeacherName, error) {
 	rows, err := d.DB.Query(ctx, `
-		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, tt.schoolname, t.registration_ts, tt.name
+		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, t.accessibilitynotes, tt.schoolname, t.registration_ts, tt.name
 		FROM teams t
 		JOIN teachers tt ON tt.email = t.teacheremail
+		WHERE t.withdrawn_ts = 0
 	`)
 	if err != nil {
 		return nil, err
@@ -187,67 +193,179 @@ func (d *Database) GetAdminTeamsWithTeacherName(ctx context.Context) ([]*TeamWit
 	defer rows.Close()
 
 	var teams []*TeamWithTeacherName
-
 	for rows.Next() {
-		team, err := d.scanTeamWithStudentsAndTeacherName(ctx, rows)
+		team, err := d.scanTeamWithTeacherName(rows)
 		if err != nil {
 			return nil, err
 		}
 		teams = append(teams, team)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-	return teams, err
+	for _, team := range teams {
+		if err := d.scanTeamStudents(ctx, team.Team); err != nil {
+			return nil, err
+		}
+	}
+	return teams, nil
 }
 
 func (d *Database) GetTeam(ctx context.Context, email string, teamID uuid.UUID) (*Team, error) {
 	row := d.DB.QueryRow(ctx, `
-		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, tt.schoolname, t.registration_ts
+		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, t.accessibilitynotes, tt.schoolname, t.registration_ts
 		FROM teams t
 		JOIN teachers tt ON tt.email = t.teacheremail
 		WHERE tt.email = ?
 		  AND t.id = ?
+		  AND t.withdrawn_ts = 0
 	`, email, teamID)
 	return d.scanTeamWithStudents(ctx, row)
 }
 
 func (d *Database) GetTeamNoMembers(ctx context.Context, teamID uuid.UUID) (*Team, error) {
 	row := d.DB.QueryRow(ctx, `
-		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, '', t.registration_ts
+		SELECT t.id, t.teacheremail, t.name, t.division, t.inperson, t.divisionexplanation, t.accessibilitynotes, '', t.registration_ts
 		FROM teams t
 		WHERE t.id = ?
 	`, teamID)
 	return d.scanTeam(row)
 }
 
-func (d *Database) UpsertTeam(ctx context.Context, teacherEmail string, teamID uuid.UUID, name string, division Division, inPerson bool, divisionExplanation string) error {
+func (d *Database) UpsertTeam(ctx context.Context, teacherEmail string, teamID uuid.UUID, name string, division Division, inPerson bool, divisionExplanation, accessibilityNotes string) error {
 	_, err := d.DB.Exec(ctx, `
-		INSERT OR REPLACE INTO teams (id, teacheremail, name, division, inperson, divisionexplanation, registration_ts)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, teamID, teacherEmail, name, division, inPerson, divisionExplanation, time.Now().UnixMilli())
+		INSERT OR REPLACE INTO teams (id, teacheremail, name, division, inperson, divisionexplanation, accessibilitynotes, registration_ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, teamID, teacherEmail, name, division, inPerson, divisionExplanation, accessibilityNotes, time.Now().UnixMilli())
 	return err
 }
 
+var ErrStudentAlreadyRegistered = errors.New("student is already registered on a team")
+
+// AddTeamMember adds the student to the team. If the student previously
+// withdrew, their old registration, check-in history, and tour request are
+// reset and reused, and any emergency info that was left over is deleted.
 func (d *Database) AddTeamMember(ctx context.Context, teamID uuid.UUID, name string, studentAge int, studentEmail string, previouslyParticipated bool) error {
-	_, err := d.DB.Exec(ctx, `
-		INSERT INTO students (teamid, name, age, email, previouslyparticipated)
-		VALUES (?, ?, ?, ?, ?)
-	`, teamID, name, studentAge, studentEmail, previouslyParticipated)
-	return err
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		res, err := d.DB.Exec(ctx, `
+			INSERT INTO students (teamid, name, age, email, previouslyparticipated, selfreportedparticipation)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (email) DO UPDATE
+			SET teamid = excluded.teamid,
+				name = excluded.name,
+				age = excluded.age,
+				previouslyparticipated = excluded.previouslyparticipated,
+				selfreportedparticipation = excluded.selfreportedparticipation,
+				participationreviewed_ts = 0,
+				parentemail = NULL,
+				signatory = NULL,
+				dietaryrestrictions = NULL,
+				dietarycategories = '',
+				campustour = NULL,
+				emailconfirmed = FALSE,
+				liabilitywaiver = FALSE,
+				computerusewaiver = FALSE,
+				qrcodesent = FALSE,
+				signformsnonce = '',
+				withdrawn_ts = 0
+			WHERE students.withdrawn_ts != 0
+		`, teamID, name, studentAge, studentEmail, previouslyParticipated, previouslyParticipated)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return ErrStudentAlreadyRegistered
+		}
+		if _, err = d.DB.Exec(ctx, `DELETE FROM checkin_events WHERE studentemail = ?`, studentEmail); err != nil {
+			return err
+		}
+		if _, err = d.DB.Exec(ctx, `DELETE FROM student_emergency_info WHERE studentemail = ?`, studentEmail); err != nil {
+			return err
+		}
+		_, err = d.DB.Exec(ctx, `DELETE FROM student_tours WHERE studentemail = ?`, studentEmail)
+		return err
+	})
 }
 
-func (d *Database) RemoveTeamMember(ctx context.Context, teamID uuid.UUID, studentEmail string) error {
-	res, err := d.DB.Exec(ctx, `
-		DELETE FROM students
-		WHERE teamid = ?
-			AND email = ?
-	`, teamID, studentEmail)
-	if err != nil {
+// WithdrawTeam marks the team and all of its remaining members as withdrawn,
+// deletes their emergency info, and unassigns the team's seat.
+func (d *Database) WithdrawTeam(ctx context.Context, teamID uuid.UUID) error {
+	now := time.Now().UnixMilli()
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		_, err := d.DB.Exec(ctx, `
+			UPDATE students
+			SET withdrawn_ts = ?
+			WHERE teamid = ?
+				AND withdrawn_ts = 0
+		`, now, teamID)
+		if err != nil {
+			return err
+		}
+		res, err := d.DB.Exec(ctx, `
+			UPDATE teams
+			SET withdrawn_ts = ?
+			WHERE id = ?
+				AND withdrawn_ts = 0
+		`, now, teamID)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err != nil {
+			return err
+		} else if affected != 1 {
+			return errors.New("incorrect number of rows affected on withdraw from teams table")
+		}
+		_, err = d.DB.Exec(ctx, `
+			DELETE FROM student_emergency_info
+			WHERE studentemail IN (SELECT email FROM students WHERE teamid = ?)
+		`, teamID)
+		if err != nil {
+			return err
+		}
+		// Free up the team's seat for another team.
+		_, err = d.DB.Exec(ctx, `DELETE FROM team_seats WHERE teamid = ?`, teamID)
 		return err
+	})
+}
+
+type WithdrawnTeam struct {
+	ID           uuid.UUID
+	Name         string
+	TeacherName  string
+	TeacherEmail string
+	SchoolName   string
+	InPerson     bool
+	WithdrawnTS  time.Time
+}
+
+func (d *Database) GetWithdrawnTeams(ctx context.Context) ([]*WithdrawnTeam, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT t.id, t.name, tt.name, tt.email, tt.schoolname, t.inperson, t.withdrawn_ts
+		FROM teams t
+		JOIN teachers tt ON tt.email = t.teacheremail
+		WHERE t.withdrawn_ts != 0
+		ORDER BY t.withdrawn_ts DESC
+	`)
+	if err != nil {
+		return nil, err
 	}
-	if affected, err := res.RowsAffected(); err != nil {
-		return err
-	} else if affected != 1 {
-		return errors.New("incorrect number of rows affected on delete from students table")
+	defer rows.Close()
+
+	var teams []*WithdrawnTeam
+	for rows.Next() {
+		var team WithdrawnTeam
+		var schoolName sql.NullString
+		var withdrawnTS int64
+		if err := rows.Scan(&team.ID, &team.Name, &team.TeacherName, &team.TeacherEmail, &schoolName, &team.InPerson, &withdrawnTS); err != nil {
+			return nil, err
+		}
+		team.SchoolName = schoolName.String
+		team.WithdrawnTS = time.UnixMilli(withdrawnTS)
+		teams = append(teams, &team)
 	}
-	return nil
+	return teams, rows.Err()
 }
@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+// TourGroup is one of the campus tours after the competition.
+type TourGroup struct {
+	ID       int64
+	Name     string
+	Time     string
+	Capacity int
+	// Notes are shown to the students, such as where the group meets.
+	Notes string
+	// Guides are the emails of the volunteers that lead the group.
+	Guides []string
+}
+
+// StudentTour is a student's request to go on a campus tour.
+type StudentTour struct {
+	StudentEmail string
+	// PreferredGroupID is the group that the student chose, or 0 if any group
+	// is fine.
+	PreferredGroupID int64
+	// GroupID is the group that the student is in, or 0 if they are on the
+	// waitlist.
+	GroupID     int64
+	RequestedTS time.Time
+}
+
+func (t *StudentTour) Waitlisted() bool {
+	return t.GroupID == 0
+}
+
+func (d *Database) GetTourGroups(ctx context.Context) ([]*TourGroup, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT id, name, time, capacity, notes
+		FROM tour_groups
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*TourGroup
+	byID := map[int64]*TourGroup{}
+	for rows.Next() {
+		var group TourGroup
+		if err := rows.Scan(&group.ID, &group.Name, &group.Time, &group.Capacity, &group.Notes); err != nil {
+			return nil, err
+		}
+		groups = append(groups, &group)
+		byID[group.ID] = &group
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	guideRows, err := d.DB.Query(ctx, `SELECT groupid, volunteeremail FROM tour_guides ORDER BY volunteeremail`)
+	if err != nil {
+		return nil, err
+	}
+	defer guideRows.Close()
+	for guideRows.Next() {
+		var groupID int64
+		var email string
+		if err := guideRows.Scan(&groupID, &email); err != nil {
+			return nil, err
+		}
+		if group, ok := byID[groupID]; ok {
+			group.Guides = append(group.Guides, email)
+		}
+	}
+	return groups, guideRows.Err()
+}
+
+func (d *Database) AddTourGroup(ctx context.Context, group *TourGroup) error {
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO tour_groups (name, time, capacity, notes)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, group.Name, group.Time, group.Capacity, group.Notes).Scan(&group.ID)
+}
+
+// UpdateTourGroup saves the group. Its guides are not changed, and students
+// are not moved out of the group if its capacity is lowered.
+func (d *Database) UpdateTourGroup(ctx context.Context, group *TourGroup) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE tour_groups
+		SET name = ?, time = ?, capacity = ?, notes = ?
+		WHERE id = ?
+	`, group.Name, group.Time, group.Capacity, group.Notes, group.ID)
+	return err
+}
+
+// DeleteTourGroup deletes the group. The students in it are put back on the
+// waitlist for any group.
+func (d *Database) DeleteTourGroup(ctx context.Context, groupID int64) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		for _, query := range []string{
+			`UPDATE student_tours SET groupid = NULL WHERE groupid = ?`,
+			`UPDATE student_tours SET preferredgroup = NULL WHERE preferredgroup = ?`,
+			`DELETE FROM tour_guides WHERE groupid = ?`,
+			`DELETE FROM tour_groups WHERE id = ?`,
+		} {
+			if _, err := d.DB.Exec(ctx, query, groupID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetTourGuides replaces the volunteers that lead the group.
+func (d *Database) SetTourGuides(ctx context.Context, groupID int64, emails []string) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM tour_guides WHERE groupid = ?`, groupID); err != nil {
+			return err
+		}
+		for _, email := range emails {
+			_, err := d.DB.Exec(ctx, `INSERT OR IGNORE INTO tour_guides (groupid, volunteeremail) VALUES (?, ?)`, groupID, email)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const studentTourColumns = `st.studentemail, COALESCE(st.preferredgroup, 0), COALESCE(st.groupid, 0), st.requested_ts`
+
+func scanStudentTour(row dbutil.Scannable) (*StudentTour, error) {
+	var tour StudentTour
+	var requestedTS int64
+	if err := row.Scan(&tour.StudentEmail, &tour.PreferredGroupID, &tour.GroupID, &requestedTS); err != nil {
+		return nil, err
+	}
+	tour.RequestedTS = time.UnixMilli(requestedTS)
+	return &tour, nil
+}
+
+// GetStudentTours returns the tour requests of the students on in-person
+// teams that have not withdrawn, in the order that they were made.
+func (d *Database) GetStudentTours(ctx context.Context) ([]*StudentTour, error) {
+	rows, err := d.DB.Query(ctx, `
+		SELECT `+studentTourColumns+`
+		FROM student_tours st
+			JOIN students s ON s.email = st.studentemail
+			JOIN teams t ON t.id = s.teamid
+		WHERE s.withdrawn_ts = 0
+			AND t.inperson
+		ORDER BY st.requested_ts, st.studentemail
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tours []*StudentTour
+	for rows.Next() {
+		tour, err := scanStudentTour(rows)
+		if err != nil {
+			return nil, err
+		}
+		tours = append(tours, tour)
+	}
+	return tours, rows.Err()
+}
+
+// GetStudentTour returns the student's tour request, or nil if they did not
+// ask to go on a tour.
+func (d *Database) GetStudentTour(ctx context.Context, studentEmail string) (*StudentTour, error) {
+	tour, err := scanStudentTour(d.DB.QueryRow(ctx, `
+		SELECT `+studentTourColumns+`
+		FROM student_tours st
+		WHERE st.studentemail = ?
+	`, studentEmail))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return tour, err
+}
+
+// RequestStudentTour records that the student wants to go on a tour, in the
+// given group or in any group if it is 0. If the student changes their
+// preferred group, they give up their place and go to the back of the
+// waitlist.
+func (d *Database) RequestStudentTour(ctx context.Context, studentEmail string, preferredGroupID int64) error {
+	var preferred sql.NullInt64
+	if preferredGroupID != 0 {
+		preferred = sql.NullInt64{Int64: preferredGroupID, Valid: true}
+	}
+	_, err := d.DB.Exec(ctx, `
+		INSERT INTO student_tours (studentemail, preferredgroup, groupid, requested_ts)
+		VALUES (?, ?, NULL, ?)
+		ON CONFLICT (studentemail) DO UPDATE
+		SET preferredgroup = excluded.preferredgroup,
+			groupid = NULL,
+			requested_ts = excluded.requested_ts
+		WHERE student_tours.preferredgroup IS NOT excluded.preferredgroup
+	`, studentEmail, preferred, time.Now().UnixMilli())
+	return err
+}
+
+// AddMissingTourRequests adds a tour request for any group for each student
+// that asked for a campus tour on an in-person team before there were tour
+// groups to choose from.
+func (d *Database) AddMissingTourRequests(ctx context.Context) (int64, error) {
+	res, err := d.DB.Exec(ctx, `
+		INSERT INTO student_tours (studentemail, preferredgroup, groupid, requested_ts)
+		SELECT s.email, NULL, NULL, ?
+		FROM students s
+			JOIN teams t ON t.id = s.teamid
+		WHERE s.campustour
+			AND s.withdrawn_ts = 0
+			AND t.inperson
+			AND s.email NOT IN (SELECT studentemail FROM student_tours)
+	`, time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetStudentTourGroup puts the student in the group, or on the waitlist if it
+// is 0.
+func (d *Database) SetStudentTourGroup(ctx context.Context, studentEmail string, groupID int64) error {
+	var group sql.NullInt64
+	if groupID != 0 {
+		group = sql.NullInt64{Int64: groupID, Valid: true}
+	}
+	_, err := d.DB.Exec(ctx, `UPDATE student_tours SET groupid = ? WHERE studentemail = ?`, group, studentEmail)
+	return err
+}
+
+// SetStudentTourGroups saves the groups of all of the given tour requests.
+func (d *Database) SetStudentTourGroups(ctx context.Context, tours []*StudentTour) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		for _, tour := range tours {
+			if err := d.SetStudentTourGroup(ctx, tour.StudentEmail, tour.GroupID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CancelStudentTour removes the student's tour request, which frees up their
+// place in their group.
+func (d *Database) CancelStudentTour(ctx context.Context, studentEmail string) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM student_tours WHERE studentemail = ?`, studentEmail); err != nil {
+			return err
+		}
+		_, err := d.DB.Exec(ctx, `UPDATE students SET campustour = FALSE WHERE email = ?`, studentEmail)
+		return err
+	})
+}
@@ -0,0 +1,4 @@
+-- v6: Add signformsnonce column to students table so that sign forms links can
+-- be invalidated when the parent email changes
+
+ALTER TABLE students ADD COLUMN signformsnonce TEXT NOT NULL DEFAULT '';
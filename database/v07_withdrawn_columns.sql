@@ -0,0 +1,5 @@
+-- v7: Add withdrawn_ts columns to the teams and students tables so that
+-- withdrawals are kept for reporting instead of deleting the rows
+
+ALTER TABLE teams ADD COLUMN withdrawn_ts BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE students ADD COLUMN withdrawn_ts BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+-- v8: Replace the teacher email allowance with a log of sent emails
+
+CREATE TABLE email_sends (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  teacheremail TEXT    NOT NULL,
+  recipient    TEXT    NOT NULL,
+  kind         TEXT    NOT NULL,
+  resend       BOOLEAN NOT NULL DEFAULT FALSE,
+  refunded     BOOLEAN NOT NULL DEFAULT FALSE,
+  ts           BIGINT  NOT NULL
+);
+
+CREATE INDEX email_sends_teacheremail_ts_idx ON email_sends (teacheremail, ts);
+
+ALTER TABLE teachers ADD COLUMN emailflagged_ts BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE teachers ADD COLUMN emailflagreason TEXT NOT NULL DEFAULT '';
+ALTER TABLE teachers ADD COLUMN emailsuspended BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE teachers DROP COLUMN emailallowance;
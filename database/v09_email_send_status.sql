@@ -0,0 +1,9 @@
+-- v9: Track the student, source and delivery status of every email send
+
+ALTER TABLE email_sends ADD COLUMN studentemail TEXT NOT NULL DEFAULT '';
+ALTER TABLE email_sends ADD COLUMN source TEXT NOT NULL DEFAULT 'teacher';
+ALTER TABLE email_sends ADD COLUMN status TEXT NOT NULL DEFAULT 'accepted';
+
+UPDATE email_sends SET studentemail = recipient;
+
+CREATE INDEX email_sends_studentemail_idx ON email_sends (studentemail, kind);
@@ -0,0 +1,19 @@
+-- v10: Record check-ins and check-outs as events instead of a boolean
+
+CREATE TABLE checkin_events (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  studentemail TEXT    NOT NULL,
+  direction    TEXT    NOT NULL,
+  ts           BIGINT  NOT NULL,
+  volunteer    TEXT    NOT NULL DEFAULT '',
+  station      TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX checkin_events_studentemail_ts_idx ON checkin_events (studentemail, ts);
+
+INSERT INTO checkin_events (studentemail, direction, ts, volunteer, station)
+SELECT email, 'in', 0, '', ''
+FROM students
+WHERE checkedin;
+
+ALTER TABLE students DROP COLUMN checkedin;
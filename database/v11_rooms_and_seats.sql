@@ -0,0 +1,22 @@
+-- v11: Add rooms and seat assignments for in-person teams
+
+CREATE TABLE rooms (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  name       TEXT    NOT NULL UNIQUE,
+  seats      INTEGER NOT NULL,
+  accessible BOOLEAN NOT NULL DEFAULT FALSE,
+  notes      TEXT    NOT NULL DEFAULT ''
+);
+
+-- Seats are kept separate from the teams table because teams are saved with
+-- INSERT OR REPLACE.
+CREATE TABLE team_seats (
+  teamid TEXT    NOT NULL PRIMARY KEY,
+  roomid INTEGER NOT NULL,
+  seat   INTEGER NOT NULL,
+  manual BOOLEAN NOT NULL DEFAULT FALSE,
+
+  UNIQUE (roomid, seat)
+);
+
+ALTER TABLE teams ADD COLUMN accessibilitynotes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- v12: Add API tokens for the read-only JSON API
+
+CREATE TABLE api_tokens (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  name         TEXT    NOT NULL,
+  tokenhash    TEXT    NOT NULL UNIQUE,
+  scopes       TEXT    NOT NULL,
+  createdby    TEXT    NOT NULL,
+  created_ts   BIGINT  NOT NULL,
+  expires_ts   BIGINT  NOT NULL DEFAULT 0,
+  revoked_ts   BIGINT  NOT NULL DEFAULT 0,
+  lastused_ts  BIGINT  NOT NULL DEFAULT 0
+);
@@ -0,0 +1,29 @@
+-- v13: Add outbound webhook subscriptions and their delivery log
+
+CREATE TABLE webhooks (
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  url         TEXT    NOT NULL,
+  description TEXT    NOT NULL DEFAULT '',
+  events      TEXT    NOT NULL,
+  secret      TEXT    NOT NULL,
+  createdby   TEXT    NOT NULL,
+  created_ts  BIGINT  NOT NULL,
+  disabled_ts BIGINT  NOT NULL DEFAULT 0
+);
+
+CREATE TABLE webhook_deliveries (
+  id             INTEGER PRIMARY KEY AUTOINCREMENT,
+  webhookid      INTEGER NOT NULL,
+  eventid        TEXT    NOT NULL,
+  eventtype      TEXT    NOT NULL,
+  payload        TEXT    NOT NULL,
+  status         TEXT    NOT NULL DEFAULT 'pending',
+  attempts       INTEGER NOT NULL DEFAULT 0,
+  created_ts     BIGINT  NOT NULL,
+  nextattempt_ts BIGINT  NOT NULL,
+  lastattempt_ts BIGINT  NOT NULL DEFAULT 0,
+  responsestatus INTEGER NOT NULL DEFAULT 0,
+  lasterror      TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, nextattempt_ts);
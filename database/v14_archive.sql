@@ -0,0 +1,123 @@
+-- v14: Move the competition archive into the database
+
+CREATE TABLE archive_years (
+  year  INTEGER NOT NULL PRIMARY KEY,
+  -- The recap paragraphs are separated by blank lines.
+  recap TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE TABLE archive_links (
+  id    INTEGER PRIMARY KEY AUTOINCREMENT,
+  year  INTEGER NOT NULL,
+  url   TEXT    NOT NULL,
+  title TEXT    NOT NULL
+);
+
+CREATE TABLE archive_results (
+  id   INTEGER PRIMARY KEY AUTOINCREMENT,
+  year INTEGER NOT NULL,
+  name TEXT    NOT NULL DEFAULT ''
+);
+
+-- The team name, school and location are kept even if the winner is linked to
+-- a registered team, so that the archive still works after the team is gone.
+CREATE TABLE archive_winners (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  resultid  INTEGER NOT NULL,
+  place     INTEGER NOT NULL,
+  teamname  TEXT    NOT NULL,
+  school    TEXT    NOT NULL DEFAULT '',
+  location  TEXT    NOT NULL DEFAULT '',
+  teamid    TEXT    NOT NULL DEFAULT ''
+);
+
+-- Seed the archive with the results that used to be hard-coded.
+INSERT INTO archive_years (year, recap) VALUES (2025, 'The 2025 competition saw 25 teams compete. We gave a separate set of prizes for teams consisting of only first-time competitors.');
+INSERT INTO archive_links (year, url, title) VALUES (2025, '/static/2025-solutions.pdf', 'Solution Sketch Slides');
+INSERT INTO archive_links (year, url, title) VALUES (2025, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202025', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (1, 2025, 'Overall Winners');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (1, 1, 'Fairview High School', 'Fairview High School', 'Boulder');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (1, 2, 'Mohakos Koders', 'Niwot High School', 'Longmont');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (1, 3, 'Lobos 3', 'Rocky Mountain High School', 'Fort Collins');
+INSERT INTO archive_results (id, year, name) VALUES (2, 2025, 'First-Time Team Winners');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (2, 1, 'Importing Iguanas', 'Niwot High School', 'Longmont');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (2, 2, 'Name Deleted', 'Innovation Center SVVSD', 'Longmont');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (2, 3, 'Runtime Terror', 'George Washington High School', 'Denver');
+INSERT INTO archive_years (year, recap) VALUES (2024, 'The 2024 competition returned to an in-person only competition, but we also had an open division. We gave a separate set of prizes for teams consisting of only first-time competitors. We did not award prizes for the open division.
+
+The in-person competition had 27 teams while the open division had 31 teams.');
+INSERT INTO archive_links (year, url, title) VALUES (2024, '/static/2024-solutions.pdf', 'Solution Sketch Slides');
+INSERT INTO archive_links (year, url, title) VALUES (2024, 'https://sumnerevans.com/posts/school/2024-hspc/', 'Competition Recap and Solution Sketches');
+INSERT INTO archive_links (year, url, title) VALUES (2024, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202024', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (3, 2024, 'Overall Winners');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (3, 1, 'Innovation Center 1', 'Innovation Center SVVSD', 'Longmont');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (3, 2, 'Sigma Scripters', 'Arapahoe High School', 'Centennial');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (3, 3, 'CyberRebels2', 'Columbine High School', 'Littleton');
+INSERT INTO archive_results (id, year, name) VALUES (4, 2024, 'First-Time Team Winners');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (4, 1, 'Loopy Groupies', 'Chatfield Senior High School', 'Littleton');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (4, 2, 'Lorem Ipsum', 'Warren Tech', 'Lakewood');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (4, 3, 'the cows(mooooooooooooo)', 'Cherry Creek High School', 'Greenwood Village');
+INSERT INTO archive_years (year, recap) VALUES (2023, 'The 2023 competition again featured two divisions: beginner and advanced. As with 2022, it was a hybrid competition, but we awarded prizes for both in-person and remote winners in both divisions.
+
+The advanced division featured 31 teams, while the beginner division had 34 teams.');
+INSERT INTO archive_links (year, url, title) VALUES (2023, '/static/2023-solutions.pdf', 'Solution Sketch Slides');
+INSERT INTO archive_links (year, url, title) VALUES (2023, 'https://sumnerevans.com/posts/school/2023-hspc/', 'Competition Recap and Solution Sketches');
+INSERT INTO archive_links (year, url, title) VALUES (2023, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202023', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (5, 2023, 'Advanced In-Person');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (5, 1, 'Code Rats', 'Futures Lab', 'Fort Collins, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (5, 2, 'The Spanish Inquisition', 'Regis Jesuit High School', 'Aurora, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (5, 3, 'CA is 202', 'Colorado Academy', 'Denver, Colorado');
+INSERT INTO archive_results (id, year, name) VALUES (6, 2023, 'Beginner In-Person');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (6, 1, 'Spaghetti Code and Meatballs', 'Warren Tech', 'Lakewood, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (6, 2, 'Innovation Center 1', 'Innovation Center SVVSD', 'Longmont, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (6, 3, 'Team LuLo', 'Colorado Academy', 'Denver, Colorado');
+INSERT INTO archive_results (id, year, name) VALUES (7, 2023, 'Advanced Remote');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (7, 1, 'River Hill Team #1', 'River Hill High School', 'Clarksville, Maryland');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (7, 2, 'CreekCyberBruins', 'Cherry Creek High School', 'Greenwood Village, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (7, 3, 'JMS', 'Bergen County Academies', 'Bergen County, New Jersey');
+INSERT INTO archive_results (id, year, name) VALUES (8, 2023, 'Beginner Remote');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (8, 1, 'Wormhole', 'Voice of Calling NPO', 'Northridge, California');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (8, 2, 'Lineup', 'Voice of Calling NPO', 'Northridge, California');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (8, 3, 'River Hill Team #2', 'River Hill High School', 'Clarksville, Maryland');
+INSERT INTO archive_years (year, recap) VALUES (2022, 'The 2022 competition was the first to feature two divisions: a beginner division and an advanced division. It was also the first hybrid competition with both remote and in-person contestants.
+
+The advanced division had 26 teams, while the beginner division had 39 teams. Due to the number of teams, we decided to give awards to first place through fourth place.');
+INSERT INTO archive_links (year, url, title) VALUES (2022, 'https://sumnerevans.com/posts/school/2022-hspc/', 'Competition Recap and Solution Sketches');
+INSERT INTO archive_links (year, url, title) VALUES (2022, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202022', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (9, 2022, 'Advanced');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (9, 1, 'Pen A Team', 'PEN Academy', 'Cresskill, New Jersey');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (9, 2, 'Cherry Creek Cobras', 'Cherry Creek High School', 'Greenwood Village, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (9, 3, 'River Hill Team 1', 'River Hill High School', 'Clarksville, Maryland');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (9, 4, 'The Spanish Inquisition', 'Regis Jesuit High School', 'Aurora, Colorado');
+INSERT INTO archive_results (id, year, name) VALUES (10, 2022, 'Beginner');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (10, 1, 'LLL', 'Future Forward at Bollman', 'Thornton, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (10, 2, 'Error 404: Name not found', 'Colorado Academy', 'Denver, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (10, 3, 'Liberty 1', 'Liberty Common School', 'Fort Collins, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (10, 4, 'Cool Cats', 'Arvada West High School', 'Arvada, Colorado');
+INSERT INTO archive_years (year, recap) VALUES (2021, 'The 2021 competition was an all-remote competition featuring 55 teams from across the nation.');
+INSERT INTO archive_links (year, url, title) VALUES (2021, 'https://sumnerevans.com/posts/school/2021-hspc/', 'Competition Recap and Solution Sketches');
+INSERT INTO archive_links (year, url, title) VALUES (2021, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202021', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (11, 2021, '');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (11, 1, 'River Hill HS Team 1', 'River Hill High School', 'Clarksville, Maryland');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (11, 2, 'PEN A Team', 'PEN Academy', 'Cresskill, New Jersey');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (11, 3, 'River Hill HS Team 2', 'River Hill High School', 'Clarksville, Maryland');
+INSERT INTO archive_years (year, recap) VALUES (2020, 'Due to COVID, the 2020 competition was the first all-remote HSPC competition. The competition featured 30 teams.');
+INSERT INTO archive_links (year, url, title) VALUES (2020, 'https://sumnerevans.com/posts/school/2020-hspc/', 'Competition Recap and Solution Sketches');
+INSERT INTO archive_links (year, url, title) VALUES (2020, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202020', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (12, 2020, '');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (12, 1, 'Installation Wizards', 'STEM School Highlands Ranch', 'Highlands Ranch, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (12, 2, 'i', 'STEM School Highlands Ranch', 'Highlands Ranch, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (12, 3, 'Sun Devils', 'Kent Denver', 'Denver, Colorado');
+INSERT INTO archive_years (year, recap) VALUES (2019, 'The second ever CS@Mines High School Programming Competition featured 22 teams from all around Colorado and from as far as Steamboat Springs.');
+INSERT INTO archive_links (year, url, title) VALUES (2019, 'https://sumnerevans.com/posts/school/2019-hspc/', 'Competition Recap and Solution Sketches');
+INSERT INTO archive_links (year, url, title) VALUES (2019, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202019', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (13, 2019, '');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (13, 1, 'STEM Team 1', 'STEM School Highlands Ranch', 'Highlands Ranch, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (13, 2, 'IntrospectionExceptions', 'Colorado Academy', 'Lakewood, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (13, 3, 'Team 2', '?', '?');
+INSERT INTO archive_years (year, recap) VALUES (2018, 'The first ever CS@Mines High School Programming Competition featured 22 teams.');
+INSERT INTO archive_links (year, url, title) VALUES (2018, 'https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202018', 'Problems');
+INSERT INTO archive_results (id, year, name) VALUES (14, 2018, '');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (14, 1, 'The Crummies', 'Warren Tech', 'Arvada, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (14, 2, 'The Bean Beans', 'Colorado Academy', 'Lakewood, Colorado');
+INSERT INTO archive_winners (resultid, place, teamname, school, location) VALUES (14, 3, 'Warriors', 'Arapahoe High School', 'Centennial, Colorado');
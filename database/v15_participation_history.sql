@@ -0,0 +1,22 @@
+-- v15: Add participation history from past seasons
+
+-- Each row is a student who competed in a past season. The email is stored in
+-- lowercase so that returning students can be found by email.
+CREATE TABLE participation_history (
+  year        INTEGER NOT NULL,
+  email       TEXT    NOT NULL,
+  name        TEXT    NOT NULL,
+  teamname    TEXT    NOT NULL DEFAULT '',
+  division    TEXT    NOT NULL DEFAULT '',
+  schoolname  TEXT    NOT NULL DEFAULT '',
+  schoolcity  TEXT    NOT NULL DEFAULT '',
+  schoolstate TEXT    NOT NULL DEFAULT '',
+
+  PRIMARY KEY (year, email)
+);
+
+-- previouslyparticipated may be corrected using the participation history, so
+-- the teacher's answer is kept separately to find disagreements.
+ALTER TABLE students ADD COLUMN selfreportedparticipation BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE students ADD COLUMN participationreviewed_ts BIGINT NOT NULL DEFAULT 0;
+UPDATE students SET selfreportedparticipation = previouslyparticipated;
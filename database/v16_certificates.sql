@@ -0,0 +1,22 @@
+-- v16: Add participation certificates
+
+-- There is only one row of certificate settings. The body is a template that
+-- is filled in with each student's details.
+CREATE TABLE certificate_settings (
+  id          INTEGER PRIMARY KEY CHECK (id = 1),
+  title       TEXT    NOT NULL,
+  body        TEXT    NOT NULL,
+  signername  TEXT    NOT NULL DEFAULT '',
+  signertitle TEXT    NOT NULL DEFAULT '',
+  signature   BLOB,
+  released    BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_ts  BIGINT  NOT NULL DEFAULT 0
+);
+
+INSERT INTO certificate_settings (id, title, body) VALUES (
+  1,
+  'Certificate of Participation',
+  'for competing as a member of team {{ .Team }} from {{ .School }} in the {{ .Season }} CS@Mines High School Programming Competition'
+);
+
+ALTER TABLE students ADD COLUMN certificatesent_ts BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,47 @@
+-- v17: Add post-competition feedback surveys
+
+CREATE TABLE survey_questions (
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  position  INTEGER NOT NULL,
+  kind      TEXT    NOT NULL,
+  prompt    TEXT    NOT NULL,
+  -- choices are newline-separated and only used by multiple choice questions
+  choices   TEXT    NOT NULL DEFAULT '',
+  -- roles is a comma-separated list of who is asked the question
+  roles     TEXT    NOT NULL,
+  required  BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Each row is an emailed survey link. The respondent's division, experience
+-- and attendance are recorded when they are invited so that the results can be
+-- broken down by them even after registrations change.
+CREATE TABLE survey_invitations (
+  season     INTEGER NOT NULL,
+  role       TEXT    NOT NULL,
+  email      TEXT    NOT NULL,
+  name       TEXT    NOT NULL,
+  division   TEXT    NOT NULL DEFAULT '',
+  experience TEXT    NOT NULL DEFAULT '',
+  attendance TEXT    NOT NULL DEFAULT '',
+  sent_ts    BIGINT  NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (season, role, email)
+);
+
+CREATE TABLE survey_responses (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  season       INTEGER NOT NULL,
+  role         TEXT    NOT NULL,
+  email        TEXT    NOT NULL,
+  submitted_ts BIGINT  NOT NULL,
+
+  UNIQUE (season, role, email)
+);
+
+CREATE TABLE survey_answers (
+  responseid INTEGER NOT NULL,
+  questionid INTEGER NOT NULL,
+  value      TEXT    NOT NULL,
+
+  PRIMARY KEY (responseid, questionid)
+);
@@ -0,0 +1,4 @@
+-- v18: Add the students' preferred language
+
+-- The locale that emails to the student and their parent are sent in.
+ALTER TABLE students ADD COLUMN language TEXT NOT NULL DEFAULT 'en';
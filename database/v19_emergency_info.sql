@@ -0,0 +1,12 @@
+-- v19: Add the students' emergency contacts and medical notes
+
+-- This is kept out of the students table so that it is only loaded where it is
+-- needed and so that it can be purged after the competition.
+CREATE TABLE student_emergency_info (
+  studentemail   TEXT   NOT NULL PRIMARY KEY,
+  contactname    TEXT   NOT NULL DEFAULT '',
+  contactphone   TEXT   NOT NULL DEFAULT '',
+  medicalnotes   TEXT   NOT NULL DEFAULT '',
+  accommodations TEXT   NOT NULL DEFAULT '',
+  updated_ts     BIGINT NOT NULL
+);
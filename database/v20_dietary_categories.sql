@@ -0,0 +1,18 @@
+-- v20: Add structured dietary restrictions
+
+-- The dietary categories that can be chosen, which admins set up each season.
+CREATE TABLE dietary_categories (
+  id     INTEGER PRIMARY KEY AUTOINCREMENT,
+  season INTEGER NOT NULL,
+  name   TEXT    NOT NULL
+);
+
+-- The chosen categories are comma-separated category IDs. The students'
+-- existing dietaryrestrictions column is kept as the note for anything else.
+ALTER TABLE students ADD COLUMN dietarycategories TEXT NOT NULL DEFAULT '';
+
+-- Teachers and volunteers also eat lunch on campus.
+ALTER TABLE teachers ADD COLUMN dietarycategories TEXT NOT NULL DEFAULT '';
+ALTER TABLE teachers ADD COLUMN dietarynote TEXT NOT NULL DEFAULT '';
+ALTER TABLE volunteers ADD COLUMN dietarycategories TEXT NOT NULL DEFAULT '';
+ALTER TABLE volunteers ADD COLUMN dietarynote TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,28 @@
+-- v21: Add campus tour groups with capacities, guides, and a waitlist
+
+CREATE TABLE tour_groups (
+  id       INTEGER PRIMARY KEY AUTOINCREMENT,
+  name     TEXT    NOT NULL UNIQUE,
+  time     TEXT    NOT NULL DEFAULT '',
+  capacity INTEGER NOT NULL,
+  notes    TEXT    NOT NULL DEFAULT ''
+);
+
+-- The volunteers that lead each tour group.
+CREATE TABLE tour_guides (
+  groupid        INTEGER NOT NULL,
+  volunteeremail TEXT    NOT NULL,
+
+  PRIMARY KEY (groupid, volunteeremail)
+);
+
+-- The students that want to go on a tour. A NULL preferredgroup means that
+-- any group is fine, and a NULL groupid means that the student is on the
+-- waitlist. Withdrawn students are not counted, and their row is removed if
+-- they are added to a team again.
+CREATE TABLE student_tours (
+  studentemail   TEXT    NOT NULL PRIMARY KEY,
+  preferredgroup INTEGER,
+  groupid        INTEGER,
+  requested_ts   BIGINT  NOT NULL
+);
@@ -0,0 +1,23 @@
+-- v22: Add teacher and chaperone attendance registration
+
+-- The adults that come to campus with each teacher's teams, including the
+-- teacher themself (isteacher). Each season is registered separately. The
+-- chosen dietary categories are comma-separated category IDs.
+CREATE TABLE chaperones (
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  season            INTEGER NOT NULL,
+  teacheremail      TEXT    NOT NULL,
+  isteacher         BOOLEAN NOT NULL DEFAULT FALSE,
+  name              TEXT    NOT NULL,
+  email             TEXT    NOT NULL,
+  phone             TEXT    NOT NULL DEFAULT '',
+  dietarycategories TEXT    NOT NULL DEFAULT '',
+  dietarynote       TEXT    NOT NULL DEFAULT '',
+  parkingpermit     BOOLEAN NOT NULL DEFAULT FALSE,
+  registered_ts     BIGINT  NOT NULL,
+  ticketsent        BOOLEAN NOT NULL DEFAULT FALSE,
+  checkedin_ts      BIGINT,
+  checkin_volunteer TEXT    NOT NULL DEFAULT '',
+
+  UNIQUE (season, email)
+);
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+type WebhookEventType string
+
+const (
+	WebhookEventTeamRegistered     WebhookEventType = "team.registered"
+	WebhookEventStudentRegistered  WebhookEventType = "student.registered"
+	WebhookEventStudentConfirmed   WebhookEventType = "student.confirmed"
+	WebhookEventStudentFormsSigned WebhookEventType = "student.forms_signed"
+	WebhookEventStudentCheckedIn   WebhookEventType = "student.checked_in"
+	WebhookEventStudentCheckedOut  WebhookEventType = "student.checked_out"
+	// WebhookEventPing is only sent when an admin tests a webhook, so it
+	// cannot be subscribed to.
+	WebhookEventPing WebhookEventType = "ping"
+)
+
+// WebhookEventTypes are the event types that webhooks can subscribe to.
+var WebhookEventTypes = []WebhookEventType{
+	WebhookEventTeamRegistered,
+	WebhookEventStudentRegistered,
+	WebhookEventStudentConfirmed,
+	WebhookEventStudentFormsSigned,
+	WebhookEventStudentCheckedIn,
+	WebhookEventStudentCheckedOut,
+}
+
+type Webhook struct {
+	ID          int64
+	URL         string
+	Description string
+	Events      []WebhookEventType
+	// Secret is the key that the payloads are signed with.
+	Secret     string
+	CreatedBy  string
+	CreatedTS  time.Time
+	DisabledTS time.Time
+}
+
+func (w *Webhook) Subscribed(eventType WebhookEventType) bool {
+	return slices.Contains(w.Events, eventType)
+}
+
+func (w *Webhook) Disabled() bool {
+	return !w.DisabledTS.IsZero()
+}
+
+const webhookColumns = `id, url, description, events, secret, createdby, created_ts, disabled_ts`
+
+func (d *Database) scanWebhook(row dbutil.Scannable) (*Webhook, error) {
+	var webhook Webhook
+	var events string
+	var createdTS, disabledTS int64
+	err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Description, &events, &webhook.Secret, &webhook.CreatedBy, &createdTS, &disabledTS)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range strings.Split(events, ",") {
+		if event != "" {
+			webhook.Events = append(webhook.Events, WebhookEventType(event))
+		}
+	}
+	webhook.CreatedTS = time.UnixMilli(createdTS)
+	if disabledTS > 0 {
+		webhook.DisabledTS = time.UnixMilli(disabledTS)
+	}
+	return &webhook, nil
+}
+
+func (d *Database) AddWebhook(ctx context.Context, webhook *Webhook) error {
+	if webhook.CreatedTS.IsZero() {
+		webhook.CreatedTS = time.Now()
+	}
+	events := make([]string, len(webhook.Events))
+	for i, event := range webhook.Events {
+		events[i] = string(event)
+	}
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO webhooks (url, description, events, secret, createdby, created_ts)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, webhook.URL, webhook.Description, strings.Join(events, ","), webhook.Secret, webhook.CreatedBy, webhook.CreatedTS.UnixMilli()).Scan(&webhook.ID)
+}
+
+func (d *Database) GetWebhooks(ctx context.Context) ([]*Webhook, error) {
+	rows, err := d.DB.Query(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*Webhook
+	for rows.Next() {
+		webhook, err := d.scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// GetWebhook returns the webhook with the ID, or nil if there is none.
+func (d *Database) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	rows, err := d.DB.Query(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return d.scanWebhook(rows)
+}
+
+// SetWebhookDisabled disables or re-enables the webhook. Deliveries that are
+// waiting to be retried are still attempted while the webhook is disabled.
+func (d *Database) SetWebhookDisabled(ctx context.Context, id int64, disabled bool) error {
+	var disabledTS int64
+	if disabled {
+		disabledTS = time.Now().UnixMilli()
+	}
+	_, err := d.DB.Exec(ctx, `UPDATE webhooks SET disabled_ts = ? WHERE id = ?`, disabledTS, id)
+	return err
+}
+
+// DeleteWebhook deletes the webhook and its delivery log.
+func (d *Database) DeleteWebhook(ctx context.Context, id int64) error {
+	return d.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		if _, err := d.DB.Exec(ctx, `DELETE FROM webhook_deliveries WHERE webhookid = ?`, id); err != nil {
+			return err
+		}
+		_, err := d.DB.Exec(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+		return err
+	})
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one attempt to send an event to a webhook, including
+// all of its retries.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	// WebhookURL is only set when the delivery is read from the database.
+	WebhookURL    string
+	EventID       string
+	EventType     WebhookEventType
+	Payload       string
+	Status        WebhookDeliveryStatus
+	Attempts      int
+	CreatedTS     time.Time
+	NextAttemptTS time.Time
+	LastAttemptTS time.Time
+	// ResponseStatus is the HTTP status of the last attempt, or zero if the
+	// request failed without a response.
+	ResponseStatus int
+	LastError      string
+}
+
+const webhookDeliveryColumns = `
+	wd.id, wd.webhookid, COALESCE(w.url, ''), wd.eventid, wd.eventtype, wd.payload, wd.status, wd.attempts,
+	wd.created_ts, wd.nextattempt_ts, wd.lastattempt_ts, wd.responsestatus, wd.lasterror
+`
+
+func (d *Database) scanWebhookDelivery(row dbutil.Scannable) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var createdTS, nextAttemptTS, lastAttemptTS int64
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.WebhookURL, &delivery.EventID, &delivery.EventType,
+		&delivery.Payload, &delivery.Status, &delivery.Attempts, &createdTS, &nextAttemptTS, &lastAttemptTS,
+		&delivery.ResponseStatus, &delivery.LastError)
+	if err != nil {
+		return nil, err
+	}
+	delivery.CreatedTS = time.UnixMilli(createdTS)
+	delivery.NextAttemptTS = time.UnixMilli(nextAttemptTS)
+	if lastAttemptTS > 0 {
+		delivery.LastAttemptTS = time.UnixMilli(lastAttemptTS)
+	}
+	return &delivery, nil
+}
+
+func (d *Database) getWebhookDeliveries(ctx context.Context, query string, args ...any) ([]*WebhookDelivery, error) {
+	rows, err := d.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery, err := d.scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// AddWebhookDelivery queues the delivery to be sent as soon as possible.
+func (d *Database) AddWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	if delivery.CreatedTS.IsZero() {
+		delivery.CreatedTS = time.Now()
+	}
+	delivery.Status = WebhookDeliveryPending
+	delivery.NextAttemptTS = delivery.CreatedTS
+	return d.DB.QueryRow(ctx, `
+		INSERT INTO webhook_deliveries (webhookid, eventid, eventtype, payload, status, created_ts, nextattempt_ts)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Payload, delivery.Status,
+		delivery.CreatedTS.UnixMilli(), delivery.NextAttemptTS.UnixMilli()).Scan(&delivery.ID)
+}
+
+// GetDueWebhookDeliveries returns the oldest pending deliveries that should be
+// attempted at the given time.
+func (d *Database) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	return d.getWebhookDeliveries(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries wd
+		LEFT JOIN webhooks w ON w.id = wd.webhookid
+		WHERE wd.status = ? AND wd.nextattempt_ts <= ?
+		ORDER BY wd.nextattempt_ts, wd.id
+		LIMIT ?
+	`, WebhookDeliveryPending, now.UnixMilli(), limit)
+}
+
+// GetRecentWebhookDeliveries returns the newest deliveries for the delivery
+// log.
+func (d *Database) GetRecentWebhookDeliveries(ctx context.Context, limit int) ([]*WebhookDelivery, error) {
+	return d.getWebhookDeliveries(ctx, `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries wd
+		LEFT JOIN webhooks w ON w.id = wd.webhookid
+		ORDER BY wd.id DESC
+		LIMIT ?
+	`, limit)
+}
+
+// UpdateWebhookDeliveryAttempt saves the result of an attempt to send the
+// delivery.
+func (d *Database) UpdateWebhookDeliveryAttempt(ctx context.Context, delivery *WebhookDelivery) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, nextattempt_ts = ?, lastattempt_ts = ?, responsestatus = ?, lasterror = ?
+		WHERE id = ?
+	`, delivery.Status, delivery.Attempts, delivery.NextAttemptTS.UnixMilli(), delivery.LastAttemptTS.UnixMilli(),
+		delivery.ResponseStatus, delivery.LastError, delivery.ID)
+	return err
+}
+
+// RetryWebhookDelivery queues the delivery to be sent again as soon as
+// possible with a fresh set of retries.
+func (d *Database) RetryWebhookDelivery(ctx context.Context, id int64) error {
+	_, err := d.DB.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, nextattempt_ts = ?
+		WHERE id = ?
+	`, WebhookDeliveryPending, time.Now().UnixMilli(), id)
+	return err
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 
 	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
 )
 
 func (a *Application) createAdminLoginJWT(email string) *jwt.Token {
@@ -112,18 +113,6 @@ func (a *Application) GetAdminTeamsTemplate(r *http.Request) map[string]any {
 	}
 }
 
-func (a *Application) GetAdminDietaryRestrictionsTemplate(r *http.Request) map[string]any {
-	dietaryRestrictions, err := a.DB.GetAllDietaryRestrictions(r.Context())
-	if err != nil {
-		a.Log.Err(err).Msg("failed to get dietary restrictions")
-		return nil
-	}
-
-	return map[string]any{
-		"DietaryRestrictions": dietaryRestrictions,
-	}
-}
-
 type PreflightStudent struct {
 	Name     string
 	Email    string
@@ -167,34 +156,85 @@ func (a *Application) GetAdminPreflightTemplate(r *http.Request) map[string]any
 	}
 }
 
+func (a *Application) GetAdminWithdrawalsTemplate(r *http.Request) map[string]any {
+	teams, err := a.DB.GetWithdrawnTeams(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get withdrawn teams")
+		return nil
+	}
+	students, err := a.DB.GetWithdrawnStudents(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get withdrawn students")
+		return nil
+	}
+	return map[string]any{
+		"Teams":    teams,
+		"Students": students,
+	}
+}
+
+type AdminTeacher struct {
+	*database.Teacher
+	EmailBudgetUsage []EmailBudgetUsage
+}
+
 func (a *Application) GetAdminTeachersTemplate(r *http.Request) map[string]any {
 	teachers, err := a.DB.GetAllTeachers(r.Context())
 	if err != nil {
 		a.Log.Err(err).Msg("failed to get teachers")
 		return nil
 	}
-	return map[string]any{"Teachers": teachers}
+
+	adminTeachers := make([]AdminTeacher, len(teachers))
+	for i, teacher := range teachers {
+		usage, err := a.getEmailBudgetUsage(r.Context(), teacher.Email)
+		if err != nil {
+			a.Log.Err(err).Str("teacher_email", teacher.Email).Msg("failed to get email budget usage")
+			return nil
+		}
+		adminTeachers[i] = AdminTeacher{Teacher: teacher, EmailBudgetUsage: usage}
+	}
+	return map[string]any{"Teachers": adminTeachers}
 }
 
-func (a *Application) HandleAdminSetEmailAllowance(w http.ResponseWriter, r *http.Request) {
+func (a *Application) HandleAdminClearEmailFlag(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		a.Log.Warn().Err(err).Msg("failed to parse form")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	email := r.FormValue("email")
-	allowanceStr := r.FormValue("allowance")
-	if email == "" || allowanceStr == "" {
+	if email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.ClearTeacherEmailFlag(r.Context(), email); err != nil {
+		a.Log.Err(err).Msg("failed to clear email flag")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/teachers", http.StatusSeeOther)
+}
+
+func (a *Application) HandleAdminSetEmailSuspended(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	allowance, err := strconv.Atoi(allowanceStr)
-	if err != nil || allowance < 0 {
+	email := r.FormValue("email")
+	suspendedStr := r.FormValue("suspended")
+	if email == "" || suspendedStr == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if err := a.DB.SetEmailAllowance(r.Context(), email, allowance); err != nil {
-		a.Log.Err(err).Msg("failed to set email allowance")
+	suspended, err := strconv.ParseBool(suspendedStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.SetTeacherEmailSuspended(r.Context(), email, suspended); err != nil {
+		a.Log.Err(err).Msg("failed to set email suspended")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -314,7 +354,9 @@ func (a *Application) HandleResendStudentEmail(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if err := a.sendStudentEmail(ctx, student.Email, student.Name, teacher.Name, team.Name, false); err != nil {
+	err = a.sendStudentEmail(ctx, student.Email, student.Name, teacher.Name, team.Name, i18n.ParseOrDefault(student.Language), false)
+	a.recordStudentVerifySend(ctx, teacher.Email, student, database.EmailSourceAdmin, true, err)
+	if err != nil {
 		a.Log.Err(err).Msg("failed to send student email")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -344,7 +386,16 @@ func (a *Application) HandleResendParentEmail(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if err := a.sendParentEmail(ctx, student, false); err != nil {
+	team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get student's team")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = a.sendParentEmail(ctx, student, false)
+	a.recordParentFormsSend(ctx, team.TeacherEmail, student, database.EmailSourceAdmin, true, err)
+	if err != nil {
 		a.Log.Err(err).Msg("failed to send parent email")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -393,14 +444,14 @@ func (a *Application) HandleGetParentEmailConfirmationLink(w http.ResponseWriter
 		return
 	}
 
-	_, err := a.DB.GetStudentByEmail(ctx, email)
+	student, err := a.DB.GetStudentByEmail(ctx, email)
 	if err != nil {
 		a.Log.Warn().Err(err).Msg("failed to get student by email")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	signURL, err := a.getParentSignFormsLink(email)
+	signURL, err := a.getParentSignFormsLink(student)
 	if err != nil {
 		a.Log.Err(err).Msg("failed to get parent sign forms link")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -430,7 +481,8 @@ func (a *Application) HandleSendEmailConfirmationReminders(w http.ResponseWriter
 			fmt.Fprintf(w, "Resending confirmation email to %s\n", member.Email)
 			go func(team *database.TeamWithTeacherName, member database.Student) {
 				ctx := log.WithContext(context.Background())
-				err := a.sendStudentEmail(ctx, member.Email, member.Name, team.TeacherName, team.Name, true)
+				err := a.sendStudentEmail(ctx, member.Email, member.Name, team.TeacherName, team.Name, i18n.ParseOrDefault(member.Language), true)
+				a.recordStudentVerifySend(ctx, team.TeacherEmail, &member, database.EmailSourceAdmin, true, err)
 				if err != nil {
 					log.Err(err).Msg("failed to send student email")
 					return
@@ -462,14 +514,15 @@ func (a *Application) HandleSendParentReminders(w http.ResponseWriter, r *http.R
 				continue
 			}
 			fmt.Fprintf(w, "Resending sign forms email to %s (for %s)\n", member.ParentEmail, member.Email)
-			go func(member database.Student) {
+			go func(team *database.TeamWithTeacherName, member database.Student) {
 				ctx := log.WithContext(context.Background())
 				err := a.sendParentEmail(ctx, &member, true)
+				a.recordParentFormsSend(ctx, team.TeacherEmail, &member, database.EmailSourceAdmin, true, err)
 				if err != nil {
 					log.Err(err).Msg("failed to send parent email")
 					return
 				}
-			}(member)
+			}(team, member)
 		}
 	}
 }
@@ -484,8 +537,15 @@ func (a *Application) HandleSendQRCodes(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	seats, err := a.DB.GetTeamSeats(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get team seats")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	for _, team := range teamsWithTeachers {
+		seat := seats[team.ID]
 		for _, member := range team.Members {
 			if member.QRCodeSent {
 				fmt.Fprintf(w, "Not sending QR code to %s since we already sent to that email\n", member.Email)
@@ -494,7 +554,7 @@ func (a *Application) HandleSendQRCodes(w http.ResponseWriter, r *http.Request)
 
 				go func(member database.Student) {
 					ctx := log.WithContext(context.Background())
-					err := a.sendQRCodeEmail(ctx, member.Name, member.Email)
+					err := a.sendQRCodeEmail(ctx, member.Name, member.Email, seat)
 					if err != nil {
 						log.Err(err).Msg("failed to send QR code email")
 						return
@@ -606,13 +666,35 @@ func (a *Application) HandleZoomBreakoutExport(w http.ResponseWriter, r *http.Re
 	writer.Flush()
 }
 
+// adminVolunteer is a volunteer and the dietary restrictions that they need
+// for lunch.
+type adminVolunteer struct {
+	Email          string
+	DietaryOptions []dietaryOption
+	DietaryNote    string
+}
+
 func (a *Application) GetAdminVolunteersTemplate(r *http.Request) map[string]any {
-	volunteers, err := a.DB.GetAllVolunteers(r.Context())
+	ctx := r.Context()
+	volunteers, err := a.DB.GetVolunteerDietaryChoices(ctx)
 	if err != nil {
 		a.Log.Err(err).Msg("failed to get volunteers")
 		return nil
 	}
-	return map[string]any{"Volunteers": volunteers}
+	categories, err := a.DB.GetDietaryCategories(ctx, currentSeason())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get dietary categories")
+		return nil
+	}
+	adminVolunteers := make([]adminVolunteer, len(volunteers))
+	for i, volunteer := range volunteers {
+		adminVolunteers[i] = adminVolunteer{
+			Email:          volunteer.Email,
+			DietaryOptions: dietaryOptions(categories, volunteer.Categories),
+			DietaryNote:    volunteer.Note,
+		}
+	}
+	return map[string]any{"Volunteers": adminVolunteers}
 }
 
 func (a *Application) HandleAdminAddVolunteer(w http.ResponseWriter, r *http.Request) {
@@ -657,21 +739,30 @@ func (a *Application) HandleManualCheckin(w http.ResponseWriter, r *http.Request
 	ctx := r.Context()
 	email := r.URL.Query().Get("email")
 	a.DB.SignFormsForStudent(ctx, email, "SIGNED IN PERSON", true)
-	a.DB.CheckInStudent(ctx, email)
+	now := time.Now()
+	if recorded, err := a.DB.CheckInStudent(ctx, email, now, a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin), checkInStationAdmin); err != nil {
+		a.Log.Err(err).Msg("failed to check in student")
+	} else if recorded {
+		a.publishStudentEvent(ctx, LiveEventCheckedIn, email, now, checkInStationAdmin)
+	}
 	http.Redirect(w, r, "/admin/teams", http.StatusSeeOther)
 }
 
-func (a *Application) HandleManualUncheckin(w http.ResponseWriter, r *http.Request) {
+func (a *Application) HandleManualCheckout(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	email := r.URL.Query().Get("email")
 	if email == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if err := a.DB.UncheckInStudent(ctx, email); err != nil {
-		a.Log.Err(err).Msg("failed to uncheck-in student")
+	now := time.Now()
+	recorded, err := a.DB.CheckOutStudent(ctx, email, now, a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin), checkInStationAdmin)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to check out student")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
+	} else if recorded {
+		a.publishStudentEvent(ctx, LiveEventCheckedOut, email, now, checkInStationAdmin)
 	}
 	http.Redirect(w, r, "/admin/teams", http.StatusSeeOther)
 }
@@ -686,6 +777,12 @@ func (a *Application) HandleTeamList(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	seats, err := a.DB.GetTeamSeats(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get team seats")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	for _, team := range teamsWithTeachers {
 		isOnlyFirstTime := true
@@ -698,7 +795,11 @@ func (a *Application) HandleTeamList(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		w.Write([]byte(team.Name + "\n"))
+		if seat := seats[team.ID]; seat != nil {
+			fmt.Fprintf(w, "%s (%s, seat %d)\n", team.Name, seat.RoomName, seat.Seat)
+		} else {
+			w.Write([]byte(team.Name + "\n"))
+		}
 		for _, member := range team.Members {
 			w.Write([]byte("  " + member.Name + " (" + member.Email + ")\n"))
 		}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func (a *Application) GetAdminAPITokensTemplate(r *http.Request) map[string]any {
+	tokens, err := a.DB.GetAPITokens(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get API tokens")
+		return nil
+	}
+	return map[string]any{
+		"Tokens": tokens,
+		"Scopes": database.APIScopes,
+	}
+}
+
+// HandleAdminCreateAPIToken creates an API token and shows it to the admin.
+// Only the hash of the token is stored, so it cannot be shown again later.
+func (a *Application) HandleAdminCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	renderError := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		a.AdminAPITokensRenderer(w, r, map[string]any{"Error": message})
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		renderError("The token needs a name.")
+		return
+	}
+	var scopes []database.APIScope
+	for _, scope := range r.Form["scope"] {
+		if !slices.Contains(database.APIScopes, database.APIScope(scope)) {
+			renderError("Unknown scope " + scope + ".")
+			return
+		}
+		scopes = append(scopes, database.APIScope(scope))
+	}
+	if len(scopes) == 0 {
+		renderError("Choose at least one scope.")
+		return
+	}
+	var expiresTS time.Time
+	if days := strings.TrimSpace(r.FormValue("expires_days")); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			renderError("The expiry must be a number of days.")
+			return
+		} else if n > 0 {
+			expiresTS = time.Now().AddDate(0, 0, n)
+		}
+	}
+
+	tokenStr, tokenHash, err := generateAPIToken()
+	if err != nil {
+		a.Log.Err(err).Msg("failed to generate API token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	token := &database.APIToken{
+		Name:      name,
+		TokenHash: tokenHash,
+		Scopes:    scopes,
+		CreatedBy: a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin),
+		ExpiresTS: expiresTS,
+	}
+	if err := a.DB.CreateAPIToken(r.Context(), token); err != nil {
+		a.Log.Err(err).Msg("failed to create API token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.Log.Info().Int64("token_id", token.ID).Str("name", name).Msg("created API token")
+	a.AdminAPITokensRenderer(w, r, map[string]any{"NewToken": tokenStr, "NewTokenName": name})
+}
+
+func (a *Application) HandleAdminRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.RevokeAPIToken(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("token_id", id).Msg("failed to revoke API token")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.Log.Info().Int64("token_id", id).Msg("revoked API token")
+	http.Redirect(w, r, "/admin/apitokens", http.StatusSeeOther)
+}
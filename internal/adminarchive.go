@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// adminArchiveTeam is a current team that an archive winner can be linked to.
+type adminArchiveTeam struct {
+	ID uuid.UUID
+	archiveTeam
+}
+
+func (a *Application) GetAdminArchiveTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	archive, err := a.DB.GetArchive(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get archive")
+		return nil
+	}
+	data := map[string]any{
+		"Archive": archive,
+		"Error":   r.URL.Query().Get("error"),
+		"Message": r.URL.Query().Get("message"),
+	}
+	if r.PathValue("year") == "" {
+		return data
+	}
+
+	year, err := strconv.Atoi(r.PathValue("year"))
+	if err != nil {
+		data["Error"] = "Invalid year."
+		return data
+	}
+	for _, archiveYear := range archive {
+		if archiveYear.Year == year {
+			data["Year"] = archiveYear
+		}
+	}
+	if data["Year"] == nil {
+		data["Error"] = fmt.Sprintf("There is no archive for %d.", year)
+		return data
+	}
+
+	teams, err := a.getArchiveTeams(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams for archive")
+		return nil
+	}
+	var teamOptions []adminArchiveTeam
+	for id, team := range teams {
+		teamOptions = append(teamOptions, adminArchiveTeam{ID: id, archiveTeam: team})
+	}
+	slices.SortFunc(teamOptions, func(a, b adminArchiveTeam) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	schools, err := a.getAPISchools(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get schools for archive")
+		return nil
+	}
+	data["Teams"] = teamOptions
+	data["Schools"] = schools
+	return data
+}
+
+func redirectToArchive(w http.ResponseWriter, r *http.Request, year int, key, message string) {
+	target := "/admin/archive"
+	if year != 0 {
+		target += "/" + strconv.Itoa(year)
+	}
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// parseArchiveForm reads the year and, if idField is set, the ID that every
+// form on the archive editor sends.
+func (a *Application) parseArchiveForm(w http.ResponseWriter, r *http.Request, idField string) (year int, id int64, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, 0, false
+	}
+	year, err := strconv.Atoi(r.FormValue("year"))
+	if err != nil || year < 1900 || year > 9999 {
+		redirectToArchive(w, r, 0, "error", "The year must be a four digit year.")
+		return 0, 0, false
+	}
+	if idField != "" {
+		if id, err = strconv.ParseInt(r.FormValue(idField), 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return 0, 0, false
+		}
+	}
+	return year, id, true
+}
+
+func (a *Application) HandleAdminSaveArchiveYear(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := a.parseArchiveForm(w, r, "")
+	if !ok {
+		return
+	}
+	if err := a.DB.SaveArchiveYear(r.Context(), year, strings.TrimSpace(r.FormValue("recap"))); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to save archive year")
+		redirectToArchive(w, r, year, "error", "Failed to save the year.")
+		return
+	}
+	redirectToArchive(w, r, year, "message", "Saved the recap.")
+}
+
+func (a *Application) HandleAdminDeleteArchiveYear(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := a.parseArchiveForm(w, r, "")
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteArchiveYear(r.Context(), year); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to delete archive year")
+		redirectToArchive(w, r, year, "error", "Failed to delete the year.")
+		return
+	}
+	a.Log.Info().Int("year", year).Msg("deleted archive year")
+	redirectToArchive(w, r, 0, "message", fmt.Sprintf("Deleted the %d archive.", year))
+}
+
+func (a *Application) HandleAdminAddArchiveLink(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := a.parseArchiveForm(w, r, "")
+	if !ok {
+		return
+	}
+	link := &database.ArchiveLink{
+		Year:  year,
+		URL:   strings.TrimSpace(r.FormValue("url")),
+		Title: strings.TrimSpace(r.FormValue("title")),
+	}
+	if u, err := url.Parse(link.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		redirectToArchive(w, r, year, "error", "The link must be a full http or https URL.")
+		return
+	} else if link.Title == "" {
+		redirectToArchive(w, r, year, "error", "The link must have a title.")
+		return
+	}
+	if err := a.DB.AddArchiveLink(r.Context(), link); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to add archive link")
+		redirectToArchive(w, r, year, "error", "Failed to add the link.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+func (a *Application) HandleAdminDeleteArchiveLink(w http.ResponseWriter, r *http.Request) {
+	year, id, ok := a.parseArchiveForm(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteArchiveLink(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("link_id", id).Msg("failed to delete archive link")
+		redirectToArchive(w, r, year, "error", "Failed to delete the link.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+func (a *Application) HandleAdminAddArchiveResult(w http.ResponseWriter, r *http.Request) {
+	year, _, ok := a.parseArchiveForm(w, r, "")
+	if !ok {
+		return
+	}
+	result := &database.ArchiveResult{Year: year, Name: strings.TrimSpace(r.FormValue("name"))}
+	if result.Name == "" {
+		redirectToArchive(w, r, year, "error", "The result must have a name.")
+		return
+	}
+	if err := a.DB.AddArchiveResult(r.Context(), result); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to add archive result")
+		redirectToArchive(w, r, year, "error", "Failed to add the result.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+func (a *Application) HandleAdminRenameArchiveResult(w http.ResponseWriter, r *http.Request) {
+	year, id, ok := a.parseArchiveForm(w, r, "id")
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		redirectToArchive(w, r, year, "error", "The result must have a name.")
+		return
+	}
+	if err := a.DB.RenameArchiveResult(r.Context(), id, name); err != nil {
+		a.Log.Err(err).Int64("result_id", id).Msg("failed to rename archive result")
+		redirectToArchive(w, r, year, "error", "Failed to rename the result.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+func (a *Application) HandleAdminDeleteArchiveResult(w http.ResponseWriter, r *http.Request) {
+	year, id, ok := a.parseArchiveForm(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteArchiveResult(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("result_id", id).Msg("failed to delete archive result")
+		redirectToArchive(w, r, year, "error", "Failed to delete the result.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+// parseArchiveWinnerForm reads the winner fields that are shared by the add
+// and update forms. If a team is linked, any blank fields are filled in from
+// the team's registration so the stored values are a useful fallback if the
+// team is later withdrawn. It returns a message if the form is invalid.
+func (a *Application) parseArchiveWinnerForm(r *http.Request) (*database.ArchiveWinner, string, error) {
+	winner := &database.ArchiveWinner{
+		TeamName: strings.TrimSpace(r.FormValue("teamname")),
+		School:   strings.TrimSpace(r.FormValue("school")),
+		Location: strings.TrimSpace(r.FormValue("location")),
+	}
+	var err error
+	if winner.Place, err = strconv.Atoi(r.FormValue("place")); err != nil || winner.Place < 1 {
+		return nil, "The place must be a positive number.", nil
+	}
+	if teamID := r.FormValue("teamid"); teamID != "" {
+		if winner.TeamID, err = uuid.Parse(teamID); err != nil {
+			return nil, "Invalid team.", nil
+		}
+		teams, err := a.getArchiveTeams(r.Context())
+		if err != nil {
+			return nil, "", err
+		}
+		team, ok := teams[winner.TeamID]
+		if !ok {
+			return nil, "The team does not exist.", nil
+		}
+		if winner.TeamName == "" {
+			winner.TeamName = team.Name
+		}
+		if winner.School == "" {
+			winner.School = team.School
+		}
+		if winner.Location == "" {
+			winner.Location = team.Location
+		}
+	}
+	if winner.TeamName == "" {
+		return nil, "The winner must have a team name or be linked to a team.", nil
+	}
+	return winner, "", nil
+}
+
+func (a *Application) HandleAdminAddArchiveWinner(w http.ResponseWriter, r *http.Request) {
+	year, resultID, ok := a.parseArchiveForm(w, r, "resultid")
+	if !ok {
+		return
+	}
+	winner, invalid, err := a.parseArchiveWinnerForm(r)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams for archive winner")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if invalid != "" {
+		redirectToArchive(w, r, year, "error", invalid)
+		return
+	}
+	winner.ResultID = resultID
+	if err := a.DB.AddArchiveWinner(r.Context(), winner); err != nil {
+		a.Log.Err(err).Int64("result_id", resultID).Msg("failed to add archive winner")
+		redirectToArchive(w, r, year, "error", "Failed to add the winner.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+func (a *Application) HandleAdminUpdateArchiveWinner(w http.ResponseWriter, r *http.Request) {
+	year, id, ok := a.parseArchiveForm(w, r, "id")
+	if !ok {
+		return
+	}
+	winner, invalid, err := a.parseArchiveWinnerForm(r)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams for archive winner")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if invalid != "" {
+		redirectToArchive(w, r, year, "error", invalid)
+		return
+	}
+	winner.ID = id
+	if err := a.DB.UpdateArchiveWinner(r.Context(), winner); err != nil {
+		a.Log.Err(err).Int64("winner_id", id).Msg("failed to update archive winner")
+		redirectToArchive(w, r, year, "error", "Failed to update the winner.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
+
+func (a *Application) HandleAdminDeleteArchiveWinner(w http.ResponseWriter, r *http.Request) {
+	year, id, ok := a.parseArchiveForm(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteArchiveWinner(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("winner_id", id).Msg("failed to delete archive winner")
+		redirectToArchive(w, r, year, "error", "Failed to delete the winner.")
+		return
+	}
+	redirectToArchive(w, r, year, "", "")
+}
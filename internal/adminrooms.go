@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+type AdminSeatingTeam struct {
+	*database.TeamWithTeacherName
+	Seat *database.TeamSeat
+}
+
+func (a *Application) GetAdminRoomsTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	rooms, err := a.DB.GetRooms(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get rooms")
+		return nil
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams")
+		return nil
+	}
+	seats, err := a.DB.GetTeamSeats(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get team seats")
+		return nil
+	}
+
+	var totalSeats, assigned int
+	for _, room := range rooms {
+		totalSeats += room.Seats
+	}
+	var seatingTeams []AdminSeatingTeam
+	for _, team := range teams {
+		if !team.InPerson || len(team.Members) == 0 {
+			continue
+		}
+		seatingTeams = append(seatingTeams, AdminSeatingTeam{TeamWithTeacherName: team, Seat: seats[team.ID]})
+		if seats[team.ID] != nil {
+			assigned++
+		}
+	}
+	// Unassigned teams go first, then teams in seat order.
+	slices.SortFunc(seatingTeams, func(a, b AdminSeatingTeam) int {
+		if a.Seat == nil || b.Seat == nil {
+			return cmp.Or(cmp.Compare(boolToInt(a.Seat != nil), boolToInt(b.Seat != nil)), cmp.Compare(a.Name, b.Name))
+		}
+		return cmp.Or(cmp.Compare(a.Seat.RoomID, b.Seat.RoomID), cmp.Compare(a.Seat.Seat, b.Seat.Seat))
+	})
+
+	return map[string]any{
+		"Rooms":      rooms,
+		"Teams":      seatingTeams,
+		"TotalSeats": totalSeats,
+		"Assigned":   assigned,
+		"Error":      r.URL.Query().Get("error"),
+		"Message":    r.URL.Query().Get("message"),
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func redirectToRooms(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/rooms"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// parseRoomForm reads the room fields that are shared by the add and update
+// forms. If the form is invalid, a message for the admin is returned.
+func parseRoomForm(r *http.Request) (*database.Room, string) {
+	room := &database.Room{
+		Name:       strings.TrimSpace(r.FormValue("name")),
+		Accessible: r.FormValue("accessible") == "on",
+		Notes:      strings.TrimSpace(r.FormValue("notes")),
+	}
+	if room.Name == "" {
+		return nil, "The room name is required."
+	}
+	seats, err := strconv.Atoi(r.FormValue("seats"))
+	if err != nil || seats < 1 {
+		return nil, "The number of seats must be a positive number."
+	}
+	room.Seats = seats
+	return room, ""
+}
+
+func (a *Application) HandleAdminAddRoom(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	room, invalid := parseRoomForm(r)
+	if invalid != "" {
+		redirectToRooms(w, r, "error", invalid)
+		return
+	}
+	if err := a.DB.AddRoom(r.Context(), room); err != nil {
+		a.Log.Err(err).Msg("failed to add room")
+		redirectToRooms(w, r, "error", "Failed to add the room. Room names must be unique.")
+		return
+	}
+	redirectToRooms(w, r, "", "")
+}
+
+func (a *Application) HandleAdminUpdateRoom(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	room, invalid := parseRoomForm(r)
+	if invalid != "" {
+		redirectToRooms(w, r, "error", invalid)
+		return
+	}
+	var err error
+	if room.ID, err = strconv.ParseInt(r.FormValue("id"), 10, 64); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.UpdateRoom(r.Context(), room); err != nil {
+		a.Log.Err(err).Msg("failed to update room")
+		redirectToRooms(w, r, "error", "Failed to update the room. Room names must be unique.")
+		return
+	}
+	redirectToRooms(w, r, "", "")
+}
+
+func (a *Application) HandleAdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	roomID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.DeleteRoom(r.Context(), roomID); err != nil {
+		a.Log.Err(err).Msg("failed to delete room")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	redirectToRooms(w, r, "", "")
+}
+
+// HandleAdminAssignSeats automatically assigns seats to all of the in-person
+// teams that were not manually seated.
+func (a *Application) HandleAdminAssignSeats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "admin_assign_seats").Logger()
+	if err := r.ParseForm(); err != nil {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	schoolSeating := SchoolSeating(r.FormValue("school_seating"))
+	if schoolSeating != SchoolSeatingApart && schoolSeating != SchoolSeatingTogether {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rooms, err := a.DB.GetRooms(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get rooms")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get teams")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	existing, err := a.DB.GetTeamSeats(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get team seats")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	seats, unassigned := assignSeats(teams, rooms, existing, schoolSeating)
+	if err := a.DB.ReplaceAutomaticTeamSeats(ctx, seats); err != nil {
+		log.Err(err).Msg("failed to save team seats")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().
+		Int("assigned", len(seats)).
+		Int("unassigned", len(unassigned)).
+		Str("school_seating", string(schoolSeating)).
+		Msg("assigned seats")
+
+	if len(unassigned) > 0 {
+		redirectToRooms(w, r, "error", fmt.Sprintf("Assigned %d teams, but there were not enough seats for %d teams.", len(seats), len(unassigned)))
+	} else {
+		redirectToRooms(w, r, "message", fmt.Sprintf("Assigned %d teams.", len(seats)))
+	}
+}
+
+// HandleAdminSetTeamSeat manually assigns a team to a seat, or unassigns it if
+// no room is given.
+func (a *Application) HandleAdminSetTeamSeat(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	teamID, err := uuid.Parse(r.FormValue("team_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log := a.Log.With().Str("page_name", "admin_set_team_seat").Stringer("team_id", teamID).Logger()
+
+	if r.FormValue("room_id") == "" {
+		if err := a.DB.ClearTeamSeat(ctx, teamID); err != nil {
+			log.Err(err).Msg("failed to clear team seat")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		redirectToRooms(w, r, "", "")
+		return
+	}
+
+	roomID, err := strconv.ParseInt(r.FormValue("room_id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rooms, err := a.DB.GetRooms(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get rooms")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	roomIdx := slices.IndexFunc(rooms, func(room *database.Room) bool { return room.ID == roomID })
+	if roomIdx < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	seat, err := strconv.Atoi(r.FormValue("seat"))
+	if err != nil || seat < 1 || seat > rooms[roomIdx].Seats {
+		redirectToRooms(w, r, "error", fmt.Sprintf("%s only has seats 1 to %d.", rooms[roomIdx].Name, rooms[roomIdx].Seats))
+		return
+	}
+
+	err = a.DB.SetTeamSeat(ctx, &database.TeamSeat{TeamID: teamID, RoomID: roomID, Seat: seat, Manual: true})
+	if errors.Is(err, database.ErrSeatTaken) {
+		redirectToRooms(w, r, "error", fmt.Sprintf("Seat %d in %s is already taken.", seat, rooms[roomIdx].Name))
+		return
+	} else if err != nil {
+		log.Err(err).Msg("failed to set team seat")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int64("room_id", roomID).Int("seat", seat).Msg("manually assigned seat")
+	redirectToRooms(w, r, "", "")
+}
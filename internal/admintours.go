@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/export"
+)
+
+// adminTourGuide is a volunteer that can be chosen to lead a tour group.
+type adminTourGuide struct {
+	Email    string
+	Selected bool
+}
+
+type adminTourRoster struct {
+	*tourRoster
+	Guides []adminTourGuide
+}
+
+func (a *Application) GetAdminToursTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	rosters, waitlist, err := a.getTourRosters(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get tour rosters")
+		return nil
+	}
+	volunteers, err := a.DB.GetAllVolunteers(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get volunteers")
+		return nil
+	}
+
+	var capacity, onTour int
+	adminRosters := make([]adminTourRoster, len(rosters))
+	for i, roster := range rosters {
+		capacity += roster.Group.Capacity
+		onTour += len(roster.Students)
+		adminRosters[i] = adminTourRoster{tourRoster: roster}
+		for _, email := range volunteers {
+			adminRosters[i].Guides = append(adminRosters[i].Guides, adminTourGuide{
+				Email:    email,
+				Selected: slices.Contains(roster.Group.Guides, email),
+			})
+		}
+	}
+
+	return map[string]any{
+		"Rosters":  adminRosters,
+		"Waitlist": waitlist,
+		"Capacity": capacity,
+		"OnTour":   onTour,
+		"Formats":  export.Formats,
+		"Error":    r.URL.Query().Get("error"),
+		"Message":  r.URL.Query().Get("message"),
+	}
+}
+
+func redirectToTours(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/tours"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// parseTourGroupForm reads the tour group fields that are shared by the add
+// and update forms. If the form is invalid, a message for the admin is
+// returned.
+func parseTourGroupForm(r *http.Request) (*database.TourGroup, string) {
+	group := &database.TourGroup{
+		Name:  strings.TrimSpace(r.FormValue("name")),
+		Time:  strings.TrimSpace(r.FormValue("time")),
+		Notes: strings.TrimSpace(r.FormValue("notes")),
+	}
+	if group.Name == "" {
+		return nil, "The tour group name is required."
+	}
+	capacity, err := strconv.Atoi(r.FormValue("capacity"))
+	if err != nil || capacity < 1 {
+		return nil, "The capacity must be a positive number."
+	}
+	group.Capacity = capacity
+	return group, ""
+}
+
+// refillTourGroups fills the tour groups after they are changed and redirects
+// back to the tours page.
+func (a *Application) refillTourGroups(w http.ResponseWriter, r *http.Request) {
+	placed, _, err := a.assignTourGroups(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to fill tour groups")
+		redirectToTours(w, r, "error", "Saved, but failed to fill the tour groups from the waitlist.")
+	} else if placed > 0 {
+		redirectToTours(w, r, "message", fmt.Sprintf("Moved %d students off of the waitlist.", placed))
+	} else {
+		redirectToTours(w, r, "", "")
+	}
+}
+
+func (a *Application) HandleAdminAddTourGroup(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	group, invalid := parseTourGroupForm(r)
+	if invalid != "" {
+		redirectToTours(w, r, "error", invalid)
+		return
+	}
+	if err := a.DB.AddTourGroup(r.Context(), group); err != nil {
+		a.Log.Err(err).Msg("failed to add tour group")
+		redirectToTours(w, r, "error", "Failed to add the tour group. Tour group names must be unique.")
+		return
+	}
+	a.refillTourGroups(w, r)
+}
+
+func (a *Application) HandleAdminUpdateTourGroup(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	group, invalid := parseTourGroupForm(r)
+	if invalid != "" {
+		redirectToTours(w, r, "error", invalid)
+		return
+	}
+	var err error
+	if group.ID, err = strconv.ParseInt(r.FormValue("id"), 10, 64); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.UpdateTourGroup(r.Context(), group); err != nil {
+		a.Log.Err(err).Msg("failed to update tour group")
+		redirectToTours(w, r, "error", "Failed to update the tour group. Tour group names must be unique.")
+		return
+	}
+	a.refillTourGroups(w, r)
+}
+
+func (a *Application) HandleAdminDeleteTourGroup(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	groupID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.DeleteTourGroup(r.Context(), groupID); err != nil {
+		a.Log.Err(err).Msg("failed to delete tour group")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.refillTourGroups(w, r)
+}
+
+// HandleAdminSetTourGuides sets the volunteers that lead a tour group.
+func (a *Application) HandleAdminSetTourGuides(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	groupID, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	volunteers, err := a.DB.GetAllVolunteers(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get volunteers")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	guides := r.Form["guide"]
+	for _, guide := range guides {
+		if !slices.Contains(volunteers, guide) {
+			redirectToTours(w, r, "error", fmt.Sprintf("%s is not a volunteer.", guide))
+			return
+		}
+	}
+	if err := a.DB.SetTourGuides(ctx, groupID, guides); err != nil {
+		a.Log.Err(err).Msg("failed to set tour guides")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.Log.Info().Int64("group_id", groupID).Strs("guides", guides).Msg("set tour guides")
+	redirectToTours(w, r, "", "")
+}
+
+// HandleAdminAssignTours fills the tour groups from the waitlist, including
+// the students that asked for a tour before there were groups to choose from.
+func (a *Application) HandleAdminAssignTours(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "admin_assign_tours").Logger()
+	added, err := a.DB.AddMissingTourRequests(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to add missing tour requests")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	placed, waitlisted, err := a.assignTourGroups(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to fill tour groups")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int64("added", added).Int("placed", placed).Int("waitlisted", waitlisted).Msg("assigned tour groups")
+
+	if waitlisted > 0 {
+		redirectToTours(w, r, "error", fmt.Sprintf("Placed %d students, but there was no space for %d students.", placed, waitlisted))
+	} else {
+		redirectToTours(w, r, "message", fmt.Sprintf("Placed %d students.", placed))
+	}
+}
+
+// HandleAdminSetStudentTour moves a student to a tour group, even if it is
+// full, or removes them from the tours if no group is given.
+func (a *Application) HandleAdminSetStudentTour(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	email := r.FormValue("email")
+	log := a.Log.With().Str("page_name", "admin_set_student_tour").Str("student_email", email).Logger()
+	tour, err := a.DB.GetStudentTour(ctx, email)
+	if err != nil {
+		log.Err(err).Msg("failed to get student tour")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if tour == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("group_id") == "" {
+		if err := a.DB.CancelStudentTour(ctx, email); err != nil {
+			log.Err(err).Msg("failed to cancel student tour")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Info().Msg("removed student from tours")
+		a.refillTourGroups(w, r)
+		return
+	}
+
+	groupID, err := strconv.ParseInt(r.FormValue("group_id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	groups, err := a.DB.GetTourGroups(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get tour groups")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if !slices.ContainsFunc(groups, func(g *database.TourGroup) bool { return g.ID == groupID }) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.SetStudentTourGroup(ctx, email, groupID); err != nil {
+		log.Err(err).Msg("failed to set student tour group")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int64("group_id", groupID).Msg("manually moved student to tour group")
+	a.refillTourGroups(w, r)
+}
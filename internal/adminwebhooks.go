@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// adminWebhookDeliveryLogSize is the number of recent deliveries that are shown
+// in the delivery log.
+const adminWebhookDeliveryLogSize = 100
+
+func (a *Application) GetAdminWebhooksTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	webhooks, err := a.DB.GetWebhooks(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get webhooks")
+		return nil
+	}
+	deliveries, err := a.DB.GetRecentWebhookDeliveries(ctx, adminWebhookDeliveryLogSize)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get webhook deliveries")
+		return nil
+	}
+	return map[string]any{
+		"Webhooks":   webhooks,
+		"EventTypes": database.WebhookEventTypes,
+		"Deliveries": deliveries,
+		"Error":      r.URL.Query().Get("error"),
+		"Message":    r.URL.Query().Get("message"),
+	}
+}
+
+func redirectToWebhooks(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/webhooks"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (a *Application) HandleAdminAddWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	webhookURL := strings.TrimSpace(r.FormValue("url"))
+	if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		redirectToWebhooks(w, r, "error", "The URL must be a full http or https URL.")
+		return
+	}
+	var events []database.WebhookEventType
+	for _, event := range r.Form["event"] {
+		if !slices.Contains(database.WebhookEventTypes, database.WebhookEventType(event)) {
+			redirectToWebhooks(w, r, "error", "Unknown event type "+event+".")
+			return
+		}
+		events = append(events, database.WebhookEventType(event))
+	}
+	if len(events) == 0 {
+		redirectToWebhooks(w, r, "error", "Choose at least one event type.")
+		return
+	}
+	secret := strings.TrimSpace(r.FormValue("secret"))
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			a.Log.Err(err).Msg("failed to generate webhook secret")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	webhook := &database.Webhook{
+		URL:         webhookURL,
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Events:      events,
+		Secret:      secret,
+		CreatedBy:   a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin),
+	}
+	if err := a.DB.AddWebhook(r.Context(), webhook); err != nil {
+		a.Log.Err(err).Msg("failed to add webhook")
+		redirectToWebhooks(w, r, "error", "Failed to add the webhook.")
+		return
+	}
+	a.Log.Info().Int64("webhook_id", webhook.ID).Str("url", webhookURL).Msg("added webhook")
+	redirectToWebhooks(w, r, "message", "Added the webhook. Send a test event to check that the receiver works.")
+}
+
+// parseWebhookFormID reads the ID form value that is used by all of the
+// buttons on the webhooks page.
+func (a *Application) parseWebhookFormID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (a *Application) HandleAdminSetWebhookDisabled(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.parseWebhookFormID(w, r)
+	if !ok {
+		return
+	}
+	disabled := r.FormValue("disabled") == "true"
+	if err := a.DB.SetWebhookDisabled(r.Context(), id, disabled); err != nil {
+		a.Log.Err(err).Int64("webhook_id", id).Msg("failed to set webhook disabled")
+		redirectToWebhooks(w, r, "error", "Failed to update the webhook.")
+		return
+	}
+	redirectToWebhooks(w, r, "", "")
+}
+
+func (a *Application) HandleAdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.parseWebhookFormID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteWebhook(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("webhook_id", id).Msg("failed to delete webhook")
+		redirectToWebhooks(w, r, "error", "Failed to delete the webhook.")
+		return
+	}
+	a.Log.Info().Int64("webhook_id", id).Msg("deleted webhook")
+	redirectToWebhooks(w, r, "", "")
+}
+
+func (a *Application) HandleAdminPingWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.parseWebhookFormID(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := a.DB.GetWebhook(r.Context(), id)
+	if err != nil {
+		a.Log.Err(err).Int64("webhook_id", id).Msg("failed to get webhook")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if webhook == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	a.Webhooks.Ping(r.Context(), webhook)
+	redirectToWebhooks(w, r, "message", "Queued a test event. Refresh to see the result in the delivery log.")
+}
+
+func (a *Application) HandleAdminRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := a.parseWebhookFormID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.RetryWebhookDelivery(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("delivery_id", id).Msg("failed to retry webhook delivery")
+		redirectToWebhooks(w, r, "error", "Failed to queue the delivery.")
+		return
+	}
+	a.Webhooks.Wake()
+	redirectToWebhooks(w, r, "message", "Queued the delivery to be sent again.")
+}
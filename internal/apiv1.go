@@ -0,0 +1,472 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// The v1 API is a read-only JSON API for scripts, such as the ones used for
+// judging and prizes. It is authenticated with API tokens that admins issue on
+// the API tokens page, rather than with the admin_token cookie.
+
+// apiTokenPrefix makes API tokens easy to recognize, for example by secret
+// scanners.
+const apiTokenPrefix = "hspc_"
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 500
+)
+
+// generateAPIToken returns a new random API token and the hash of it that is
+// stored in the database.
+func generateAPIToken() (token, tokenHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashAPIToken(token), nil
+}
+
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
+
+func writeAPIError(log zerolog.Logger, w http.ResponseWriter, status int, message string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	}
+	writeJSON(log, w, status, APIError{Error: message})
+}
+
+// APITokenAuthMiddleware only calls the handler if the request has an active
+// API token with the scope in its Authorization header.
+func (a *Application) APITokenAuthMiddleware(scope database.APIScope, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := a.Log.With().Str("page_name", "api_v1").Str("path", r.URL.Path).Logger()
+
+		tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || tokenStr == "" {
+			writeAPIError(log, w, http.StatusUnauthorized, "missing API token")
+			return
+		}
+		token, err := a.DB.GetAPITokenByHash(r.Context(), hashAPIToken(strings.TrimSpace(tokenStr)))
+		if err != nil {
+			log.Err(err).Msg("failed to get API token")
+			writeAPIError(log, w, http.StatusInternalServerError, "internal server error")
+			return
+		} else if token == nil {
+			writeAPIError(log, w, http.StatusUnauthorized, "invalid API token")
+			return
+		} else if token.Revoked() {
+			writeAPIError(log, w, http.StatusUnauthorized, "API token has been revoked")
+			return
+		} else if token.Expired() {
+			writeAPIError(log, w, http.StatusUnauthorized, "API token has expired")
+			return
+		} else if !token.HasScope(scope) {
+			writeAPIError(log, w, http.StatusForbidden, fmt.Sprintf("API token does not have the %s scope", scope))
+			return
+		}
+
+		if err := a.DB.MarkAPITokenUsed(r.Context(), token.ID); err != nil {
+			log.Warn().Err(err).Int64("token_id", token.ID).Msg("failed to mark API token as used")
+		}
+		next(w, r)
+	})
+}
+
+type APIPagination struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	// Total is the number of items that match the filters on all pages.
+	Total int `json:"total"`
+}
+
+type APIList[T any] struct {
+	Data       []T           `json:"data"`
+	Pagination APIPagination `json:"pagination"`
+}
+
+// parsePagination reads the limit and offset query parameters.
+func parsePagination(query url.Values) (offset, limit int, err error) {
+	limit = apiDefaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > apiMaxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", apiMaxLimit)
+		}
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return offset, limit, nil
+}
+
+func paginate[T any](items []T, offset, limit int) APIList[T] {
+	list := APIList[T]{
+		Data:       []T{},
+		Pagination: APIPagination{Offset: offset, Limit: limit, Total: len(items)},
+	}
+	if offset < len(items) {
+		list.Data = items[offset:min(offset+limit, len(items))]
+	}
+	return list
+}
+
+// serveAPIList writes the requested page of the dataset's rows that match the
+// dataset's filters and the extra match function, if any.
+func serveAPIList[T, R any](log zerolog.Logger, w http.ResponseWriter, r *http.Request, dataset *exportDataset[T], match func(T) bool, convert func(T) R) {
+	query := r.URL.Query()
+	offset, limit, err := parsePagination(query)
+	if err != nil {
+		writeAPIError(log, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filterValues := map[string]string{}
+	for _, filter := range dataset.filters {
+		filterValues[filter.Key] = query.Get(filter.Key)
+	}
+
+	rows, err := dataset.filterRows(r.Context(), filterValues)
+	if errors.Is(err, errInvalidExportRequest) {
+		writeAPIError(log, w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		log.Err(err).Msg("failed to get rows")
+		writeAPIError(log, w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	var items []R
+	for _, row := range rows {
+		if match == nil || match(row) {
+			items = append(items, convert(row))
+		}
+	}
+	writeJSON(log, w, http.StatusOK, paginate(items, offset, limit))
+}
+
+type APIStudent struct {
+	Email                   string     `json:"email"`
+	Name                    string     `json:"name"`
+	Age                     int        `json:"age"`
+	TeamID                  uuid.UUID  `json:"team_id"`
+	FirstTime               bool       `json:"first_time"`
+	EmailConfirmed          bool       `json:"email_confirmed"`
+	LiabilitySigned         bool       `json:"liability_signed"`
+	ComputerUseWaiverSigned bool       `json:"computer_use_waiver_signed"`
+	CampusTour              bool       `json:"campus_tour"`
+	DietaryRestrictions     string     `json:"dietary_restrictions"`
+	CheckedIn               bool       `json:"checked_in"`
+	CheckedInAt             *time.Time `json:"checked_in_at"`
+}
+
+func newAPIStudent(student *database.Student) APIStudent {
+	apiStudent := APIStudent{
+		Email:                   student.Email,
+		Name:                    student.Name,
+		Age:                     student.Age,
+		TeamID:                  student.TeamID,
+		FirstTime:               !student.PreviouslyParticipated,
+		EmailConfirmed:          student.EmailConfirmed,
+		LiabilitySigned:         student.LiabilitySigned,
+		ComputerUseWaiverSigned: student.ComputerUseWaiverSigned,
+		CampusTour:              student.CampusTour,
+		DietaryRestrictions:     student.DietaryRestrictions,
+		CheckedIn:               student.CheckedIn,
+	}
+	if student.CheckedIn && !student.CheckedInTS.IsZero() {
+		apiStudent.CheckedInAt = &student.CheckedInTS
+	}
+	return apiStudent
+}
+
+type APITeam struct {
+	ID           uuid.UUID    `json:"id"`
+	Name         string       `json:"name"`
+	Division     string       `json:"division"`
+	InPerson     bool         `json:"in_person"`
+	FirstTime    bool         `json:"first_time"`
+	School       string       `json:"school"`
+	TeacherName  string       `json:"teacher_name"`
+	TeacherEmail string       `json:"teacher_email"`
+	Room         string       `json:"room,omitempty"`
+	Seat         int          `json:"seat,omitempty"`
+	RegisteredAt time.Time    `json:"registered_at"`
+	Members      []APIStudent `json:"members"`
+}
+
+func newAPITeam(team *exportTeam) APITeam {
+	apiTeam := APITeam{
+		ID:           team.ID,
+		Name:         team.Name,
+		Division:     string(team.Division),
+		InPerson:     team.InPerson,
+		FirstTime:    team.firstTime(),
+		School:       team.SchoolName,
+		TeacherName:  team.TeacherName,
+		TeacherEmail: team.TeacherEmail,
+		RegisteredAt: team.RegistrationTS,
+		Members:      make([]APIStudent, len(team.Members)),
+	}
+	if team.Seat != nil {
+		apiTeam.Room = team.Seat.RoomName
+		apiTeam.Seat = team.Seat.Seat
+	}
+	for i := range team.Members {
+		apiTeam.Members[i] = newAPIStudent(&team.Members[i])
+	}
+	return apiTeam
+}
+
+type APIStudentWithTeam struct {
+	APIStudent
+	TeamName string `json:"team_name"`
+	Division string `json:"division"`
+	InPerson bool   `json:"in_person"`
+	School   string `json:"school"`
+}
+
+type APITeacher struct {
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	EmailConfirmed bool   `json:"email_confirmed"`
+	School         string `json:"school"`
+	City           string `json:"city"`
+	State          string `json:"state"`
+}
+
+type APISchool struct {
+	Name     string `json:"name"`
+	City     string `json:"city"`
+	State    string `json:"state"`
+	Teachers int    `json:"teachers"`
+	Teams    int    `json:"teams"`
+	Students int    `json:"students"`
+}
+
+type APIStats struct {
+	LiveCounts
+	Divisions map[database.Division]LiveCounts `json:"divisions"`
+}
+
+type APICheckIn struct {
+	ID           int64     `json:"id"`
+	StudentEmail string    `json:"student_email"`
+	StudentName  string    `json:"student_name"`
+	TeamName     string    `json:"team_name"`
+	Direction    string    `json:"direction"`
+	Time         time.Time `json:"time"`
+	Volunteer    string    `json:"volunteer"`
+	Station      string    `json:"station"`
+}
+
+func (a *Application) HandleAPITeams(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_teams").Logger()
+	serveAPIList(log, w, r, a.teamsExportDataset(), nil, newAPITeam)
+}
+
+func (a *Application) HandleAPITeam(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_team").Logger()
+	teamID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(log, w, http.StatusNotFound, "team not found")
+		return
+	}
+	teams, err := a.getExportTeams(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to get teams")
+		writeAPIError(log, w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	i := slices.IndexFunc(teams, func(t *exportTeam) bool { return t.ID == teamID })
+	if i < 0 {
+		writeAPIError(log, w, http.StatusNotFound, "team not found")
+		return
+	}
+	writeJSON(log, w, http.StatusOK, newAPITeam(teams[i]))
+}
+
+// HandleAPIStudents lists the students. In addition to the student export
+// filters, the team_id query parameter only lists the members of that team.
+func (a *Application) HandleAPIStudents(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_students").Logger()
+	var match func(*exportStudent) bool
+	if teamIDStr := r.URL.Query().Get("team_id"); teamIDStr != "" {
+		teamID, err := uuid.Parse(teamIDStr)
+		if err != nil {
+			writeAPIError(log, w, http.StatusBadRequest, "invalid team_id")
+			return
+		}
+		match = func(s *exportStudent) bool { return s.TeamID == teamID }
+	}
+	serveAPIList(log, w, r, a.studentsExportDataset(), match, func(s *exportStudent) APIStudentWithTeam {
+		return APIStudentWithTeam{
+			APIStudent: newAPIStudent(s.Student),
+			TeamName:   s.Team.Name,
+			Division:   string(s.Team.Division),
+			InPerson:   s.Team.InPerson,
+			School:     s.Team.SchoolName,
+		}
+	})
+}
+
+func (a *Application) HandleAPITeachers(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_teachers").Logger()
+	serveAPIList(log, w, r, a.teachersExportDataset(), nil, func(t *database.Teacher) APITeacher {
+		return APITeacher{
+			Name:           t.Name,
+			Email:          t.Email,
+			EmailConfirmed: t.EmailConfirmed,
+			School:         t.SchoolName,
+			City:           t.SchoolCity,
+			State:          t.SchoolState,
+		}
+	})
+}
+
+// getAPISchools groups the teachers by school. Schools are the same if their
+// name, city and state only differ in case and surrounding whitespace.
+func (a *Application) getAPISchools(ctx context.Context) ([]*APISchool, error) {
+	teachers, err := a.DB.GetAllTeachers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	normalize := func(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+	schoolsByKey := map[string]*APISchool{}
+	teacherSchools := map[string]*APISchool{}
+	var schools []*APISchool
+	for _, teacher := range teachers {
+		if strings.TrimSpace(teacher.SchoolName) == "" {
+			continue
+		}
+		key := normalize(teacher.SchoolName) + "\x00" + normalize(teacher.SchoolCity) + "\x00" + normalize(teacher.SchoolState)
+		school, ok := schoolsByKey[key]
+		if !ok {
+			school = &APISchool{
+				Name:  strings.TrimSpace(teacher.SchoolName),
+				City:  strings.TrimSpace(teacher.SchoolCity),
+				State: strings.TrimSpace(teacher.SchoolState),
+			}
+			schoolsByKey[key] = school
+			schools = append(schools, school)
+		}
+		school.Teachers++
+		teacherSchools[teacher.Email] = school
+	}
+	for _, team := range teams {
+		if school, ok := teacherSchools[team.TeacherEmail]; ok {
+			school.Teams++
+			school.Students += len(team.Members)
+		}
+	}
+	slices.SortFunc(schools, func(a, b *APISchool) int {
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)),
+			cmp.Compare(strings.ToLower(a.City), strings.ToLower(b.City)),
+		)
+	})
+	return schools, nil
+}
+
+func (a *Application) HandleAPISchools(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_schools").Logger()
+	offset, limit, err := parsePagination(r.URL.Query())
+	if err != nil {
+		writeAPIError(log, w, http.StatusBadRequest, err.Error())
+		return
+	}
+	schools, err := a.getAPISchools(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to get schools")
+		writeAPIError(log, w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	writeJSON(log, w, http.StatusOK, paginate(schools, offset, limit))
+}
+
+func (a *Application) HandleAPIStats(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_stats").Logger()
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to get teams")
+		writeAPIError(log, w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	stats := APIStats{
+		LiveCounts: countLiveStats(teams),
+		Divisions:  map[database.Division]LiveCounts{},
+	}
+	for _, division := range []database.Division{database.DivisionBeginner, database.DivisionAdvanced} {
+		stats.Divisions[division] = countLiveStats(slices.DeleteFunc(slices.Clone(teams), func(t *database.TeamWithTeacherName) bool {
+			return t.Division != division
+		}))
+	}
+	writeJSON(log, w, http.StatusOK, stats)
+}
+
+// HandleAPICheckIns lists the check-in events, newest first. In addition to
+// the direction filter, the student_email query parameter only lists the
+// events of one student and the since query parameter (RFC 3339) only lists
+// the events after that time.
+func (a *Application) HandleAPICheckIns(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "api_v1_checkins").Logger()
+	query := r.URL.Query()
+	studentEmail := query.Get("student_email")
+	var since time.Time
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, sinceStr); err != nil {
+			writeAPIError(log, w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+	}
+	match := func(e *database.CheckInEventWithStudent) bool {
+		return (studentEmail == "" || strings.EqualFold(e.StudentEmail, studentEmail)) &&
+			(since.IsZero() || e.TS.After(since))
+	}
+	serveAPIList(log, w, r, a.checkInsExportDataset(), match, func(e *database.CheckInEventWithStudent) APICheckIn {
+		return APICheckIn{
+			ID:           e.ID,
+			StudentEmail: e.StudentEmail,
+			StudentName:  e.StudentName,
+			TeamName:     e.TeamName,
+			Direction:    string(e.Direction),
+			Time:         e.TS,
+			Volunteer:    e.Volunteer,
+			Station:      e.Station,
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func addTestAPIToken(t *testing.T, a *Application, expiresTS time.Time, scopes ...database.APIScope) (string, *database.APIToken) {
+	t.Helper()
+	tokenStr, tokenHash, err := generateAPIToken()
+	require.NoError(t, err)
+	token := &database.APIToken{Name: "Test", TokenHash: tokenHash, Scopes: scopes, CreatedBy: "admin@example.com", ExpiresTS: expiresTS}
+	require.NoError(t, a.DB.CreateAPIToken(context.Background(), token))
+	return tokenStr, token
+}
+
+func doAPIRequest(router http.Handler, path, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIv1_Auth(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+
+	teamsToken, teamsAPIToken := addTestAPIToken(t, a, time.Time{}, database.APIScopeTeams)
+	expiredToken, _ := addTestAPIToken(t, a, time.Now().Add(-time.Minute), database.APIScopeTeams)
+	revokedToken, revokedAPIToken := addTestAPIToken(t, a, time.Time{}, database.APIScopeTeams)
+	require.NoError(t, a.DB.RevokeAPIToken(ctx, revokedAPIToken.ID))
+
+	for _, token := range []string{"", "hspc_wrong", expiredToken, revokedToken} {
+		rec := doAPIRequest(router, "/api/v1/teams", token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, token)
+		assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	}
+	// The admin cookie does not work for the API.
+	rec := doRequest(router, http.MethodGet, "/api/v1/teams", &http.Cookie{Name: "admin_token", Value: adminToken(t)})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	assert.Equal(t, http.StatusForbidden, doAPIRequest(router, "/api/v1/students", teamsToken).Code)
+	assert.Equal(t, http.StatusOK, doAPIRequest(router, "/api/v1/teams", teamsToken).Code)
+
+	tokens, err := a.DB.GetAPITokens(ctx)
+	require.NoError(t, err)
+	for _, token := range tokens {
+		if token.ID == teamsAPIToken.ID {
+			assert.False(t, token.LastUsedTS.IsZero())
+		} else {
+			assert.True(t, token.LastUsedTS.IsZero())
+		}
+	}
+}
+
+func TestAPIv1_Data(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teamID, _ := addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", true, "Vegetarian", "parent@example.com"))
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Returning", 17, "returning@example.com", true))
+	remoteTeamID := uuid.New()
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", remoteTeamID, "Remote Team", database.DivisionAdvanced, false, "", ""))
+	require.NoError(t, a.DB.AddTeamMember(ctx, remoteTeamID, "Remote", 18, "remote@example.com", false))
+	_, err := a.DB.CheckInStudent(ctx, "student@example.com", time.Now().Add(-time.Hour), "volunteer@example.com", "kiosk")
+	require.NoError(t, err)
+	router := a.BuildRouter()
+	token, _ := addTestAPIToken(t, a, time.Now().Add(time.Hour), database.APIScopes...)
+
+	get := func(path string, v any) {
+		t.Helper()
+		rec := doAPIRequest(router, path, token)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), path)
+	}
+
+	var teams APIList[APITeam]
+	get("/api/v1/teams", &teams)
+	require.Len(t, teams.Data, 2)
+	assert.Equal(t, APIPagination{Offset: 0, Limit: apiDefaultLimit, Total: 2}, teams.Pagination)
+	assert.Equal(t, "Remote Team", teams.Data[0].Name)
+	assert.Equal(t, "Team", teams.Data[1].Name)
+	require.Len(t, teams.Data[1].Members, 2)
+
+	get("/api/v1/teams?limit=1&offset=1", &teams)
+	require.Len(t, teams.Data, 1)
+	assert.Equal(t, "Team", teams.Data[0].Name)
+	assert.Equal(t, APIPagination{Offset: 1, Limit: 1, Total: 2}, teams.Pagination)
+
+	get("/api/v1/teams?in_person=no", &teams)
+	require.Len(t, teams.Data, 1)
+	assert.Equal(t, remoteTeamID, teams.Data[0].ID)
+
+	var team APITeam
+	get("/api/v1/teams/"+teamID.String(), &team)
+	assert.Equal(t, "Beginner", team.Division)
+	assert.False(t, team.FirstTime)
+
+	var students APIList[APIStudentWithTeam]
+	get("/api/v1/students?team_id="+teamID.String()+"&first_time=yes", &students)
+	require.Len(t, students.Data, 1)
+	assert.Equal(t, "student@example.com", students.Data[0].Email)
+	assert.Equal(t, "Vegetarian", students.Data[0].DietaryRestrictions)
+	assert.True(t, students.Data[0].CheckedIn)
+	assert.NotNil(t, students.Data[0].CheckedInAt)
+	rec := doAPIRequest(router, "/api/v1/students", token)
+	assert.NotContains(t, rec.Body.String(), "parent@example.com")
+
+	var teachers APIList[APITeacher]
+	get("/api/v1/teachers", &teachers)
+	require.Len(t, teachers.Data, 1)
+	assert.Equal(t, "Golden", teachers.Data[0].City)
+
+	var schools APIList[APISchool]
+	get("/api/v1/schools", &schools)
+	assert.Equal(t, []APISchool{{Name: "School", City: "Golden", State: "CO", Teachers: 1, Teams: 2, Students: 3}}, schools.Data)
+
+	var stats APIStats
+	get("/api/v1/stats", &stats)
+	assert.Equal(t, 2, stats.Teams)
+	assert.Equal(t, 3, stats.Students)
+	assert.Equal(t, 1, stats.OnSite)
+	assert.Equal(t, 2, stats.Divisions[database.DivisionBeginner].Students)
+	assert.Equal(t, 1, stats.Divisions[database.DivisionAdvanced].Students)
+
+	var checkIns APIList[APICheckIn]
+	get("/api/v1/checkins?direction=in&student_email=student@example.com", &checkIns)
+	require.Len(t, checkIns.Data, 1)
+	assert.Equal(t, "kiosk", checkIns.Data[0].Station)
+	get("/api/v1/checkins?since="+url.QueryEscape(time.Now().Format(time.RFC3339)), &checkIns)
+	assert.Empty(t, checkIns.Data)
+
+	for path, code := range map[string]int{
+		"/api/v1/teams?limit=0":                http.StatusBadRequest,
+		"/api/v1/teams?limit=501":              http.StatusBadRequest,
+		"/api/v1/teams?offset=-1":              http.StatusBadRequest,
+		"/api/v1/teams?division=Expert":        http.StatusBadRequest,
+		"/api/v1/students?team_id=nope":        http.StatusBadRequest,
+		"/api/v1/checkins?since=yesterday":     http.StatusBadRequest,
+		"/api/v1/teams/" + uuid.NewString():    http.StatusNotFound,
+		"/api/v1/teams?offset=10":              http.StatusOK,
+		"/api/v1/students?division=Advanced":   http.StatusOK,
+		"/api/v1/teachers?email_confirmed=yes": http.StatusOK,
+	} {
+		assert.Equal(t, code, doAPIRequest(router, path, token).Code, path)
+	}
+}
+
+func TestAdminAPITokens(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/admin/apitokens/create", url.Values{"name": {"Judging"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Choose at least one scope.")
+	rec = post("/admin/apitokens/create", url.Values{"name": {"Judging"}, "scope": {"teams:write"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post("/admin/apitokens/create", url.Values{"name": {"Judging"}, "scope": {"teams:read", "stats:read"}, "expires_days": {"7"}})
+	require.Equal(t, http.StatusOK, rec.Code)
+	tokens, err := a.DB.GetAPITokens(ctx)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, []database.APIScope{database.APIScopeTeams, database.APIScopeStats}, tokens[0].Scopes)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 7), tokens[0].ExpiresTS, time.Minute)
+	assert.Equal(t, "test@example.com", tokens[0].CreatedBy)
+
+	// The token is only shown once, on the page that created it.
+	match := regexp.MustCompile(`<code class="user-select-all">(hspc_[\w-]+)</code>`).FindStringSubmatch(rec.Body.String())
+	require.Len(t, match, 2)
+	tokenStr := match[1]
+	assert.Equal(t, tokens[0].TokenHash, hashAPIToken(tokenStr))
+	assert.Equal(t, http.StatusOK, doAPIRequest(router, "/api/v1/stats", tokenStr).Code)
+	assert.NotContains(t, doRequest(router, http.MethodGet, "/admin/apitokens", cookie).Body.String(), tokenStr)
+
+	rec = post("/admin/apitokens/revoke", url.Values{"id": {"1"}})
+	assertRedirectsTo(t, rec, "/admin/apitokens")
+	assert.Equal(t, http.StatusUnauthorized, doAPIRequest(router, "/api/v1/stats", tokenStr).Code)
+}
@@ -1,12 +1,15 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"maps"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
@@ -14,6 +17,7 @@ import (
 
 	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
 	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/config"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
 	"github.com/ColoradoSchoolOfMines/mineshspc.com/website"
 )
 
@@ -29,19 +33,45 @@ type Application struct {
 	TeacherLoginRenderer          func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
 	EmailLoginRenderer            func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
 	StudentConfirmInfoRenderer    func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
+	StudentProfileRenderer        func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
 	TeamAddMemberRenderer         func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
+	TeamEditRenderer              func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
 
 	TeacherCreateAccountRenderer func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
+	SurveyRenderer               func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
+
+	AdminAPITokensRenderer func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
+	AdminResultsRenderer   func(w http.ResponseWriter, r *http.Request, extraData map[string]any)
 
 	SendGridClient *sendgrid.Client
+	Captcha        CaptchaVerifier
+	Live           *LiveHub
+	Webhooks       *WebhookDispatcher
+
+	// tourLock keeps students from being put in the same spot on a tour when
+	// the tour groups are filled at the same time.
+	tourLock sync.Mutex
+	// sendingCertificates and sendingSurveys are set while the certificates or
+	// survey invitations are being emailed in the background, so that a second
+	// send can't email everyone again before the first has marked who it sent
+	// to.
+	sendingCertificates atomic.Bool
+	sendingSurveys      atomic.Bool
 }
 
 func NewApplication(log *zerolog.Logger, config config.Configuration, db *database.Database) *Application {
+	captcha, err := NewCaptchaVerifier(config.GetCaptchaConfig(), config.DevMode)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid captcha configuration")
+	}
 	return &Application{
 		Log:        log,
 		DB:         db,
 		EmailRegex: regexp.MustCompile(`(?i)^[A-Z0-9._%+-]+@[A-Z0-9.-]+\.[A-Z]{2,}$`),
 		Config:     config,
+		Captcha:    captcha,
+		Live:       NewLiveHub(),
+		Webhooks:   NewWebhookDispatcher(log, db),
 	}
 }
 
@@ -55,12 +85,13 @@ func (a *Application) ServeTemplate(logger *zerolog.Logger, templateName string,
 func (a *Application) ServeTemplateExtra(logger *zerolog.Logger, templateName string, generateTemplateData func(r *http.Request) map[string]any) func(w http.ResponseWriter, r *http.Request, extraData map[string]any) {
 	log := logger.With().Str("page_name", templateName).Logger()
 
-	template, err := template.ParseFS(website.TemplateFS, "templates/base.html", "templates/partials/*", fmt.Sprintf("templates/%s", templateName))
+	template, err := template.New(templateName).Funcs(i18n.FuncMap).ParseFS(website.TemplateFS, "templates/base.html", "templates/partials/*", fmt.Sprintf("templates/%s", templateName))
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to parse template")
 	}
 
 	parts := strings.Split(templateName, ".")
+	localized := localizedTemplates[templateName]
 
 	return func(w http.ResponseWriter, r *http.Request, extraData map[string]any) {
 		data := generateTemplateData(r)
@@ -73,11 +104,21 @@ func (a *Application) ServeTemplateExtra(logger *zerolog.Logger, templateName st
 			data["Username"] = user.Name
 		}
 
+		locale := i18n.Default
+		if localized {
+			rememberLocale(w, r)
+			locale = requestLocale(r)
+		}
+
 		templateData := map[string]any{
 			"PageName":            parts[0],
 			"Data":                data,
 			"HostedByHTML":        a.Config.HostedByHTML,
 			"RegistrationEnabled": a.Config.RegistrationEnabled,
+			"Locale":              locale,
+		}
+		if localized {
+			templateData["LocaleLinks"] = localeLinks(r, locale)
 		}
 		if err := template.ExecuteTemplate(w, "base.html", templateData); err != nil {
 			log.Err(err).Msg("Failed to execute the template")
@@ -144,18 +185,21 @@ func (a *Application) BuildRouter() http.Handler {
 
 	a.EmailLoginRenderer = a.ServeTemplateExtra(a.Log, "emaillogin.html", a.GetEmailLoginTemplate)
 	a.StudentConfirmInfoRenderer = a.ServeTemplateExtra(a.Log, "student.html", a.GetStudentConfirmInfoTemplate)
+	a.StudentProfileRenderer = a.ServeTemplateExtra(a.Log, "studentprofile.html", a.GetStudentProfileTemplate)
 	a.TeamAddMemberRenderer = a.ServeTemplateExtra(a.Log, "teamaddmember.html", a.GetTeacherAddMemberTemplate)
+	a.TeamEditRenderer = a.ServeTemplateExtra(a.Log, "teamedit.html", a.GetTeacherTeamEditTemplate)
 	registrationPages := map[string]renderInfo{
 		"/register/teacher/confirmemail":   {a.ConfirmEmailRenderer, true},
 		"/register/teacher/createaccount":  {a.TeacherCreateAccountRenderer, true},
 		"/register/teacher/login":          {a.TeacherLoginRenderer, true},
 		"/register/teacher/schoolinfo":     {a.ServeTemplateExtra(a.Log, "schoolinfo.html", a.GetTeacherSchoolInfoTemplate), false},
 		"/register/teacher/teams":          {a.ServeTemplateExtra(a.Log, "teams.html", a.GetTeacherTeamsTemplate), false},
-		"/register/teacher/team/edit":      {a.ServeTemplateExtra(a.Log, "teamedit.html", a.GetTeacherTeamEditTemplate), false},
+		"/register/teacher/team/edit":      {a.TeamEditRenderer, false},
 		"/register/teacher/team/addmember": {a.TeamAddMemberRenderer, false},
 
 		// Student
 		"/register/student/confirminfo": {a.StudentConfirmInfoRenderer, false},
+		"/register/student/profile":     {a.StudentProfileRenderer, false},
 
 		// Parent
 		"/register/parent/signforms": {a.ServeTemplateExtra(a.Log, "parent.html", a.GetParentSignFormsTemplate), false},
@@ -195,6 +239,26 @@ func (a *Application) BuildRouter() http.Handler {
 	// Delete Team member
 	router.HandleFunc("POST /register/teacher/team/delete", a.HandleTeacherDeleteMember)
 
+	// Withdraw Team
+	router.HandleFunc("POST /register/teacher/team/withdraw", a.HandleTeacherWithdrawTeam)
+
+	// Resend registration emails to a team member
+	router.HandleFunc("POST /register/teacher/team/resend", a.HandleTeacherResendEmail)
+
+	// Register the teacher and their chaperones to come to campus
+	router.HandleFunc("POST /register/teacher/attendance", a.HandleTeacherAttendance)
+	router.HandleFunc("POST /register/teacher/chaperone/add", a.HandleTeacherAddChaperone)
+	router.HandleFunc("POST /register/teacher/chaperone/remove", a.HandleTeacherRemoveChaperone)
+	router.HandleFunc("GET /register/teacher/chaperone/ticket", a.HandleTeacherChaperoneTicket)
+
+	// Download the certificates for all of the teacher's students
+	router.HandleFunc("GET /register/teacher/certificates", a.HandleTeacherCertificates)
+
+	// Post-competition feedback survey
+	a.SurveyRenderer = a.ServeTemplateExtra(a.Log, "survey.html", a.GetSurveyTemplate)
+	router.HandleFunc("GET /survey", func(w http.ResponseWriter, r *http.Request) { a.SurveyRenderer(w, r, nil) })
+	router.HandleFunc("POST /survey", a.HandleSurvey)
+
 	// Email confirmation code handling
 	router.HandleFunc("GET /register/teacher/emaillogin", a.HandleTeacherEmailLogin)
 
@@ -209,6 +273,8 @@ func (a *Application) BuildRouter() http.Handler {
 		"/register/teacher/team/edit":      a.HandleTeacherTeamEdit,
 		"/register/teacher/team/addmember": a.HandleTeacherAddMember,
 		"/register/student/confirminfo":    a.HandleStudentConfirmEmail,
+		"/register/student/profile":        a.HandleStudentProfile,
+		"/register/student/withdraw":       a.HandleStudentWithdraw,
 		"/register/parent/signforms":       a.HandleParentSignForms,
 	}
 	for path, fn := range formHandlers {
@@ -226,16 +292,87 @@ func (a *Application) BuildRouter() http.Handler {
 	router.HandleFunc("POST /admin/emaillogin", a.HandleAdminLogin)
 
 	// Admin pages (protected) — subrouter consolidates all protected admin routes
+	a.AdminAPITokensRenderer = a.ServeTemplateExtra(a.Log, "adminapitokens.html", a.GetAdminAPITokensTemplate)
+	a.AdminResultsRenderer = a.ServeTemplateExtra(a.Log, "adminresults.html", a.GetAdminResultsTemplate)
 	adminRouter := http.NewServeMux()
 	adminRouter.HandleFunc("GET /{$}", a.ServeTemplate(a.Log, "adminhome.html", noArgs))
+	adminRouter.HandleFunc("GET /checkins", a.ServeTemplate(a.Log, "admincheckins.html", a.GetAdminCheckInsTemplate))
+	adminRouter.HandleFunc("GET /live", a.ServeTemplate(a.Log, "adminlive.html", a.GetAdminLiveTemplate))
+	adminRouter.HandleFunc("GET /exports", a.ServeTemplate(a.Log, "adminexports.html", a.GetAdminExportsTemplate))
 	adminRouter.HandleFunc("GET /dietaryrestrictions", a.ServeTemplate(a.Log, "admindietaryrestrictions.html", a.GetAdminDietaryRestrictionsTemplate))
+	adminRouter.HandleFunc("POST /dietaryrestrictions/category/add", a.HandleAdminAddDietaryCategory)
+	adminRouter.HandleFunc("POST /dietaryrestrictions/category/rename", a.HandleAdminRenameDietaryCategory)
+	adminRouter.HandleFunc("POST /dietaryrestrictions/category/delete", a.HandleAdminDeleteDietaryCategory)
+	adminRouter.HandleFunc("POST /dietaryrestrictions/category/copy", a.HandleAdminCopyDietaryCategories)
+	adminRouter.HandleFunc("GET /onsite", a.ServeTemplate(a.Log, "adminonsite.html", a.GetAdminOnSiteTemplate))
 	adminRouter.HandleFunc("GET /preflight", a.ServeTemplate(a.Log, "adminpreflight.html", a.GetAdminPreflightTemplate))
 	adminRouter.HandleFunc("GET /teachers", a.ServeTemplate(a.Log, "adminteachers.html", a.GetAdminTeachersTemplate))
-	adminRouter.HandleFunc("POST /teachers/allowance", a.HandleAdminSetEmailAllowance)
+	adminRouter.HandleFunc("POST /teachers/clearflag", a.HandleAdminClearEmailFlag)
+	adminRouter.HandleFunc("POST /teachers/suspend", a.HandleAdminSetEmailSuspended)
+	adminRouter.HandleFunc("GET /chaperones", a.ServeTemplate(a.Log, "adminchaperones.html", a.GetAdminChaperonesTemplate))
+	adminRouter.HandleFunc("POST /chaperones/sendtickets", a.HandleAdminSendChaperoneTickets)
+	adminRouter.HandleFunc("GET /rooms", a.ServeTemplate(a.Log, "adminrooms.html", a.GetAdminRoomsTemplate))
+	adminRouter.HandleFunc("POST /rooms/add", a.HandleAdminAddRoom)
+	adminRouter.HandleFunc("POST /rooms/update", a.HandleAdminUpdateRoom)
+	adminRouter.HandleFunc("POST /rooms/delete", a.HandleAdminDeleteRoom)
+	adminRouter.HandleFunc("POST /rooms/assign", a.HandleAdminAssignSeats)
+	adminRouter.HandleFunc("POST /rooms/seat", a.HandleAdminSetTeamSeat)
+	adminRouter.HandleFunc("GET /tours", a.ServeTemplate(a.Log, "admintours.html", a.GetAdminToursTemplate))
+	adminRouter.HandleFunc("POST /tours/add", a.HandleAdminAddTourGroup)
+	adminRouter.HandleFunc("POST /tours/update", a.HandleAdminUpdateTourGroup)
+	adminRouter.HandleFunc("POST /tours/delete", a.HandleAdminDeleteTourGroup)
+	adminRouter.HandleFunc("POST /tours/guides", a.HandleAdminSetTourGuides)
+	adminRouter.HandleFunc("POST /tours/assign", a.HandleAdminAssignTours)
+	adminRouter.HandleFunc("POST /tours/student", a.HandleAdminSetStudentTour)
 	adminRouter.HandleFunc("GET /teams", a.ServeTemplate(a.Log, "adminteams.html", a.GetAdminTeamsTemplate))
+	adminRouter.HandleFunc("GET /apitokens", func(w http.ResponseWriter, r *http.Request) { a.AdminAPITokensRenderer(w, r, nil) })
+	adminRouter.HandleFunc("POST /apitokens/create", a.HandleAdminCreateAPIToken)
+	adminRouter.HandleFunc("POST /apitokens/revoke", a.HandleAdminRevokeAPIToken)
+	adminRouter.HandleFunc("GET /webhooks", a.ServeTemplate(a.Log, "adminwebhooks.html", a.GetAdminWebhooksTemplate))
+	adminRouter.HandleFunc("POST /webhooks/add", a.HandleAdminAddWebhook)
+	adminRouter.HandleFunc("POST /webhooks/disable", a.HandleAdminSetWebhookDisabled)
+	adminRouter.HandleFunc("POST /webhooks/delete", a.HandleAdminDeleteWebhook)
+	adminRouter.HandleFunc("POST /webhooks/ping", a.HandleAdminPingWebhook)
+	adminRouter.HandleFunc("POST /webhooks/redeliver", a.HandleAdminRedeliverWebhook)
+	adminRouter.HandleFunc("GET /archive", a.ServeTemplate(a.Log, "adminarchive.html", a.GetAdminArchiveTemplate))
+	adminRouter.HandleFunc("GET /archive/{year}", a.ServeTemplate(a.Log, "adminarchive.html", a.GetAdminArchiveTemplate))
+	adminRouter.HandleFunc("POST /archive/year/save", a.HandleAdminSaveArchiveYear)
+	adminRouter.HandleFunc("POST /archive/year/delete", a.HandleAdminDeleteArchiveYear)
+	adminRouter.HandleFunc("POST /archive/link/add", a.HandleAdminAddArchiveLink)
+	adminRouter.HandleFunc("POST /archive/link/delete", a.HandleAdminDeleteArchiveLink)
+	adminRouter.HandleFunc("POST /archive/result/add", a.HandleAdminAddArchiveResult)
+	adminRouter.HandleFunc("POST /archive/result/rename", a.HandleAdminRenameArchiveResult)
+	adminRouter.HandleFunc("POST /archive/result/delete", a.HandleAdminDeleteArchiveResult)
+	adminRouter.HandleFunc("POST /archive/winner/add", a.HandleAdminAddArchiveWinner)
+	adminRouter.HandleFunc("POST /archive/winner/update", a.HandleAdminUpdateArchiveWinner)
+	adminRouter.HandleFunc("POST /archive/winner/delete", a.HandleAdminDeleteArchiveWinner)
+	adminRouter.HandleFunc("GET /results", func(w http.ResponseWriter, r *http.Request) { a.AdminResultsRenderer(w, r, nil) })
+	adminRouter.HandleFunc("POST /results/preview", a.HandleAdminPreviewResults)
+	adminRouter.HandleFunc("POST /results/publish", a.HandleAdminPublishResults)
+	adminRouter.HandleFunc("GET /participation", a.ServeTemplate(a.Log, "adminparticipation.html", a.GetAdminParticipationTemplate))
+	adminRouter.HandleFunc("GET /participation/school", a.ServeTemplate(a.Log, "adminschoolhistory.html", a.GetAdminSchoolHistoryTemplate))
+	adminRouter.HandleFunc("POST /participation/record", a.HandleAdminRecordParticipationSeason)
+	adminRouter.HandleFunc("POST /participation/import", a.HandleAdminImportParticipationSeason)
+	adminRouter.HandleFunc("POST /participation/delete", a.HandleAdminDeleteParticipationSeason)
+	adminRouter.HandleFunc("POST /participation/apply", a.HandleAdminApplyParticipationHistory)
+	adminRouter.HandleFunc("POST /participation/review", a.HandleAdminReviewParticipation)
+	adminRouter.HandleFunc("GET /certificates", a.ServeTemplate(a.Log, "admincertificates.html", a.GetAdminCertificatesTemplate))
+	adminRouter.HandleFunc("POST /certificates/save", a.HandleAdminSaveCertificateSettings)
+	adminRouter.HandleFunc("POST /certificates/send", a.HandleAdminSendCertificates)
+	adminRouter.HandleFunc("GET /surveys", a.ServeTemplate(a.Log, "adminsurveys.html", a.GetAdminSurveysTemplate))
+	adminRouter.HandleFunc("GET /surveys/results", a.ServeTemplate(a.Log, "adminsurveyresults.html", a.GetAdminSurveyResultsTemplate))
+	adminRouter.HandleFunc("POST /surveys/question/add", a.HandleAdminAddSurveyQuestion)
+	adminRouter.HandleFunc("POST /surveys/question/update", a.HandleAdminUpdateSurveyQuestion)
+	adminRouter.HandleFunc("POST /surveys/question/move", a.HandleAdminMoveSurveyQuestion)
+	adminRouter.HandleFunc("POST /surveys/question/delete", a.HandleAdminDeleteSurveyQuestion)
+	adminRouter.HandleFunc("POST /surveys/send", a.HandleAdminSendSurveys)
+	adminRouter.Handle("GET /emergency", a.EmergencyInfoAccessMiddleware(http.HandlerFunc(a.ServeTemplate(a.Log, "adminemergency.html", a.GetAdminEmergencyInfoTemplate))))
+	adminRouter.Handle("POST /emergency/purge", a.EmergencyInfoAccessMiddleware(http.HandlerFunc(a.HandleAdminPurgeEmergencyInfo)))
 	adminRouter.HandleFunc("GET /volunteers", a.ServeTemplate(a.Log, "adminvolunteers.html", a.GetAdminVolunteersTemplate))
+	adminRouter.HandleFunc("GET /withdrawals", a.ServeTemplate(a.Log, "adminwithdrawals.html", a.GetAdminWithdrawalsTemplate))
 	adminRouter.HandleFunc("POST /volunteers/add", a.HandleAdminAddVolunteer)
 	adminRouter.HandleFunc("POST /volunteers/remove", a.HandleAdminRemoveVolunteer)
+	adminRouter.HandleFunc("POST /volunteers/dietary", a.HandleAdminVolunteerDietary)
 	adminRouter.HandleFunc("GET /api/dietaryrestrictions", a.HandleDietaryRestrictionsExport)
 	adminRouter.HandleFunc("GET /api/resendstudentemail", a.HandleResendStudentEmail)
 	adminRouter.HandleFunc("GET /api/resendparentemail", a.HandleResendParentEmail)
@@ -247,15 +384,31 @@ func (a *Application) BuildRouter() http.Handler {
 	adminRouter.HandleFunc("GET /api/kattis/teams", a.HandleKattisTeamsExport)
 	adminRouter.HandleFunc("GET /api/kattis/participants", a.HandleKattisParticipantsExport)
 	adminRouter.HandleFunc("GET /api/zoom/breakout", a.HandleZoomBreakoutExport)
+	adminRouter.HandleFunc("GET /api/domjudge/{file}", a.HandleDOMjudgeExport)
+	adminRouter.HandleFunc("GET /api/export/{dataset}", a.HandleExport)
+	adminRouter.HandleFunc("GET /api/badges", a.HandleBadgesExport)
+	adminRouter.HandleFunc("GET /api/tablecards", a.HandleTableCardsExport)
+	adminRouter.HandleFunc("GET /api/tourrosters", a.HandleTourRostersExport)
+	adminRouter.HandleFunc("GET /api/certificates", a.HandleAdminCertificatesExport)
 	adminRouter.HandleFunc("GET /api/manualcheckin", a.HandleManualCheckin)
-	adminRouter.HandleFunc("GET /api/manualuncheckin", a.HandleManualUncheckin)
+	adminRouter.HandleFunc("GET /api/manualcheckout", a.HandleManualCheckout)
 	adminRouter.HandleFunc("GET /api/team-list", a.HandleTeamList)
+	adminRouter.HandleFunc("GET /api/live", a.HandleAdminLiveStream)
 	router.Handle("/admin/", http.StripPrefix("/admin", a.AdminAuthMiddleware(adminRouter)))
 	// Redirect /admin → /admin/ so the subrouter handles the home page in one place.
 	// Auth check here prevents leaking the redirect to unauthenticated requests.
 	router.Handle("GET /admin", a.AdminAuthMiddleware(
 		http.RedirectHandler("/admin/", http.StatusMovedPermanently)))
 
+	// Read-only JSON API (protected by API tokens)
+	router.Handle("GET /api/v1/teams", a.APITokenAuthMiddleware(database.APIScopeTeams, a.HandleAPITeams))
+	router.Handle("GET /api/v1/teams/{id}", a.APITokenAuthMiddleware(database.APIScopeTeams, a.HandleAPITeam))
+	router.Handle("GET /api/v1/students", a.APITokenAuthMiddleware(database.APIScopeStudents, a.HandleAPIStudents))
+	router.Handle("GET /api/v1/teachers", a.APITokenAuthMiddleware(database.APIScopeTeachers, a.HandleAPITeachers))
+	router.Handle("GET /api/v1/schools", a.APITokenAuthMiddleware(database.APIScopeSchools, a.HandleAPISchools))
+	router.Handle("GET /api/v1/stats", a.APITokenAuthMiddleware(database.APIScopeStats, a.HandleAPIStats))
+	router.Handle("GET /api/v1/checkins", a.APITokenAuthMiddleware(database.APIScopeCheckIns, a.HandleAPICheckIns))
+
 	// Volunteer pages (unprotected)
 	router.HandleFunc("GET /volunteer", a.ServeTemplate(a.Log, "volunteerhome.html", noArgs))
 	router.HandleFunc("GET /volunteer/login", a.ServeTemplate(a.Log, "volunteerlogin.html", noArgs))
@@ -267,6 +420,16 @@ func (a *Application) BuildRouter() http.Handler {
 		http.HandlerFunc(a.ServeTemplate(a.Log, "volunteerscan.html", a.GetVolunteerScanTemplate))))
 	router.Handle("GET /volunteer/checkin", a.VolunteerAuthMiddleware(
 		http.HandlerFunc(a.HandleVolunteerCheckIn)))
+	router.Handle("GET /volunteer/tours", a.VolunteerAuthMiddleware(
+		http.HandlerFunc(a.ServeTemplate(a.Log, "volunteertours.html", a.GetVolunteerToursTemplate))))
+	router.Handle("GET /volunteer/kiosk", a.VolunteerAuthMiddleware(
+		http.HandlerFunc(a.ServeTemplate(a.Log, "volunteerkiosk.html", a.GetVolunteerKioskTemplate))))
+	router.Handle("POST /volunteer/api/checkin", a.VolunteerAuthMiddleware(
+		http.HandlerFunc(a.HandleVolunteerCheckInAPI)))
+	router.Handle("GET /volunteer/api/roster", a.VolunteerAuthMiddleware(
+		http.HandlerFunc(a.HandleVolunteerRosterAPI)))
+	router.Handle("POST /volunteer/api/checkin/sync", a.VolunteerAuthMiddleware(
+		http.HandlerFunc(a.HandleVolunteerCheckInSyncAPI)))
 
 	var handler http.Handler = router
 	handler = hlog.RequestIDHandler("request_id", "RequestID")(handler)
@@ -279,6 +442,12 @@ func (a *Application) Start() {
 	a.Log.Info().Msg("connecting to sendgrid")
 	a.SendGridClient = sendgrid.NewSendClient(a.Config.SendgridAPIKey)
 
+	a.Log.Info().Msg("Starting webhook dispatcher")
+	go a.Webhooks.Run(context.Background())
+
+	a.Log.Info().Msg("Starting emergency info purger")
+	go a.RunEmergencyInfoPurger(context.Background())
+
 	a.Log.Info().Msg("Starting router")
 	handler := a.BuildRouter()
 
@@ -1,7 +1,13 @@
 package internal
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
 )
 
 type Link struct {
@@ -29,227 +35,113 @@ type YearInfo struct {
 	Results         []CompetitionResult
 }
 
-func (a *Application) GetArchiveTemplate(*http.Request) map[string]any {
-	return map[string]any{
-		"YearInfo": []YearInfo{
-			{
-				Year: 2025,
-				RecapParagraphs: []string{
-					"The 2025 competition saw 25 teams compete. We gave a separate set of prizes for teams consisting of only first-time competitors.",
-				},
-				Links: []Link{
-					{"/static/2025-solutions.pdf", "Solution Sketch Slides"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202025", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Name:      "Overall Winners",
-						Shortname: "Overall",
-						Teams: []WinningTeam{
-							{"1st", "Fairview High School", "Fairview High School", "Boulder"},
-							{"2nd", "Mohakos Koders", "Niwot High School", "Longmont"},
-							{"3nd", "Lobos 3", "Rocky Mountain High School", "Fort Collins"},
-						},
-					},
-					{
-						Name:      "First-Time Team Winners",
-						Shortname: "FirstTime",
-						Teams: []WinningTeam{
-							{"1st", "Importing Iguanas", "Niwot High School", "Longmont"},
-							{"2nd", "Name Deleted", "Innovation Center SVVSD", "Longmont"},
-							{"3nd", "Runtime Terror", "George Washington High School", "Denver"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2024,
-				RecapParagraphs: []string{
-					"The 2024 competition returned to an in-person only competition, but we also had an open division. We gave a separate set of prizes for teams consisting of only first-time competitors. We did not award prizes for the open division.",
-					"The in-person competition had 27 teams while the open division had 31 teams.",
-				},
-				Links: []Link{
-					{"/static/2024-solutions.pdf", "Solution Sketch Slides"},
-					{"https://sumnerevans.com/posts/school/2024-hspc/", "Competition Recap and Solution Sketches"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202024", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Name:      "Overall Winners",
-						Shortname: "Overall",
-						Teams: []WinningTeam{
-							{"1st", "Innovation Center 1", "Innovation Center SVVSD", "Longmont"},
-							{"2nd", "Sigma Scripters", "Arapahoe High School", "Centennial"},
-							{"3nd", "CyberRebels2", "Columbine High School", "Littleton"},
-						},
-					},
-					{
-						Name:      "First-Time Team Winners",
-						Shortname: "FirstTime",
-						Teams: []WinningTeam{
-							{"1st", "Loopy Groupies", "Chatfield Senior High School", "Littleton"},
-							{"2nd", "Lorem Ipsum", "Warren Tech", "Lakewood"},
-							{"3nd", "the cows(mooooooooooooo)", "Cherry Creek High School", "Greenwood Village"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2023,
-				RecapParagraphs: []string{
-					"The 2023 competition again featured two divisions: beginner and advanced. As with 2022, it was a hybrid competition, but we awarded prizes for both in-person and remote winners in both divisions.",
-					"The advanced division featured 31 teams, while the beginner division had 34 teams.",
-				},
-				Links: []Link{
-					{"/static/2023-solutions.pdf", "Solution Sketch Slides"},
-					{"https://sumnerevans.com/posts/school/2023-hspc/", "Competition Recap and Solution Sketches"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202023", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Name:      "Advanced In-Person",
-						Shortname: "AdvancedInPerson",
-						Teams: []WinningTeam{
-							{"1st", "Code Rats", "Futures Lab", "Fort Collins, Colorado"},
-							{"2nd", "The Spanish Inquisition", "Regis Jesuit High School", "Aurora, Colorado"},
-							{"3nd", "CA is 202", "Colorado Academy", "Denver, Colorado"},
-						},
-					},
-					{
-						Name:      "Beginner In-Person",
-						Shortname: "BeginnerInPerson",
-						Teams: []WinningTeam{
-							{"1st", "Spaghetti Code and Meatballs", "Warren Tech", "Lakewood, Colorado"},
-							{"2nd", "Innovation Center 1", "Innovation Center SVVSD", "Longmont, Colorado"},
-							{"3nd", "Team LuLo", "Colorado Academy", "Denver, Colorado"},
-						},
-					},
-					{
-						Name:      "Advanced Remote",
-						Shortname: "AdvancedRemote",
-						Teams: []WinningTeam{
-							{"1st", "River Hill Team #1", "River Hill High School", "Clarksville, Maryland"},
-							{"2nd", "CreekCyberBruins", "Cherry Creek High School", "Greenwood Village, Colorado"},
-							{"3nd", "JMS", "Bergen County Academies", "Bergen County, New Jersey"},
-						},
-					},
-					{
-						Name:      "Beginner Remote",
-						Shortname: "BeginnerRemote",
-						Teams: []WinningTeam{
-							{"1st", "Wormhole", "Voice of Calling NPO", "Northridge, California"},
-							{"2nd", "Lineup", "Voice of Calling NPO", "Northridge, California"},
-							{"3nd", "River Hill Team #2", "River Hill High School", "Clarksville, Maryland"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2022,
-				RecapParagraphs: []string{
-					"The 2022 competition was the first to feature two divisions: a beginner division and an advanced division. It was also the first hybrid competition with both remote and in-person contestants.",
-					"The advanced division had 26 teams, while the beginner division had 39 teams. Due to the number of teams, we decided to give awards to first place through fourth place.",
-				},
-				Links: []Link{
-					{"https://sumnerevans.com/posts/school/2022-hspc/", "Competition Recap and Solution Sketches"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202022", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Name: "Advanced",
-						Teams: []WinningTeam{
-							{"1st", "Pen A Team", "PEN Academy", "Cresskill, New Jersey"},
-							{"2nd", "Cherry Creek Cobras", "Cherry Creek High School", "Greenwood Village, Colorado"},
-							{"3nd", "River Hill Team 1", "River Hill High School", "Clarksville, Maryland"},
-							{"4th", "The Spanish Inquisition", "Regis Jesuit High School", "Aurora, Colorado"},
-						},
-					},
-					{
-						Name: "Beginner",
-						Teams: []WinningTeam{
-							{"1st", "LLL", "Future Forward at Bollman", "Thornton, Colorado"},
-							{"2nd", "Error 404: Name not found", "Colorado Academy", "Denver, Colorado"},
-							{"3nd", "Liberty 1", "Liberty Common School", "Fort Collins, Colorado"},
-							{"4th", "Cool Cats", "Arvada West High School", "Arvada, Colorado"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2021,
-				RecapParagraphs: []string{
-					"The 2021 competition was an all-remote competition featuring 55 teams from across the nation.",
-				},
-				Links: []Link{
-					{"https://sumnerevans.com/posts/school/2021-hspc/", "Competition Recap and Solution Sketches"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202021", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Teams: []WinningTeam{
-							{"1st", "River Hill HS Team 1", "River Hill High School", "Clarksville, Maryland"},
-							{"2nd", "PEN A Team", "PEN Academy", "Cresskill, New Jersey"},
-							{"3nd", "River Hill HS Team 2", "River Hill High School", "Clarksville, Maryland"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2020,
-				RecapParagraphs: []string{
-					"Due to COVID, the 2020 competition was the first all-remote HSPC competition. The competition featured 30 teams.",
-				},
-				Links: []Link{
-					{"https://sumnerevans.com/posts/school/2020-hspc/", "Competition Recap and Solution Sketches"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202020", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Teams: []WinningTeam{
-							{"1st", "Installation Wizards", "STEM School Highlands Ranch", "Highlands Ranch, Colorado"},
-							{"2nd", "i", "STEM School Highlands Ranch", "Highlands Ranch, Colorado"},
-							{"3nd", "Sun Devils", "Kent Denver", "Denver, Colorado"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2019,
-				RecapParagraphs: []string{
-					"The second ever CS@Mines High School Programming Competition featured 22 teams from all around Colorado and from as far as Steamboat Springs.",
-				},
-				Links: []Link{
-					{"https://sumnerevans.com/posts/school/2019-hspc/", "Competition Recap and Solution Sketches"},
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202019", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Teams: []WinningTeam{
-							{"1st", "STEM Team 1", "STEM School Highlands Ranch", "Highlands Ranch, Colorado"},
-							{"2nd", "IntrospectionExceptions", "Colorado Academy", "Lakewood, Colorado"},
-							{"3nd", "Team 2", "?", "?"},
-						},
-					},
-				},
-			},
-			{
-				Year: 2018,
-				RecapParagraphs: []string{
-					"The first ever CS@Mines High School Programming Competition featured 22 teams.",
-				},
-				Links: []Link{
-					{"https://open.kattis.com/problem-sources/CS%40Mines%20High%20School%20Programming%20Competition%202018", "Problems"},
-				},
-				Results: []CompetitionResult{
-					{
-						Teams: []WinningTeam{
-							{"1st", "The Crummies", "Warren Tech", "Arvada, Colorado"},
-							{"2nd", "The Bean Beans", "Colorado Academy", "Lakewood, Colorado"},
-							{"3nd", "Warriors", "Arapahoe High School", "Centennial, Colorado"},
-						},
-					},
-				},
-			},
-		},
+// ordinal formats a place as "1st", "2nd", "3rd", "4th" and so on.
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// archiveTeam is the current registration data for a team that an archive
+// winner is linked to.
+type archiveTeam struct {
+	Name     string
+	School   string
+	Location string
+}
+
+// getArchiveTeams returns the registration data for all of the current teams
+// so that linked archive winners show the same names as registration.
+func (a *Application) getArchiveTeams(ctx context.Context) (map[uuid.UUID]archiveTeam, error) {
+	teachers, err := a.DB.GetAllTeachers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	locations := map[string]string{}
+	for _, teacher := range teachers {
+		if teacher.SchoolCity != "" && teacher.SchoolState != "" {
+			locations[teacher.Email] = teacher.SchoolCity + ", " + teacher.SchoolState
+		}
+	}
+	archiveTeams := map[uuid.UUID]archiveTeam{}
+	for _, team := range teams {
+		archiveTeams[team.ID] = archiveTeam{
+			Name:     team.Name,
+			School:   team.SchoolName,
+			Location: locations[team.TeacherEmail],
+		}
+	}
+	return archiveTeams, nil
+}
+
+func newWinningTeam(winner *database.ArchiveWinner, teams map[uuid.UUID]archiveTeam) WinningTeam {
+	winningTeam := WinningTeam{
+		Place:    ordinal(winner.Place),
+		Name:     winner.TeamName,
+		School:   winner.School,
+		Location: winner.Location,
+	}
+	// Linked teams use the current registration data, falling back to the
+	// stored values if the team has since been withdrawn.
+	if team, ok := teams[winner.TeamID]; ok && winner.TeamID != uuid.Nil {
+		winningTeam.Name = team.Name
+		if team.School != "" {
+			winningTeam.School = team.School
+		}
+		if team.Location != "" {
+			winningTeam.Location = team.Location
+		}
+	}
+	return winningTeam
+}
+
+func (a *Application) GetArchiveTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	archive, err := a.DB.GetArchive(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get archive")
+		return nil
+	}
+	teams, err := a.getArchiveTeams(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams for archive")
+		return nil
+	}
+
+	var yearInfo []YearInfo
+	for _, year := range archive {
+		info := YearInfo{
+			Year:            year.Year,
+			RecapParagraphs: year.RecapParagraphs(),
+		}
+		for _, link := range year.Links {
+			info.Links = append(info.Links, Link{URL: link.URL, Title: link.Title})
+		}
+		for _, result := range year.Results {
+			competitionResult := CompetitionResult{
+				Name:      result.Name,
+				Shortname: fmt.Sprint(result.ID),
+			}
+			for _, winner := range result.Winners {
+				competitionResult.Teams = append(competitionResult.Teams, newWinningTeam(winner, teams))
+			}
+			info.Results = append(info.Results, competitionResult)
+		}
+		yearInfo = append(yearInfo, info)
 	}
+	return map[string]any{"YearInfo": yearInfo}
 }
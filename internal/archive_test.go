@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestOrdinal(t *testing.T) {
+	for n, expected := range map[int]string{
+		1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 102: "102nd", 111: "111th",
+	} {
+		assert.Equal(t, expected, ordinal(n))
+	}
+}
+
+func TestArchive_Seeded(t *testing.T) {
+	a := newTestAppWithDB(t)
+	archive, err := a.DB.GetArchive(context.Background())
+	require.NoError(t, err)
+	require.Len(t, archive, 8)
+	assert.Equal(t, 2025, archive[0].Year)
+	assert.Equal(t, 2018, archive[len(archive)-1].Year)
+
+	rec := doRequest(a.BuildRouter(), http.MethodGet, "/archive")
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "<h2>2025</h2>")
+	assert.Contains(t, body, "3rd")
+	assert.NotContains(t, body, "3nd")
+}
+
+func TestAdminArchive(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	teamID, _ := addTestStudent(t, a, "student@example.com", 16)
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/admin/archive/year/save", url.Values{"year": {"2030"}, "recap": {"First paragraph.\r\n\r\nSecond paragraph."}})
+	assert.Contains(t, rec.Header().Get("Location"), "/admin/archive/2030?message=")
+	rec = post("/admin/archive/link/add", url.Values{"year": {"2030"}, "title": {"Problems"}, "url": {"javascript:alert(1)"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+	rec = post("/admin/archive/link/add", url.Values{"year": {"2030"}, "title": {"Problems"}, "url": {"https://example.com/problems"}})
+	assert.Equal(t, "/admin/archive/2030", rec.Header().Get("Location"))
+	post("/admin/archive/result/add", url.Values{"year": {"2030"}, "name": {"Beginner"}})
+
+	year, err := a.DB.GetArchiveYear(ctx, 2030)
+	require.NoError(t, err)
+	require.NotNil(t, year)
+	assert.Equal(t, []string{"First paragraph.", "Second paragraph."}, year.RecapParagraphs())
+	require.Len(t, year.Links, 1)
+	require.Len(t, year.Results, 1)
+	resultID := year.Results[0].ID
+
+	rec = post("/admin/archive/winner/add", url.Values{"year": {"2030"}, "resultid": {"x"}, "place": {"1"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = post("/admin/archive/winner/add", url.Values{"year": {"2030"}, "resultid": {strconv.FormatInt(resultID, 10)}, "place": {"1"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+
+	// A linked winner is filled in from the team's registration.
+	post("/admin/archive/winner/add", url.Values{"year": {"2030"}, "resultid": {strconv.FormatInt(resultID, 10)}, "place": {"1"}, "teamid": {teamID.String()}})
+	post("/admin/archive/winner/add", url.Values{"year": {"2030"}, "resultid": {strconv.FormatInt(resultID, 10)}, "place": {"3"}, "teamname": {"Other Team"}, "school": {"Other School"}, "location": {"Denver, CO"}})
+	year, err = a.DB.GetArchiveYear(ctx, 2030)
+	require.NoError(t, err)
+	winners := year.Results[0].Winners
+	require.Len(t, winners, 2)
+	assert.Equal(t, teamID, winners[0].TeamID)
+	assert.Equal(t, "Team", winners[0].TeamName)
+	assert.Equal(t, "School", winners[0].School)
+	assert.Equal(t, "Golden, CO", winners[0].Location)
+
+	// Linked winners show the team's current name.
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", teamID, "Renamed Team", database.DivisionBeginner, true, "", ""))
+	page := doRequest(router, http.MethodGet, "/archive").Body.String()
+	assert.Contains(t, page, "Renamed Team")
+	assert.Contains(t, page, "Other Team")
+	assert.Contains(t, page, "3rd")
+
+	page = doRequest(router, http.MethodGet, "/admin/archive/2030", cookie).Body.String()
+	assert.Contains(t, page, "Second paragraph.")
+	assert.Contains(t, page, `value="`+teamID.String()+`" selected`)
+
+	post("/admin/archive/winner/update", url.Values{"year": {"2030"}, "id": {strconv.FormatInt(winners[1].ID, 10)}, "place": {"2"}, "teamname": {"Other Team"}})
+	post("/admin/archive/year/delete", url.Values{"year": {"2030"}})
+	year, err = a.DB.GetArchiveYear(ctx, 2030)
+	require.NoError(t, err)
+	assert.Nil(t, year)
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image/png"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/pdf"
+)
+
+// BadgeLayout describes a sheet of name badge labels. All measurements are in
+// points.
+type BadgeLayout struct {
+	Columns, Rows         int
+	LabelWidth            float64
+	LabelHeight           float64
+	MarginLeft, MarginTop float64
+	PitchX, PitchY        float64
+}
+
+var badgeLayouts = map[string]BadgeLayout{
+	// Avery 5395: eight 2-1/3" x 3-3/8" adhesive name badges per sheet.
+	"avery5395": {
+		Columns: 2, Rows: 4,
+		LabelWidth: 3.375 * pdf.Inch, LabelHeight: 2.333 * pdf.Inch,
+		MarginLeft: 0.6875 * pdf.Inch, MarginTop: 0.583 * pdf.Inch,
+		PitchX: 3.75 * pdf.Inch, PitchY: 2.5 * pdf.Inch,
+	},
+	// Avery 5392: six 3" x 4" badge inserts per sheet for clip-on holders.
+	"avery5392": {
+		Columns: 2, Rows: 3,
+		LabelWidth: 4 * pdf.Inch, LabelHeight: 3 * pdf.Inch,
+		MarginLeft: 0.25 * pdf.Inch, MarginTop: 1 * pdf.Inch,
+		PitchX: 4 * pdf.Inch, PitchY: 3 * pdf.Inch,
+	},
+}
+
+const defaultBadgeLayout = "avery5395"
+
+// getPrintableTeams returns the in-person teams that have members, optionally
+// only in one division, sorted by name along with their members.
+func (a *Application) getPrintableTeams(r *http.Request) ([]*database.TeamWithTeacherName, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	var division database.Division
+	if divStr := r.URL.Query().Get("div"); divStr != "" {
+		if division, err = database.ParseDivision(divStr); err != nil {
+			return nil, err
+		}
+	}
+
+	var printable []*database.TeamWithTeacherName
+	for _, team := range teams {
+		if !team.InPerson || len(team.Members) == 0 || (division != "" && team.Division != division) {
+			continue
+		}
+		slices.SortFunc(team.Members, func(a, b database.Student) int {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+		printable = append(printable, team)
+	}
+	slices.SortFunc(printable, func(a, b *database.TeamWithTeacherName) int {
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return printable, nil
+}
+
+func writePDF(w http.ResponseWriter, filename string, doc *pdf.Document) error {
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// HandleBadgesExport renders a name badge for every in-person student onto
+// sheets of labels.
+func (a *Application) HandleBadgesExport(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "admin_badges_export").Logger()
+
+	layoutName := r.URL.Query().Get("layout")
+	if layoutName == "" {
+		layoutName = defaultBadgeLayout
+	}
+	layout, ok := badgeLayouts[layoutName]
+	if !ok {
+		log.Warn().Str("layout", layoutName).Msg("unknown badge layout")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	teams, err := a.getPrintableTeams(r)
+	if err != nil {
+		log.Err(err).Msg("failed to get teams")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	doc := pdf.New()
+	var page *pdf.Page
+	var i int
+	for _, team := range teams {
+		for _, member := range team.Members {
+			slot := i % (layout.Columns * layout.Rows)
+			if slot == 0 {
+				page = doc.AddPage(pdf.LetterWidth, pdf.LetterHeight)
+			}
+			x := layout.MarginLeft + float64(slot%layout.Columns)*layout.PitchX
+			y := pdf.LetterHeight - layout.MarginTop - float64(slot/layout.Columns)*layout.PitchY - layout.LabelHeight
+			if err := a.drawBadge(doc, page, layout, x, y, team, &member); err != nil {
+				log.Err(err).Str("student_email", member.Email).Msg("failed to draw badge")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			i++
+		}
+	}
+	if i == 0 {
+		doc.AddPage(pdf.LetterWidth, pdf.LetterHeight)
+	}
+
+	if err := writePDF(w, "badges.pdf", doc); err != nil {
+		log.Err(err).Msg("failed to write badges")
+	}
+}
+
+// drawBadge draws one badge with its bottom left corner at (x, y).
+func (a *Application) drawBadge(doc *pdf.Document, page *pdf.Page, layout BadgeLayout, x, y float64, team *database.TeamWithTeacherName, student *database.Student) error {
+	qrCodePNG, err := a.getStudentQRCodeImage(student.Email)
+	if err != nil {
+		return err
+	}
+	qrCodeImage, err := png.Decode(bytes.NewReader(qrCodePNG))
+	if err != nil {
+		return err
+	}
+	qrCode, err := doc.AddImage(qrCodeImage)
+	if err != nil {
+		return err
+	}
+
+	padding := 0.15 * pdf.Inch
+	width := layout.LabelWidth - 2*padding
+	top := y + layout.LabelHeight - padding
+	centerX := x + layout.LabelWidth/2
+
+	page.TextCentered(pdf.HelveticaBold, 9, centerX, top-9, fmt.Sprintf("CS@Mines HSPC %d", time.Now().Year()))
+
+	nameSize, name := pdf.HelveticaBold.Fit(width, 26, 12, student.Name)
+	page.TextCentered(pdf.HelveticaBold, nameSize, centerX, top-14-nameSize, name)
+
+	// The team details go on the left, next to the QR code in the bottom right
+	// corner.
+	qrSize := min(layout.LabelHeight*0.45, layout.LabelWidth*0.35)
+	page.Image(qrCode, x+layout.LabelWidth-padding-qrSize, y+padding, qrSize, qrSize)
+
+	textWidth := width - qrSize - padding
+	lines := []struct {
+		font pdf.Font
+		size float64
+		text string
+	}{
+		{pdf.HelveticaBold, 12, team.Name},
+		{pdf.Helvetica, 10, team.SchoolName},
+		{pdf.Helvetica, 10, string(team.Division) + " Division"},
+	}
+	lineY := y + padding + qrSize - 12
+	for _, line := range lines {
+		size, text := line.font.Fit(textWidth, line.size, 6, line.text)
+		page.Text(line.font, size, x+padding, lineY, text)
+		lineY -= line.size + 4
+	}
+	return nil
+}
+
+// HandleTableCardsExport renders a folding placard for every in-person team,
+// in seat order. Each card is a landscape letter page that is folded in half,
+// with the top half upside down so that the card reads correctly from both
+// sides.
+func (a *Application) HandleTableCardsExport(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "admin_table_cards_export").Logger()
+
+	teams, err := a.getPrintableTeams(r)
+	if err != nil {
+		log.Err(err).Msg("failed to get teams")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	seats, err := a.DB.GetTeamSeats(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to get team seats")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Teams without a seat go last.
+	slices.SortStableFunc(teams, func(a, b *database.TeamWithTeacherName) int {
+		seatA, seatB := seats[a.ID], seats[b.ID]
+		if seatA == nil || seatB == nil {
+			return cmp.Compare(boolToInt(seatA == nil), boolToInt(seatB == nil))
+		}
+		return cmp.Or(cmp.Compare(seatA.RoomID, seatB.RoomID), cmp.Compare(seatA.Seat, seatB.Seat))
+	})
+
+	doc := pdf.New()
+	for _, team := range teams {
+		page := doc.AddPage(pdf.LetterHeight, pdf.LetterWidth)
+		half := page.Height() / 2
+		drawTableCardSide(page, 0, 0, team, seats[team.ID])
+		page.Rotated(0, half, page.Width(), half, func() {
+			drawTableCardSide(page, 0, half, team, seats[team.ID])
+		})
+		page.Line(0.25*pdf.Inch, half, page.Width()-0.25*pdf.Inch, half, 0.5, 4)
+	}
+	if len(teams) == 0 {
+		doc.AddPage(pdf.LetterHeight, pdf.LetterWidth)
+	}
+
+	if err := writePDF(w, "table-cards.pdf", doc); err != nil {
+		log.Err(err).Msg("failed to write table cards")
+	}
+}
+
+// drawTableCardSide draws one side of a table card in the rectangle of the
+// given height starting at (x, y) and spanning the width of the page.
+func drawTableCardSide(page *pdf.Page, x, y float64, team *database.TeamWithTeacherName, seat *database.TeamSeat) {
+	width := page.Width() - 1*pdf.Inch
+	centerX := x + page.Width()/2
+	height := page.Height() / 2
+
+	nameSize, name := pdf.HelveticaBold.Fit(width, 60, 20, team.Name)
+	nameY := y + height*0.55
+	page.TextCentered(pdf.HelveticaBold, nameSize, centerX, nameY, name)
+
+	schoolSize, school := pdf.Helvetica.Fit(width, 24, 10, team.SchoolName)
+	page.TextCentered(pdf.Helvetica, schoolSize, centerX, nameY-schoolSize-12, school)
+
+	memberNames := make([]string, len(team.Members))
+	for i, member := range team.Members {
+		memberNames[i] = member.Name
+	}
+	membersSize, members := pdf.Helvetica.Fit(width, 16, 8, strings.Join(memberNames, " · "))
+	page.TextCentered(pdf.Helvetica, membersSize, centerX, y+0.6*pdf.Inch, members)
+
+	header := string(team.Division) + " Division"
+	if seat != nil {
+		header = fmt.Sprintf("%s · Seat %d · %s", seat.RoomName, seat.Seat, header)
+	}
+	page.TextCentered(pdf.HelveticaBold, 14, centerX, y+height-0.75*pdf.Inch, header)
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintableExports(t *testing.T) {
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 16)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+
+	for _, path := range []string{
+		"/admin/api/badges",
+		"/admin/api/badges?layout=avery5392&div=Beginner",
+		"/admin/api/tablecards",
+	} {
+		rec := doRequest(router, http.MethodGet, path, cookie)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"), path)
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "%PDF-"), path)
+		assert.Contains(t, rec.Body.String(), "/Count 1", path)
+	}
+
+	rec := doRequest(router, http.MethodGet, "/admin/api/badges?layout=unknown", cookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/config"
+)
+
+var (
+	ErrCaptchaFailed        = errors.New("captcha failed")
+	ErrCaptchaScoreTooLow   = errors.New("captcha score too low")
+	ErrCaptchaNotConfigured = errors.New("captcha is not configured")
+)
+
+// CaptchaWidget describes how to render the captcha on a form.
+type CaptchaWidget struct {
+	Provider config.CaptchaProvider
+	// ScriptURL is the provider's JavaScript. It is empty for the stub.
+	ScriptURL string
+	// Class is the class of the element that the script turns into the
+	// widget.
+	Class   string
+	SiteKey string
+	// ResponseField is the form field that the widget puts its response in.
+	ResponseField string
+}
+
+// CaptchaVerifier verifies the responses produced by a captcha widget.
+type CaptchaVerifier interface {
+	Widget() CaptchaWidget
+	// Verify returns nil if the response is valid.
+	Verify(ctx context.Context, response string) error
+}
+
+// NewCaptchaVerifier creates the verifier for the configured provider, which
+// defaults to reCAPTCHA. In dev mode, if no secret key has been configured, a
+// stub that accepts every response is used.
+func NewCaptchaVerifier(cfg config.CaptchaConfig, devMode bool) (CaptchaVerifier, error) {
+	if devMode && cfg.Provider == "" && cfg.SecretKey == "" {
+		return &StubCaptchaVerifier{Success: true}, nil
+	}
+
+	switch cfg.Provider {
+	case config.CaptchaProviderStub:
+		return &StubCaptchaVerifier{Success: cfg.StubSuccess}, nil
+	case config.CaptchaProviderTurnstile:
+		return newSiteVerifyCaptcha(cfg, CaptchaWidget{
+			Provider:      config.CaptchaProviderTurnstile,
+			ScriptURL:     "https://challenges.cloudflare.com/turnstile/v0/api.js",
+			Class:         "cf-turnstile",
+			ResponseField: "cf-turnstile-response",
+		}, "https://challenges.cloudflare.com/turnstile/v0/siteverify"), nil
+	case config.CaptchaProviderHCaptcha:
+		return newSiteVerifyCaptcha(cfg, CaptchaWidget{
+			Provider:      config.CaptchaProviderHCaptcha,
+			ScriptURL:     "https://js.hcaptcha.com/1/api.js",
+			Class:         "h-captcha",
+			ResponseField: "h-captcha-response",
+		}, "https://api.hcaptcha.com/siteverify"), nil
+	case "", config.CaptchaProviderRecaptcha:
+		return newSiteVerifyCaptcha(cfg, CaptchaWidget{
+			Provider:      config.CaptchaProviderRecaptcha,
+			ScriptURL:     "https://www.google.com/recaptcha/api.js",
+			Class:         "g-recaptcha",
+			ResponseField: "g-recaptcha-response",
+		}, "https://www.google.com/recaptcha/api/siteverify"), nil
+	default:
+		return nil, fmt.Errorf("unknown captcha provider %q", cfg.Provider)
+	}
+}
+
+// siteVerifyCaptcha verifies responses using the siteverify protocol, which
+// is shared by reCAPTCHA, Turnstile and hCaptcha.
+type siteVerifyCaptcha struct {
+	widget    CaptchaWidget
+	verifyURL string
+	secretKey string
+	minScore  float64
+	client    *http.Client
+}
+
+func newSiteVerifyCaptcha(cfg config.CaptchaConfig, widget CaptchaWidget, defaultVerifyURL string) *siteVerifyCaptcha {
+	widget.SiteKey = cfg.SiteKey
+	verifyURL := cfg.VerifyURL
+	if verifyURL == "" {
+		verifyURL = defaultVerifyURL
+	}
+	return &siteVerifyCaptcha{
+		widget:    widget,
+		verifyURL: verifyURL,
+		secretKey: cfg.SecretKey,
+		minScore:  cfg.MinScore,
+		client:    &http.Client{Timeout: cfg.GetTimeout()},
+	}
+}
+
+type siteVerifyResponse struct {
+	Success     bool     `json:"success"`
+	ChallengeTS string   `json:"challenge_ts"`
+	Hostname    string   `json:"hostname"`
+	ErrorCodes  []string `json:"error-codes"`
+	// Score and Action are only returned by score-based captchas.
+	Score  *float64 `json:"score"`
+	Action string   `json:"action"`
+}
+
+func (c *siteVerifyCaptcha) Widget() CaptchaWidget {
+	return c.widget
+}
+
+func (c *siteVerifyCaptcha) Verify(ctx context.Context, response string) error {
+	if c.secretKey == "" {
+		return ErrCaptchaNotConfigured
+	} else if response == "" {
+		return ErrCaptchaFailed
+	}
+
+	form := url.Values{}
+	form.Add("secret", c.secretKey)
+	form.Add("response", response)
+	if c.widget.Provider == config.CaptchaProviderHCaptcha && c.widget.SiteKey != "" {
+		form.Add("sitekey", c.widget.SiteKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from siteverify", resp.StatusCode)
+	}
+
+	var verifyResponse siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verifyResponse); err != nil {
+		return err
+	}
+	zerolog.Ctx(ctx).Info().
+		Str("provider", string(c.widget.Provider)).
+		Any("resp", verifyResponse).
+		Msg("captcha response")
+	if !verifyResponse.Success {
+		return fmt.Errorf("%w: %s", ErrCaptchaFailed, strings.Join(verifyResponse.ErrorCodes, ", "))
+	} else if verifyResponse.Score != nil && *verifyResponse.Score < c.minScore {
+		return fmt.Errorf("%w: %.2f < %.2f", ErrCaptchaScoreTooLow, *verifyResponse.Score, c.minScore)
+	}
+	return nil
+}
+
+// StubCaptchaVerifier gives the same answer for every response without making
+// any requests.
+type StubCaptchaVerifier struct {
+	Success bool
+}
+
+func (c *StubCaptchaVerifier) Widget() CaptchaWidget {
+	return CaptchaWidget{Provider: config.CaptchaProviderStub}
+}
+
+func (c *StubCaptchaVerifier) Verify(ctx context.Context, response string) error {
+	if !c.Success {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
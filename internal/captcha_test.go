@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/config"
+)
+
+func newSiteVerifyServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "secret", r.FormValue("secret"))
+		assert.Equal(t, "token", r.FormValue("response"))
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCaptchaVerifier_SiteVerify(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		provider config.CaptchaProvider
+		body     string
+		err      error
+	}{
+		{"recaptcha v2", config.CaptchaProviderRecaptcha, `{"success": true}`, nil},
+		{"default provider", "", `{"success": false}`, ErrCaptchaFailed},
+		{"recaptcha v3 score", config.CaptchaProviderRecaptcha, `{"success": true, "score": 0.9}`, nil},
+		{"recaptcha v3 low score", config.CaptchaProviderRecaptcha, `{"success": true, "score": 0.1}`, ErrCaptchaScoreTooLow},
+		{"turnstile failed", config.CaptchaProviderTurnstile, `{"success": false, "error-codes": ["invalid-input-response"]}`, ErrCaptchaFailed},
+		{"hcaptcha", config.CaptchaProviderHCaptcha, `{"success": true}`, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newSiteVerifyServer(t, tc.body)
+			verifier, err := NewCaptchaVerifier(config.CaptchaConfig{
+				Provider:  tc.provider,
+				SecretKey: "secret",
+				VerifyURL: srv.URL,
+				MinScore:  0.5,
+			}, false)
+			require.NoError(t, err)
+			err = verifier.Verify(context.Background(), "token")
+			if tc.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestNewCaptchaVerifier_UnknownProvider(t *testing.T) {
+	_, err := NewCaptchaVerifier(config.CaptchaConfig{Provider: "turnstyle", SecretKey: "secret"}, false)
+	assert.ErrorContains(t, err, `unknown captcha provider "turnstyle"`)
+
+	verifier, err := NewCaptchaVerifier(config.CaptchaConfig{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, config.CaptchaProviderRecaptcha, verifier.Widget().Provider)
+}
+
+func TestHandleTeacherCreateAccount_Captcha(t *testing.T) {
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	a.Config.RegistrationEnabled = true
+	router := a.BuildRouter()
+
+	createAccount := func() *httptest.ResponseRecorder {
+		form := url.Values{"email-address": {"teacher@example.com"}, "your-name": {"Teacher"}}
+		req := httptest.NewRequest(http.MethodPost, "/register/teacher/createaccount", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	a.Captcha = &StubCaptchaVerifier{Success: false}
+	rec := createAccount()
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Please complete the captcha.")
+
+	a.Captcha = &StubCaptchaVerifier{Success: true}
+	assertRedirectsTo(t, createAccount(), "/register/teacher/confirmemail")
+	_, err := a.DB.GetTeacherByEmail(context.Background(), "teacher@example.com")
+	require.NoError(t, err)
+}
@@ -0,0 +1,475 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/export"
+)
+
+// defaultDietaryCategories are offered for the first season that has dietary
+// categories.
+var defaultDietaryCategories = []string{"Vegetarian", "Vegan", "Gluten-free", "Dairy-free", "Nut allergy", "Halal", "Kosher"}
+
+// dietaryNoteMaxLength limits how long the note for other dietary
+// restrictions can be.
+const dietaryNoteMaxLength = 500
+
+// dietaryOption is a dietary category checkbox on a form.
+type dietaryOption struct {
+	ID      int64
+	Name    string
+	Checked bool
+}
+
+func dietaryOptions(categories []*database.DietaryCategory, chosen []int64) []dietaryOption {
+	options := make([]dietaryOption, len(categories))
+	for i, category := range categories {
+		options[i] = dietaryOption{ID: category.ID, Name: category.Name, Checked: slices.Contains(chosen, category.ID)}
+	}
+	return options
+}
+
+// getDietaryOptions returns the checkboxes for this season's dietary
+// categories with the chosen ones checked.
+func (a *Application) getDietaryOptions(ctx context.Context, chosen []int64) []dietaryOption {
+	categories, err := a.DB.GetDietaryCategories(ctx, currentSeason())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get dietary categories")
+		return nil
+	}
+	return dietaryOptions(categories, chosen)
+}
+
+// parseDietaryForm reads the dietary-category checkboxes and the dietary-note
+// field of a form. Categories that are not from this season are ignored.
+func (a *Application) parseDietaryForm(r *http.Request) (categories []int64, note string, err error) {
+	seasonCategories, err := a.DB.GetDietaryCategories(r.Context(), currentSeason())
+	if err != nil {
+		return nil, "", err
+	}
+	for _, category := range seasonCategories {
+		if slices.Contains(r.Form["dietary-category"], strconv.FormatInt(category.ID, 10)) {
+			categories = append(categories, category.ID)
+		}
+	}
+	note = strings.TrimSpace(r.FormValue("dietary-note"))
+	if len(note) > dietaryNoteMaxLength {
+		note = note[:dietaryNoteMaxLength]
+	}
+	return categories, note, nil
+}
+
+// cateringBasis is which in-person students, teachers, and chaperones are
+// counted in the catering report.
+type cateringBasis string
+
+const (
+	cateringBasisConfirmed cateringBasis = "confirmed"
+	cateringBasisCheckedIn cateringBasis = "checked_in"
+)
+
+func (b cateringBasis) includes(student *database.Student) bool {
+	if b == cateringBasisCheckedIn {
+		return student.CheckedIn
+	}
+	return student.EmailConfirmed
+}
+
+func (b cateringBasis) includesChaperone(chaperone *database.Chaperone) bool {
+	return b != cateringBasisCheckedIn || chaperone.CheckedIn
+}
+
+var cateringBasisFilter = ExportFilter{
+	Key:     "basis",
+	Title:   "Count People That Are",
+	Options: []string{string(cateringBasisConfirmed), string(cateringBasisCheckedIn)},
+}
+
+func parseCateringBasis(s string) (cateringBasis, bool) {
+	if s == "" {
+		return cateringBasisConfirmed, true
+	}
+	basis := cateringBasis(s)
+	return basis, slices.Contains(cateringBasisFilter.Options, s)
+}
+
+type cateringRole string
+
+const (
+	cateringRoleStudent   cateringRole = "Student"
+	cateringRoleTeacher   cateringRole = "Teacher"
+	cateringRoleChaperone cateringRole = "Chaperone"
+	cateringRoleVolunteer cateringRole = "Volunteer"
+)
+
+// cateringLine is the number of meals of one kind. Chaperones are counted with
+// the teachers.
+type cateringLine struct {
+	Name       string
+	Students   int
+	Teachers   int
+	Volunteers int
+}
+
+func (l *cateringLine) Total() int {
+	return l.Students + l.Teachers + l.Volunteers
+}
+
+func (l *cateringLine) add(role cateringRole) {
+	switch role {
+	case cateringRoleStudent:
+		l.Students++
+	case cateringRoleTeacher, cateringRoleChaperone:
+		l.Teachers++
+	case cateringRoleVolunteer:
+		l.Volunteers++
+	}
+}
+
+// cateringNote is a dietary restriction that is not one of the categories.
+type cateringNote struct {
+	Role  cateringRole
+	Name  string
+	Email string
+	Team  string
+	Note  string
+}
+
+// cateringReport counts the meals needed for everyone that is on campus. A
+// person with several dietary restrictions is counted in each of their
+// categories, so the lines may add up to more than the total.
+type cateringReport struct {
+	Basis      cateringBasis
+	Categories []*cateringLine
+	// Other is everyone with a note about other dietary restrictions.
+	Other *cateringLine
+	// Unrestricted is everyone without any dietary restrictions.
+	Unrestricted *cateringLine
+	Total        *cateringLine
+	Notes        []cateringNote
+}
+
+// Lines returns every line of the report in the order that it is shown.
+func (r *cateringReport) Lines() []*cateringLine {
+	return append(slices.Clone(r.Categories), r.Other, r.Unrestricted, r.Total)
+}
+
+func (r *cateringReport) add(byID map[int64]*cateringLine, role cateringRole, categories []int64, note string, who cateringNote) {
+	restricted := false
+	for _, id := range categories {
+		if line, ok := byID[id]; ok {
+			line.add(role)
+			restricted = true
+		}
+	}
+	if note != "" {
+		r.Other.add(role)
+		who.Role = role
+		who.Note = note
+		r.Notes = append(r.Notes, who)
+		restricted = true
+	}
+	if !restricted {
+		r.Unrestricted.add(role)
+	}
+	r.Total.add(role)
+}
+
+// getCateringReport counts the meals needed for the season. The students on
+// in-person teams are counted if they match the basis, the teachers and
+// chaperones that registered to come are counted if they match the basis,
+// and every volunteer is counted.
+func (a *Application) getCateringReport(ctx context.Context, season int, basis cateringBasis) (*cateringReport, error) {
+	categories, err := a.DB.GetDietaryCategories(ctx, season)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := a.getExportTeams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chaperones, err := a.DB.GetChaperones(ctx, season)
+	if err != nil {
+		return nil, err
+	}
+	volunteers, err := a.DB.GetVolunteerDietaryChoices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &cateringReport{
+		Basis:        basis,
+		Other:        &cateringLine{Name: "Other"},
+		Unrestricted: &cateringLine{Name: "No Restrictions"},
+		Total:        &cateringLine{Name: "Total"},
+	}
+	byID := map[int64]*cateringLine{}
+	for _, category := range categories {
+		line := &cateringLine{Name: category.Name}
+		report.Categories = append(report.Categories, line)
+		byID[category.ID] = line
+	}
+
+	for _, team := range teams {
+		if !team.InPerson {
+			continue
+		}
+		for _, student := range team.Members {
+			if !basis.includes(&student) {
+				continue
+			}
+			report.add(byID, cateringRoleStudent, student.DietaryCategories, strings.TrimSpace(student.DietaryRestrictions),
+				cateringNote{Name: student.Name, Email: student.Email, Team: team.Name})
+		}
+	}
+	for _, chaperone := range chaperones {
+		if !basis.includesChaperone(chaperone.Chaperone) {
+			continue
+		}
+		role := cateringRoleChaperone
+		if chaperone.IsTeacher {
+			role = cateringRoleTeacher
+		}
+		report.add(byID, role, chaperone.DietaryCategories, chaperone.DietaryNote,
+			cateringNote{Name: chaperone.Name, Email: chaperone.Email, Team: chaperone.SchoolName})
+	}
+	for _, volunteer := range volunteers {
+		report.add(byID, cateringRoleVolunteer, volunteer.Categories, volunteer.Note, cateringNote{Email: volunteer.Email})
+	}
+	return report, nil
+}
+
+// cateringExportDataset exports the catering report. Unlike the other
+// datasets, its filter changes how the rows are counted instead of which rows
+// are included.
+type cateringExportDataset struct {
+	a *Application
+}
+
+func (d *cateringExportDataset) dataset(basis cateringBasis) *exportDataset[*cateringLine] {
+	return &exportDataset[*cateringLine]{
+		name:  "catering",
+		title: "Catering",
+		columns: []exportColumn[*cateringLine]{
+			column("meal", "Meal", func(l *cateringLine) any { return l.Name }),
+			column("students", "Students", func(l *cateringLine) any { return l.Students }),
+			column("teachers", "Teachers and Chaperones", func(l *cateringLine) any { return l.Teachers }),
+			column("volunteers", "Volunteers", func(l *cateringLine) any { return l.Volunteers }),
+			column("total", "Total", func(l *cateringLine) any { return l.Total() }),
+		},
+		rows: func(ctx context.Context) ([]*cateringLine, error) {
+			report, err := d.a.getCateringReport(ctx, currentSeason(), basis)
+			if err != nil {
+				return nil, err
+			}
+			return report.Lines(), nil
+		},
+	}
+}
+
+func (d *cateringExportDataset) Name() string             { return "catering" }
+func (d *cateringExportDataset) Title() string            { return "Catering" }
+func (d *cateringExportDataset) Columns() []export.Column { return d.dataset("").Columns() }
+func (d *cateringExportDataset) Filters() []ExportFilter  { return []ExportFilter{cateringBasisFilter} }
+
+func (d *cateringExportDataset) Table(ctx context.Context, columnKeys []string, filterValues map[string]string) (*export.Table, error) {
+	basis, ok := parseCateringBasis(filterValues[cateringBasisFilter.Key])
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid value %q for %s", errInvalidExportRequest, basis, cateringBasisFilter.Key)
+	}
+	return d.dataset(basis).Table(ctx, columnKeys, nil)
+}
+
+func (a *Application) GetAdminDietaryRestrictionsTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	season := currentSeason()
+	data := map[string]any{
+		"Season":  season,
+		"Formats": export.Formats,
+		"Error":   r.URL.Query().Get("error"),
+		"Message": r.URL.Query().Get("message"),
+	}
+	basis, ok := parseCateringBasis(r.URL.Query().Get("basis"))
+	if !ok {
+		data["Error"] = "Invalid basis."
+		basis = cateringBasisConfirmed
+	}
+
+	categories, err := a.DB.GetDietaryCategories(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get dietary categories")
+		return nil
+	}
+	previousSeason, err := a.DB.GetLatestDietaryCategorySeason(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get previous dietary category season")
+		return nil
+	}
+	report, err := a.getCateringReport(ctx, season, basis)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get catering report")
+		return nil
+	}
+	data["Categories"] = categories
+	data["PreviousSeason"] = previousSeason
+	data["Report"] = report
+	return data
+}
+
+func redirectToDietaryRestrictions(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/dietaryrestrictions"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// parseDietaryCategoryForm reads the category ID and name of the rename and
+// delete forms. The category must be from this season.
+func (a *Application) parseDietaryCategoryForm(w http.ResponseWriter, r *http.Request) (id int64, name string, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, "", false
+	}
+	categories, err := a.DB.GetDietaryCategories(r.Context(), currentSeason())
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Msg("failed to get dietary categories")
+		redirectToDietaryRestrictions(w, r, "error", "Failed to get the dietary categories.")
+		return 0, "", false
+	} else if !slices.ContainsFunc(categories, func(c *database.DietaryCategory) bool { return c.ID == id }) {
+		redirectToDietaryRestrictions(w, r, "error", "Only this season's categories can be changed.")
+		return 0, "", false
+	}
+	return id, strings.TrimSpace(r.FormValue("name")), true
+}
+
+func (a *Application) HandleAdminAddDietaryCategory(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	category := &database.DietaryCategory{Season: currentSeason(), Name: strings.TrimSpace(r.FormValue("name"))}
+	if category.Name == "" {
+		redirectToDietaryRestrictions(w, r, "error", "Enter a name for the category.")
+		return
+	}
+	if err := a.DB.AddDietaryCategory(r.Context(), category); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("failed to add dietary category")
+		redirectToDietaryRestrictions(w, r, "error", "Failed to add the category.")
+		return
+	}
+	redirectToDietaryRestrictions(w, r, "message", fmt.Sprintf("Added %s.", category.Name))
+}
+
+func (a *Application) HandleAdminRenameDietaryCategory(w http.ResponseWriter, r *http.Request) {
+	id, name, ok := a.parseDietaryCategoryForm(w, r)
+	if !ok {
+		return
+	} else if name == "" {
+		redirectToDietaryRestrictions(w, r, "error", "Enter a name for the category.")
+		return
+	}
+	if err := a.DB.RenameDietaryCategory(r.Context(), id, name); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("failed to rename dietary category")
+		redirectToDietaryRestrictions(w, r, "error", "Failed to rename the category.")
+		return
+	}
+	redirectToDietaryRestrictions(w, r, "message", fmt.Sprintf("Renamed the category to %s.", name))
+}
+
+func (a *Application) HandleAdminDeleteDietaryCategory(w http.ResponseWriter, r *http.Request) {
+	id, _, ok := a.parseDietaryCategoryForm(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteDietaryCategory(r.Context(), id); err != nil {
+		hlog.FromRequest(r).Err(err).Msg("failed to delete dietary category")
+		redirectToDietaryRestrictions(w, r, "error", "Failed to delete the category.")
+		return
+	}
+	redirectToDietaryRestrictions(w, r, "message", "Deleted the category.")
+}
+
+// HandleAdminCopyDietaryCategories sets up this season's categories from the
+// most recent season that had any, or from the defaults.
+func (a *Application) HandleAdminCopyDietaryCategories(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := hlog.FromRequest(r)
+	season := currentSeason()
+	existing, err := a.DB.GetDietaryCategories(ctx, season)
+	if err != nil {
+		log.Err(err).Msg("failed to get dietary categories")
+		redirectToDietaryRestrictions(w, r, "error", "Failed to get the dietary categories.")
+		return
+	} else if len(existing) > 0 {
+		redirectToDietaryRestrictions(w, r, "error", "This season already has dietary categories.")
+		return
+	}
+
+	names := defaultDietaryCategories
+	previousSeason, err := a.DB.GetLatestDietaryCategorySeason(ctx, season)
+	if err != nil {
+		log.Err(err).Msg("failed to get previous dietary category season")
+		redirectToDietaryRestrictions(w, r, "error", "Failed to get the previous season's categories.")
+		return
+	} else if previousSeason != 0 {
+		previous, err := a.DB.GetDietaryCategories(ctx, previousSeason)
+		if err != nil {
+			log.Err(err).Msg("failed to get previous dietary categories")
+			redirectToDietaryRestrictions(w, r, "error", "Failed to get the previous season's categories.")
+			return
+		}
+		names = nil
+		for _, category := range previous {
+			names = append(names, category.Name)
+		}
+	}
+
+	for _, name := range names {
+		if err := a.DB.AddDietaryCategory(ctx, &database.DietaryCategory{Season: season, Name: name}); err != nil {
+			log.Err(err).Msg("failed to add dietary category")
+			redirectToDietaryRestrictions(w, r, "error", "Failed to add the categories.")
+			return
+		}
+	}
+	redirectToDietaryRestrictions(w, r, "message", fmt.Sprintf("Added %d categories.", len(names)))
+}
+
+func (a *Application) HandleAdminVolunteerDietary(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	email := r.FormValue("email")
+	if email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	categories, note, err := a.parseDietaryForm(r)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to parse dietary restrictions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := a.DB.SetVolunteerDietaryChoice(r.Context(), email, categories, note); err != nil {
+		a.Log.Err(err).Msg("failed to save volunteer dietary restrictions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/volunteers", http.StatusSeeOther)
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func addTestDietaryCategories(t *testing.T, a *Application, names ...string) []int64 {
+	t.Helper()
+	ids := make([]int64, len(names))
+	for i, name := range names {
+		category := &database.DietaryCategory{Season: currentSeason(), Name: name}
+		require.NoError(t, a.DB.AddDietaryCategory(context.Background(), category))
+		ids[i] = category.ID
+	}
+	return ids
+}
+
+func TestCateringReport(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestResultsTeams(t, a)
+	ids := addTestDietaryCategories(t, a, "Vegetarian", "Gluten-free")
+	old := &database.DietaryCategory{Season: currentSeason() - 1, Name: "Vegetarian"}
+	require.NoError(t, a.DB.AddDietaryCategory(ctx, old))
+
+	// studenta (in-person) is vegetarian and gluten-free, studentb is remote,
+	// and studentc (in-person) has a note.
+	for _, email := range []string{"studenta@example.com", "studentb@example.com", "studentc@example.com"} {
+		require.NoError(t, a.DB.ConfirmStudent(ctx, email, false, "", "parent@example.com"))
+	}
+	require.NoError(t, a.DB.SetStudentDietaryCategories(ctx, "studenta@example.com", append(ids, old.ID)))
+	require.NoError(t, a.DB.SetStudentDietaryCategories(ctx, "studentb@example.com", ids))
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "studentc@example.com", false, "No pork", "parent@example.com"))
+	teacher := &database.Chaperone{
+		Season:            currentSeason(),
+		TeacherEmail:      "teacher@example.com",
+		IsTeacher:         true,
+		Name:              "Teacher",
+		Email:             "teacher@example.com",
+		DietaryCategories: ids[:1],
+	}
+	require.NoError(t, a.DB.AddChaperone(ctx, teacher))
+	require.NoError(t, a.DB.AddVolunteer(ctx, "volunteer@example.com"))
+	require.NoError(t, a.DB.AddVolunteer(ctx, "volunteer2@example.com"))
+	require.NoError(t, a.DB.SetVolunteerDietaryChoice(ctx, "volunteer@example.com", ids[1:], "Shellfish"))
+
+	report, err := a.getCateringReport(ctx, currentSeason(), cateringBasisConfirmed)
+	require.NoError(t, err)
+	lines := map[string]cateringLine{}
+	for _, line := range report.Lines() {
+		lines[line.Name] = *line
+	}
+	assert.Equal(t, cateringLine{Name: "Vegetarian", Students: 1, Teachers: 1}, lines["Vegetarian"])
+	assert.Equal(t, cateringLine{Name: "Gluten-free", Students: 1, Volunteers: 1}, lines["Gluten-free"])
+	assert.Equal(t, cateringLine{Name: "Other", Students: 1, Volunteers: 1}, lines["Other"])
+	assert.Equal(t, cateringLine{Name: "No Restrictions", Volunteers: 1}, lines["No Restrictions"])
+	assert.Equal(t, cateringLine{Name: "Total", Students: 2, Teachers: 1, Volunteers: 2}, lines["Total"])
+	require.Len(t, report.Notes, 2)
+	assert.Equal(t, cateringNote{Role: cateringRoleStudent, Name: "Student", Email: "studentc@example.com", Team: "Cool Cats", Note: "No pork"}, report.Notes[0])
+	assert.Equal(t, cateringRoleVolunteer, report.Notes[1].Role)
+
+	// Only checked-in students, teachers, and chaperones are counted on the
+	// day.
+	report, err = a.getCateringReport(ctx, currentSeason(), cateringBasisCheckedIn)
+	require.NoError(t, err)
+	assert.Equal(t, cateringLine{Name: "Total", Volunteers: 2}, *report.Total)
+	_, err = a.DB.CheckInStudent(ctx, "studentc@example.com", time.Now(), "volunteer@example.com", checkInStationScan)
+	require.NoError(t, err)
+	_, err = a.DB.CheckInChaperone(ctx, teacher.ID, time.Now(), "volunteer@example.com")
+	require.NoError(t, err)
+	report, err = a.getCateringReport(ctx, currentSeason(), cateringBasisCheckedIn)
+	require.NoError(t, err)
+	assert.Equal(t, cateringLine{Name: "Total", Students: 1, Teachers: 1, Volunteers: 2}, *report.Total)
+
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	rec := doRequest(router, http.MethodGet, "/admin/api/export/catering?column=meal&column=total", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Meal,Total\nVegetarian,2\nGluten-free,2\nOther,2\nNo Restrictions,1\nTotal,5\n", rec.Body.String())
+	rec = doRequest(router, http.MethodGet, "/admin/api/export/catering?column=meal&column=students&basis=checked_in", cookie)
+	assert.Equal(t, "Meal,Students\nVegetarian,0\nGluten-free,0\nOther,1\nNo Restrictions,0\nTotal,1\n", rec.Body.String())
+	rec = doRequest(router, http.MethodGet, "/admin/api/export/catering?basis=everyone", cookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(router, http.MethodGet, "/admin/api/export/dietaryrestrictions?column=name&column=dietary_categories&in_person=yes", cookie)
+	assert.Equal(t, "Name,Dietary Categories\nStudent,\"Vegetarian, Gluten-free\"\nStudent,\n", rec.Body.String())
+
+	rec = doRequest(router, http.MethodGet, "/admin/dietaryrestrictions", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "No pork")
+}
+
+func TestDietaryCategoryChoices(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	router := a.BuildRouter()
+	addTestStudent(t, a, "student@example.com", 16)
+	ids := addTestDietaryCategories(t, a, "Vegetarian", "Vegan")
+	link, err := a.getStudentConfirmEmailLink("student@example.com")
+	require.NoError(t, err)
+	path := strings.TrimPrefix(link, a.Config.Domain)
+
+	rec := doRequest(router, http.MethodGet, path)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `name="dietary-category"`)
+
+	// Categories from other seasons can't be chosen.
+	form := url.Values{
+		"confirm-info-correct": {"on"},
+		"parent-email":         {"parent@example.com"},
+		"dietary-category":     {"12345", "2"},
+		"dietary-restrictions": {"No mushrooms"},
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	student, err := a.DB.GetStudentByEmail(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, ids[1:], student.DietaryCategories)
+	assert.Equal(t, "No mushrooms", student.DietaryRestrictions)
+	assert.Contains(t, rec.Body.String(), `value="2"`+"\n"+`                            id="dietary-category-2" checked`)
+
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	require.NoError(t, a.DB.AddVolunteer(ctx, "volunteer@example.com"))
+	req = httptest.NewRequest(http.MethodPost, "/admin/volunteers/dietary",
+		strings.NewReader(url.Values{"email": {"volunteer@example.com"}, "dietary-category": {"1"}, "dietary-note": {" Halal "}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assertRedirectsTo(t, rec, "/admin/volunteers")
+	volunteers, err := a.DB.GetVolunteerDietaryChoices(ctx)
+	require.NoError(t, err)
+	require.Len(t, volunteers, 1)
+	assert.Equal(t, ids[:1], volunteers[0].Categories)
+	assert.Equal(t, "Halal", volunteers[0].Note)
+}
+
+func TestAdminDietaryCategories(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	names := func() []string {
+		categories, err := a.DB.GetDietaryCategories(ctx, currentSeason())
+		require.NoError(t, err)
+		var names []string
+		for _, category := range categories {
+			names = append(names, category.Name)
+		}
+		return names
+	}
+
+	post("/admin/dietaryrestrictions/category/copy", nil)
+	assert.Equal(t, defaultDietaryCategories, names(), "the defaults are used for the first season")
+	rec := post("/admin/dietaryrestrictions/category/copy", nil)
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+
+	// Later seasons start from the most recent season's categories.
+	for _, category := range []string{"Vegetarian", "Vegan"} {
+		require.NoError(t, a.DB.AddDietaryCategory(ctx, &database.DietaryCategory{Season: currentSeason() + 1, Name: category}))
+	}
+	season, err := a.DB.GetLatestDietaryCategorySeason(ctx, currentSeason()+2)
+	require.NoError(t, err)
+	assert.Equal(t, currentSeason()+1, season)
+
+	assert.Contains(t, post("/admin/dietaryrestrictions/category/add", url.Values{"name": {" "}}).Header().Get("Location"), "error=")
+	post("/admin/dietaryrestrictions/category/add", url.Values{"name": {"Kosher style"}})
+	categories, err := a.DB.GetDietaryCategories(ctx, currentSeason())
+	require.NoError(t, err)
+	assert.Equal(t, "Kosher style", categories[len(categories)-1].Name)
+
+	post("/admin/dietaryrestrictions/category/rename", url.Values{"id": {"1"}, "name": {"Veggie"}})
+	post("/admin/dietaryrestrictions/category/delete", url.Values{"id": {"2"}})
+	assert.Equal(t, []string{"Veggie", "Gluten-free", "Dairy-free", "Nut allergy", "Halal", "Kosher", "Kosher style"}, names())
+
+	next, err := a.DB.GetDietaryCategories(ctx, currentSeason()+1)
+	require.NoError(t, err)
+	rec = post("/admin/dietaryrestrictions/category/delete", url.Values{"id": {strconv.FormatInt(next[1].ID, 10)}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=", "other seasons' categories can't be changed")
+	next, err = a.DB.GetDietaryCategories(ctx, currentSeason()+1)
+	require.NoError(t, err)
+	assert.Len(t, next, 2)
+}
@@ -0,0 +1,570 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/pdf"
+)
+
+const maxSignatureSize = 1 << 20
+
+// certificateData is what the certificate body template is executed with.
+type certificateData struct {
+	Name     string
+	Team     string
+	School   string
+	Division database.Division
+	Season   int
+	// Awards are the student's team's placements in the season's results,
+	// such as "1st Place, Overall Winners".
+	Awards []string
+}
+
+// certificate is one student's certificate.
+type certificate struct {
+	certificateData
+	Email        string
+	TeacherEmail string
+}
+
+// sampleCertificate is used to check the body template and to preview the
+// certificate before anyone is registered.
+var sampleCertificate = &certificate{certificateData: certificateData{
+	Name:     "Ada Lovelace",
+	Team:     "Code Rats",
+	School:   "Golden High School",
+	Division: database.DivisionAdvanced,
+	Season:   2030,
+	Awards:   []string{"1st Place, Overall Winners"},
+}}
+
+// getCertificateAwards returns a function that finds the placements of a team
+// in the season's archive results. Winners are matched by their linked team,
+// or by team name and school if they are not linked.
+func (a *Application) getCertificateAwards(ctx context.Context, season int) (func(team *database.TeamWithTeacherName) []string, error) {
+	year, err := a.DB.GetArchiveYear(ctx, season)
+	if err != nil {
+		return nil, err
+	}
+	byTeamID := map[uuid.UUID][]string{}
+	byName := map[string][]string{}
+	if year != nil {
+		for _, result := range year.Results {
+			for _, winner := range result.Winners {
+				award := fmt.Sprintf("%s Place, %s", ordinal(winner.Place), result.Name)
+				if winner.TeamID != uuid.Nil {
+					byTeamID[winner.TeamID] = append(byTeamID[winner.TeamID], award)
+				} else {
+					key := participationNameKey(winner.TeamName, winner.School)
+					byName[key] = append(byName[key], award)
+				}
+			}
+		}
+	}
+	return func(team *database.TeamWithTeacherName) []string {
+		return slices.Concat(byTeamID[team.ID], byName[participationNameKey(team.Name, team.SchoolName)])
+	}, nil
+}
+
+// getCertificates returns a certificate for every student that took part,
+// sorted by team and then by name. Students on in-person teams took part if
+// they were checked in, and students on remote teams if they confirmed their
+// registration. If teacherEmail is not empty, only that teacher's students are
+// included.
+func (a *Application) getCertificates(ctx context.Context, teacherEmail string) ([]*certificate, error) {
+	season := currentSeason()
+	awards, err := a.getCertificateAwards(ctx, season)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get awards: %w", err)
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams: %w", err)
+	}
+	checkedIn, err := a.DB.GetCheckedInStudentEmails(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checked in students: %w", err)
+	}
+	var certificates []*certificate
+	for _, team := range teams {
+		if teacherEmail != "" && team.TeacherEmail != teacherEmail {
+			continue
+		}
+		teamAwards := awards(team)
+		for _, member := range team.Members {
+			if (team.InPerson && !checkedIn[member.Email]) || (!team.InPerson && !member.EmailConfirmed) {
+				continue
+			}
+			certificates = append(certificates, &certificate{
+				certificateData: certificateData{
+					Name:     member.Name,
+					Team:     team.Name,
+					School:   team.SchoolName,
+					Division: team.Division,
+					Season:   season,
+					Awards:   teamAwards,
+				},
+				Email:        member.Email,
+				TeacherEmail: team.TeacherEmail,
+			})
+		}
+	}
+	slices.SortFunc(certificates, func(a, b *certificate) int {
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(a.Team), strings.ToLower(b.Team)),
+			cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)),
+		)
+	})
+	return certificates, nil
+}
+
+// parseCertificateBody parses the body template and checks that it can be
+// executed.
+func parseCertificateBody(body string) (*texttemplate.Template, error) {
+	tmpl, err := texttemplate.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(&strings.Builder{}, sampleCertificate.certificateData); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// certificateRenderer draws certificates using the saved settings.
+type certificateRenderer struct {
+	settings  *database.CertificateSettings
+	body      *texttemplate.Template
+	signature image.Image
+}
+
+func (a *Application) newCertificateRenderer(ctx context.Context) (*certificateRenderer, error) {
+	settings, err := a.DB.GetCertificateSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate settings: %w", err)
+	}
+	renderer := &certificateRenderer{settings: settings}
+	if renderer.body, err = parseCertificateBody(settings.Body); err != nil {
+		return nil, fmt.Errorf("invalid certificate body: %w", err)
+	}
+	if len(settings.Signature) > 0 {
+		if renderer.signature, _, err = image.Decode(bytes.NewReader(settings.Signature)); err != nil {
+			return nil, fmt.Errorf("invalid signature image: %w", err)
+		}
+	}
+	return renderer, nil
+}
+
+// render draws each certificate on its own landscape page.
+func (cr *certificateRenderer) render(certificates []*certificate) (*pdf.Document, error) {
+	doc := pdf.New()
+	var signature *pdf.Image
+	if cr.signature != nil {
+		var err error
+		if signature, err = doc.AddImage(cr.signature); err != nil {
+			return nil, err
+		}
+	}
+	for _, cert := range certificates {
+		if err := cr.draw(doc.AddPage(pdf.LetterHeight, pdf.LetterWidth), signature, cert); err != nil {
+			return nil, fmt.Errorf("failed to draw certificate for %s: %w", cert.Email, err)
+		}
+	}
+	if len(certificates) == 0 {
+		doc.AddPage(pdf.LetterHeight, pdf.LetterWidth)
+	}
+	return doc, nil
+}
+
+func (cr *certificateRenderer) draw(page *pdf.Page, signature *pdf.Image, cert *certificate) error {
+	var body strings.Builder
+	if err := cr.body.Execute(&body, cert.certificateData); err != nil {
+		return err
+	}
+
+	width := page.Width() - 2.5*pdf.Inch
+	centerX := page.Width() / 2
+	top := page.Height()
+	page.Rect(0.4*pdf.Inch, 0.4*pdf.Inch, page.Width()-0.8*pdf.Inch, page.Height()-0.8*pdf.Inch, 3)
+	page.Rect(0.5*pdf.Inch, 0.5*pdf.Inch, page.Width()-1*pdf.Inch, page.Height()-1*pdf.Inch, 1)
+
+	titleSize, title := pdf.HelveticaBold.Fit(width, 36, 20, cr.settings.Title)
+	page.TextCentered(pdf.HelveticaBold, titleSize, centerX, top-1.5*pdf.Inch, title)
+	page.TextCentered(pdf.Helvetica, 14, centerX, top-2.2*pdf.Inch, "This certificate is presented to")
+
+	nameSize, name := pdf.HelveticaBold.Fit(width, 40, 18, cert.Name)
+	nameY := top - 3*pdf.Inch
+	page.TextCentered(pdf.HelveticaBold, nameSize, centerX, nameY, name)
+	page.Line(centerX-width/2+pdf.Inch, nameY-12, centerX+width/2-pdf.Inch, nameY-12, 0.75, 0)
+
+	lineY := nameY - 0.6*pdf.Inch
+	for _, line := range pdf.Helvetica.Wrap(width, 14, body.String()) {
+		page.TextCentered(pdf.Helvetica, 14, centerX, lineY, line)
+		lineY -= 20
+	}
+	lineY -= 8
+	for _, award := range cert.Awards {
+		size, award := pdf.HelveticaBold.Fit(width, 16, 10, award)
+		page.TextCentered(pdf.HelveticaBold, size, centerX, lineY, award)
+		lineY -= 22
+	}
+
+	// The signature goes above the signature line at the bottom, scaled to
+	// fit in a 3" x 0.75" box.
+	signatureY := 1.5 * pdf.Inch
+	if signature != nil {
+		bounds := cr.signature.Bounds()
+		scale := min(3*pdf.Inch/float64(bounds.Dx()), 0.75*pdf.Inch/float64(bounds.Dy()))
+		imageWidth, imageHeight := float64(bounds.Dx())*scale, float64(bounds.Dy())*scale
+		page.Image(signature, centerX-imageWidth/2, signatureY+4, imageWidth, imageHeight)
+	}
+	page.Line(centerX-1.75*pdf.Inch, signatureY, centerX+1.75*pdf.Inch, signatureY, 0.75, 0)
+	if cr.settings.SignerName != "" {
+		page.TextCentered(pdf.Helvetica, 12, centerX, signatureY-16, cr.settings.SignerName)
+	}
+	if cr.settings.SignerTitle != "" {
+		page.TextCentered(pdf.Helvetica, 10, centerX, signatureY-30, cr.settings.SignerTitle)
+	}
+	page.Text(pdf.Helvetica, 10, 0.75*pdf.Inch, 0.75*pdf.Inch, fmt.Sprintf("CS@Mines HSPC %d", cert.Season))
+	return nil
+}
+
+// certificateFilename is the name of a student's certificate file.
+func certificateFilename(cert *certificate) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, cert.Name)
+	return fmt.Sprintf("hspc-%d-certificate-%s.pdf", cert.Season, strings.Trim(name, "-"))
+}
+
+// getCertificatesToSend returns the certificates that have not been emailed,
+// or all of them if resend is true.
+func (a *Application) getCertificatesToSend(ctx context.Context, resend bool) ([]*certificate, error) {
+	certificates, err := a.getCertificates(ctx, "")
+	if err != nil {
+		return nil, err
+	} else if resend {
+		return certificates, nil
+	}
+	sent, err := a.DB.GetCertificatesSent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(certificates, func(cert *certificate) bool {
+		_, ok := sent[cert.Email]
+		return ok
+	}), nil
+}
+
+// sendCertificates emails each student their certificate and returns the
+// number that were sent. Failures to send to a student are logged and the
+// rest of the students are still sent their certificates.
+func (a *Application) sendCertificates(ctx context.Context, certificates []*certificate) (int, error) {
+	log := zerolog.Ctx(ctx).With().Str("action", "send_certificates").Logger()
+	renderer, err := a.newCertificateRenderer(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sent, err := a.DB.GetCertificatesSent(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, cert := range certificates {
+		log := log.With().Str("student_email", cert.Email).Logger()
+		doc, err := renderer.render([]*certificate{cert})
+		if err != nil {
+			log.Err(err).Msg("failed to render certificate")
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err := doc.WriteTo(&buf); err != nil {
+			log.Err(err).Msg("failed to write certificate")
+			continue
+		}
+
+		attachment := mail.NewAttachment()
+		attachment.SetFilename(certificateFilename(cert))
+		attachment.SetType("application/pdf")
+		attachment.SetContent(base64.StdEncoding.EncodeToString(buf.Bytes()))
+
+		var plainTextContent, htmlContent strings.Builder
+		texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/certificate.txt")).Execute(&plainTextContent, cert)
+		htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/certificate.html")).Execute(&htmlContent, cert)
+
+		_, resend := sent[cert.Email]
+		sendErr := a.SendEmail(log, fmt.Sprintf("Your %d Mines HSPC Certificate", cert.Season),
+			mail.NewEmail(cert.Name, cert.Email),
+			plainTextContent.String(),
+			htmlContent.String(),
+			attachment)
+		err = a.recordEmailSend(ctx, &database.EmailSend{
+			TeacherEmail: cert.TeacherEmail,
+			StudentEmail: cert.Email,
+			Recipient:    cert.Email,
+			Kind:         database.EmailKindCertificate,
+			Source:       database.EmailSourceAdmin,
+			Resend:       resend,
+		}, sendErr)
+		if err != nil {
+			log.Err(err).Msg("failed to record email send")
+		}
+		if sendErr != nil {
+			continue
+		}
+		if err := a.DB.MarkCertificateSent(ctx, cert.Email); err != nil {
+			log.Err(err).Msg("failed to mark certificate sent")
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (a *Application) GetAdminCertificatesTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	settings, err := a.DB.GetCertificateSettings(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get certificate settings")
+		return nil
+	}
+	certificates, err := a.getCertificates(ctx, "")
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get certificates")
+		return nil
+	}
+	sent, err := a.DB.GetCertificatesSent(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get sent certificates")
+		return nil
+	}
+	var awarded, sentCount int
+	for _, cert := range certificates {
+		if len(cert.Awards) > 0 {
+			awarded++
+		}
+		if _, ok := sent[cert.Email]; ok {
+			sentCount++
+		}
+	}
+	return map[string]any{
+		"Settings":     settings,
+		"Season":       currentSeason(),
+		"Certificates": len(certificates),
+		"Awarded":      awarded,
+		"Sent":         sentCount,
+		"Unsent":       len(certificates) - sentCount,
+		"Error":        r.URL.Query().Get("error"),
+		"Message":      r.URL.Query().Get("message"),
+	}
+}
+
+func redirectToCertificates(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/certificates"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// HandleAdminSaveCertificateSettings saves the certificate template and
+// replaces or removes the signature image.
+func (a *Application) HandleAdminSaveCertificateSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, maxSignatureSize+1<<16)
+	if err := r.ParseMultipartForm(maxSignatureSize); err != nil && err != http.ErrNotMultipart {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		redirectToCertificates(w, r, "error", "The signature image is too large.")
+		return
+	}
+
+	settings := &database.CertificateSettings{
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Body:        strings.TrimSpace(r.FormValue("body")),
+		SignerName:  strings.TrimSpace(r.FormValue("signer_name")),
+		SignerTitle: strings.TrimSpace(r.FormValue("signer_title")),
+		Released:    r.FormValue("released") == "on",
+	}
+	if settings.Title == "" || settings.Body == "" {
+		redirectToCertificates(w, r, "error", "The title and body are required.")
+		return
+	} else if _, err := parseCertificateBody(settings.Body); err != nil {
+		redirectToCertificates(w, r, "error", fmt.Sprintf("The body is not a valid template: %s", err))
+		return
+	}
+
+	signature, err := readFormUpload(r, "signature")
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to read signature image")
+		redirectToCertificates(w, r, "error", "Failed to read the signature image.")
+		return
+	} else if len(signature) > 0 {
+		if _, _, err := image.Decode(bytes.NewReader(signature)); err != nil {
+			redirectToCertificates(w, r, "error", "The signature must be a PNG or JPEG image.")
+			return
+		}
+	}
+
+	if err := a.DB.SaveCertificateSettings(ctx, settings); err != nil {
+		a.Log.Err(err).Msg("failed to save certificate settings")
+		redirectToCertificates(w, r, "error", "Failed to save the certificate settings.")
+		return
+	}
+	if len(signature) > 0 || r.FormValue("remove_signature") == "on" {
+		if err := a.DB.SetCertificateSignature(ctx, signature); err != nil {
+			a.Log.Err(err).Msg("failed to save certificate signature")
+			redirectToCertificates(w, r, "error", "Failed to save the signature image.")
+			return
+		}
+	}
+	redirectToCertificates(w, r, "message", "Saved the certificate settings.")
+}
+
+// HandleAdminCertificatesExport renders every student's certificate into one
+// PDF. With ?preview=true, only one certificate is rendered, using sample data
+// if nobody is registered.
+func (a *Application) HandleAdminCertificatesExport(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "admin_certificates_export").Logger()
+	certificates, err := a.getCertificates(r.Context(), "")
+	if err != nil {
+		log.Err(err).Msg("failed to get certificates")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	filename := "certificates.pdf"
+	if r.URL.Query().Get("preview") == "true" {
+		filename = "certificate-preview.pdf"
+		// Prefer a certificate with an award to show how awards look.
+		preview := []*certificate{sampleCertificate}
+		if i := slices.IndexFunc(certificates, func(cert *certificate) bool { return len(cert.Awards) > 0 }); i >= 0 {
+			preview = certificates[i : i+1]
+		} else if len(certificates) > 0 {
+			preview = certificates[:1]
+		}
+		certificates = preview
+	}
+	a.writeCertificates(w, r, log, filename, certificates)
+}
+
+func (a *Application) writeCertificates(w http.ResponseWriter, r *http.Request, log zerolog.Logger, filename string, certificates []*certificate) {
+	renderer, err := a.newCertificateRenderer(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to load certificate settings")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	doc, err := renderer.render(certificates)
+	if err != nil {
+		log.Err(err).Msg("failed to render certificates")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := writePDF(w, filename, doc); err != nil {
+		log.Err(err).Msg("failed to write certificates")
+	}
+}
+
+// HandleAdminSendCertificates starts emailing the certificates in the
+// background, since there may be hundreds of them.
+func (a *Application) HandleAdminSendCertificates(w http.ResponseWriter, r *http.Request) {
+	log := hlog.FromRequest(r).With().Str("action", "send_certificates").Logger()
+	if err := r.ParseForm(); err != nil {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !a.sendingCertificates.CompareAndSwap(false, true) {
+		redirectToCertificates(w, r, "error", "The certificates are already being sent. Please wait for that to finish.")
+		return
+	}
+	sending := false
+	defer func() {
+		if !sending {
+			a.sendingCertificates.Store(false)
+		}
+	}()
+
+	resend := r.FormValue("resend") == "on"
+	certificates, err := a.getCertificatesToSend(r.Context(), resend)
+	if err != nil {
+		log.Err(err).Msg("failed to get certificates to send")
+		redirectToCertificates(w, r, "error", "Failed to get the certificates.")
+		return
+	} else if len(certificates) == 0 {
+		redirectToCertificates(w, r, "message", "There are no certificates to send.")
+		return
+	}
+	// Check the settings now so that problems are shown instead of only being
+	// logged by the background sender.
+	if _, err := a.newCertificateRenderer(r.Context()); err != nil {
+		log.Err(err).Msg("failed to load certificate settings")
+		redirectToCertificates(w, r, "error", err.Error())
+		return
+	}
+
+	sending = true
+	go func() {
+		defer a.sendingCertificates.Store(false)
+		ctx := log.WithContext(context.Background())
+		sent, err := a.sendCertificates(ctx, certificates)
+		if err != nil {
+			log.Err(err).Msg("failed to send certificates")
+		}
+		log.Info().Int("sent", sent).Int("total", len(certificates)).Msg("finished sending certificates")
+	}()
+	redirectToCertificates(w, r, "message", fmt.Sprintf("Sending certificates to %d students.", len(certificates)))
+}
+
+// HandleTeacherCertificates downloads the certificates of all of the teacher's
+// students in one PDF once they have been released.
+func (a *Application) HandleTeacherCertificates(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "teacher_certificates").Logger()
+	user, err := a.GetLoggedInTeacher(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get logged in user")
+		http.Redirect(w, r, "/register/teacher/login", http.StatusSeeOther)
+		return
+	}
+	log = log.With().Str("teacher_email", user.Email).Logger()
+
+	settings, err := a.DB.GetCertificateSettings(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to get certificate settings")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if !settings.Released {
+		log.Warn().Msg("teacher tried to download certificates before they were released")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	certificates, err := a.getCertificates(r.Context(), user.Email)
+	if err != nil {
+		log.Err(err).Msg("failed to get certificates")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.writeCertificates(w, r, log, fmt.Sprintf("hspc-%d-certificates.pdf", currentSeason()), certificates)
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestParseCertificateBody(t *testing.T) {
+	_, err := parseCertificateBody("for {{ .Team }} in {{ .Season }}")
+	assert.NoError(t, err)
+	_, err = parseCertificateBody("for {{ .Team ")
+	assert.Error(t, err)
+	_, err = parseCertificateBody("for {{ .Teacher }}")
+	assert.ErrorContains(t, err, "Teacher")
+}
+
+func TestCertificates(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	teams := addTestResultsTeams(t, a)
+	for _, email := range []string{"studenta@example.com", "studentb@example.com", "studentc@example.com"} {
+		require.NoError(t, a.DB.ConfirmStudent(ctx, email, false, "", "parent@example.com"))
+	}
+	_, err := a.DB.CheckInStudent(ctx, "studenta@example.com", time.Now(), "volunteer@example.com", "")
+	require.NoError(t, err)
+
+	// Code Rats is linked to its result and Lobos 3 is matched by name.
+	season := currentSeason()
+	require.NoError(t, a.DB.SaveArchiveYear(ctx, season, ""))
+	result := &database.ArchiveResult{Year: season, Name: "Overall Winners"}
+	require.NoError(t, a.DB.AddArchiveResult(ctx, result))
+	require.NoError(t, a.DB.AddArchiveWinner(ctx, &database.ArchiveWinner{ResultID: result.ID, Place: 1, TeamName: "Code Rats", TeamID: teams["Code Rats"]}))
+	require.NoError(t, a.DB.AddArchiveWinner(ctx, &database.ArchiveWinner{ResultID: result.ID, Place: 2, TeamName: "lobos 3", School: "School"}))
+
+	certificates, err := a.getCertificates(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, certificates, 2, "in-person students that were not checked in do not get certificates")
+	assert.Equal(t, "Code Rats", certificates[0].Team)
+	assert.Equal(t, []string{"1st Place, Overall Winners"}, certificates[0].Awards)
+	assert.Equal(t, []string{"2nd Place, Overall Winners"}, certificates[1].Awards)
+
+	sent, err := a.sendCertificates(ctx, certificates)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	unsent, err := a.getCertificatesToSend(ctx, false)
+	require.NoError(t, err)
+	assert.Empty(t, unsent)
+	lastSend, err := a.DB.GetLatestEmailSend(ctx, "studenta@example.com", database.EmailKindCertificate)
+	require.NoError(t, err)
+	require.NotNil(t, lastSend)
+	assert.Equal(t, database.EmailSourceAdmin, lastSend.Source)
+}
+
+func TestAdminCertificates(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", false, "", "parent@example.com"))
+	_, err := a.DB.CheckInStudent(ctx, "student@example.com", time.Now(), "volunteer@example.com", "")
+	require.NoError(t, err)
+
+	saveSettings := func(body string, signature []byte) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		for key, value := range map[string]string{"title": "Certificate of Awesome", "body": body, "signer_name": "Dean", "released": "on"} {
+			require.NoError(t, writer.WriteField(key, value))
+		}
+		if signature != nil {
+			file, err := writer.CreateFormFile("signature", "signature.png")
+			require.NoError(t, err)
+			file.Write(signature)
+		}
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/admin/certificates/save", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := saveSettings("for {{ .Nope }}", nil)
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+	rec = saveSettings("for {{ .Team }}", []byte("not an image"))
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+
+	var signature bytes.Buffer
+	require.NoError(t, png.Encode(&signature, image.NewGray(image.Rect(0, 0, 40, 10))))
+	rec = saveSettings("for {{ .Team }}", signature.Bytes())
+	assert.Contains(t, rec.Header().Get("Location"), "message=")
+	settings, err := a.DB.GetCertificateSettings(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Certificate of Awesome", settings.Title)
+	assert.True(t, settings.Released)
+	assert.NotEmpty(t, settings.Signature)
+
+	rec = doRequest(router, http.MethodGet, "/admin/api/certificates?preview=true", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "%PDF-"))
+
+	// Teachers can download their students' certificates once they are
+	// released.
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Issuer:    string(IssuerSessionToken),
+		Subject:   "teacher@example.com",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(testSecretKey))
+	require.NoError(t, err)
+	teacherCookie := &http.Cookie{Name: "tok", Value: tok}
+	rec = doRequest(router, http.MethodGet, "/register/teacher/certificates", teacherCookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/Count 1")
+
+	settings.Released = false
+	require.NoError(t, a.DB.SaveCertificateSettings(ctx, settings))
+	rec = doRequest(router, http.MethodGet, "/register/teacher/certificates", teacherCookie)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminSendCertificates_AlreadySending(t *testing.T) {
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+
+	a.sendingCertificates.Store(true)
+	rec := doRequest(router, http.MethodPost, "/admin/certificates/send", cookie)
+	assert.Contains(t, rec.Header().Get("Location"), "already+being+sent")
+
+	a.sendingCertificates.Store(false)
+	rec = doRequest(router, http.MethodPost, "/admin/certificates/send", cookie)
+	assert.Contains(t, rec.Header().Get("Location"), "no+certificates")
+	assert.False(t, a.sendingCertificates.Load(), "the guard should be released if nothing is sent")
+}
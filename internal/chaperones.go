@@ -0,0 +1,491 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog/hlog"
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/export"
+)
+
+// chaperoneFieldMaxLength limits how long the name, email, and phone number
+// of a chaperone can be.
+const chaperoneFieldMaxLength = 200
+
+// getChaperoneQRToken returns the token in the chaperone's ticket. Chaperones
+// are identified by ID since their email can be changed.
+func (a *Application) getChaperoneQRToken(id int64) (string, error) {
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Issuer:  string(IssuerChaperoneQRCode),
+		Subject: strconv.FormatInt(id, 10),
+	})
+	return tok.SignedString(a.Config.ReadSecretKey())
+}
+
+func (a *Application) getChaperoneQRCodeImage(id int64) ([]byte, error) {
+	signedTok, err := a.getChaperoneQRToken(id)
+	if err != nil {
+		return nil, err
+	}
+	return qrcode.Encode(fmt.Sprintf("%s/volunteer/scan?tok=%s", a.Config.Domain, signedTok), qrcode.Medium, 256)
+}
+
+func (a *Application) getChaperoneByQRToken(ctx context.Context, tokenStr string) (*database.Chaperone, error) {
+	subject, err := a.parseQRToken(tokenStr, IssuerChaperoneQRCode)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chaperone ID in token: %w", err)
+	}
+	chaperone, err := a.DB.GetChaperone(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if chaperone == nil {
+		return nil, errors.New("chaperone was removed")
+	}
+	return chaperone, nil
+}
+
+func (a *Application) sendChaperoneTicketEmail(ctx context.Context, chaperone *database.ChaperoneWithTeacher) error {
+	qrcodeBytes, err := a.getChaperoneQRCodeImage(chaperone.ID)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get chaperone QR code image")
+		return err
+	}
+	return a.sendTicketEmail(ctx, chaperone.Email, "chaperoneticket", qrcodeBytes, map[string]any{
+		"Name":          chaperone.Name,
+		"TeacherName":   chaperone.TeacherName,
+		"SchoolName":    chaperone.SchoolName,
+		"IsTeacher":     chaperone.IsTeacher,
+		"ParkingPermit": chaperone.ParkingPermit,
+	})
+}
+
+// setChaperoneScanData adds what the volunteer needs to know about a scanned
+// chaperone ticket to the scan page.
+func (a *Application) setChaperoneScanData(ctx context.Context, res map[string]any, chaperone *database.Chaperone) {
+	res["Chaperone"] = chaperone
+	res["WrongSeason"] = chaperone.Season != currentSeason()
+	teacher, err := a.DB.GetTeacherByEmail(ctx, chaperone.TeacherEmail)
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to get chaperone's teacher")
+		return
+	}
+	res["ChaperoneTeacher"] = teacher
+}
+
+// checkInChaperone checks in the chaperone if their ticket is for this season.
+func (a *Application) checkInChaperone(r *http.Request, chaperone *database.Chaperone) {
+	if chaperone.CheckedIn || chaperone.Season != currentSeason() {
+		return
+	}
+	volunteer := a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin)
+	recorded, err := a.DB.CheckInChaperone(r.Context(), chaperone.ID, time.Now(), volunteer)
+	if err != nil {
+		hlog.FromRequest(r).Err(err).Int64("chaperone_id", chaperone.ID).Msg("failed to check in chaperone")
+	} else if recorded {
+		hlog.FromRequest(r).Info().
+			Int64("chaperone_id", chaperone.ID).
+			Str("volunteer_email", volunteer).
+			Msg("checked in chaperone")
+	}
+}
+
+// chaperoneDietaryNames returns the names of the chosen dietary categories.
+func chaperoneDietaryNames(categories []*database.DietaryCategory, chosen []int64) []string {
+	var names []string
+	for _, category := range categories {
+		if slices.Contains(chosen, category.ID) {
+			names = append(names, category.Name)
+		}
+	}
+	return names
+}
+
+// teacherChaperone is a chaperone on the teacher's teams page.
+type teacherChaperone struct {
+	*database.Chaperone
+	DietaryNames []string
+}
+
+// setTeacherAttendanceData adds the teacher's own attendance and the
+// chaperones that they registered for this season to the teams page.
+func (a *Application) setTeacherAttendanceData(ctx context.Context, data map[string]any, teacher *database.Teacher) error {
+	season := currentSeason()
+	chaperones, err := a.DB.GetTeacherChaperones(ctx, season, teacher.Email)
+	if err != nil {
+		return err
+	}
+	categories, err := a.DB.GetDietaryCategories(ctx, season)
+	if err != nil {
+		return err
+	}
+
+	// Until the teacher registers for this season, their dietary
+	// restrictions from last time are filled in.
+	dietaryCategories, dietaryNote := teacher.DietaryCategories, teacher.DietaryNote
+	var others []teacherChaperone
+	for _, chaperone := range chaperones {
+		if chaperone.IsTeacher {
+			data["Attendance"] = chaperone
+			dietaryCategories, dietaryNote = chaperone.DietaryCategories, chaperone.DietaryNote
+		} else {
+			others = append(others, teacherChaperone{chaperone, chaperoneDietaryNames(categories, chaperone.DietaryCategories)})
+		}
+	}
+	data["Chaperones"] = others
+	data["DietaryOptions"] = dietaryOptions(categories, dietaryCategories)
+	data["DietaryNote"] = dietaryNote
+	data["ChaperoneDietaryOptions"] = dietaryOptions(categories, nil)
+	return nil
+}
+
+func redirectToTeacherTeams(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	target := "/register/teacher/teams"
+	if errorMessage != "" {
+		target += "?" + url.Values{"error": {errorMessage}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func limitLength(s string, maxLength int) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > maxLength {
+		return string([]rune(s)[:maxLength])
+	}
+	return s
+}
+
+// parseChaperoneForm reads the fields that are shared by the teacher's
+// attendance form and the form for adding a chaperone into the chaperone.
+func (a *Application) parseChaperoneForm(r *http.Request, chaperone *database.Chaperone) (err error) {
+	chaperone.Phone = limitLength(r.FormValue("phone"), chaperoneFieldMaxLength)
+	chaperone.ParkingPermit = r.FormValue("parking-permit") == "on"
+	chaperone.DietaryCategories, chaperone.DietaryNote, err = a.parseDietaryForm(r)
+	return err
+}
+
+// HandleTeacherAttendance registers the teacher to come to campus this season,
+// or cancels their registration.
+func (a *Application) HandleTeacherAttendance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "teacher_attendance").Logger()
+	user, err := a.GetLoggedInTeacher(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get logged in user")
+		http.Redirect(w, r, "/register/teacher/login", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log = log.With().Str("teacher_email", user.Email).Logger()
+
+	chaperones, err := a.DB.GetTeacherChaperones(ctx, currentSeason(), user.Email)
+	if err != nil {
+		log.Err(err).Msg("failed to get chaperones")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var attendance *database.Chaperone
+	if i := slices.IndexFunc(chaperones, func(c *database.Chaperone) bool { return c.IsTeacher }); i >= 0 {
+		attendance = chaperones[i]
+	}
+
+	if r.FormValue("attending") != "on" {
+		if attendance == nil {
+			redirectToTeacherTeams(w, r, "")
+			return
+		} else if attendance.CheckedIn {
+			redirectToTeacherTeams(w, r, "You have already been checked in.")
+			return
+		}
+		if err := a.DB.DeleteChaperone(ctx, attendance.ID); err != nil {
+			log.Err(err).Msg("failed to cancel teacher attendance")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Info().Msg("teacher cancelled their attendance")
+		redirectToTeacherTeams(w, r, "")
+		return
+	}
+
+	isNew := attendance == nil
+	if isNew {
+		attendance = &database.Chaperone{Season: currentSeason(), TeacherEmail: user.Email, IsTeacher: true}
+	}
+	attendance.Name = user.Name
+	attendance.Email = user.Email
+	if err := a.parseChaperoneForm(r, attendance); err != nil {
+		log.Err(err).Msg("failed to parse dietary restrictions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The teacher's dietary restrictions are also kept with their account
+	// so that they are filled in next season.
+	if err := a.DB.SetTeacherDietaryChoice(ctx, user.Email, attendance.DietaryCategories, attendance.DietaryNote); err != nil {
+		log.Err(err).Msg("failed to save dietary restrictions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if isNew {
+		err = a.DB.AddChaperone(ctx, attendance)
+	} else {
+		err = a.DB.UpdateChaperone(ctx, attendance)
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to save teacher attendance")
+		redirectToTeacherTeams(w, r, "Failed to register you. If another teacher registered you as a chaperone, please ask them to remove you.")
+		return
+	}
+	redirectToTeacherTeams(w, r, "")
+}
+
+func (a *Application) HandleTeacherAddChaperone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "teacher_add_chaperone").Logger()
+	user, err := a.GetLoggedInTeacher(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get logged in user")
+		http.Redirect(w, r, "/register/teacher/login", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		log.Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	chaperone := &database.Chaperone{
+		Season:       currentSeason(),
+		TeacherEmail: user.Email,
+		Name:         limitLength(r.FormValue("name"), chaperoneFieldMaxLength),
+		Email:        limitLength(r.FormValue("email"), chaperoneFieldMaxLength),
+	}
+	if chaperone.Name == "" || !strings.Contains(chaperone.Email, "@") {
+		redirectToTeacherTeams(w, r, "Please enter the chaperone's name and email address.")
+		return
+	}
+	if err := a.parseChaperoneForm(r, chaperone); err != nil {
+		log.Err(err).Msg("failed to parse dietary restrictions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := a.DB.AddChaperone(ctx, chaperone); err != nil {
+		log.Err(err).Msg("failed to add chaperone")
+		redirectToTeacherTeams(w, r, fmt.Sprintf("Failed to add %s. Each email address can only be registered once.", chaperone.Name))
+		return
+	}
+	log.Info().
+		Str("teacher_email", user.Email).
+		Int64("chaperone_id", chaperone.ID).
+		Msg("added chaperone")
+	redirectToTeacherTeams(w, r, "")
+}
+
+// getTeacherChaperone returns the chaperone in the id parameter if it is one
+// of the logged in teacher's chaperones. Otherwise, an error response is
+// written and nil is returned.
+func (a *Application) getTeacherChaperone(w http.ResponseWriter, r *http.Request) *database.Chaperone {
+	user, err := a.GetLoggedInTeacher(r)
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("Failed to get logged in user")
+		http.Redirect(w, r, "/register/teacher/login", http.StatusSeeOther)
+		return nil
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	}
+	chaperone, err := a.DB.GetChaperone(r.Context(), id)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get chaperone")
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil
+	} else if chaperone == nil || chaperone.TeacherEmail != user.Email {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	return chaperone
+}
+
+func (a *Application) HandleTeacherRemoveChaperone(w http.ResponseWriter, r *http.Request) {
+	chaperone := a.getTeacherChaperone(w, r)
+	if chaperone == nil {
+		return
+	} else if chaperone.IsTeacher {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	} else if chaperone.CheckedIn {
+		redirectToTeacherTeams(w, r, fmt.Sprintf("%s has already been checked in.", chaperone.Name))
+		return
+	}
+	if err := a.DB.DeleteChaperone(r.Context(), chaperone.ID); err != nil {
+		a.Log.Err(err).Msg("failed to remove chaperone")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.Log.Info().
+		Str("teacher_email", chaperone.TeacherEmail).
+		Int64("chaperone_id", chaperone.ID).
+		Msg("removed chaperone")
+	redirectToTeacherTeams(w, r, "")
+}
+
+// HandleTeacherChaperoneTicket downloads the ticket of the teacher or one of
+// their chaperones.
+func (a *Application) HandleTeacherChaperoneTicket(w http.ResponseWriter, r *http.Request) {
+	chaperone := a.getTeacherChaperone(w, r)
+	if chaperone == nil {
+		return
+	}
+	image, err := a.getChaperoneQRCodeImage(chaperone.ID)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get chaperone QR code image")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", `attachment; filename="ticket.png"`)
+	w.Write(image)
+}
+
+// exportChaperone is a chaperone in the admin pages and exports.
+type exportChaperone struct {
+	*database.ChaperoneWithTeacher
+	DietaryNames []string
+}
+
+func (c *exportChaperone) Role() string {
+	if c.IsTeacher {
+		return "Teacher"
+	}
+	return "Chaperone"
+}
+
+func (a *Application) getExportChaperones(ctx context.Context) ([]*exportChaperone, error) {
+	chaperones, err := a.DB.GetChaperones(ctx, currentSeason())
+	if err != nil {
+		return nil, err
+	}
+	categories, err := a.DB.GetDietaryCategories(ctx, currentSeason())
+	if err != nil {
+		return nil, err
+	}
+	exportChaperones := make([]*exportChaperone, len(chaperones))
+	for i, chaperone := range chaperones {
+		exportChaperones[i] = &exportChaperone{chaperone, chaperoneDietaryNames(categories, chaperone.DietaryCategories)}
+	}
+	return exportChaperones, nil
+}
+
+func (a *Application) chaperonesExportDataset() *exportDataset[*exportChaperone] {
+	return &exportDataset[*exportChaperone]{
+		name:  "chaperones",
+		title: "Teachers and Chaperones",
+		columns: []exportColumn[*exportChaperone]{
+			column("name", "Name", func(c *exportChaperone) any { return c.Name }),
+			column("email", "Email", func(c *exportChaperone) any { return c.Email }),
+			column("phone", "Phone", func(c *exportChaperone) any { return c.Phone }),
+			column("role", "Role", func(c *exportChaperone) any { return c.Role() }),
+			column("teacher", "Teacher", func(c *exportChaperone) any { return c.TeacherName }),
+			column("school", "School", func(c *exportChaperone) any { return c.SchoolName }),
+			column("parking_permit", "Parking Permit", func(c *exportChaperone) any { return c.ParkingPermit }),
+			column("dietary_categories", "Dietary Categories", func(c *exportChaperone) any { return strings.Join(c.DietaryNames, ", ") }),
+			column("dietary_note", "Other Dietary Restrictions", func(c *exportChaperone) any { return c.DietaryNote }),
+			column("ticket_sent", "Ticket Sent", func(c *exportChaperone) any { return c.TicketSent }),
+			column("checked_in", "On Site", func(c *exportChaperone) any { return c.CheckedIn }),
+			column("registered", "Registered", func(c *exportChaperone) any { return c.RegisteredTS }),
+		},
+		filters: []exportFilter[*exportChaperone]{
+			yesNoFilter("teacher", "Teacher", func(c *exportChaperone) bool { return c.IsTeacher }),
+			yesNoFilter("parking_permit", "Parking Permit", func(c *exportChaperone) bool { return c.ParkingPermit }),
+			yesNoFilter("checked_in", "On Site", func(c *exportChaperone) bool { return c.CheckedIn }),
+		},
+		rows: a.getExportChaperones,
+	}
+}
+
+func (a *Application) GetAdminChaperonesTemplate(r *http.Request) map[string]any {
+	chaperones, err := a.getExportChaperones(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get chaperones")
+		return nil
+	}
+	var teachers, parkingPermits, checkedIn, ticketsUnsent int
+	for _, chaperone := range chaperones {
+		if chaperone.IsTeacher {
+			teachers++
+		}
+		if chaperone.ParkingPermit {
+			parkingPermits++
+		}
+		if chaperone.CheckedIn {
+			checkedIn++
+		}
+		if !chaperone.TicketSent {
+			ticketsUnsent++
+		}
+	}
+	return map[string]any{
+		"Season":          currentSeason(),
+		"Chaperones":      chaperones,
+		"Teachers":        teachers,
+		"OtherChaperones": len(chaperones) - teachers,
+		"ParkingPermits":  parkingPermits,
+		"CheckedIn":       checkedIn,
+		"TicketsUnsent":   ticketsUnsent,
+		"Formats":         export.Formats,
+		"Message":         r.URL.Query().Get("message"),
+	}
+}
+
+// HandleAdminSendChaperoneTickets emails the tickets of this season's
+// teachers and chaperones that have not been sent one yet.
+func (a *Application) HandleAdminSendChaperoneTickets(w http.ResponseWriter, r *http.Request) {
+	log := hlog.FromRequest(r).With().Str("action", "send_chaperone_tickets").Logger()
+	chaperones, err := a.DB.GetChaperones(r.Context(), currentSeason())
+	if err != nil {
+		log.Err(err).Msg("failed to get chaperones")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var sending int
+	for _, chaperone := range chaperones {
+		if chaperone.TicketSent {
+			continue
+		}
+		sending++
+		go func(chaperone *database.ChaperoneWithTeacher) {
+			ctx := log.WithContext(context.Background())
+			if err := a.sendChaperoneTicketEmail(ctx, chaperone); err != nil {
+				log.Err(err).Int64("chaperone_id", chaperone.ID).Msg("failed to send chaperone ticket email")
+				return
+			}
+			if err := a.DB.MarkChaperoneTicketSent(ctx, chaperone.ID); err != nil {
+				log.Err(err).Int64("chaperone_id", chaperone.ID).Msg("failed to mark chaperone ticket sent")
+			}
+		}(chaperone)
+	}
+	log.Info().Int("count", sending).Msg("sending chaperone tickets")
+	http.Redirect(w, r, "/admin/chaperones?"+url.Values{"message": {fmt.Sprintf("Sending %d tickets.", sending)}}.Encode(), http.StatusSeeOther)
+}
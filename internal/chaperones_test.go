@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func teacherCookie(t *testing.T, email string) *http.Cookie {
+	t.Helper()
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Issuer:    string(IssuerSessionToken),
+		Subject:   email,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(testSecretKey))
+	require.NoError(t, err)
+	return &http.Cookie{Name: "tok", Value: tok}
+}
+
+func TestTeacherChaperones(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	addTestResultsTeams(t, a)
+	ids := addTestDietaryCategories(t, a, "Vegetarian")
+	cookie := teacherCookie(t, "teacher@example.com")
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	chaperones := func() []*database.Chaperone {
+		chaperones, err := a.DB.GetTeacherChaperones(ctx, currentSeason(), "teacher@example.com")
+		require.NoError(t, err)
+		return chaperones
+	}
+
+	// The teacher's dietary restrictions from their account are filled in.
+	require.NoError(t, a.DB.SetTeacherDietaryChoice(ctx, "teacher@example.com", ids, ""))
+	rec := doRequest(router, http.MethodGet, "/register/teacher/teams", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `id="dietary-category-`+strconv.FormatInt(ids[0], 10)+`" checked`)
+
+	assertRedirectsTo(t, post("/register/teacher/attendance", url.Values{
+		"attending":      {"on"},
+		"phone":          {" 555-0100 "},
+		"parking-permit": {"on"},
+	}), "/register/teacher/teams")
+	assert.Contains(t, post("/register/teacher/chaperone/add", url.Values{"name": {"Parent"}}).Header().Get("Location"), "error=")
+	assertRedirectsTo(t, post("/register/teacher/chaperone/add", url.Values{
+		"name":             {"Parent"},
+		"email":            {"parent@example.com"},
+		"dietary-category": {strconv.FormatInt(ids[0], 10)},
+		"dietary-note":     {"No nuts"},
+	}), "/register/teacher/teams")
+	assert.Contains(t, post("/register/teacher/chaperone/add", url.Values{
+		"name":  {"Parent"},
+		"email": {"parent@example.com"},
+	}).Header().Get("Location"), "error=", "each email can only be registered once")
+
+	registered := chaperones()
+	require.Len(t, registered, 2)
+	teacher, parent := registered[0], registered[1]
+	assert.True(t, teacher.IsTeacher)
+	assert.Equal(t, "Teacher", teacher.Name)
+	assert.Equal(t, "555-0100", teacher.Phone)
+	assert.True(t, teacher.ParkingPermit)
+	assert.Empty(t, teacher.DietaryCategories, "unchecking every category clears them")
+	assert.Equal(t, "Parent", parent.Name)
+	assert.Equal(t, ids, parent.DietaryCategories)
+	assert.Equal(t, "No nuts", parent.DietaryNote)
+
+	rec = doRequest(router, http.MethodGet, "/register/teacher/teams", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "parent@example.com")
+
+	ticketPath := "/register/teacher/chaperone/ticket?id=" + strconv.FormatInt(parent.ID, 10)
+	rec = doRequest(router, http.MethodGet, ticketPath, cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	require.NoError(t, a.DB.NewTeacher(ctx, "Other", "other@example.com"))
+	rec = doRequest(router, http.MethodGet, ticketPath, teacherCookie(t, "other@example.com"))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "teachers can only get their own chaperones' tickets")
+
+	// Chaperones are checked in by scanning their ticket.
+	volunteerCookie := &http.Cookie{Name: "volunteer_token", Value: volunteerToken(t)}
+	tok, err := a.getChaperoneQRToken(parent.ID)
+	require.NoError(t, err)
+	rec = doRequest(router, http.MethodGet, "/volunteer/scan?tok="+tok, volunteerCookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<h2>Parent</h2>")
+	assert.Contains(t, rec.Body.String(), "School (with Teacher)")
+	assertRedirectsTo(t, doRequest(router, http.MethodGet, "/volunteer/checkin?tok="+tok, volunteerCookie), "/volunteer/scan?tok="+tok)
+	parent, err = a.DB.GetChaperone(ctx, parent.ID)
+	require.NoError(t, err)
+	assert.True(t, parent.CheckedIn)
+	assert.Equal(t, "test@example.com", parent.CheckInVolunteer)
+
+	removeForm := url.Values{"id": {strconv.FormatInt(parent.ID, 10)}}
+	assert.Contains(t, post("/register/teacher/chaperone/remove", removeForm).Header().Get("Location"), "error=",
+		"chaperones that are checked in can't be removed")
+
+	adminCookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	rec = doRequest(router, http.MethodGet, "/admin/api/export/chaperones?column=name&column=role&column=parking_permit&column=checked_in", adminCookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Name,Role,Parking Permit,On Site\nTeacher,Teacher,yes,no\nParent,Chaperone,no,yes\n", rec.Body.String())
+	rec = doRequest(router, http.MethodGet, "/admin/chaperones", adminCookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "1 teachers and 1 chaperones")
+	withTeachers, err := a.DB.GetChaperones(ctx, currentSeason())
+	require.NoError(t, err)
+	require.Len(t, withTeachers, 2)
+	assert.Equal(t, "School", withTeachers[1].SchoolName)
+
+	// Tickets from other seasons can't be used to check in.
+	old := &database.Chaperone{Season: currentSeason() - 1, TeacherEmail: "teacher@example.com", Name: "Old", Email: "old@example.com"}
+	require.NoError(t, a.DB.AddChaperone(ctx, old))
+	tok, err = a.getChaperoneQRToken(old.ID)
+	require.NoError(t, err)
+	doRequest(router, http.MethodGet, "/volunteer/checkin?tok="+tok, volunteerCookie)
+	old, err = a.DB.GetChaperone(ctx, old.ID)
+	require.NoError(t, err)
+	assert.False(t, old.CheckedIn)
+
+	assertRedirectsTo(t, post("/register/teacher/attendance", nil), "/register/teacher/teams")
+	registered = chaperones()
+	require.Len(t, registered, 1, "the teacher cancelled their attendance")
+	assert.Equal(t, parent.ID, registered[0].ID)
+}
+
+func TestChaperoneKioskCheckIn(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	addTestResultsTeams(t, a)
+	online := &database.Chaperone{Season: currentSeason(), TeacherEmail: "teacher@example.com", Name: "Online", Email: "online@example.com"}
+	offline := &database.Chaperone{Season: currentSeason(), TeacherEmail: "teacher@example.com", Name: "Offline", Email: "offline@example.com"}
+	require.NoError(t, a.DB.AddChaperone(ctx, online))
+	require.NoError(t, a.DB.AddChaperone(ctx, offline))
+	onlineTok, err := a.getChaperoneQRToken(online.ID)
+	require.NoError(t, err)
+	offlineTok, err := a.getChaperoneQRToken(offline.ID)
+	require.NoError(t, err)
+
+	// The roster has the chaperones so that they can be checked in offline.
+	rec := doVolunteerJSONRequest(t, router, http.MethodGet, "/volunteer/api/roster", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var signed SignedRoster
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&signed))
+	var roster Roster
+	require.NoError(t, json.Unmarshal([]byte(signed.Roster), &roster))
+	require.Len(t, roster.Chaperones, 2)
+	assert.Equal(t, hashQRToken(onlineTok), roster.Chaperones[0].TokenHash)
+	assert.Equal(t, "Teacher", roster.Chaperones[0].TeacherName)
+	assert.Equal(t, "School", roster.Chaperones[0].SchoolName)
+
+	rec = doVolunteerJSONRequest(t, router, http.MethodPost, "/volunteer/api/checkin", CheckInAPIRequest{
+		Token: "https://example.com/volunteer/scan?tok=" + onlineTok,
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp CheckInAPIResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.NotNil(t, resp.Chaperone)
+	assert.Equal(t, "Online", resp.Chaperone.Name)
+	assert.True(t, resp.CheckedIn)
+	assert.False(t, resp.AlreadyCheckedIn)
+	online, err = a.DB.GetChaperone(ctx, online.ID)
+	require.NoError(t, err)
+	assert.True(t, online.CheckedIn)
+
+	checkedInAt := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	rec = doVolunteerJSONRequest(t, router, http.MethodPost, "/volunteer/api/checkin/sync", CheckInSyncRequest{
+		KioskID: "kiosk",
+		Roster:  signed,
+		CheckIns: []CheckInSyncItem{
+			{Token: offlineTok, ClientTS: checkedInAt.UnixMilli(), Volunteer: "Kiosk"},
+			{Token: offlineTok, ClientTS: checkedInAt.UnixMilli(), Direction: database.CheckInDirectionOut},
+		},
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var syncResp CheckInSyncResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&syncResp))
+	require.Len(t, syncResp.Results, 2)
+	assert.Equal(t, CheckInSyncCheckedIn, syncResp.Results[0].Status)
+	assert.Equal(t, offline.ID, syncResp.Results[0].ChaperoneID)
+	assert.Equal(t, CheckInSyncInvalid, syncResp.Results[1].Status, "chaperones are not checked out")
+	offline, err = a.DB.GetChaperone(ctx, offline.ID)
+	require.NoError(t, err)
+	assert.Equal(t, checkedInAt, offline.CheckedInTS)
+	assert.Equal(t, "test@example.com (Kiosk)", offline.CheckInVolunteer)
+}
+
+func TestLimitLength_TruncatesOnRunes(t *testing.T) {
+	assert.Equal(t, "Peña", limitLength(" Peña ", 10))
+	assert.Equal(t, "Peñ", limitLength("Peña", 3))
+}
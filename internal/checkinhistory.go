@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+const (
+	// checkInStationAdmin is recorded for check-ins done from the admin pages.
+	checkInStationAdmin = "admin"
+	// checkInStationScan is recorded for check-ins done from the volunteer
+	// scan page.
+	checkInStationScan = "scan"
+	// checkInStationKiosk is recorded for kiosk check-ins when the volunteer
+	// did not name the station.
+	checkInStationKiosk = "kiosk"
+)
+
+type CheckInHourCount struct {
+	Hour     time.Time
+	Arrivals int
+	Exits    int
+}
+
+func (a *Application) GetAdminCheckInsTemplate(r *http.Request) map[string]any {
+	studentEmail := r.URL.Query().Get("email")
+	events, err := a.DB.GetCheckInEvents(r.Context(), studentEmail)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get check-in events")
+		return nil
+	}
+
+	// Bucket the events by hour for the arrival timeline. Events that were
+	// backfilled without a time are left out.
+	counts := map[time.Time]*CheckInHourCount{}
+	for _, event := range events {
+		if event.TS.UnixMilli() <= 0 {
+			continue
+		}
+		hour := event.TS.Truncate(time.Hour)
+		if counts[hour] == nil {
+			counts[hour] = &CheckInHourCount{Hour: hour}
+		}
+		if event.Direction == database.CheckInDirectionIn {
+			counts[hour].Arrivals++
+		} else {
+			counts[hour].Exits++
+		}
+	}
+	timeline := make([]*CheckInHourCount, 0, len(counts))
+	for _, count := range counts {
+		timeline = append(timeline, count)
+	}
+	sort.Slice(timeline, func(i, j int) bool {
+		return timeline[i].Hour.Before(timeline[j].Hour)
+	})
+
+	return map[string]any{
+		"StudentEmail": studentEmail,
+		"Events":       events,
+		"Timeline":     timeline,
+	}
+}
+
+type OnSiteStudent struct {
+	database.Student
+	TeamName     string
+	TeacherName  string
+	TeacherEmail string
+	// LastEvent is the student's latest check-in event.
+	LastEvent *database.CheckInEventWithStudent
+}
+
+// GetAdminOnSiteTemplate lists the students that are currently on site for
+// emergency headcounts, along with the students that have left.
+func (a *Application) GetAdminOnSiteTemplate(r *http.Request) map[string]any {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams")
+		return nil
+	}
+	events, err := a.DB.GetCheckInEvents(r.Context(), "")
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get check-in events")
+		return nil
+	}
+	// The events are newest first, so the first event seen for each student
+	// is their latest.
+	lastEvents := map[string]*database.CheckInEventWithStudent{}
+	for _, event := range events {
+		if _, ok := lastEvents[event.StudentEmail]; !ok {
+			lastEvents[event.StudentEmail] = event
+		}
+	}
+
+	var onSite, left []OnSiteStudent
+	var minorsOnSite, minorsLeft int
+	for _, team := range teams {
+		for _, member := range team.Members {
+			lastEvent, ok := lastEvents[member.Email]
+			if !ok {
+				continue
+			}
+			student := OnSiteStudent{
+				Student:      member,
+				TeamName:     team.Name,
+				TeacherName:  team.TeacherName,
+				TeacherEmail: team.TeacherEmail,
+				LastEvent:    lastEvent,
+			}
+			if member.CheckedIn {
+				onSite = append(onSite, student)
+				if member.Age < 18 {
+					minorsOnSite++
+				}
+			} else {
+				left = append(left, student)
+				if member.Age < 18 {
+					minorsLeft++
+				}
+			}
+		}
+	}
+
+	return map[string]any{
+		"GeneratedAt":  time.Now(),
+		"OnSite":       onSite,
+		"Left":         left,
+		"MinorsOnSite": minorsOnSite,
+		"MinorsLeft":   minorsLeft,
+	}
+}
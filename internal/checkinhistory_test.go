@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestCheckInEvents_ReEntry(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", false, "", "parent@example.com"))
+	require.NoError(t, a.DB.SignFormsForStudent(ctx, "student@example.com", "Parent", true))
+	token, err := a.getStudentQRToken("student@example.com")
+	require.NoError(t, err)
+
+	arrived := time.Now().Add(-3 * time.Hour).Truncate(time.Millisecond)
+	lunch := arrived.Add(time.Hour)
+	returned := lunch.Add(time.Hour)
+	rec := doVolunteerJSONRequest(t, a.BuildRouter(), http.MethodPost, "/volunteer/api/checkin/sync", CheckInSyncRequest{
+		KioskID: "kiosk",
+		Roster:  signTestRoster(t, a, arrived.Add(-time.Hour)),
+		CheckIns: []CheckInSyncItem{
+			{Token: token, ClientTS: returned.UnixMilli(), Station: "Main entrance"},
+			{Token: token, ClientTS: lunch.UnixMilli(), Direction: database.CheckInDirectionOut},
+			{Token: token, ClientTS: arrived.UnixMilli()},
+			{Token: token, ClientTS: arrived.Add(time.Minute).UnixMilli()},
+		},
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp CheckInSyncResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, CheckInSyncCheckedIn, resp.Results[0].Status)
+	assert.Equal(t, CheckInSyncCheckedOut, resp.Results[1].Status)
+	assert.Equal(t, CheckInSyncCheckedIn, resp.Results[2].Status)
+	assert.Equal(t, CheckInSyncDuplicate, resp.Results[3].Status)
+
+	student, err := a.DB.GetStudentByEmail(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.True(t, student.CheckedIn)
+	assert.Equal(t, returned, student.CheckedInTS)
+
+	events, err := a.DB.GetCheckInEvents(ctx, "student@example.com")
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "Main entrance", events[0].Station)
+	assert.Equal(t, database.CheckInDirectionOut, events[1].Direction)
+	assert.Equal(t, "kiosk", events[1].Station)
+	assert.Equal(t, arrived, events[2].TS)
+
+	// A check-in before an existing one replaces it as the arrival.
+	recorded, err := a.DB.CheckInStudent(ctx, "student@example.com", returned.Add(-time.Minute), "admin@example.com", checkInStationAdmin)
+	require.NoError(t, err)
+	assert.True(t, recorded)
+	events, err = a.DB.GetCheckInEvents(ctx, "student@example.com")
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, checkInStationAdmin, events[0].Station)
+}
+
+func TestVolunteerCheckInAPI_CheckOut(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", false, "", "parent@example.com"))
+	require.NoError(t, a.DB.SignFormsForStudent(ctx, "student@example.com", "Parent", true))
+	token, err := a.getStudentQRToken("student@example.com")
+	require.NoError(t, err)
+	router := a.BuildRouter()
+
+	checkIn := func(direction database.CheckInDirection) CheckInAPIResponse {
+		rec := doVolunteerJSONRequest(t, router, http.MethodPost, "/volunteer/api/checkin", CheckInAPIRequest{
+			Token:     token,
+			Direction: direction,
+			Station:   "Door",
+		})
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp CheckInAPIResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := checkIn(database.CheckInDirectionOut)
+	assert.True(t, resp.NotOnSite)
+	assert.False(t, resp.CheckedOut)
+
+	resp = checkIn(database.CheckInDirectionIn)
+	assert.True(t, resp.CheckedIn)
+	onSite := a.GetAdminOnSiteTemplate(httptest.NewRequest(http.MethodGet, "/admin/onsite", nil))
+	require.Len(t, onSite["OnSite"], 1)
+	assert.Equal(t, 1, onSite["MinorsOnSite"])
+
+	resp = checkIn(database.CheckInDirectionOut)
+	assert.True(t, resp.CheckedOut)
+	assert.False(t, resp.CheckedIn)
+	assert.True(t, resp.Student.Minor)
+	onSite = a.GetAdminOnSiteTemplate(httptest.NewRequest(http.MethodGet, "/admin/onsite", nil))
+	assert.Empty(t, onSite["OnSite"])
+	assert.Len(t, onSite["Left"], 1)
+
+	for _, path := range []string{"/admin/onsite", "/admin/checkins?email=student@example.com"} {
+		rec := doRequest(router, http.MethodGet, path, &http.Cookie{Name: "admin_token", Value: adminToken(t)})
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Contains(t, rec.Body.String(), "Door", path)
+	}
+}
@@ -0,0 +1,416 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+const (
+	// maxCheckInSyncBatch is the most queued check-ins accepted per request.
+	maxCheckInSyncBatch = 1000
+	// maxCheckInClockSkew is how far a kiosk's clock may be from the server's.
+	// Timestamps further in the future are replaced with the server's time, and
+	// ones further before the kiosk's roster was generated are rejected.
+	maxCheckInClockSkew = 5 * time.Minute
+)
+
+type RosterStudent struct {
+	// TokenHash is the hex SHA-256 of the student's QR code token.
+	TokenHash               string `json:"token_hash"`
+	Name                    string `json:"name"`
+	Email                   string `json:"email"`
+	Minor                   bool   `json:"minor"`
+	TeamID                  string `json:"team_id"`
+	TeamName                string `json:"team_name"`
+	Room                    string `json:"room,omitempty"`
+	Seat                    int    `json:"seat,omitempty"`
+	InPerson                bool   `json:"in_person"`
+	EmailConfirmed          bool   `json:"email_confirmed"`
+	LiabilitySigned         bool   `json:"liability_signed"`
+	ComputerUseWaiverSigned bool   `json:"computer_use_waiver_signed"`
+	AllGood                 bool   `json:"all_good"`
+	CheckedIn               bool   `json:"checked_in"`
+}
+
+// RosterChaperone is a teacher or chaperone that is registered to come this
+// season.
+type RosterChaperone struct {
+	// TokenHash is the hex SHA-256 of the chaperone's QR code token.
+	TokenHash   string `json:"token_hash"`
+	Name        string `json:"name"`
+	IsTeacher   bool   `json:"is_teacher"`
+	TeacherName string `json:"teacher_name"`
+	SchoolName  string `json:"school_name"`
+	CheckedIn   bool   `json:"checked_in"`
+}
+
+type Roster struct {
+	GeneratedAt int64             `json:"generated_at"`
+	Students    []RosterStudent   `json:"students"`
+	Chaperones  []RosterChaperone `json:"chaperones"`
+}
+
+// SignedRoster is a JSON-encoded Roster along with an Ed25519 signature over
+// it, so that a kiosk can verify the copy that it has cached. The roster is
+// sent as a string so that the signed bytes are preserved exactly.
+type SignedRoster struct {
+	Roster    string `json:"roster"`
+	Signature string `json:"signature"`
+	PublicKey string `json:"public_key"`
+}
+
+func hashQRToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// rosterSigningKey derives the roster signing key from the JWT secret so that
+// it is stable across restarts without any extra configuration.
+func (a *Application) rosterSigningKey() ed25519.PrivateKey {
+	seed := sha256.Sum256(append([]byte("mineshspc roster signing key:"), a.Config.ReadSecretKey()...))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+func (a *Application) rosterPublicKey() string {
+	return base64.StdEncoding.EncodeToString(a.rosterSigningKey().Public().(ed25519.PublicKey))
+}
+
+// verifyRoster checks the roster's signature and decodes it.
+func (a *Application) verifyRoster(signed SignedRoster) (*Roster, error) {
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, err
+	} else if !ed25519.Verify(a.rosterSigningKey().Public().(ed25519.PublicKey), []byte(signed.Roster), signature) {
+		return nil, errors.New("invalid roster signature")
+	}
+	var roster Roster
+	if err = json.Unmarshal([]byte(signed.Roster), &roster); err != nil {
+		return nil, err
+	}
+	return &roster, nil
+}
+
+func (a *Application) HandleVolunteerRosterAPI(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "volunteer_roster_api").Logger()
+
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get teams")
+		writeJSON(log, w, http.StatusInternalServerError, map[string]string{"error": "Failed to get the roster."})
+		return
+	}
+	seats, err := a.DB.GetTeamSeats(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get team seats")
+		writeJSON(log, w, http.StatusInternalServerError, map[string]string{"error": "Failed to get the roster."})
+		return
+	}
+
+	chaperones, err := a.DB.GetChaperones(ctx, currentSeason())
+	if err != nil {
+		log.Err(err).Msg("failed to get chaperones")
+		writeJSON(log, w, http.StatusInternalServerError, map[string]string{"error": "Failed to get the roster."})
+		return
+	}
+
+	roster := Roster{GeneratedAt: time.Now().UnixMilli(), Students: []RosterStudent{}, Chaperones: []RosterChaperone{}}
+	for _, team := range teams {
+		for _, member := range team.Members {
+			token, err := a.getStudentQRToken(member.Email)
+			if err != nil {
+				log.Err(err).Msg("failed to get student QR token")
+				writeJSON(log, w, http.StatusInternalServerError, map[string]string{"error": "Failed to get the roster."})
+				return
+			}
+			rosterStudent := RosterStudent{
+				TokenHash:               hashQRToken(token),
+				Name:                    member.Name,
+				Email:                   member.Email,
+				Minor:                   member.Age < 18,
+				TeamID:                  team.ID.String(),
+				TeamName:                team.Name,
+				InPerson:                team.InPerson,
+				EmailConfirmed:          member.EmailConfirmed,
+				LiabilitySigned:         member.LiabilitySigned,
+				ComputerUseWaiverSigned: member.ComputerUseWaiverSigned,
+				AllGood:                 team.InPerson && completedCheckInSteps(&member),
+				CheckedIn:               member.CheckedIn,
+			}
+			if seat := seats[team.ID]; seat != nil {
+				rosterStudent.Room = seat.RoomName
+				rosterStudent.Seat = seat.Seat
+			}
+			roster.Students = append(roster.Students, rosterStudent)
+		}
+	}
+
+	for _, chaperone := range chaperones {
+		token, err := a.getChaperoneQRToken(chaperone.ID)
+		if err != nil {
+			log.Err(err).Msg("failed to get chaperone QR token")
+			writeJSON(log, w, http.StatusInternalServerError, map[string]string{"error": "Failed to get the roster."})
+			return
+		}
+		roster.Chaperones = append(roster.Chaperones, RosterChaperone{
+			TokenHash:   hashQRToken(token),
+			Name:        chaperone.Name,
+			IsTeacher:   chaperone.IsTeacher,
+			TeacherName: chaperone.TeacherName,
+			SchoolName:  chaperone.SchoolName,
+			CheckedIn:   chaperone.CheckedIn,
+		})
+	}
+
+	rosterBytes, err := json.Marshal(roster)
+	if err != nil {
+		log.Err(err).Msg("failed to marshal roster")
+		writeJSON(log, w, http.StatusInternalServerError, map[string]string{"error": "Failed to get the roster."})
+		return
+	}
+
+	writeJSON(log, w, http.StatusOK, SignedRoster{
+		Roster:    string(rosterBytes),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(a.rosterSigningKey(), rosterBytes)),
+		PublicKey: a.rosterPublicKey(),
+	})
+}
+
+type CheckInSyncItem struct {
+	// Token is either the student's QR code token, or the whole URL that is
+	// encoded in the QR code.
+	Token string `json:"token"`
+	// ClientTS is when the kiosk checked in the student, in milliseconds.
+	ClientTS int64 `json:"client_ts"`
+	// Volunteer is the name entered on the kiosk by the volunteer running it.
+	Volunteer string `json:"volunteer"`
+	// Direction is whether the student was arriving or leaving. It defaults to
+	// arriving.
+	Direction database.CheckInDirection `json:"direction"`
+	// Station is where the student was scanned. It defaults to the kiosk ID.
+	Station string `json:"station"`
+}
+
+type CheckInSyncRequest struct {
+	KioskID string `json:"kiosk_id"`
+	// Roster is the signed roster that the kiosk used for the check-ins. Any
+	// check-ins from before it was generated are rejected.
+	Roster   SignedRoster      `json:"roster"`
+	CheckIns []CheckInSyncItem `json:"check_ins"`
+}
+
+type CheckInSyncStatus string
+
+const (
+	CheckInSyncCheckedIn  CheckInSyncStatus = "checked_in"
+	CheckInSyncCheckedOut CheckInSyncStatus = "checked_out"
+	// CheckInSyncDuplicate means that the student was already checked in (or
+	// out) at that time. The earliest of several check-ins is kept.
+	CheckInSyncDuplicate CheckInSyncStatus = "duplicate"
+	// CheckInSyncConflict means that the server no longer agrees that the
+	// student can be checked in, for example because the kiosk's roster was
+	// out of date.
+	CheckInSyncConflict CheckInSyncStatus = "conflict"
+	CheckInSyncInvalid  CheckInSyncStatus = "invalid"
+)
+
+type CheckInSyncResult struct {
+	// Index is the position of the check-in in the request.
+	Index        int               `json:"index"`
+	Status       CheckInSyncStatus `json:"status"`
+	StudentEmail string            `json:"student_email,omitempty"`
+	// ChaperoneID is set instead of StudentEmail if the ticket was a
+	// chaperone's.
+	ChaperoneID int64  `json:"chaperone_id,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+type CheckInSyncResponse struct {
+	Error   string              `json:"error,omitempty"`
+	Results []CheckInSyncResult `json:"results"`
+}
+
+// HandleVolunteerCheckInSyncAPI applies check-ins that a kiosk queued while it
+// was offline.
+func (a *Application) HandleVolunteerCheckInSyncAPI(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	volunteerEmail := a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin)
+	log := a.Log.With().
+		Str("page_name", "volunteer_checkin_sync_api").
+		Str("volunteer_email", volunteerEmail).
+		Logger()
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSON(log, w, http.StatusUnsupportedMediaType, CheckInSyncResponse{Error: "Expected a JSON request."})
+		return
+	}
+
+	var req CheckInSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn().Err(err).Msg("failed to decode request")
+		writeJSON(log, w, http.StatusBadRequest, CheckInSyncResponse{Error: "Invalid request."})
+		return
+	} else if len(req.CheckIns) > maxCheckInSyncBatch {
+		writeJSON(log, w, http.StatusRequestEntityTooLarge, CheckInSyncResponse{
+			Error: fmt.Sprintf("At most %d check-ins can be synced at once.", maxCheckInSyncBatch),
+		})
+		return
+	}
+	log = log.With().Str("kiosk_id", req.KioskID).Int("count", len(req.CheckIns)).Logger()
+	roster, err := a.verifyRoster(req.Roster)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to verify roster")
+		writeJSON(log, w, http.StatusBadRequest, CheckInSyncResponse{Error: "Invalid roster."})
+		return
+	}
+	rosterGeneratedAt := time.UnixMilli(roster.GeneratedAt)
+	log.Info().Time("roster_generated_at", rosterGeneratedAt).Msg("syncing queued check-ins")
+
+	// Apply the check-ins in the order that they happened so that the earliest
+	// of several check-ins of a student wins and later ones are reported as
+	// duplicates.
+	now := time.Now()
+	order := make([]int, len(req.CheckIns))
+	timestamps := make([]time.Time, len(req.CheckIns))
+	for i, item := range req.CheckIns {
+		order[i] = i
+		timestamps[i] = time.UnixMilli(item.ClientTS)
+		if item.ClientTS <= 0 || timestamps[i].After(now.Add(maxCheckInClockSkew)) {
+			timestamps[i] = now
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return timestamps[order[i]].Before(timestamps[order[j]])
+	})
+
+	results := make([]CheckInSyncResult, len(req.CheckIns))
+	for _, i := range order {
+		item := req.CheckIns[i]
+		results[i] = CheckInSyncResult{Index: i}
+
+		// The kiosk could not have scanned the ticket before it had the
+		// roster, so don't let an earlier time rewrite the check-in history.
+		if timestamps[i].Before(rosterGeneratedAt.Add(-maxCheckInClockSkew)) {
+			results[i].Status = CheckInSyncInvalid
+			results[i].Message = "The check-in is from before the kiosk's roster was generated."
+			continue
+		}
+
+		token := extractQRToken(item.Token)
+		if chaperone, err := a.getChaperoneByQRToken(ctx, token); err == nil {
+			results[i].ChaperoneID = chaperone.ID
+			results[i].Status, results[i].Message, err = a.syncChaperoneCheckIn(ctx, chaperone, item.Direction, timestamps[i],
+				checkedInBy(volunteerEmail, item.Volunteer))
+			if err != nil {
+				log.Err(err).Int64("chaperone_id", chaperone.ID).Msg("failed to sync chaperone check-in")
+				writeJSON(log, w, http.StatusInternalServerError, CheckInSyncResponse{
+					Error:   "Failed to sync check-ins. Please try again.",
+					Results: results,
+				})
+				return
+			}
+			continue
+		}
+		student, err := a.getStudentByQRToken(ctx, token)
+		if err != nil {
+			log.Warn().Err(err).Int("index", i).Msg("failed to get student by token")
+			results[i].Status = CheckInSyncInvalid
+			results[i].Message = "Invalid ticket or the student has withdrawn."
+			continue
+		}
+		results[i].StudentEmail = student.Email
+
+		if item.Direction == "" {
+			item.Direction = database.CheckInDirectionIn
+		} else if item.Direction != database.CheckInDirectionIn && item.Direction != database.CheckInDirectionOut {
+			results[i].Status = CheckInSyncInvalid
+			results[i].Message = "Invalid direction."
+			continue
+		}
+		if item.Station == "" {
+			item.Station = req.KioskID
+		}
+
+		status, message, err := a.syncCheckIn(ctx, student, &database.CheckInEvent{
+			StudentEmail: student.Email,
+			Direction:    item.Direction,
+			TS:           timestamps[i],
+			Volunteer:    checkedInBy(volunteerEmail, item.Volunteer),
+			Station:      checkInStation(item.Station),
+		})
+		if err != nil {
+			log.Err(err).Str("student_email", student.Email).Msg("failed to sync check-in")
+			writeJSON(log, w, http.StatusInternalServerError, CheckInSyncResponse{
+				Error:   "Failed to sync check-ins. Please try again.",
+				Results: results,
+			})
+			return
+		}
+		results[i].Status = status
+		results[i].Message = message
+	}
+
+	writeJSON(log, w, http.StatusOK, CheckInSyncResponse{Results: results})
+}
+
+func checkedInBy(volunteerEmail, volunteerName string) string {
+	volunteerName = strings.TrimSpace(volunteerName)
+	if volunteerName == "" {
+		return volunteerEmail
+	}
+	return fmt.Sprintf("%s (%s)", volunteerEmail, volunteerName)
+}
+
+func (a *Application) syncCheckIn(ctx context.Context, student *database.Student, event *database.CheckInEvent) (CheckInSyncStatus, string, error) {
+	if event.Direction == database.CheckInDirectionIn {
+		team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+		if err != nil {
+			return "", "", err
+		} else if !team.InPerson {
+			return CheckInSyncConflict, "The student's team is not competing in person.", nil
+		} else if !completedCheckInSteps(student) {
+			return CheckInSyncConflict, "The student has not completed all of their forms.", nil
+		}
+	}
+
+	recorded, err := a.DB.RecordCheckInEvent(ctx, event)
+	if err != nil {
+		return "", "", err
+	} else if !recorded {
+		return CheckInSyncDuplicate, "", nil
+	}
+	a.publishCheckInEvent(ctx, event)
+	if event.Direction == database.CheckInDirectionOut {
+		return CheckInSyncCheckedOut, "", nil
+	}
+	return CheckInSyncCheckedIn, "", nil
+}
+
+// syncChaperoneCheckIn checks in a chaperone that was scanned while the kiosk
+// was offline. Chaperones are never checked out.
+func (a *Application) syncChaperoneCheckIn(ctx context.Context, chaperone *database.Chaperone, direction database.CheckInDirection, ts time.Time, volunteer string) (CheckInSyncStatus, string, error) {
+	if direction != "" && direction != database.CheckInDirectionIn {
+		return CheckInSyncInvalid, "Chaperones are not checked out.", nil
+	} else if chaperone.Season != currentSeason() {
+		return CheckInSyncConflict, "The ticket is not for this year's competition.", nil
+	}
+	recorded, err := a.DB.CheckInChaperone(ctx, chaperone.ID, ts, volunteer)
+	if err != nil {
+		return "", "", err
+	} else if !recorded {
+		return CheckInSyncDuplicate, "", nil
+	}
+	return CheckInSyncCheckedIn, "", nil
+}
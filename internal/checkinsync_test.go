@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func doVolunteerJSONRequest(t *testing.T, router http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&reqBody).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "volunteer_token", Value: volunteerToken(t)})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func signTestRoster(t *testing.T, a *Application, generatedAt time.Time) SignedRoster {
+	t.Helper()
+	rosterBytes, err := json.Marshal(Roster{GeneratedAt: generatedAt.UnixMilli(), Students: []RosterStudent{}})
+	require.NoError(t, err)
+	return SignedRoster{
+		Roster:    string(rosterBytes),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(a.rosterSigningKey(), rosterBytes)),
+		PublicKey: a.rosterPublicKey(),
+	}
+}
+
+func TestVolunteerRosterAPI_Signed(t *testing.T) {
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 18)
+
+	rec := doVolunteerJSONRequest(t, a.BuildRouter(), http.MethodGet, "/volunteer/api/roster", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var signed SignedRoster
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&signed))
+
+	publicKey, err := base64.StdEncoding.DecodeString(signed.PublicKey)
+	require.NoError(t, err)
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	require.NoError(t, err)
+	assert.True(t, ed25519.Verify(publicKey, []byte(signed.Roster), signature))
+
+	var roster Roster
+	require.NoError(t, json.Unmarshal([]byte(signed.Roster), &roster))
+	require.Len(t, roster.Students, 1)
+	token, err := a.getStudentQRToken("student@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, hashQRToken(token), roster.Students[0].TokenHash)
+}
+
+func TestVolunteerCheckInSyncAPI(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teamID, _ := addTestStudent(t, a, "ready@example.com", 18)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "ready@example.com", false, "", ""))
+	require.NoError(t, a.DB.SignFormsForStudent(ctx, "ready@example.com", "Ready", true))
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Unsigned", 18, "unsigned@example.com", false))
+
+	readyURL, err := a.getStudentQRCodeURL("ready@example.com")
+	require.NoError(t, err)
+	unsignedToken, err := a.getStudentQRToken("unsigned@example.com")
+	require.NoError(t, err)
+
+	first := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	rec := doVolunteerJSONRequest(t, a.BuildRouter(), http.MethodPost, "/volunteer/api/checkin/sync", CheckInSyncRequest{
+		KioskID: "kiosk",
+		Roster:  signTestRoster(t, a, first.Add(-time.Minute)),
+		CheckIns: []CheckInSyncItem{
+			{Token: readyURL, ClientTS: first.Add(time.Minute).UnixMilli(), Volunteer: "Second"},
+			{Token: readyURL, ClientTS: first.UnixMilli(), Volunteer: "First"},
+			{Token: unsignedToken, ClientTS: first.UnixMilli()},
+			{Token: "garbage", ClientTS: first.UnixMilli()},
+		},
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp CheckInSyncResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 4)
+	assert.Equal(t, CheckInSyncDuplicate, resp.Results[0].Status)
+	assert.Equal(t, CheckInSyncCheckedIn, resp.Results[1].Status)
+	assert.Equal(t, CheckInSyncConflict, resp.Results[2].Status)
+	assert.Equal(t, CheckInSyncInvalid, resp.Results[3].Status)
+
+	student, err := a.DB.GetStudentByEmail(ctx, "ready@example.com")
+	require.NoError(t, err)
+	assert.True(t, student.CheckedIn)
+	assert.Equal(t, first, student.CheckedInTS, "the earliest check-in should win")
+	assert.Equal(t, "test@example.com (First)", student.CheckedInBy)
+
+	student, err = a.DB.GetStudentByEmail(ctx, "unsigned@example.com")
+	require.NoError(t, err)
+	assert.False(t, student.CheckedIn)
+}
+
+func TestVolunteerCheckInSyncAPI_BeforeRoster(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	addTestStudent(t, a, "ready@example.com", 18)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "ready@example.com", false, "", ""))
+	require.NoError(t, a.DB.SignFormsForStudent(ctx, "ready@example.com", "Ready", true))
+	token, err := a.getStudentQRToken("ready@example.com")
+	require.NoError(t, err)
+
+	generatedAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	checkIns := []CheckInSyncItem{
+		{Token: token, ClientTS: generatedAt.Add(-maxCheckInClockSkew - time.Minute).UnixMilli()},
+		{Token: token, ClientTS: generatedAt.Add(time.Minute).UnixMilli()},
+		// The kiosk's clock may be a little behind the server's.
+		{Token: token, ClientTS: generatedAt.Add(-time.Minute).UnixMilli()},
+	}
+
+	forged := signTestRoster(t, a, generatedAt)
+	forged.Roster = strings.Replace(forged.Roster, strconv.FormatInt(generatedAt.UnixMilli(), 10), "0", 1)
+	rec := doVolunteerJSONRequest(t, router, http.MethodPost, "/volunteer/api/checkin/sync", CheckInSyncRequest{
+		KioskID:  "kiosk",
+		Roster:   forged,
+		CheckIns: checkIns,
+	})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the roster's generation time can't be changed")
+
+	rec = doVolunteerJSONRequest(t, router, http.MethodPost, "/volunteer/api/checkin/sync", CheckInSyncRequest{
+		KioskID:  "kiosk",
+		Roster:   signTestRoster(t, a, generatedAt),
+		CheckIns: checkIns,
+	})
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp CheckInSyncResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, CheckInSyncInvalid, resp.Results[0].Status)
+	assert.Equal(t, CheckInSyncDuplicate, resp.Results[1].Status)
+	assert.Equal(t, CheckInSyncCheckedIn, resp.Results[2].Status)
+
+	student, err := a.DB.GetStudentByEmail(ctx, "ready@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, generatedAt.Add(-time.Minute), student.CheckedInTS)
+}
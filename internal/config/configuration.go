@@ -3,7 +3,9 @@ package config
 import (
 	"html/template"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"go.mau.fi/util/dbutil"
 	"go.mau.fi/util/exerrors"
@@ -26,6 +28,39 @@ type RecaptchaConfig struct {
 	SecretKey string `yaml:"secret_key"`
 }
 
+type CaptchaProvider string
+
+const (
+	CaptchaProviderRecaptcha CaptchaProvider = "recaptcha"
+	CaptchaProviderTurnstile CaptchaProvider = "turnstile"
+	CaptchaProviderHCaptcha  CaptchaProvider = "hcaptcha"
+	// CaptchaProviderStub accepts or rejects every response without making
+	// any requests. It is meant for development and tests.
+	CaptchaProviderStub CaptchaProvider = "stub"
+)
+
+type CaptchaConfig struct {
+	Provider  CaptchaProvider `yaml:"provider"`
+	SiteKey   string          `yaml:"site_key"`
+	SecretKey string          `yaml:"secret_key"`
+	// VerifyURL overrides the provider's default siteverify URL.
+	VerifyURL string        `yaml:"verify_url"`
+	Timeout   time.Duration `yaml:"timeout"`
+	// MinScore is the lowest acceptable score for providers that return one
+	// (reCAPTCHA v3 and hCaptcha Enterprise). Responses without a score are
+	// not checked.
+	MinScore float64 `yaml:"min_score"`
+	// StubSuccess is the answer given by the stub provider.
+	StubSuccess bool `yaml:"stub_success"`
+}
+
+func (c CaptchaConfig) GetTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return c.Timeout
+}
+
 type HomepageConfig struct {
 	H2Text                 string        `yaml:"h2_text"`
 	HeroText               template.HTML `yaml:"hero_text"`
@@ -35,6 +70,59 @@ type HomepageConfig struct {
 	OpenDivisionURL        string        `yaml:"open_division_url"`
 }
 
+type WithdrawalConfig struct {
+	// RefundSends controls whether the emails sent to a withdrawn student stop
+	// counting against the teacher's email send budget.
+	RefundSends bool `yaml:"refund_sends"`
+	// RefundConfirmed controls whether students who have already confirmed
+	// their email are refunded as well.
+	RefundConfirmed bool `yaml:"refund_confirmed"`
+}
+
+type EmailBudgetWindow struct {
+	Duration   time.Duration `yaml:"duration"`
+	FirstSends int           `yaml:"first_sends"`
+	Resends    int           `yaml:"resends"`
+}
+
+type EmailBudgetConfig struct {
+	// Windows are sliding windows over the emails sent on behalf of a teacher.
+	// Exceeding any of them flags the teacher's account for admin review.
+	Windows []EmailBudgetWindow `yaml:"windows"`
+	// ResendCooldown is the minimum time between resends of the same email to
+	// a student by their teacher.
+	ResendCooldown time.Duration `yaml:"resend_cooldown"`
+}
+
+var defaultEmailBudgetWindows = []EmailBudgetWindow{
+	{Duration: time.Hour, FirstSends: 24, Resends: 12},
+	{Duration: 24 * time.Hour, FirstSends: 64, Resends: 32},
+}
+
+func (c EmailBudgetConfig) GetWindows() []EmailBudgetWindow {
+	if len(c.Windows) == 0 {
+		return defaultEmailBudgetWindows
+	}
+	return c.Windows
+}
+
+func (c EmailBudgetConfig) GetResendCooldown() time.Duration {
+	if c.ResendCooldown == 0 {
+		return 10 * time.Minute
+	}
+	return c.ResendCooldown
+}
+
+type EmergencyInfoConfig struct {
+	// ViewerEmails are the admins that can see every student's emergency
+	// contact and medical information. Volunteers only see it for the student
+	// that they scanned.
+	ViewerEmails []string `yaml:"viewer_emails"`
+	// PurgeAfter is when the emergency information is automatically deleted,
+	// usually the day after the competition. It is kept forever if unset.
+	PurgeAfter time.Time `yaml:"purge_after"`
+}
+
 type Configuration struct {
 	secretKeyBytes []byte
 
@@ -49,16 +137,37 @@ type Configuration struct {
 	RegistrationEnabled bool           `yaml:"registration_enabled"`
 	Homepage            HomepageConfig `yaml:"homepage"`
 
+	Withdrawal  WithdrawalConfig  `yaml:"withdrawal"`
+	EmailBudget EmailBudgetConfig `yaml:"email_budget"`
+
 	AdminEmails []string `yaml:"admin_emails"`
 
+	EmergencyInfo EmergencyInfoConfig `yaml:"emergency_info"`
+
 	JWTSecretKeyFile string `yaml:"jwt_secret_key_file"`
 	JWTSecretKey     string `yaml:"jwt_secret_key"`
 
+	Captcha CaptchaConfig `yaml:"captcha"`
+	// Deprecated: use Captcha instead. This is only read if Captcha is not
+	// configured.
 	Recaptcha RecaptchaConfig `yaml:"recaptcha"`
 
 	Logging zeroconfig.Config `yaml:"logging"`
 }
 
+// GetCaptchaConfig returns the captcha configuration, falling back to the
+// legacy recaptcha section if the captcha section is empty.
+func (c *Configuration) GetCaptchaConfig() CaptchaConfig {
+	if c.Captcha.Provider == "" && c.Captcha.SecretKey == "" && c.Recaptcha.SecretKey != "" {
+		captcha := c.Captcha
+		captcha.Provider = CaptchaProviderRecaptcha
+		captcha.SiteKey = c.Recaptcha.SiteKey
+		captcha.SecretKey = c.Recaptcha.SecretKey
+		return captcha
+	}
+	return c.Captcha
+}
+
 func (c *Configuration) IsAdminEmail(email string) bool {
 	for _, e := range c.AdminEmails {
 		if e == email {
@@ -68,6 +177,18 @@ func (c *Configuration) IsAdminEmail(email string) bool {
 	return false
 }
 
+// CanViewEmergencyInfo reports whether the admin can see every student's
+// emergency contact and medical information.
+func (c *Configuration) CanViewEmergencyInfo(email string) bool {
+	return c.IsAdminEmail(email) && slices.Contains(c.EmergencyInfo.ViewerEmails, email)
+}
+
+// EmergencyInfoExpired reports whether the emergency information should have
+// been purged by now.
+func (c *Configuration) EmergencyInfoExpired(now time.Time) bool {
+	return !c.EmergencyInfo.PurgeAfter.IsZero() && !now.Before(c.EmergencyInfo.PurgeAfter)
+}
+
 func (c *Configuration) ReadSecretKey() []byte {
 	if len(c.JWTSecretKey) > 0 {
 		return []byte(c.JWTSecretKey)
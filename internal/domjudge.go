@@ -0,0 +1,309 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// The DOMjudge exports follow the import formats that are described in the
+// "Importing data" section of the DOMjudge admin manual. The team numbers and
+// passwords are derived from the registered teams, so they stay the same
+// between exports.
+
+const domjudgeFirstTimeGroupID = "first-time"
+
+type DOMjudgeGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type DOMjudgeOrganization struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	FormalName string `json:"formal_name"`
+	Country    string `json:"country"`
+}
+
+type DOMjudgeTeam struct {
+	ID             string   `json:"id"`
+	Label          string   `json:"label"`
+	GroupIDs       []string `json:"group_ids"`
+	Name           string   `json:"name"`
+	DisplayName    string   `json:"display_name"`
+	OrganizationID string   `json:"organization_id"`
+}
+
+type DOMjudgeAccount struct {
+	ID       string
+	Username string
+	Password string
+	Name     string
+	TeamID   string
+}
+
+type domjudgeExport struct {
+	Groups        []DOMjudgeGroup
+	Organizations []DOMjudgeOrganization
+	Teams         []DOMjudgeTeam
+	Accounts      []DOMjudgeAccount
+	// RegisteredTeams maps the DOMjudge team IDs to the registered teams.
+	RegisteredTeams map[string]uuid.UUID
+}
+
+func domjudgeDivisionGroupID(division database.Division) string {
+	return strings.ToLower(string(division))
+}
+
+// domjudgeOrganizationID returns a stable ID for the school so that teams
+// from different teachers at the same school share an organization.
+func domjudgeOrganizationID(teacher *database.Teacher) string {
+	key := strings.ToLower(strings.Join([]string{
+		strings.TrimSpace(teacher.SchoolName),
+		strings.TrimSpace(teacher.SchoolCity),
+		strings.TrimSpace(teacher.SchoolState),
+	}, "|"))
+	hash := sha256.Sum256([]byte(key))
+	return "school-" + hex.EncodeToString(hash[:4])
+}
+
+// domjudgeTeamID returns a stable team number for the team. The legacy TSV
+// format only allows numeric team IDs, so the number is taken from a hash of
+// the team's ID. It is always eight digits long.
+func domjudgeTeamID(teamID uuid.UUID) string {
+	hash := sha256.Sum256([]byte("domjudge-team:" + teamID.String()))
+	return strconv.FormatUint(10_000_000+uint64(binary.BigEndian.Uint32(hash[:4]))%90_000_000, 10)
+}
+
+// domjudgePasswordAlphabet leaves out the characters that are easily confused
+// with each other when the password is read off of a printout.
+const domjudgePasswordAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// domjudgePassword derives the team's password from the secret key so that
+// the password stays the same every time the accounts are exported.
+func (a *Application) domjudgePassword(teamID uuid.UUID) string {
+	mac := hmac.New(sha256.New, a.Config.ReadSecretKey())
+	mac.Write([]byte("domjudge-password:" + teamID.String()))
+	sum := mac.Sum(nil)
+	password := make([]byte, 10)
+	for i := range password {
+		password[i] = domjudgePasswordAlphabet[int(sum[i])%len(domjudgePasswordAlphabet)]
+	}
+	return string(password)
+}
+
+// buildDOMjudgeExport collects the teams that have members, optionally only in
+// one division, along with their schools and accounts.
+func (a *Application) buildDOMjudgeExport(ctx context.Context, division database.Division) (*domjudgeExport, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams: %w", err)
+	}
+	teachers, err := a.DB.GetAllTeachers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teachers: %w", err)
+	}
+	teachersByEmail := map[string]*database.Teacher{}
+	for _, teacher := range teachers {
+		teachersByEmail[teacher.Email] = teacher
+	}
+
+	teams = slices.DeleteFunc(teams, func(team *database.TeamWithTeacherName) bool {
+		return len(team.Members) == 0 || (division != "" && team.Division != division)
+	})
+	slices.SortFunc(teams, func(a, b *database.TeamWithTeacherName) int {
+		return cmp.Or(a.RegistrationTS.Compare(b.RegistrationTS), strings.Compare(a.ID.String(), b.ID.String()))
+	})
+
+	export := &domjudgeExport{
+		Organizations:   []DOMjudgeOrganization{},
+		Teams:           []DOMjudgeTeam{},
+		RegisteredTeams: map[string]uuid.UUID{},
+	}
+	for _, div := range []database.Division{database.DivisionBeginner, database.DivisionAdvanced} {
+		if division == "" || division == div {
+			export.Groups = append(export.Groups, DOMjudgeGroup{ID: domjudgeDivisionGroupID(div), Name: string(div)})
+		}
+	}
+	export.Groups = append(export.Groups, DOMjudgeGroup{ID: domjudgeFirstTimeGroupID, Name: "First-Time Teams"})
+
+	organizations := map[string]bool{}
+	for _, team := range teams {
+		teacher, ok := teachersByEmail[team.TeacherEmail]
+		if !ok {
+			return nil, fmt.Errorf("no teacher for team %s", team.ID)
+		}
+		orgID := domjudgeOrganizationID(teacher)
+		if !organizations[orgID] {
+			organizations[orgID] = true
+			export.Organizations = append(export.Organizations, DOMjudgeOrganization{
+				ID:         orgID,
+				Name:       teacher.SchoolName,
+				FormalName: fmt.Sprintf("%s, %s, %s", teacher.SchoolName, teacher.SchoolCity, teacher.SchoolState),
+				Country:    "USA",
+			})
+		}
+
+		// A team is a first-time team if none of its members have competed
+		// before.
+		groupIDs := []string{domjudgeDivisionGroupID(team.Division)}
+		if !slices.ContainsFunc(team.Members, func(s database.Student) bool { return s.PreviouslyParticipated }) {
+			groupIDs = append(groupIDs, domjudgeFirstTimeGroupID)
+		}
+
+		teamID := domjudgeTeamID(team.ID)
+		if other, ok := export.RegisteredTeams[teamID]; ok {
+			return nil, fmt.Errorf("teams %s and %s have the same DOMjudge team ID %s", other, team.ID, teamID)
+		}
+		export.RegisteredTeams[teamID] = team.ID
+		export.Teams = append(export.Teams, DOMjudgeTeam{
+			ID:             teamID,
+			Label:          teamID,
+			GroupIDs:       groupIDs,
+			Name:           team.Name,
+			DisplayName:    team.Name,
+			OrganizationID: orgID,
+		})
+		username := "team" + teamID
+		export.Accounts = append(export.Accounts, DOMjudgeAccount{
+			ID:       username,
+			Username: username,
+			Password: a.domjudgePassword(team.ID),
+			Name:     team.Name,
+			TeamID:   teamID,
+		})
+	}
+	slices.SortFunc(export.Organizations, func(a, b DOMjudgeOrganization) int {
+		return cmp.Compare(strings.ToLower(a.FormalName), strings.ToLower(b.FormalName))
+	})
+	return export, nil
+}
+
+// tsvField removes the characters that would break a tab separated line.
+func tsvField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+func writeTSVLine(w io.Writer, fields ...string) {
+	for i, field := range fields {
+		fields[i] = tsvField(field)
+	}
+	fmt.Fprintln(w, strings.Join(fields, "\t"))
+}
+
+// yamlString quotes the string for YAML. JSON strings are valid YAML
+// double-quoted scalars.
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+func (e *domjudgeExport) writeGroupsTSV(w io.Writer) {
+	writeTSVLine(w, "File_Version", "1")
+	for _, group := range e.Groups {
+		writeTSVLine(w, group.ID, group.Name)
+	}
+}
+
+// writeTeamsTSV writes the legacy teams.tsv format. It only supports one group
+// per team, so the division is used.
+func (e *domjudgeExport) writeTeamsTSV(w io.Writer) {
+	organizations := map[string]DOMjudgeOrganization{}
+	for _, org := range e.Organizations {
+		organizations[org.ID] = org
+	}
+	writeTSVLine(w, "File_Version", "2")
+	for _, team := range e.Teams {
+		org := organizations[team.OrganizationID]
+		writeTSVLine(w, team.ID, team.ID, team.GroupIDs[0], team.Name, org.FormalName, org.Name, org.Country, org.ID)
+	}
+}
+
+func (e *domjudgeExport) writeAccountsYAML(w io.Writer) {
+	if len(e.Accounts) == 0 {
+		fmt.Fprintln(w, "[]")
+		return
+	}
+	for _, account := range e.Accounts {
+		fmt.Fprintf(w, "- id: %s\n", yamlString(account.ID))
+		fmt.Fprintf(w, "  username: %s\n", yamlString(account.Username))
+		fmt.Fprintf(w, "  password: %s\n", yamlString(account.Password))
+		fmt.Fprintln(w, "  type: team")
+		fmt.Fprintf(w, "  name: %s\n", yamlString(account.Name))
+		fmt.Fprintf(w, "  team_id: %s\n", yamlString(account.TeamID))
+	}
+}
+
+// HandleDOMjudgeExport serves one of the DOMjudge import files. Add the div
+// query parameter to only export one division.
+func (a *Application) HandleDOMjudgeExport(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	log := a.Log.With().Str("page_name", "admin_domjudge_export").Str("file", file).Logger()
+
+	var division database.Division
+	if divStr := r.URL.Query().Get("div"); divStr != "" {
+		var err error
+		if division, err = database.ParseDivision(divStr); err != nil {
+			log.Warn().Err(err).Msg("invalid division")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	export, err := a.buildDOMjudgeExport(r.Context(), division)
+	if err != nil {
+		log.Err(err).Msg("failed to build DOMjudge export")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch file {
+	case "groups.json", "organizations.json", "teams.json":
+		data := map[string]any{
+			"groups.json":        export.Groups,
+			"organizations.json": export.Organizations,
+			"teams.json":         export.Teams,
+		}[file]
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			log.Err(err).Msg("failed to encode JSON")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		contentType = "application/json"
+	case "groups.tsv":
+		export.writeGroupsTSV(&buf)
+		contentType = "text/tab-separated-values"
+	case "teams.tsv":
+		export.writeTeamsTSV(&buf)
+		contentType = "text/tab-separated-values"
+	case "accounts.yaml":
+		export.writeAccountsYAML(&buf)
+		contentType = "application/yaml"
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file))
+	buf.WriteTo(w)
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestDOMjudgeExport(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 16)
+	advancedTeamID := uuid.New()
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", advancedTeamID, "Advanced Team", database.DivisionAdvanced, false, "", ""))
+	require.NoError(t, a.DB.AddTeamMember(ctx, advancedTeamID, "Veteran", 17, "veteran@example.com", true))
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", uuid.New(), "Empty Team", database.DivisionAdvanced, false, "", ""))
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+
+	get := func(path string) string {
+		t.Helper()
+		rec := doRequest(router, http.MethodGet, path, cookie)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		return rec.Body.String()
+	}
+
+	var teams []DOMjudgeTeam
+	require.NoError(t, json.Unmarshal([]byte(get("/admin/api/domjudge/teams.json")), &teams))
+	require.Len(t, teams, 2, "teams without members are not exported")
+	teamsByName := map[string]DOMjudgeTeam{}
+	for _, team := range teams {
+		teamsByName[team.Name] = team
+	}
+	assert.Equal(t, []string{"beginner", domjudgeFirstTimeGroupID}, teamsByName["Team"].GroupIDs)
+	assert.Equal(t, []string{"advanced"}, teamsByName["Advanced Team"].GroupIDs)
+	assert.Equal(t, teams[0].OrganizationID, teams[1].OrganizationID, "teams from the same school share an organization")
+
+	var organizations []DOMjudgeOrganization
+	require.NoError(t, json.Unmarshal([]byte(get("/admin/api/domjudge/organizations.json")), &organizations))
+	require.Len(t, organizations, 1)
+	assert.Equal(t, "School, Golden, CO", organizations[0].FormalName)
+
+	var groups []DOMjudgeGroup
+	require.NoError(t, json.Unmarshal([]byte(get("/admin/api/domjudge/groups.json?div=Advanced")), &groups))
+	assert.Equal(t, []DOMjudgeGroup{{ID: "advanced", Name: "Advanced"}, {ID: domjudgeFirstTimeGroupID, Name: "First-Time Teams"}}, groups)
+
+	advancedID := domjudgeTeamID(advancedTeamID)
+	assert.Len(t, advancedID, 8)
+	assert.Equal(t, advancedID, teamsByName["Advanced Team"].ID)
+	accounts := get("/admin/api/domjudge/accounts.yaml")
+	assert.Contains(t, accounts, `- id: "team`+advancedID+`"`)
+	assert.Contains(t, accounts, `  team_id: "`+advancedID+`"`)
+	assert.Equal(t, accounts, get("/admin/api/domjudge/accounts.yaml"), "passwords should not change between exports")
+
+	teamsTSV := strings.Split(strings.TrimSpace(get("/admin/api/domjudge/teams.tsv?div=Advanced")), "\n")
+	require.Len(t, teamsTSV, 2)
+	assert.Equal(t, "File_Version\t2", teamsTSV[0])
+	assert.True(t, strings.HasPrefix(teamsTSV[1], advancedID+"\t"+advancedID+"\tadvanced\tAdvanced Team\tSchool, Golden, CO\tSchool\tUSA\t"))
+
+	assert.Equal(t, http.StatusNotFound, doRequest(router, http.MethodGet, "/admin/api/domjudge/unknown.txt", cookie).Code)
+	assert.Equal(t, http.StatusBadRequest, doRequest(router, http.MethodGet, "/admin/api/domjudge/teams.json?div=Expert", cookie).Code)
+}
+
+func TestDOMjudgeExport_StableTeamIDs(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teams := addTestResultsTeams(t, a)
+	idsByName := func() map[string]string {
+		t.Helper()
+		export, err := a.buildDOMjudgeExport(ctx, "")
+		require.NoError(t, err)
+		ids := map[string]string{}
+		for _, team := range export.Teams {
+			ids[team.Name] = team.ID
+		}
+		return ids
+	}
+
+	before := idsByName()
+	require.Len(t, before, 3)
+
+	// Editing a team resets its registration time, and withdrawing a team
+	// removes it from the export. Neither changes the other teams' IDs.
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", teams["Code Rats"], "Code Rats", database.DivisionAdvanced, true, "", ""))
+	require.NoError(t, a.DB.WithdrawTeam(ctx, teams["Lobos 3"]))
+	after := idsByName()
+	assert.Equal(t, map[string]string{
+		"Code Rats": before["Code Rats"],
+		"Cool Cats": before["Cool Cats"],
+	}, after)
+}
@@ -8,7 +8,8 @@ import (
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
-func (a *Application) SendEmail(log zerolog.Logger, subject string, to *mail.Email, plainTextContent, htmlContent string) error {
+// SendEmail sends an email from the support address with any attachments.
+func (a *Application) SendEmail(log zerolog.Logger, subject string, to *mail.Email, plainTextContent, htmlContent string, attachments ...*mail.Attachment) error {
 	log = log.With().
 		Str("component", "send_email").
 		Interface("to", to).
@@ -17,6 +18,9 @@ func (a *Application) SendEmail(log zerolog.Logger, subject string, to *mail.Ema
 
 	if a.Config.DevMode {
 		fmt.Printf("=== EMAIL ===\nTo: %s\nSubject: %s\n\n%s\n\n", to, subject, plainTextContent)
+		for _, attachment := range attachments {
+			fmt.Printf("Attachment: %s (%s)\n\n", attachment.Filename, attachment.Type)
+		}
 
 		return nil
 	}
@@ -24,6 +28,7 @@ func (a *Application) SendEmail(log zerolog.Logger, subject string, to *mail.Ema
 	from := mail.NewEmail("Mines HSPC Support", "support@mineshspc.com")
 	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
 	message.ReplyTo = from
+	message.AddAttachment(attachments...)
 	resp, err := a.SendGridClient.Send(message)
 	if err != nil {
 		log.Err(err).Msg("failed to send email")
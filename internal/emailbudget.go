@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+var ErrEmailSendingSuspended = errors.New("email sending is suspended for this account")
+
+// checkEmailBudget returns an error if the teacher is not allowed to send any
+// more emails. Teachers are only blocked once an admin has reviewed their
+// account and suspended it; exceeding the budget only flags the account.
+func (a *Application) checkEmailBudget(teacher *database.Teacher) error {
+	if teacher.EmailSuspended {
+		return ErrEmailSendingSuspended
+	}
+	return nil
+}
+
+// recordEmailSend logs the outcome of sending an email regarding a student so
+// that the teacher can see when it was last sent and whether it was accepted.
+func (a *Application) recordEmailSend(ctx context.Context, send *database.EmailSend, sendErr error) error {
+	send.Status = database.EmailStatusAccepted
+	if sendErr != nil {
+		send.Status = database.EmailStatusFailed
+	}
+	return a.DB.RecordEmailSend(ctx, send)
+}
+
+// recordStudentVerifySend logs a confirmation email that was not sent by the
+// teacher. Failures to record are only logged.
+func (a *Application) recordStudentVerifySend(ctx context.Context, teacherEmail string, student *database.Student, source database.EmailSource, resend bool, sendErr error) {
+	err := a.recordEmailSend(ctx, &database.EmailSend{
+		TeacherEmail: teacherEmail,
+		StudentEmail: student.Email,
+		Recipient:    student.Email,
+		Kind:         database.EmailKindStudentVerify,
+		Source:       source,
+		Resend:       resend,
+	}, sendErr)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("failed to record email send")
+	}
+}
+
+// recordParentFormsSend logs a forms email that was not sent by the teacher.
+// Failures to record are only logged.
+func (a *Application) recordParentFormsSend(ctx context.Context, teacherEmail string, student *database.Student, source database.EmailSource, resend bool, sendErr error) {
+	err := a.recordEmailSend(ctx, &database.EmailSend{
+		TeacherEmail: teacherEmail,
+		StudentEmail: student.Email,
+		Recipient:    parentFormsRecipient(student),
+		Kind:         database.EmailKindParentForms,
+		Source:       source,
+		Resend:       resend,
+	}, sendErr)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Msg("failed to record email send")
+	}
+}
+
+// recordTeacherEmailSend logs an email that was sent on behalf of the teacher
+// and flags the teacher's account if any of the budget windows have been
+// exceeded.
+func (a *Application) recordTeacherEmailSend(ctx context.Context, teacher *database.Teacher, send *database.EmailSend, sendErr error) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("action", "recordTeacherEmailSend").
+		Str("teacher_email", teacher.Email).
+		Logger()
+
+	send.TeacherEmail = teacher.Email
+	send.Source = database.EmailSourceTeacher
+	if err := a.recordEmailSend(ctx, send, sendErr); err != nil {
+		return err
+	} else if sendErr != nil {
+		// Failed sends don't count against the budget.
+		return nil
+	}
+
+	now := time.Now()
+	for _, window := range a.Config.EmailBudget.GetWindows() {
+		firstSends, resends, err := a.DB.CountEmailSends(ctx, teacher.Email, now.Add(-window.Duration))
+		if err != nil {
+			return err
+		}
+
+		var reason string
+		if window.FirstSends > 0 && firstSends > window.FirstSends {
+			reason = fmt.Sprintf("%d emails sent in %s (budget is %d)", firstSends, window.Duration, window.FirstSends)
+		} else if window.Resends > 0 && resends > window.Resends {
+			reason = fmt.Sprintf("%d resends in %s (budget is %d)", resends, window.Duration, window.Resends)
+		} else {
+			continue
+		}
+
+		newlyFlagged, err := a.DB.FlagTeacherEmail(ctx, teacher.Email, reason)
+		if err != nil {
+			return err
+		} else if newlyFlagged {
+			log.Warn().Str("reason", reason).Msg("flagged teacher for exceeding email send budget")
+			a.notifyAdminsOfEmailFlag(log, teacher, reason)
+		}
+		return nil
+	}
+	return nil
+}
+
+func (a *Application) notifyAdminsOfEmailFlag(log zerolog.Logger, teacher *database.Teacher, reason string) {
+	plainTextContent := fmt.Sprintf(`%s (%s) has exceeded the email send budget: %s.
+
+Sending has not been blocked. Please review the account and suspend sending if necessary:
+
+%s/admin/teachers`, teacher.Name, teacher.Email, reason, a.Config.Domain)
+
+	for _, adminEmail := range a.Config.AdminEmails {
+		err := a.SendEmail(log, "Mines HSPC teacher flagged for email volume",
+			mail.NewEmail("", adminEmail),
+			plainTextContent,
+			"")
+		if err != nil {
+			log.Err(err).Str("admin_email", adminEmail).Msg("failed to notify admin of flagged teacher")
+		}
+	}
+}
+
+type EmailBudgetUsage struct {
+	Duration    time.Duration
+	FirstSends  int
+	Resends     int
+	FirstLimit  int
+	ResendLimit int
+}
+
+func (a *Application) getEmailBudgetUsage(ctx context.Context, teacherEmail string) ([]EmailBudgetUsage, error) {
+	now := time.Now()
+	var usage []EmailBudgetUsage
+	for _, window := range a.Config.EmailBudget.GetWindows() {
+		firstSends, resends, err := a.DB.CountEmailSends(ctx, teacherEmail, now.Add(-window.Duration))
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, EmailBudgetUsage{
+			Duration:    window.Duration,
+			FirstSends:  firstSends,
+			Resends:     resends,
+			FirstLimit:  window.FirstSends,
+			ResendLimit: window.Resends,
+		})
+	}
+	return usage, nil
+}
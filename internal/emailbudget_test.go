@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/config"
+)
+
+func TestRecordTeacherEmailSend_FlagsWithoutBlocking(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	a.Config.EmailBudget.Windows = []config.EmailBudgetWindow{
+		{Duration: time.Hour, FirstSends: 2, Resends: 1},
+	}
+	require.NoError(t, a.DB.NewTeacher(ctx, "Teacher", "teacher@example.com"))
+
+	for i, recipient := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		teacher, err := a.DB.GetTeacherByEmail(ctx, "teacher@example.com")
+		require.NoError(t, err)
+		assert.False(t, teacher.EmailFlagged(), "should not be flagged before send %d", i)
+		send := &database.EmailSend{StudentEmail: recipient, Recipient: recipient, Kind: database.EmailKindStudentVerify}
+		require.NoError(t, a.recordTeacherEmailSend(ctx, teacher, send, nil))
+	}
+
+	teacher, err := a.DB.GetTeacherByEmail(ctx, "teacher@example.com")
+	require.NoError(t, err)
+	assert.True(t, teacher.EmailFlagged())
+	assert.Contains(t, teacher.EmailFlagReason, "3 emails sent")
+	assert.NoError(t, a.checkEmailBudget(teacher), "flagged teachers should not be blocked")
+
+	require.NoError(t, a.DB.SetTeacherEmailSuspended(ctx, teacher.Email, true))
+	teacher, err = a.DB.GetTeacherByEmail(ctx, "teacher@example.com")
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.checkEmailBudget(teacher), ErrEmailSendingSuspended)
+}
+
+func TestCountEmailSends_SeparatesResends(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	for _, send := range []*database.EmailSend{
+		{TeacherEmail: "teacher@example.com", StudentEmail: "a@example.com", Kind: database.EmailKindStudentVerify},
+		{TeacherEmail: "teacher@example.com", StudentEmail: "a@example.com", Kind: database.EmailKindStudentVerify, Resend: true},
+		{TeacherEmail: "teacher@example.com", StudentEmail: "a@example.com", Kind: database.EmailKindParentForms, Resend: true},
+		{TeacherEmail: "other@example.com", StudentEmail: "b@example.com", Kind: database.EmailKindStudentVerify},
+		// Failed sends and sends by anyone other than the teacher are not counted.
+		{TeacherEmail: "teacher@example.com", StudentEmail: "a@example.com", Kind: database.EmailKindStudentVerify, Resend: true, Status: database.EmailStatusFailed},
+		{TeacherEmail: "teacher@example.com", StudentEmail: "a@example.com", Kind: database.EmailKindParentForms, Resend: true, Source: database.EmailSourceAdmin},
+	} {
+		if send.Source == "" {
+			send.Source = database.EmailSourceTeacher
+		}
+		if send.Status == "" {
+			send.Status = database.EmailStatusAccepted
+		}
+		send.Recipient = send.StudentEmail
+		require.NoError(t, a.DB.RecordEmailSend(ctx, send))
+	}
+
+	firstSends, resends, err := a.DB.CountEmailSends(ctx, "teacher@example.com", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, firstSends)
+	assert.Equal(t, 2, resends)
+
+	firstSends, resends, err = a.DB.CountEmailSends(ctx, "teacher@example.com", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, firstSends)
+	assert.Zero(t, resends)
+}
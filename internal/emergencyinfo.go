@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+const (
+	// emergencyInfoMaxLength limits how much can be entered in each of the
+	// emergency information fields.
+	emergencyInfoMaxLength = 2000
+	// emergencyInfoPurgeInterval is how often the emergency information is
+	// checked for whether it is due to be purged.
+	emergencyInfoPurgeInterval = time.Hour
+)
+
+// parseEmergencyInfoForm reads the emergency information fields of the
+// student and parent forms.
+func parseEmergencyInfoForm(r *http.Request, studentEmail string) *database.EmergencyInfo {
+	field := func(name string) string {
+		value := strings.TrimSpace(r.FormValue(name))
+		if utf8.RuneCountInString(value) > emergencyInfoMaxLength {
+			value = string([]rune(value)[:emergencyInfoMaxLength])
+		}
+		return value
+	}
+	return &database.EmergencyInfo{
+		StudentEmail:   studentEmail,
+		ContactName:    field("emergency-contact-name"),
+		ContactPhone:   field("emergency-contact-phone"),
+		MedicalNotes:   field("medical-notes"),
+		Accommodations: field("accommodations"),
+	}
+}
+
+// collectingEmergencyInfo reports whether the team's students are asked for
+// their emergency information. It is only needed on campus and is no longer
+// collected once it is due to be purged.
+func (a *Application) collectingEmergencyInfo(team *database.Team) bool {
+	return team.InPerson && !a.Config.EmergencyInfoExpired(time.Now())
+}
+
+// saveEmergencyInfo stores the emergency information from a student or parent
+// form. Leaving every field empty does not create a record.
+func (a *Application) saveEmergencyInfo(ctx context.Context, info *database.EmergencyInfo) error {
+	log := zerolog.Ctx(ctx).With().Str("action", "save_emergency_info").Str("student_email", info.StudentEmail).Logger()
+	if info.IsEmpty() {
+		existing, err := a.DB.GetEmergencyInfo(ctx, info.StudentEmail)
+		if err != nil {
+			return err
+		} else if existing == nil {
+			return nil
+		}
+	}
+	if err := a.DB.SaveEmergencyInfo(ctx, info); err != nil {
+		return err
+	}
+	log.Info().Msg("saved emergency info")
+	return nil
+}
+
+// getStudentEmergencyInfo returns the student's emergency information for
+// filling in the forms, or nil if there is none.
+func (a *Application) getStudentEmergencyInfo(ctx context.Context, student *database.Student) *database.EmergencyInfo {
+	info, err := a.DB.GetEmergencyInfo(ctx, student.Email)
+	if err != nil {
+		a.Log.Err(err).Str("student_email", student.Email).Msg("failed to get emergency info")
+	}
+	return info
+}
+
+// EmergencyInfoAccessMiddleware only lets through the admins that are allowed
+// to see every student's emergency information.
+func (a *Application) EmergencyInfoAccessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminEmail := a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin)
+		if !a.Config.CanViewEmergencyInfo(adminEmail) {
+			hlog.FromRequest(r).Warn().Str("admin_email", adminEmail).Msg("admin is not allowed to view emergency info")
+			http.Error(w, "You are not allowed to view the emergency information.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Application) GetAdminEmergencyInfoTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	infos, err := a.DB.GetAllEmergencyInfo(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get emergency info")
+		return nil
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams for emergency info")
+		return nil
+	}
+	hlog.FromRequest(r).Info().
+		Str("admin_email", a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin)).
+		Int("students", len(infos)).
+		Msg("admin viewed emergency info")
+
+	provided := map[string]bool{}
+	for _, info := range infos {
+		provided[info.StudentEmail] = info.ContactName != "" && info.ContactPhone != ""
+	}
+	var missing []PreflightStudent
+	for _, team := range teams {
+		if !team.InPerson {
+			continue
+		}
+		for _, student := range team.Members {
+			if student.EmailConfirmed && !provided[student.Email] {
+				missing = append(missing, PreflightStudent{Name: student.Name, Email: student.Email, TeamName: team.Name})
+			}
+		}
+	}
+
+	return map[string]any{
+		"EmergencyInfo": infos,
+		"Missing":       missing,
+		"PurgeAfter":    a.Config.EmergencyInfo.PurgeAfter,
+		"Error":         r.URL.Query().Get("error"),
+		"Message":       r.URL.Query().Get("message"),
+	}
+}
+
+func redirectToEmergencyInfo(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/emergency"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func (a *Application) HandleAdminPurgeEmergencyInfo(w http.ResponseWriter, r *http.Request) {
+	log := hlog.FromRequest(r).With().
+		Str("action", "purge_emergency_info").
+		Str("admin_email", a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin)).
+		Logger()
+	if err := r.ParseForm(); err != nil {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("confirm") != "on" {
+		redirectToEmergencyInfo(w, r, "error", "Confirm that you want to delete all of the emergency information.")
+		return
+	}
+
+	purged, err := a.DB.PurgeEmergencyInfo(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to purge emergency info")
+		redirectToEmergencyInfo(w, r, "error", "Failed to delete the emergency information.")
+		return
+	}
+	log.Info().Int64("purged", purged).Msg("purged emergency info")
+	redirectToEmergencyInfo(w, r, "message", fmt.Sprintf("Deleted the emergency information of %d students.", purged))
+}
+
+// purgeExpiredEmergencyInfo deletes all of the emergency information if it is
+// due to be purged at the given time.
+func (a *Application) purgeExpiredEmergencyInfo(ctx context.Context, now time.Time) error {
+	if !a.Config.EmergencyInfoExpired(now) {
+		return nil
+	}
+	purged, err := a.DB.PurgeEmergencyInfo(ctx)
+	if err != nil {
+		return err
+	} else if purged > 0 {
+		a.Log.Info().Int64("purged", purged).Msg("purged expired emergency info")
+	}
+	return nil
+}
+
+// RunEmergencyInfoPurger purges the emergency information once it is due until
+// the context is cancelled.
+func (a *Application) RunEmergencyInfoPurger(ctx context.Context) {
+	ticker := time.NewTicker(emergencyInfoPurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := a.purgeExpiredEmergencyInfo(ctx, time.Now()); err != nil {
+			a.Log.Err(err).Msg("failed to purge expired emergency info")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
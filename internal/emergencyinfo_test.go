@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestParentSignFormsEmergencyInfo(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	_, student := addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, student.Email, false, "", "parent@example.com"))
+	path := "/register/parent/signforms?tok=" + signFormsToken(t, a, student)
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := doRequest(router, http.MethodGet, path)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `name="emergency-contact-phone"`)
+
+	form := url.Values{"liability-waiver": {"on"}, "computer-use-waiver": {"on"}, "parent-name": {"Parent"}}
+	assert.Equal(t, http.StatusBadRequest, post(form).Code, "in-person students need an emergency contact")
+	student, err := a.DB.GetStudentByEmail(ctx, student.Email)
+	require.NoError(t, err)
+	assert.False(t, student.LiabilitySigned)
+
+	form.Set("emergency-contact-name", " Parent ")
+	form.Set("emergency-contact-phone", "303-555-0100")
+	form.Set("medical-notes", "Peanut allergy, carries an EpiPen")
+	assertRedirectsTo(t, post(form), path)
+	info, err := a.DB.GetEmergencyInfo(ctx, student.Email)
+	require.NoError(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, "Parent", info.ContactName)
+	assert.Equal(t, "Peanut allergy, carries an EpiPen", info.MedicalNotes)
+	assert.Empty(t, info.Accommodations)
+
+	// The volunteer that scans the student sees it.
+	qrTok, err := a.getStudentQRToken(student.Email)
+	require.NoError(t, err)
+	rec = doRequest(router, http.MethodGet, "/volunteer/scan?tok="+qrTok, &http.Cookie{Name: "volunteer_token", Value: volunteerToken(t)})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<a href="tel:303-555-0100">`)
+	assert.Contains(t, rec.Body.String(), "Peanut allergy")
+}
+
+func TestStudentConfirmEmergencyInfo(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	router := a.BuildRouter()
+	addTestStudent(t, a, "student@example.com", 16)
+	link, err := a.getStudentConfirmEmailLink("student@example.com")
+	require.NoError(t, err)
+	path := strings.TrimPrefix(link, a.Config.Domain)
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	form := url.Values{"confirm-info-correct": {"on"}, "parent-email": {"parent@example.com"}}
+	require.Equal(t, http.StatusOK, post(form).Code)
+	info, err := a.DB.GetEmergencyInfo(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, info, "leaving the fields empty does not store anything")
+
+	form.Set("accommodations", "Wheelchair accessible seating")
+	rec := post(form)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Wheelchair accessible seating")
+	info, err = a.DB.GetEmergencyInfo(ctx, "student@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, "Wheelchair accessible seating", info.Accommodations)
+
+	// Nothing is collected once it is due to be purged.
+	a.Config.EmergencyInfo.PurgeAfter = time.Now().Add(-time.Hour)
+	rec = doRequest(router, http.MethodGet, path)
+	assert.NotContains(t, rec.Body.String(), `name="accommodations"`)
+}
+
+func TestAdminEmergencyInfo(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	_, student := addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, student.Email, false, "", "parent@example.com"))
+	require.NoError(t, a.DB.SaveEmergencyInfo(ctx, &database.EmergencyInfo{
+		StudentEmail: student.Email,
+		ContactName:  "Parent",
+		ContactPhone: "303-555-0100",
+	}))
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/emergency/purge", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := doRequest(router, http.MethodGet, "/admin/emergency", cookie)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "admins can only see it if they are allowed to")
+	assert.NotContains(t, rec.Body.String(), "303-555-0100")
+	assert.Equal(t, http.StatusForbidden, post(url.Values{"confirm": {"on"}}).Code)
+
+	a.Config.AdminEmails = []string{"test@example.com"}
+	a.Config.EmergencyInfo.ViewerEmails = []string{"test@example.com"}
+	rec = doRequest(router, http.MethodGet, "/admin/emergency", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "303-555-0100")
+
+	assert.Contains(t, post(url.Values{}).Header().Get("Location"), "error=")
+	assert.Contains(t, post(url.Values{"confirm": {"on"}}).Header().Get("Location"), "message=")
+	info, err := a.DB.GetEmergencyInfo(ctx, student.Email)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	rec = doRequest(router, http.MethodGet, "/admin/emergency", cookie)
+	assert.Contains(t, rec.Body.String(), "student@example.com", "the student is listed as missing an emergency contact")
+}
+
+func TestPurgeExpiredEmergencyInfo(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.SaveEmergencyInfo(ctx, &database.EmergencyInfo{StudentEmail: "student@example.com", ContactName: "Parent"}))
+
+	purgeAfter := time.Date(2026, time.April, 26, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, a.purgeExpiredEmergencyInfo(ctx, purgeAfter), "it is kept forever by default")
+	a.Config.EmergencyInfo.PurgeAfter = purgeAfter
+	require.NoError(t, a.purgeExpiredEmergencyInfo(ctx, purgeAfter.Add(-time.Minute)))
+	info, err := a.DB.GetEmergencyInfo(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, info)
+
+	require.NoError(t, a.purgeExpiredEmergencyInfo(ctx, purgeAfter))
+	info, err = a.DB.GetEmergencyInfo(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestParseEmergencyInfoForm_TruncatesOnRunes(t *testing.T) {
+	notes := strings.Repeat("ñ", emergencyInfoMaxLength+1)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"medical-notes": {notes}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	info := parseEmergencyInfoForm(req, "student@example.com")
+	assert.True(t, utf8.ValidString(info.MedicalNotes))
+	assert.Equal(t, emergencyInfoMaxLength, utf8.RuneCountInString(info.MedicalNotes))
+}
@@ -0,0 +1,136 @@
+// Package export writes tables of data as CSV, JSON or XLSX files.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+type Column struct {
+	// Key identifies the column in the JSON output and in query parameters.
+	Key   string
+	Title string
+}
+
+// Table is a list of rows with one value per column. Values may be strings,
+// ints, bools or times. A zero time is written as an empty value.
+type Table struct {
+	// Name is used for the XLSX sheet name.
+	Name    string
+	Columns []Column
+	Rows    [][]any
+}
+
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+	FormatXLSX Format = "xlsx"
+)
+
+var Formats = []Format{FormatCSV, FormatJSON, FormatXLSX}
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatCSV, FormatJSON, FormatXLSX:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("invalid export format: %s", s)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv"
+	}
+}
+
+// Write writes the table in the format.
+func (t *Table) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		return t.WriteJSON(w)
+	case FormatXLSX:
+		return t.WriteXLSX(w)
+	default:
+		return t.WriteCSV(w)
+	}
+}
+
+// TimeLayout is how times are formatted in CSV files.
+const TimeLayout = "2006-01-02 15:04:05"
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(TimeLayout)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// WriteCSV writes the table as a CSV file with a header row.
+func (t *Table) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		header[i] = column.Title
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = formatValue(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes the table as a JSON array with an object for each row,
+// keyed by the column keys.
+func (t *Table) WriteJSON(w io.Writer) error {
+	rows := make([]map[string]any, len(t.Rows))
+	for i, row := range t.Rows {
+		rows[i] = make(map[string]any, len(t.Columns))
+		for j, column := range t.Columns {
+			if v, ok := row[j].(time.Time); ok && v.IsZero() {
+				rows[i][column.Key] = nil
+			} else {
+				rows[i][column.Key] = row[j]
+			}
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
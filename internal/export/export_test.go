@@ -0,0 +1,92 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTable = &Table{
+	Name: "Students: All",
+	Columns: []Column{
+		{Key: "name", Title: "Name"},
+		{Key: "age", Title: "Age"},
+		{Key: "confirmed", Title: "Confirmed"},
+		{Key: "checked_in", Title: "Checked In"},
+	},
+	Rows: [][]any{
+		{"Ada, \"The Countess\"", 17, true, time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)},
+		{"Grace <Hopper> & Co", 16, false, time.Time{}},
+	},
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testTable.Write(&buf, FormatCSV))
+	assert.Equal(t, "Name,Age,Confirmed,Checked In\n"+
+		"\"Ada, \"\"The Countess\"\"\",17,yes,2026-03-14 09:30:00\n"+
+		"Grace <Hopper> & Co,16,no,\n", buf.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testTable.Write(&buf, FormatJSON))
+	var rows []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rows))
+	require.Len(t, rows, 2)
+	assert.Equal(t, map[string]any{
+		"name":       "Ada, \"The Countess\"",
+		"age":        float64(17),
+		"confirmed":  true,
+		"checked_in": "2026-03-14T09:30:00Z",
+	}, rows[0])
+	assert.Nil(t, rows[1]["checked_in"])
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testTable.Write(&buf, FormatXLSX))
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[file.Name] = string(content)
+	}
+	require.Contains(t, files, "[Content_Types].xml")
+	require.Contains(t, files, "xl/styles.xml")
+	assert.Contains(t, files["xl/workbook.xml"], `name="Students  All"`)
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">Name</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="B2"><v>17</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2" t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" s="2"><v>46095.395833333336</v></c>`)
+	assert.Contains(t, sheet, `Grace &lt;Hopper&gt; &amp; Co`)
+	assert.NotContains(t, sheet, `r="D3"`, "zero times should be left empty")
+}
+
+func TestColumnName(t *testing.T) {
+	for i, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, name, columnName(i))
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("xlsx")
+	require.NoError(t, err)
+	assert.Equal(t, FormatXLSX, format)
+	_, err = ParseFormat("pdf")
+	assert.Error(t, err)
+}
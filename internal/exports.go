@@ -0,0 +1,485 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/export"
+)
+
+var errInvalidExportRequest = errors.New("invalid export request")
+
+// ExportFilter is a filter that can be applied to a dataset. The filter is
+// given as a query parameter named by the key, and must be one of the options.
+type ExportFilter struct {
+	Key     string
+	Title   string
+	Options []string
+}
+
+// ExportDataset is a dataset that can be downloaded in any of the export
+// formats with a chosen set of columns and filters.
+type ExportDataset interface {
+	Name() string
+	Title() string
+	Columns() []export.Column
+	Filters() []ExportFilter
+	// Table returns the rows that match all of the filters with the given
+	// columns, or all columns if none are given.
+	Table(ctx context.Context, columnKeys []string, filterValues map[string]string) (*export.Table, error)
+}
+
+type exportColumn[T any] struct {
+	export.Column
+	Value func(T) any
+}
+
+type exportFilter[T any] struct {
+	ExportFilter
+	Match func(row T, value string) bool
+}
+
+type exportDataset[T any] struct {
+	name    string
+	title   string
+	columns []exportColumn[T]
+	filters []exportFilter[T]
+	rows    func(ctx context.Context) ([]T, error)
+}
+
+func (d *exportDataset[T]) Name() string  { return d.name }
+func (d *exportDataset[T]) Title() string { return d.title }
+
+func (d *exportDataset[T]) Columns() []export.Column {
+	columns := make([]export.Column, len(d.columns))
+	for i, column := range d.columns {
+		columns[i] = column.Column
+	}
+	return columns
+}
+
+func (d *exportDataset[T]) Filters() []ExportFilter {
+	filters := make([]ExportFilter, len(d.filters))
+	for i, filter := range d.filters {
+		filters[i] = filter.ExportFilter
+	}
+	return filters
+}
+
+// filterRows returns the rows that match all of the filters. Filters without a
+// value are not applied.
+func (d *exportDataset[T]) filterRows(ctx context.Context, filterValues map[string]string) ([]T, error) {
+	var filters []exportFilter[T]
+	var values []string
+	for _, filter := range d.filters {
+		value := filterValues[filter.Key]
+		if value == "" {
+			continue
+		} else if !slices.Contains(filter.Options, value) {
+			return nil, fmt.Errorf("%w: invalid value %q for %s", errInvalidExportRequest, value, filter.Key)
+		}
+		filters = append(filters, filter)
+		values = append(values, value)
+	}
+
+	rows, err := d.rows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(rows, func(row T) bool {
+		for i, filter := range filters {
+			if !filter.Match(row, values[i]) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (d *exportDataset[T]) Table(ctx context.Context, columnKeys []string, filterValues map[string]string) (*export.Table, error) {
+	columns := d.columns
+	if len(columnKeys) > 0 {
+		columns = nil
+		for _, key := range columnKeys {
+			i := slices.IndexFunc(d.columns, func(c exportColumn[T]) bool { return c.Key == key })
+			if i < 0 {
+				return nil, fmt.Errorf("%w: unknown column %q", errInvalidExportRequest, key)
+			}
+			columns = append(columns, d.columns[i])
+		}
+	}
+
+	rows, err := d.filterRows(ctx, filterValues)
+	if err != nil {
+		return nil, err
+	}
+	table := &export.Table{Name: d.title}
+	for _, column := range columns {
+		table.Columns = append(table.Columns, column.Column)
+	}
+	for _, row := range rows {
+		values := make([]any, len(columns))
+		for i, column := range columns {
+			values[i] = column.Value(row)
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	return table, nil
+}
+
+func column[T any](key, title string, value func(T) any) exportColumn[T] {
+	return exportColumn[T]{Column: export.Column{Key: key, Title: title}, Value: value}
+}
+
+func yesNoFilter[T any](key, title string, value func(T) bool) exportFilter[T] {
+	return exportFilter[T]{
+		ExportFilter: ExportFilter{Key: key, Title: title, Options: []string{"yes", "no"}},
+		Match:        func(row T, v string) bool { return value(row) == (v == "yes") },
+	}
+}
+
+func divisionFilter[T any](division func(T) database.Division) exportFilter[T] {
+	return exportFilter[T]{
+		ExportFilter: ExportFilter{
+			Key:     "division",
+			Title:   "Division",
+			Options: []string{string(database.DivisionBeginner), string(database.DivisionAdvanced)},
+		},
+		Match: func(row T, v string) bool { return string(division(row)) == v },
+	}
+}
+
+type exportTeam struct {
+	*database.TeamWithTeacherName
+	Seat *database.TeamSeat
+}
+
+func (t *exportTeam) firstTime() bool {
+	return !slices.ContainsFunc(t.Members, func(s database.Student) bool { return s.PreviouslyParticipated })
+}
+
+func (t *exportTeam) allMembers(f func(s *database.Student) bool) bool {
+	for _, member := range t.Members {
+		if !f(&member) {
+			return false
+		}
+	}
+	return true
+}
+
+type exportStudent struct {
+	*database.Student
+	Team *exportTeam
+	// DietaryCategoryNames are the names of the student's dietary categories
+	// from this season.
+	DietaryCategoryNames []string
+}
+
+// formsSigned reports whether the student has signed all of the forms that
+// their team needs.
+func formsSigned(student *database.Student, team *database.TeamWithTeacherName) bool {
+	return student.LiabilitySigned && (!team.InPerson || student.ComputerUseWaiverSigned)
+}
+
+func (a *Application) getExportTeams(ctx context.Context) ([]*exportTeam, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seats, err := a.DB.GetTeamSeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exportTeams := make([]*exportTeam, len(teams))
+	for i, team := range teams {
+		slices.SortFunc(team.Members, func(a, b database.Student) int {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+		exportTeams[i] = &exportTeam{TeamWithTeacherName: team, Seat: seats[team.ID]}
+	}
+	slices.SortFunc(exportTeams, func(a, b *exportTeam) int {
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return exportTeams, nil
+}
+
+func (a *Application) getExportStudents(ctx context.Context) ([]*exportStudent, error) {
+	teams, err := a.getExportTeams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := a.DB.GetDietaryCategories(ctx, currentSeason())
+	if err != nil {
+		return nil, err
+	}
+	var students []*exportStudent
+	for _, team := range teams {
+		for i := range team.Members {
+			student := &exportStudent{Student: &team.Members[i], Team: team}
+			for _, category := range categories {
+				if slices.Contains(student.DietaryCategories, category.ID) {
+					student.DietaryCategoryNames = append(student.DietaryCategoryNames, category.Name)
+				}
+			}
+			students = append(students, student)
+		}
+	}
+	return students, nil
+}
+
+func seatRoom(seat *database.TeamSeat) any {
+	if seat == nil {
+		return ""
+	}
+	return seat.RoomName
+}
+
+func seatNumber(seat *database.TeamSeat) any {
+	if seat == nil {
+		return ""
+	}
+	return seat.Seat
+}
+
+// studentExportColumns are shared by the students and dietary restrictions
+// datasets.
+var studentExportColumns = []exportColumn[*exportStudent]{
+	column("name", "Name", func(s *exportStudent) any { return s.Name }),
+	column("email", "Email", func(s *exportStudent) any { return s.Email }),
+	column("age", "Age", func(s *exportStudent) any { return s.Age }),
+	column("team", "Team", func(s *exportStudent) any { return s.Team.Name }),
+	column("division", "Division", func(s *exportStudent) any { return string(s.Team.Division) }),
+	column("in_person", "In Person", func(s *exportStudent) any { return s.Team.InPerson }),
+	column("school", "School", func(s *exportStudent) any { return s.Team.SchoolName }),
+	column("teacher", "Teacher", func(s *exportStudent) any { return s.Team.TeacherName }),
+	column("teacher_email", "Teacher Email", func(s *exportStudent) any { return s.Team.TeacherEmail }),
+	column("parent_email", "Parent Email", func(s *exportStudent) any { return s.ParentEmail }),
+	column("first_time", "First Time", func(s *exportStudent) any { return !s.PreviouslyParticipated }),
+	column("email_confirmed", "Email Confirmed", func(s *exportStudent) any { return s.EmailConfirmed }),
+	column("liability_signed", "Liability Waiver Signed", func(s *exportStudent) any { return s.LiabilitySigned }),
+	column("computer_use_signed", "Computer Use Waiver Signed", func(s *exportStudent) any { return s.ComputerUseWaiverSigned }),
+	column("signatory", "Signatory", func(s *exportStudent) any { return s.Signatory }),
+	column("campus_tour", "Campus Tour", func(s *exportStudent) any { return s.CampusTour }),
+	column("dietary_categories", "Dietary Categories", func(s *exportStudent) any { return strings.Join(s.DietaryCategoryNames, ", ") }),
+	column("dietary_restrictions", "Dietary Restrictions", func(s *exportStudent) any { return s.DietaryRestrictions }),
+	column("qr_code_sent", "Ticket Sent", func(s *exportStudent) any { return s.QRCodeSent }),
+	column("checked_in", "On Site", func(s *exportStudent) any { return s.CheckedIn }),
+	column("room", "Room", func(s *exportStudent) any { return seatRoom(s.Team.Seat) }),
+	column("seat", "Seat", func(s *exportStudent) any { return seatNumber(s.Team.Seat) }),
+}
+
+var studentExportFilters = []exportFilter[*exportStudent]{
+	divisionFilter(func(s *exportStudent) database.Division { return s.Team.Division }),
+	yesNoFilter("in_person", "In Person", func(s *exportStudent) bool { return s.Team.InPerson }),
+	yesNoFilter("first_time", "First Time", func(s *exportStudent) bool { return !s.PreviouslyParticipated }),
+	yesNoFilter("email_confirmed", "Email Confirmed", func(s *exportStudent) bool { return s.EmailConfirmed }),
+	yesNoFilter("forms_signed", "Waivers Signed", func(s *exportStudent) bool { return formsSigned(s.Student, s.Team.TeamWithTeacherName) }),
+}
+
+// exportDatasets returns all of the datasets that can be exported, in the
+// order that they are shown to admins.
+func (a *Application) exportDatasets() []ExportDataset {
+	return []ExportDataset{
+		a.teamsExportDataset(),
+		a.studentsExportDataset(),
+		a.teachersExportDataset(),
+		a.chaperonesExportDataset(),
+		a.volunteersExportDataset(),
+		a.dietaryRestrictionsExportDataset(),
+		&cateringExportDataset{a: a},
+		a.toursExportDataset(),
+		a.checkInsExportDataset(),
+	}
+}
+
+func (a *Application) teamsExportDataset() *exportDataset[*exportTeam] {
+	return &exportDataset[*exportTeam]{
+		name:  "teams",
+		title: "Teams",
+		columns: []exportColumn[*exportTeam]{
+			column("id", "ID", func(t *exportTeam) any { return t.ID.String() }),
+			column("name", "Name", func(t *exportTeam) any { return t.Name }),
+			column("division", "Division", func(t *exportTeam) any { return string(t.Division) }),
+			column("in_person", "In Person", func(t *exportTeam) any { return t.InPerson }),
+			column("school", "School", func(t *exportTeam) any { return t.SchoolName }),
+			column("teacher", "Teacher", func(t *exportTeam) any { return t.TeacherName }),
+			column("teacher_email", "Teacher Email", func(t *exportTeam) any { return t.TeacherEmail }),
+			column("member_count", "Members", func(t *exportTeam) any { return len(t.Members) }),
+			column("member_names", "Member Names", func(t *exportTeam) any {
+				names := make([]string, len(t.Members))
+				for i, member := range t.Members {
+					names[i] = member.Name
+				}
+				return strings.Join(names, ", ")
+			}),
+			column("first_time", "First Time", func(t *exportTeam) any { return t.firstTime() }),
+			column("division_explanation", "Division Explanation", func(t *exportTeam) any { return t.DivisionExplanation }),
+			column("accessibility_notes", "Accessibility Notes", func(t *exportTeam) any { return t.AccessibilityNotes }),
+			column("room", "Room", func(t *exportTeam) any { return seatRoom(t.Seat) }),
+			column("seat", "Seat", func(t *exportTeam) any { return seatNumber(t.Seat) }),
+			column("registered", "Registered", func(t *exportTeam) any { return t.RegistrationTS }),
+		},
+		filters: []exportFilter[*exportTeam]{
+			divisionFilter(func(t *exportTeam) database.Division { return t.Division }),
+			yesNoFilter("in_person", "In Person", func(t *exportTeam) bool { return t.InPerson }),
+			yesNoFilter("first_time", "First Time", (*exportTeam).firstTime),
+			yesNoFilter("email_confirmed", "All Emails Confirmed", func(t *exportTeam) bool {
+				return t.allMembers(func(s *database.Student) bool { return s.EmailConfirmed })
+			}),
+			yesNoFilter("forms_signed", "All Waivers Signed", func(t *exportTeam) bool {
+				return t.allMembers(func(s *database.Student) bool { return formsSigned(s, t.TeamWithTeacherName) })
+			}),
+		},
+		rows: a.getExportTeams,
+	}
+}
+
+func (a *Application) studentsExportDataset() *exportDataset[*exportStudent] {
+	return &exportDataset[*exportStudent]{
+		name:    "students",
+		title:   "Students",
+		columns: studentExportColumns,
+		filters: studentExportFilters,
+		rows:    a.getExportStudents,
+	}
+}
+
+func (a *Application) teachersExportDataset() *exportDataset[*database.Teacher] {
+	return &exportDataset[*database.Teacher]{
+		name:  "teachers",
+		title: "Teachers",
+		columns: []exportColumn[*database.Teacher]{
+			column("name", "Name", func(t *database.Teacher) any { return t.Name }),
+			column("email", "Email", func(t *database.Teacher) any { return t.Email }),
+			column("email_confirmed", "Email Confirmed", func(t *database.Teacher) any { return t.EmailConfirmed }),
+			column("school", "School", func(t *database.Teacher) any { return t.SchoolName }),
+			column("city", "City", func(t *database.Teacher) any { return t.SchoolCity }),
+			column("state", "State", func(t *database.Teacher) any { return t.SchoolState }),
+			column("email_suspended", "Email Suspended", func(t *database.Teacher) any { return t.EmailSuspended }),
+		},
+		filters: []exportFilter[*database.Teacher]{
+			yesNoFilter("email_confirmed", "Email Confirmed", func(t *database.Teacher) bool { return t.EmailConfirmed }),
+		},
+		rows: a.DB.GetAllTeachers,
+	}
+}
+
+func (a *Application) volunteersExportDataset() *exportDataset[string] {
+	return &exportDataset[string]{
+		name:  "volunteers",
+		title: "Volunteers",
+		columns: []exportColumn[string]{
+			column("email", "Email", func(email string) any { return email }),
+		},
+		rows: a.DB.GetAllVolunteers,
+	}
+}
+
+func (a *Application) dietaryRestrictionsExportDataset() *exportDataset[*exportStudent] {
+	return &exportDataset[*exportStudent]{
+		name:    "dietaryrestrictions",
+		title:   "Dietary Restrictions",
+		columns: studentExportColumns,
+		filters: studentExportFilters,
+		rows: func(ctx context.Context) ([]*exportStudent, error) {
+			students, err := a.getExportStudents(ctx)
+			return slices.DeleteFunc(students, func(s *exportStudent) bool {
+				return len(s.DietaryCategoryNames) == 0 && strings.TrimSpace(s.DietaryRestrictions) == ""
+			}), err
+		},
+	}
+}
+
+func (a *Application) checkInsExportDataset() *exportDataset[*database.CheckInEventWithStudent] {
+	return &exportDataset[*database.CheckInEventWithStudent]{
+		name:  "checkins",
+		title: "Check-ins",
+		columns: []exportColumn[*database.CheckInEventWithStudent]{
+			column("time", "Time", func(e *database.CheckInEventWithStudent) any { return e.TS }),
+			column("direction", "Direction", func(e *database.CheckInEventWithStudent) any { return string(e.Direction) }),
+			column("student_name", "Student", func(e *database.CheckInEventWithStudent) any { return e.StudentName }),
+			column("student_email", "Student Email", func(e *database.CheckInEventWithStudent) any { return e.StudentEmail }),
+			column("team", "Team", func(e *database.CheckInEventWithStudent) any { return e.TeamName }),
+			column("volunteer", "Volunteer", func(e *database.CheckInEventWithStudent) any { return e.Volunteer }),
+			column("station", "Station", func(e *database.CheckInEventWithStudent) any { return e.Station }),
+		},
+		filters: []exportFilter[*database.CheckInEventWithStudent]{{
+			ExportFilter: ExportFilter{
+				Key:     "direction",
+				Title:   "Direction",
+				Options: []string{string(database.CheckInDirectionIn), string(database.CheckInDirectionOut)},
+			},
+			Match: func(e *database.CheckInEventWithStudent, v string) bool { return string(e.Direction) == v },
+		}},
+		rows: func(ctx context.Context) ([]*database.CheckInEventWithStudent, error) {
+			return a.DB.GetCheckInEvents(ctx, "")
+		},
+	}
+}
+
+func (a *Application) GetAdminExportsTemplate(r *http.Request) map[string]any {
+	return map[string]any{
+		"Datasets": a.exportDatasets(),
+		"Formats":  export.Formats,
+	}
+}
+
+// HandleExport serves a dataset. The format query parameter chooses the
+// format, which defaults to CSV. The column query parameter can be given
+// multiple times to choose the columns, and each filter is given as a query
+// parameter named by the filter key.
+func (a *Application) HandleExport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("dataset")
+	log := a.Log.With().Str("page_name", "admin_export").Str("dataset", name).Logger()
+
+	datasets := a.exportDatasets()
+	i := slices.IndexFunc(datasets, func(d ExportDataset) bool { return d.Name() == name })
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	dataset := datasets[i]
+
+	query := r.URL.Query()
+	format := export.FormatCSV
+	if formatStr := query.Get("format"); formatStr != "" {
+		var err error
+		if format, err = export.ParseFormat(formatStr); err != nil {
+			log.Warn().Err(err).Msg("invalid export format")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	filterValues := map[string]string{}
+	for _, filter := range dataset.Filters() {
+		filterValues[filter.Key] = query.Get(filter.Key)
+	}
+
+	table, err := dataset.Table(r.Context(), query["column"], filterValues)
+	if errors.Is(err, errInvalidExportRequest) {
+		log.Warn().Err(err).Msg("invalid export request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Err(err).Msg("failed to get export data")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := table.Write(&buf, format); err != nil {
+		log.Err(err).Msg("failed to write export")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, dataset.Name(), format))
+	buf.WriteTo(w)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teamID, _ := addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", true, "Vegetarian", "parent@example.com"))
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Returning", 17, "returning@example.com", true))
+	remoteTeamID := uuid.New()
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", remoteTeamID, "Remote Team", database.DivisionAdvanced, false, "", ""))
+	require.NoError(t, a.DB.AddTeamMember(ctx, remoteTeamID, "Remote", 18, "remote@example.com", false))
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+
+	get := func(path string) string {
+		t.Helper()
+		rec := doRequest(router, http.MethodGet, path, cookie)
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "Name,Team\nRemote,Remote Team\nReturning,Team\nStudent,Team\n",
+		get("/admin/api/export/students?column=name&column=team"))
+	assert.Equal(t, "Name,Email Confirmed\nStudent,yes\n",
+		get("/admin/api/export/students?column=name&column=email_confirmed&division=Beginner&first_time=yes"))
+	assert.Equal(t, "Name\nRemote Team\n",
+		get("/admin/api/export/teams?column=name&in_person=no"))
+	assert.Equal(t, "Name,Dietary Restrictions\nStudent,Vegetarian\n",
+		get("/admin/api/export/dietaryrestrictions?column=name&column=dietary_restrictions"))
+
+	var teams []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(get("/admin/api/export/teams?format=json&first_time=yes")), &teams))
+	require.Len(t, teams, 1)
+	assert.Equal(t, "Remote Team", teams[0]["name"])
+	assert.Equal(t, float64(1), teams[0]["member_count"])
+	assert.Equal(t, false, teams[0]["in_person"])
+
+	rec := doRequest(router, http.MethodGet, "/admin/api/export/teachers?format=xlsx", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `attachment; filename="teachers.xlsx"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "PK", rec.Body.String()[:2])
+
+	for path, code := range map[string]int{
+		"/admin/api/export/unknown":                  http.StatusNotFound,
+		"/admin/api/export/teams?format=pdf":         http.StatusBadRequest,
+		"/admin/api/export/teams?column=password":    http.StatusBadRequest,
+		"/admin/api/export/teams?division=Expert":    http.StatusBadRequest,
+		"/admin/api/export/checkins?direction=in":    http.StatusOK,
+		"/admin/api/export/volunteers?format=json":   http.StatusOK,
+		"/admin/api/export/students?forms_signed=no": http.StatusOK,
+	} {
+		assert.Equal(t, code, doRequest(router, http.MethodGet, path, cookie).Code, path)
+	}
+}
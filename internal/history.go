@@ -0,0 +1,595 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// currentSeason is the year of the competition that is being registered for.
+// Participation history from this year or later does not make a student a
+// returning student.
+func currentSeason() int {
+	return time.Now().Year()
+}
+
+// participationIndex finds the past seasons of a student. Students are linked
+// across seasons by email, or by name if they are at the same school since
+// students often register with a different email each year.
+type participationIndex struct {
+	byEmail      map[string][]*database.ParticipationRecord
+	byNameSchool map[string][]*database.ParticipationRecord
+}
+
+func participationNameKey(name, school string) string {
+	return normalizeName(name) + "|" + normalizeName(school)
+}
+
+func newParticipationIndex(records []*database.ParticipationRecord) *participationIndex {
+	index := &participationIndex{
+		byEmail:      map[string][]*database.ParticipationRecord{},
+		byNameSchool: map[string][]*database.ParticipationRecord{},
+	}
+	for _, record := range records {
+		index.byEmail[record.Email] = append(index.byEmail[record.Email], record)
+		key := participationNameKey(record.Name, record.SchoolName)
+		index.byNameSchool[key] = append(index.byNameSchool[key], record)
+	}
+	return index
+}
+
+// pastSeasons returns one record for each season before the given season that
+// the student competed in, oldest first. matchedByName is true if none of the
+// records matched the student's email.
+func (idx *participationIndex) pastSeasons(email, name, school string, season int) (records []*database.ParticipationRecord, matchedByName bool) {
+	seen := map[int]bool{}
+	add := func(candidates []*database.ParticipationRecord) {
+		for _, record := range candidates {
+			if record.Year < season && !seen[record.Year] {
+				seen[record.Year] = true
+				records = append(records, record)
+			}
+		}
+	}
+	add(idx.byEmail[strings.ToLower(strings.TrimSpace(email))])
+	matchedByName = len(records) == 0
+	add(idx.byNameSchool[participationNameKey(name, school)])
+	if len(records) == 0 {
+		matchedByName = false
+	}
+	slices.SortFunc(records, func(a, b *database.ParticipationRecord) int { return cmp.Compare(a.Year, b.Year) })
+	return records, matchedByName
+}
+
+// studentParticipation compares a registered student's answer to whether they
+// have competed before with their participation history.
+type studentParticipation struct {
+	Student       *database.Student
+	Team          *database.TeamWithTeacherName
+	PastSeasons   []*database.ParticipationRecord
+	MatchedByName bool
+}
+
+func (p *studentParticipation) Returning() bool {
+	return len(p.PastSeasons) > 0
+}
+
+// Disagrees reports whether the teacher's answer differs from the history.
+func (p *studentParticipation) Disagrees() bool {
+	return p.Student.SelfReportedParticipation != p.Returning()
+}
+
+func (p *studentParticipation) NeedsReview() bool {
+	return p.Disagrees() && p.Student.ParticipationReviewedTS.IsZero()
+}
+
+func (a *Application) getStudentParticipation(ctx context.Context, season int) ([]*studentParticipation, error) {
+	history, err := a.DB.GetParticipationHistory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participation history: %w", err)
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams: %w", err)
+	}
+	index := newParticipationIndex(history)
+	var participation []*studentParticipation
+	for _, team := range teams {
+		for i := range team.Members {
+			student := &team.Members[i]
+			pastSeasons, matchedByName := index.pastSeasons(student.Email, student.Name, team.SchoolName, season)
+			participation = append(participation, &studentParticipation{
+				Student:       student,
+				Team:          team,
+				PastSeasons:   pastSeasons,
+				MatchedByName: matchedByName,
+			})
+		}
+	}
+	slices.SortFunc(participation, func(a, b *studentParticipation) int {
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(a.Team.SchoolName), strings.ToLower(b.Team.SchoolName)),
+			cmp.Compare(strings.ToLower(a.Student.Name), strings.ToLower(b.Student.Name)),
+		)
+	})
+	return participation, nil
+}
+
+// applyParticipationHistory marks the students that the history shows are
+// returning students as having competed before. Students that the teacher said
+// have competed before are left alone since the history may be incomplete, as
+// are students whose status was reviewed by an admin. It returns the number of
+// students that were changed.
+func (a *Application) applyParticipationHistory(ctx context.Context, season int) (int, error) {
+	participation, err := a.getStudentParticipation(ctx, season)
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, p := range participation {
+		if !p.Student.ParticipationReviewedTS.IsZero() {
+			continue
+		}
+		previouslyParticipated := p.Student.SelfReportedParticipation || p.Returning()
+		if previouslyParticipated == p.Student.PreviouslyParticipated {
+			continue
+		}
+		if err := a.DB.SetStudentPreviouslyParticipated(ctx, p.Student.Email, previouslyParticipated, false); err != nil {
+			return changed, fmt.Errorf("failed to update student %s: %w", p.Student.Email, err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// checkStudentParticipationHistory marks a newly added student as having
+// competed before if they are in the participation history.
+func (a *Application) checkStudentParticipationHistory(ctx context.Context, email, name, school string) error {
+	history, err := a.DB.GetParticipationHistory(ctx)
+	if err != nil {
+		return err
+	}
+	pastSeasons, _ := newParticipationIndex(history).pastSeasons(email, name, school, currentSeason())
+	if len(pastSeasons) == 0 {
+		return nil
+	}
+	a.Log.Info().
+		Str("student_email", email).
+		Int("past_seasons", len(pastSeasons)).
+		Msg("marking student as returning from the participation history")
+	return a.DB.SetStudentPreviouslyParticipated(ctx, email, true, false)
+}
+
+// currentParticipationRecords returns the current registrations as
+// participation history.
+func (a *Application) currentParticipationRecords(ctx context.Context) ([]*database.ParticipationRecord, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teachers, err := a.DB.GetAllTeachers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	teachersByEmail := map[string]*database.Teacher{}
+	for _, teacher := range teachers {
+		teachersByEmail[teacher.Email] = teacher
+	}
+	var records []*database.ParticipationRecord
+	for _, team := range teams {
+		teacher := teachersByEmail[team.TeacherEmail]
+		for _, member := range team.Members {
+			record := &database.ParticipationRecord{
+				Email:      member.Email,
+				Name:       member.Name,
+				TeamName:   team.Name,
+				Division:   team.Division,
+				SchoolName: team.SchoolName,
+			}
+			if teacher != nil {
+				record.SchoolCity = teacher.SchoolCity
+				record.SchoolState = teacher.SchoolState
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// participationCSVColumns are the header names that are read from imported
+// CSV files. They match the titles of the students export so that a past
+// season's export can be imported directly.
+var participationCSVColumns = map[string][]string{
+	"name":     {"name", "student name"},
+	"email":    {"email", "student email"},
+	"team":     {"team", "team name"},
+	"division": {"division"},
+	"school":   {"school", "school name"},
+	"city":     {"city", "school city"},
+	"state":    {"state", "school state"},
+}
+
+// parseParticipationCSV reads the students of a past season from a CSV file
+// with a header row.
+func parseParticipationCSV(data []byte) ([]*database.ParticipationRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	} else if len(lines) == 0 {
+		return nil, errors.New("the CSV is empty")
+	}
+	columns := map[string]int{}
+	for i, header := range lines[0] {
+		header = strings.ToLower(strings.TrimSpace(header))
+		for column, names := range participationCSVColumns {
+			if _, ok := columns[column]; !ok && slices.Contains(names, header) {
+				columns[column] = i
+			}
+		}
+	}
+	for _, column := range []string{"name", "email"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("the CSV has no %s column", column)
+		}
+	}
+	field := func(line []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(line) {
+			return strings.TrimSpace(line[i])
+		}
+		return ""
+	}
+	var records []*database.ParticipationRecord
+	for _, line := range lines[1:] {
+		record := &database.ParticipationRecord{
+			Email:       field(line, "email"),
+			Name:        field(line, "name"),
+			TeamName:    field(line, "team"),
+			Division:    database.Division(field(line, "division")),
+			SchoolName:  field(line, "school"),
+			SchoolCity:  field(line, "city"),
+			SchoolState: field(line, "state"),
+		}
+		if record.Email != "" && record.Name != "" {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the CSV has no students")
+	}
+	return records, nil
+}
+
+// participationSchool is a school that has participation history.
+type participationSchool struct {
+	Name    string
+	Seasons []int
+}
+
+func participationSchools(history []*database.ParticipationRecord) []*participationSchool {
+	schoolsByKey := map[string]*participationSchool{}
+	var schools []*participationSchool
+	for _, record := range history {
+		key := normalizeName(record.SchoolName)
+		if key == "" {
+			continue
+		}
+		school, ok := schoolsByKey[key]
+		if !ok {
+			school = &participationSchool{Name: record.SchoolName}
+			schoolsByKey[key] = school
+			schools = append(schools, school)
+		}
+		if !slices.Contains(school.Seasons, record.Year) {
+			school.Seasons = append(school.Seasons, record.Year)
+		}
+	}
+	slices.SortFunc(schools, func(a, b *participationSchool) int {
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return schools
+}
+
+func (a *Application) GetAdminParticipationTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	season := currentSeason()
+	seasons, err := a.DB.GetParticipationSeasons(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get participation seasons")
+		return nil
+	}
+	history, err := a.DB.GetParticipationHistory(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get participation history")
+		return nil
+	}
+	participation, err := a.getStudentParticipation(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get student participation")
+		return nil
+	}
+	var needsReview, reviewed []*studentParticipation
+	returning := 0
+	for _, p := range participation {
+		if p.Returning() {
+			returning++
+		}
+		if p.NeedsReview() {
+			needsReview = append(needsReview, p)
+		} else if p.Disagrees() {
+			reviewed = append(reviewed, p)
+		}
+	}
+	return map[string]any{
+		"Season":      season,
+		"Seasons":     seasons,
+		"Schools":     participationSchools(history),
+		"Students":    len(participation),
+		"Returning":   returning,
+		"NeedsReview": needsReview,
+		"Reviewed":    reviewed,
+		"Error":       r.URL.Query().Get("error"),
+		"Message":     r.URL.Query().Get("message"),
+	}
+}
+
+func redirectToParticipation(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/participation"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func parseParticipationYear(r *http.Request) (int, bool) {
+	year, err := strconv.Atoi(r.FormValue("year"))
+	return year, err == nil && year >= 1900 && year <= 9999
+}
+
+// HandleAdminRecordParticipationSeason saves the current registrations as the
+// participation history of the season so that returning students can be found
+// in later seasons.
+func (a *Application) HandleAdminRecordParticipationSeason(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	year, ok := parseParticipationYear(r)
+	if !ok {
+		redirectToParticipation(w, r, "error", "The year must be a four digit year.")
+		return
+	}
+	records, err := a.currentParticipationRecords(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get current registrations")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if len(records) == 0 {
+		redirectToParticipation(w, r, "error", "There are no registered students to record.")
+		return
+	}
+	if err := a.DB.ReplaceParticipationSeason(ctx, year, records); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to record participation season")
+		redirectToParticipation(w, r, "error", "Failed to record the season.")
+		return
+	}
+	a.Log.Info().Int("year", year).Int("students", len(records)).Msg("recorded participation season")
+	redirectToParticipation(w, r, "message", fmt.Sprintf("Recorded %d students as the %d season.", len(records), year))
+}
+
+// HandleAdminImportParticipationSeason replaces the participation history of
+// a past season with a students CSV export from that season.
+func (a *Application) HandleAdminImportParticipationSeason(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxScoreboardSize)
+	if err := r.ParseMultipartForm(maxScoreboardSize); err != nil && err != http.ErrNotMultipart {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	year, ok := parseParticipationYear(r)
+	if !ok {
+		redirectToParticipation(w, r, "error", "The year must be a four digit year.")
+		return
+	}
+	data, err := readFormUpload(r, "students")
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to read participation upload")
+		redirectToParticipation(w, r, "error", "Failed to read the uploaded file.")
+		return
+	}
+	records, err := parseParticipationCSV(data)
+	if err != nil {
+		redirectToParticipation(w, r, "error", "Failed to import the season: "+err.Error())
+		return
+	}
+	if err := a.DB.ReplaceParticipationSeason(r.Context(), year, records); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to import participation season")
+		redirectToParticipation(w, r, "error", "Failed to import the season.")
+		return
+	}
+	a.Log.Info().Int("year", year).Int("students", len(records)).Msg("imported participation season")
+	redirectToParticipation(w, r, "message", fmt.Sprintf("Imported %d students as the %d season.", len(records), year))
+}
+
+func (a *Application) HandleAdminDeleteParticipationSeason(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	year, ok := parseParticipationYear(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.DeleteParticipationSeason(r.Context(), year); err != nil {
+		a.Log.Err(err).Int("year", year).Msg("failed to delete participation season")
+		redirectToParticipation(w, r, "error", "Failed to delete the season.")
+		return
+	}
+	redirectToParticipation(w, r, "message", fmt.Sprintf("Deleted the %d season.", year))
+}
+
+func (a *Application) HandleAdminApplyParticipationHistory(w http.ResponseWriter, r *http.Request) {
+	changed, err := a.applyParticipationHistory(r.Context(), currentSeason())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to apply participation history")
+		redirectToParticipation(w, r, "error", "Failed to update the students.")
+		return
+	}
+	redirectToParticipation(w, r, "message", fmt.Sprintf("Marked %d students as returning students.", changed))
+}
+
+// HandleAdminReviewParticipation records an admin's decision about whether a
+// student has competed before.
+func (a *Application) HandleAdminReviewParticipation(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		a.Log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	email := r.FormValue("email")
+	previouslyParticipated, err := strconv.ParseBool(r.FormValue("previously_participated"))
+	if email == "" || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := a.DB.SetStudentPreviouslyParticipated(r.Context(), email, previouslyParticipated, true); err != nil {
+		a.Log.Err(err).Str("student_email", email).Msg("failed to review student participation")
+		redirectToParticipation(w, r, "error", "Failed to update the student.")
+		return
+	}
+	a.Log.Info().
+		Str("student_email", email).
+		Bool("previously_participated", previouslyParticipated).
+		Str("reviewed_by", a.getCookieTokenSubject(r, "admin_token", IssuerAdminLogin)).
+		Msg("reviewed student participation")
+	redirectToParticipation(w, r, "", "")
+}
+
+// schoolHistorySeason is one season of a school's participation history.
+type schoolHistorySeason struct {
+	Year       int
+	Teams      []*schoolHistoryTeam
+	Placements []*schoolHistoryPlacement
+}
+
+type schoolHistoryTeam struct {
+	Name     string
+	Division database.Division
+	Members  []string
+}
+
+type schoolHistoryPlacement struct {
+	Result string
+	Place  string
+	Team   string
+}
+
+// GetAdminSchoolHistoryTemplate shows a school's past teams from the
+// participation history, its current teams and its placements in the archive.
+func (a *Application) GetAdminSchoolHistoryTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	school := r.URL.Query().Get("school")
+	schoolKey := normalizeName(school)
+	if schoolKey == "" {
+		return map[string]any{"Error": "Choose a school."}
+	}
+
+	seasonsByYear := map[int]*schoolHistorySeason{}
+	getSeason := func(year int) *schoolHistorySeason {
+		if _, ok := seasonsByYear[year]; !ok {
+			seasonsByYear[year] = &schoolHistorySeason{Year: year}
+		}
+		return seasonsByYear[year]
+	}
+	addMember := func(season *schoolHistorySeason, teamName string, division database.Division, member string) {
+		i := slices.IndexFunc(season.Teams, func(t *schoolHistoryTeam) bool { return t.Name == teamName })
+		if i < 0 {
+			season.Teams = append(season.Teams, &schoolHistoryTeam{Name: teamName, Division: division})
+			i = len(season.Teams) - 1
+		}
+		season.Teams[i].Members = append(season.Teams[i].Members, member)
+	}
+
+	history, err := a.DB.GetParticipationHistory(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get participation history")
+		return nil
+	}
+	for _, record := range history {
+		if normalizeName(record.SchoolName) == schoolKey {
+			addMember(getSeason(record.Year), record.TeamName, record.Division, record.Name)
+		}
+	}
+
+	// The current registrations are included unless they have already been
+	// recorded as history.
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get teams")
+		return nil
+	}
+	schoolTeams := map[string]bool{}
+	if _, recorded := seasonsByYear[currentSeason()]; !recorded {
+		for _, team := range teams {
+			if normalizeName(team.SchoolName) != schoolKey {
+				continue
+			}
+			for _, member := range team.Members {
+				addMember(getSeason(currentSeason()), team.Name, team.Division, member.Name)
+			}
+		}
+	}
+	for _, team := range teams {
+		if normalizeName(team.SchoolName) == schoolKey {
+			schoolTeams[team.ID.String()] = true
+		}
+	}
+
+	archive, err := a.DB.GetArchive(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get archive")
+		return nil
+	}
+	for _, year := range archive {
+		for _, result := range year.Results {
+			for _, winner := range result.Winners {
+				if normalizeName(winner.School) != schoolKey && !schoolTeams[winner.TeamID.String()] {
+					continue
+				}
+				season := getSeason(year.Year)
+				season.Placements = append(season.Placements, &schoolHistoryPlacement{
+					Result: result.Name,
+					Place:  ordinal(winner.Place),
+					Team:   winner.TeamName,
+				})
+			}
+		}
+	}
+
+	var seasons []*schoolHistorySeason
+	for _, season := range seasonsByYear {
+		seasons = append(seasons, season)
+	}
+	slices.SortFunc(seasons, func(a, b *schoolHistorySeason) int { return cmp.Compare(b.Year, a.Year) })
+	return map[string]any{
+		"School":  school,
+		"Seasons": seasons,
+	}
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestParticipationIndex(t *testing.T) {
+	index := newParticipationIndex([]*database.ParticipationRecord{
+		{Year: 2022, Email: "ada@example.com", Name: "Ada Lovelace", SchoolName: "Golden High School"},
+		{Year: 2023, Email: "ada.l@example.com", Name: "Ada  Lovelace", SchoolName: "golden high school"},
+		{Year: 2024, Email: "ada@example.com", Name: "Ada Lovelace", SchoolName: "Golden High School"},
+		{Year: 2023, Email: "grace@example.com", Name: "Grace Hopper", SchoolName: "Arvada High School"},
+	})
+
+	records, matchedByName := index.pastSeasons("ADA@example.com", "Ada Lovelace", "Golden High School", 2024)
+	assert.False(t, matchedByName)
+	require.Len(t, records, 2)
+	assert.Equal(t, 2022, records[0].Year)
+	assert.Equal(t, 2023, records[1].Year)
+
+	records, matchedByName = index.pastSeasons("new@example.com", "Grace Hopper", "Arvada High School", 2025)
+	assert.True(t, matchedByName)
+	assert.Len(t, records, 1)
+
+	// The same name at a different school is a different student.
+	records, matchedByName = index.pastSeasons("new@example.com", "Grace Hopper", "Golden High School", 2025)
+	assert.False(t, matchedByName)
+	assert.Empty(t, records)
+}
+
+func TestParseParticipationCSV(t *testing.T) {
+	records, err := parseParticipationCSV([]byte("\ufeffStudent Name,Student Email,Team Name,Division,School Name\n" +
+		"Ada Lovelace,ada@example.com,Code Rats,Advanced,Golden High School\n" +
+		",missing@example.com,Code Rats,Advanced,Golden High School\n"))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "Ada Lovelace", records[0].Name)
+	assert.Equal(t, "Code Rats", records[0].TeamName)
+	assert.Equal(t, database.DivisionAdvanced, records[0].Division)
+	assert.Equal(t, "Golden High School", records[0].SchoolName)
+
+	_, err = parseParticipationCSV([]byte("Name,Team\nAda,Code Rats\n"))
+	assert.ErrorContains(t, err, "no email column")
+}
+
+func TestParticipationHistory_ReturningStudent(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	lastSeason := currentSeason() - 1
+	require.NoError(t, a.DB.ReplaceParticipationSeason(ctx, lastSeason, []*database.ParticipationRecord{
+		{Email: "Student@example.com", Name: "Student", TeamName: "Old Team", SchoolName: "School"},
+	}))
+	addTestStudent(t, a, "student@example.com", 16)
+
+	require.NoError(t, a.checkStudentParticipationHistory(ctx, "student@example.com", "Student", "School"))
+	student, err := a.DB.GetStudentByEmail(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.True(t, student.PreviouslyParticipated)
+	assert.False(t, student.SelfReportedParticipation)
+
+	participation, err := a.getStudentParticipation(ctx, currentSeason())
+	require.NoError(t, err)
+	require.Len(t, participation, 1)
+	assert.True(t, participation[0].Returning())
+	assert.True(t, participation[0].NeedsReview())
+
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	page := doRequest(router, http.MethodGet, "/admin/participation", cookie).Body.String()
+	assert.Contains(t, page, "Old Team")
+
+	// An admin's review is not overwritten by the history.
+	rec := post("/admin/participation/review", url.Values{"email": {"student@example.com"}, "previously_participated": {"false"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	changed, err := a.applyParticipationHistory(ctx, currentSeason())
+	require.NoError(t, err)
+	assert.Zero(t, changed)
+	student, err = a.DB.GetStudentByEmail(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.False(t, student.PreviouslyParticipated)
+	assert.False(t, student.ParticipationReviewedTS.IsZero())
+}
+
+func TestAdminParticipation_ImportAndSchoolHistory(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	addTestStudent(t, a, "student@example.com", 16)
+
+	form := url.Values{
+		"year":          {"2019"},
+		"students_text": {"Name,Email,Team,School\nAda Lovelace,ada@example.com,Code Rats,School\n"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/admin/participation/import", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Header().Get("Location"), "message=")
+
+	seasons, err := a.DB.GetParticipationSeasons(ctx)
+	require.NoError(t, err)
+	require.Len(t, seasons, 1)
+	assert.Equal(t, 2019, seasons[0].Year)
+	assert.Equal(t, 1, seasons[0].Students)
+
+	page := doRequest(router, http.MethodGet, "/admin/participation/school?school=School", cookie).Body.String()
+	assert.Contains(t, page, "Code Rats")
+	assert.Contains(t, page, "Ada Lovelace")
+	// The current registrations are shown as the current season.
+	assert.Contains(t, page, "<h2>"+strconv.Itoa(currentSeason())+"</h2>")
+}
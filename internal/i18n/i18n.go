@@ -0,0 +1,167 @@
+// Package i18n translates the text of the pages and emails that students and
+// their parents see.
+//
+// Each locale has a catalog in the locales directory that maps message keys to
+// the translated text. Messages may contain fmt verbs that are filled in with
+// the arguments given to T. Messages with keys ending in "_html" contain HTML
+// and are only used with THTML.
+package i18n
+
+import (
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Locale is a language that the site is translated into.
+type Locale string
+
+const (
+	English Locale = "en"
+	Spanish Locale = "es"
+)
+
+// Default is the locale that is used when no other locale is chosen. Its
+// catalog has every message.
+const Default = English
+
+// Locales are the supported locales in the order that they are offered.
+var Locales = []Locale{English, Spanish}
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+var catalogs = map[Locale]map[string]string{}
+
+func init() {
+	for _, locale := range Locales {
+		data, err := localeFS.ReadFile("locales/" + string(locale) + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("missing catalog for locale %s: %v", locale, err))
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("invalid catalog for locale %s: %v", locale, err))
+		}
+		catalogs[locale] = catalog
+	}
+}
+
+// Name is the name of the locale in its own language.
+func (l Locale) Name() string {
+	return T(l, "language.name")
+}
+
+// Parse returns the supported locale for a language tag such as "es" or
+// "es-MX".
+func Parse(tag string) (Locale, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if slices.Contains(Locales, Locale(tag)) {
+		return Locale(tag), true
+	}
+	return "", false
+}
+
+// ParseOrDefault is like Parse, but returns Default for unsupported tags.
+func ParseOrDefault(tag string) Locale {
+	if locale, ok := Parse(tag); ok {
+		return locale
+	}
+	return Default
+}
+
+// MatchAcceptLanguage returns the supported locale that is preferred the most
+// by an Accept-Language header, or Default if none of them are accepted.
+func MatchAcceptLanguage(header string) Locale {
+	type preference struct {
+		locale Locale
+		q      float64
+	}
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		locale, ok := Parse(tag)
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			preferences = append(preferences, preference{locale, q})
+		}
+	}
+	if len(preferences) == 0 {
+		return Default
+	}
+	// The stable sort keeps the header's order for tags with the same
+	// quality.
+	slices.SortStableFunc(preferences, func(a, b preference) int { return cmp.Compare(b.q, a.q) })
+	return preferences[0].locale
+}
+
+func lookup(locale Locale, key string) string {
+	if message, ok := catalogs[locale][key]; ok {
+		return message
+	} else if message, ok := catalogs[Default][key]; ok {
+		return message
+	}
+	return key
+}
+
+// T returns the message with the key in the locale, formatted with the
+// arguments. Messages that are missing from the locale's catalog fall back to
+// the Default locale, and unknown keys are returned as is.
+func T(locale Locale, key string, args ...any) string {
+	message := lookup(locale, key)
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// THTML is like T, but for messages that contain HTML. The arguments are
+// escaped.
+func THTML(locale Locale, key string, args ...any) template.HTML {
+	escaped := make([]any, len(args))
+	for i, arg := range args {
+		escaped[i] = html.EscapeString(fmt.Sprint(arg))
+	}
+	return template.HTML(T(locale, key, escaped...))
+}
+
+// FuncMap has the template functions for translating messages. Templates call
+// them with the locale first, like {{ t .Locale "key" }}.
+var FuncMap = map[string]any{
+	"t":     T,
+	"tHTML": THTML,
+}
+
+// Keys returns the keys in the locale's catalog.
+func Keys(locale Locale) []string {
+	keys := make([]string, 0, len(catalogs[locale]))
+	for key := range catalogs[locale] {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Has returns whether the locale's catalog has the key.
+func Has(locale Locale, key string) bool {
+	_, ok := catalogs[locale][key]
+	return ok
+}
@@ -0,0 +1,66 @@
+package i18n
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var verbRegex = regexp.MustCompile(`%[^%\s]`)
+
+// TestCatalogsComplete checks that every locale translates every message, so
+// that a missing translation fails the tests instead of falling back to
+// English.
+func TestCatalogsComplete(t *testing.T) {
+	for _, locale := range Locales {
+		for _, key := range Keys(Default) {
+			assert.True(t, Has(locale, key), "%s is missing %q", locale, key)
+		}
+		for _, key := range Keys(locale) {
+			assert.True(t, Has(Default, key), "%s has %q, which is not in %s", locale, key, Default)
+		}
+	}
+}
+
+func TestCatalogsFormat(t *testing.T) {
+	for _, locale := range Locales {
+		for _, key := range Keys(locale) {
+			message := catalogs[locale][key]
+			assert.NotEmpty(t, strings.TrimSpace(message), "%s %q is empty", locale, key)
+			assert.Equal(t, verbRegex.FindAllString(catalogs[Default][key], -1), verbRegex.FindAllString(message, -1),
+				"%s %q has different arguments than %s", locale, key, Default)
+			if !strings.HasSuffix(key, "_html") {
+				assert.NotContains(t, message, "<", "%s %q has HTML but its key does not end in _html", locale, key)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for tag, expected := range map[string]Locale{"es": Spanish, "es-MX": Spanish, "EN_us": English, " es ": Spanish} {
+		locale, ok := Parse(tag)
+		assert.True(t, ok, tag)
+		assert.Equal(t, expected, locale, tag)
+	}
+	_, ok := Parse("fr")
+	assert.False(t, ok)
+	assert.Equal(t, Default, ParseOrDefault(""))
+}
+
+func TestMatchAcceptLanguage(t *testing.T) {
+	assert.Equal(t, Spanish, MatchAcceptLanguage("es-MX,es;q=0.9,en;q=0.8"))
+	assert.Equal(t, English, MatchAcceptLanguage("en-US,en;q=0.9,es;q=0.8"))
+	assert.Equal(t, Spanish, MatchAcceptLanguage("fr-FR, es;q=0.5"))
+	assert.Equal(t, Spanish, MatchAcceptLanguage("en;q=0.2, es;q=0.7"))
+	assert.Equal(t, Default, MatchAcceptLanguage("en;q=0, fr"))
+	assert.Equal(t, Default, MatchAcceptLanguage(""))
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "Español", Spanish.Name())
+	assert.Equal(t, "RECORDATORIO: hola", T(Spanish, "email.reminder", "hola"))
+	assert.Equal(t, "no.such.key", T(Spanish, "no.such.key"))
+	assert.Contains(t, string(THTML(English, "profile.intro_html", "<Code Rats>")), "<b>&lt;Code Rats&gt;</b>")
+}
@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// LiveEventKind is the kind of registration or check-in activity that is
+// pushed to the live admin dashboard.
+type LiveEventKind string
+
+const (
+	LiveEventRegistered  LiveEventKind = "registered"
+	LiveEventConfirmed   LiveEventKind = "confirmed"
+	LiveEventFormsSigned LiveEventKind = "forms_signed"
+	LiveEventCheckedIn   LiveEventKind = "checked_in"
+	LiveEventCheckedOut  LiveEventKind = "checked_out"
+)
+
+type LiveEvent struct {
+	ID          int64         `json:"id"`
+	Kind        LiveEventKind `json:"kind"`
+	Time        time.Time     `json:"time"`
+	StudentName string        `json:"student_name"`
+	TeamName    string        `json:"team_name,omitempty"`
+	Detail      string        `json:"detail,omitempty"`
+}
+
+const (
+	// liveFeedSize is the number of recent events that are replayed to new
+	// dashboard connections.
+	liveFeedSize = 100
+	// liveSubscriberBuffer is the number of events that can be waiting for a
+	// dashboard connection before it is considered too slow and disconnected.
+	liveSubscriberBuffer = 64
+)
+
+// LiveHub fans out activity events to the connected live dashboards. Events
+// are only kept in memory, so the feed starts empty when the server restarts,
+// but the counts on the dashboard always come from the database.
+type LiveHub struct {
+	lock        sync.Mutex
+	lastID      int64
+	recent      []LiveEvent
+	subscribers map[chan LiveEvent]struct{}
+}
+
+func NewLiveHub() *LiveHub {
+	return &LiveHub{subscribers: map[chan LiveEvent]struct{}{}}
+}
+
+// Publish assigns the event an ID and sends it to all of the subscribers.
+// Subscribers that are not keeping up are disconnected rather than blocking
+// the request that caused the event.
+func (h *LiveHub) Publish(event LiveEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.lastID++
+	event.ID = h.lastID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	h.recent = append(h.recent, event)
+	if len(h.recent) > liveFeedSize {
+		h.recent = h.recent[len(h.recent)-liveFeedSize:]
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the recent events after the given event ID and a channel
+// of new events. The channel is closed if the subscriber falls too far behind.
+// The returned function must be called once the subscriber is done.
+func (h *LiveHub) Subscribe(afterID int64) (recent []LiveEvent, events <-chan LiveEvent, unsubscribe func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, event := range h.recent {
+		if event.ID > afterID {
+			recent = append(recent, event)
+		}
+	}
+	ch := make(chan LiveEvent, liveSubscriberBuffer)
+	h.subscribers[ch] = struct{}{}
+	return recent, ch, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishStudentEvent publishes an event about the student to the live
+// dashboard and to the webhooks that subscribe to it. The student's name and
+// team are looked up so that the event makes sense on its own.
+func (a *Application) publishStudentEvent(ctx context.Context, kind LiveEventKind, email string, ts time.Time, detail string) {
+	event := LiveEvent{Kind: kind, Time: ts, StudentName: email, Detail: detail}
+	student, err := a.DB.GetStudentByEmail(ctx, email)
+	if err != nil {
+		a.Log.Warn().Err(err).Str("student_email", email).Msg("failed to get student for live event")
+		a.Live.Publish(event)
+		return
+	}
+	event.StudentName = student.Name
+	team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+	if err != nil {
+		a.Log.Warn().Err(err).Str("student_email", email).Msg("failed to get team for live event")
+		a.Live.Publish(event)
+		return
+	}
+	event.TeamName = team.Name
+	a.Live.Publish(event)
+
+	if webhookType, ok := liveEventWebhookTypes[kind]; ok {
+		data := WebhookStudentData{Student: APIStudentWithTeam{
+			APIStudent: newAPIStudent(student),
+			TeamName:   team.Name,
+			Division:   string(team.Division),
+			InPerson:   team.InPerson,
+		}}
+		if teacher, err := a.DB.GetTeacherByEmail(ctx, team.TeacherEmail); err != nil {
+			a.Log.Warn().Err(err).Str("student_email", email).Msg("failed to get teacher for webhook event")
+		} else {
+			data.Student.School = teacher.SchoolName
+		}
+		if kind == LiveEventCheckedIn || kind == LiveEventCheckedOut {
+			data.Station = detail
+		}
+		a.Webhooks.Enqueue(ctx, webhookType, ts, data)
+	}
+}
+
+// publishCheckInEvent publishes a check-in event that was recorded.
+func (a *Application) publishCheckInEvent(ctx context.Context, event *database.CheckInEvent) {
+	kind := LiveEventCheckedIn
+	if event.Direction == database.CheckInDirectionOut {
+		kind = LiveEventCheckedOut
+	}
+	a.publishStudentEvent(ctx, kind, event.StudentEmail, event.TS, event.Station)
+}
+
+type LiveCounts struct {
+	Teams            int `json:"teams"`
+	Students         int `json:"students"`
+	InPersonStudents int `json:"in_person_students"`
+	EmailConfirmed   int `json:"email_confirmed"`
+	FormsSigned      int `json:"forms_signed"`
+	QRCodesSent      int `json:"qr_codes_sent"`
+	// OnSite is the number of students that are currently checked in.
+	OnSite int `json:"on_site"`
+}
+
+func countLiveStats(teams []*database.TeamWithTeacherName) LiveCounts {
+	var counts LiveCounts
+	for _, team := range teams {
+		counts.Teams++
+		for _, member := range team.Members {
+			counts.Students++
+			if team.InPerson {
+				counts.InPersonStudents++
+			}
+			if member.EmailConfirmed {
+				counts.EmailConfirmed++
+			}
+			if member.LiabilitySigned {
+				counts.FormsSigned++
+			}
+			if member.QRCodeSent {
+				counts.QRCodesSent++
+			}
+			if member.CheckedIn {
+				counts.OnSite++
+			}
+		}
+	}
+	return counts
+}
+
+func (a *Application) getLiveCounts(ctx context.Context) (LiveCounts, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return LiveCounts{}, err
+	}
+	return countLiveStats(teams), nil
+}
+
+func (a *Application) GetAdminLiveTemplate(r *http.Request) map[string]any {
+	counts, err := a.getLiveCounts(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get live counts")
+		return nil
+	}
+	return map[string]any{"Counts": counts}
+}
+
+func writeServerSentEvent(w io.Writer, id int64, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+	return err
+}
+
+const (
+	// liveCountsInterval limits how often the counts are recomputed while
+	// events are streaming in.
+	liveCountsInterval = time.Second
+	// liveKeepAliveInterval keeps proxies from closing idle connections.
+	liveKeepAliveInterval = 20 * time.Second
+)
+
+// HandleAdminLiveStream streams activity to the live dashboard using
+// server-sent events. Each activity is sent as an "activity" event, and the
+// current counts are sent as a "counts" event when the stream starts and
+// after new activity. Browsers that reconnect send the Last-Event-ID header
+// and are sent the activity that they missed.
+func (a *Application) HandleAdminLiveStream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "admin_live_stream").Logger()
+	rc := http.NewResponseController(w)
+
+	lastEventID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	recent, events, unsubscribe := a.Live.Subscribe(lastEventID)
+	defer unsubscribe()
+
+	counts, err := a.getLiveCounts(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get live counts")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeServerSentEvent(w, 0, "counts", counts); err != nil {
+		return
+	}
+	for _, event := range recent {
+		if err := writeServerSentEvent(w, event.ID, "activity", event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Err(err).Msg("streaming is not supported")
+		return
+	}
+
+	countsTicker := time.NewTicker(liveCountsInterval)
+	defer countsTicker.Stop()
+	keepAliveTicker := time.NewTicker(liveKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+	var countsStale bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				log.Warn().Msg("live dashboard fell behind, disconnecting")
+				return
+			}
+			if err := writeServerSentEvent(w, event.ID, "activity", event); err != nil {
+				return
+			}
+			countsStale = true
+		case <-countsTicker.C:
+			if !countsStale {
+				continue
+			}
+			counts, err := a.getLiveCounts(ctx)
+			if err != nil {
+				log.Err(err).Msg("failed to get live counts")
+				continue
+			}
+			if err := writeServerSentEvent(w, 0, "counts", counts); err != nil {
+				return
+			}
+			countsStale = false
+		case <-keepAliveTicker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveHub_ReplayAndSlowSubscriber(t *testing.T) {
+	hub := NewLiveHub()
+	hub.Publish(LiveEvent{Kind: LiveEventRegistered, StudentName: "One"})
+	hub.Publish(LiveEvent{Kind: LiveEventConfirmed, StudentName: "Two"})
+
+	recent, events, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+	require.Len(t, recent, 1)
+	assert.Equal(t, "Two", recent[0].StudentName)
+	assert.Equal(t, int64(2), recent[0].ID)
+	assert.False(t, recent[0].Time.IsZero())
+
+	for range liveSubscriberBuffer + 1 {
+		hub.Publish(LiveEvent{Kind: LiveEventCheckedIn, StudentName: "Three"})
+	}
+	var received int
+	for range events {
+		received++
+	}
+	assert.Equal(t, liveSubscriberBuffer, received, "slow subscribers should be disconnected")
+}
+
+type sseEvent struct {
+	ID   string
+	Name string
+	Data string
+}
+
+func readSSEEvent(t *testing.T, scanner *bufio.Scanner) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event.Name != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	require.NoError(t, scanner.Err())
+	t.Fatal("stream ended")
+	return event
+}
+
+func TestAdminLiveStream(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 18)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", false, "", ""))
+	require.NoError(t, a.DB.SignFormsForStudent(ctx, "student@example.com", "Student", true))
+	a.Live.Publish(LiveEvent{Kind: LiveEventRegistered, StudentName: "Student", TeamName: "Team"})
+	server := httptest.NewServer(a.BuildRouter())
+	defer server.Close()
+
+	streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, server.URL+"/admin/api/live", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "admin_token", Value: adminToken(t)})
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	scanner := bufio.NewScanner(resp.Body)
+
+	event := readSSEEvent(t, scanner)
+	require.Equal(t, "counts", event.Name)
+	var counts LiveCounts
+	require.NoError(t, json.Unmarshal([]byte(event.Data), &counts))
+	assert.Equal(t, LiveCounts{Teams: 1, Students: 1, InPersonStudents: 1, EmailConfirmed: 1, FormsSigned: 1}, counts)
+
+	event = readSSEEvent(t, scanner)
+	assert.Equal(t, "activity", event.Name)
+	assert.Equal(t, "1", event.ID)
+
+	// Checking in the student is pushed to the stream, followed by the new
+	// counts.
+	qrURL, err := a.getStudentQRCodeURL("student@example.com")
+	require.NoError(t, err)
+	rec := doVolunteerJSONRequest(t, a.BuildRouter(), http.MethodPost, "/volunteer/api/checkin", CheckInAPIRequest{Token: qrURL})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	event = readSSEEvent(t, scanner)
+	require.Equal(t, "activity", event.Name)
+	var activity LiveEvent
+	require.NoError(t, json.Unmarshal([]byte(event.Data), &activity))
+	assert.Equal(t, LiveEventCheckedIn, activity.Kind)
+	assert.Equal(t, "Student", activity.StudentName)
+	assert.Equal(t, "Team", activity.TeamName)
+	assert.Equal(t, checkInStationKiosk, activity.Detail)
+
+	event = readSSEEvent(t, scanner)
+	require.Equal(t, "counts", event.Name)
+	require.NoError(t, json.Unmarshal([]byte(event.Data), &counts))
+	assert.Equal(t, 1, counts.OnSite)
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
+)
+
+const localeCookieName = "lang"
+
+// localizedTemplates are the templates that are translated. Every other page
+// is shown in the default locale.
+var localizedTemplates = map[string]bool{
+	"parent.html":         true,
+	"student.html":        true,
+	"studentprofile.html": true,
+}
+
+// requestLocale returns the locale that the request asked for. The lang query
+// parameter is used by the language toggle and by the links in emails, then
+// the cookie set by the toggle, and then the browser's Accept-Language.
+func requestLocale(r *http.Request) i18n.Locale {
+	if locale, ok := i18n.Parse(r.URL.Query().Get(localeCookieName)); ok {
+		return locale
+	}
+	if cookie, err := r.Cookie(localeCookieName); err == nil {
+		if locale, ok := i18n.Parse(cookie.Value); ok {
+			return locale
+		}
+	}
+	return i18n.MatchAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+// rememberLocale saves the locale chosen with the lang query parameter so that
+// the following pages are shown in it too.
+func rememberLocale(w http.ResponseWriter, r *http.Request) {
+	locale, ok := i18n.Parse(r.URL.Query().Get(localeCookieName))
+	if !ok {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     localeCookieName,
+		Value:    string(locale),
+		Path:     "/",
+		Expires:  time.Now().Add(365 * 24 * time.Hour),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+type localeLink struct {
+	Locale i18n.Locale
+	Name   string
+	URL    string
+	Active bool
+}
+
+// localeLinks returns links to the current page in each locale.
+func localeLinks(r *http.Request, current i18n.Locale) []localeLink {
+	links := make([]localeLink, len(i18n.Locales))
+	for i, locale := range i18n.Locales {
+		query := r.URL.Query()
+		query.Set(localeCookieName, string(locale))
+		links[i] = localeLink{
+			Locale: locale,
+			Name:   locale.Name(),
+			URL:    r.URL.Path + "?" + query.Encode(),
+			Active: locale == current,
+		}
+	}
+	return links
+}
+
+// withLocaleParam adds the locale to a link that is sent in an email so that
+// the page opens in the same language as the email.
+func withLocaleParam(link string, locale i18n.Locale) string {
+	if locale == i18n.Default {
+		return link
+	}
+	return link + "&" + localeCookieName + "=" + string(locale)
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/website"
+)
+
+var (
+	templateKeyRegex = regexp.MustCompile(`[{(]-?\s*(?:t|tHTML)\s+\S+\s+"([^"]+)"`)
+	goKeyRegex       = regexp.MustCompile(`i18n\.T(?:HTML)?\([^,]+,\s*"([^"]+)"`)
+)
+
+// TestTranslationKeys checks that every message used by the templates and the
+// handlers is in the catalogs.
+func TestTranslationKeys(t *testing.T) {
+	check := func(fsys fs.FS, root string, keyRegex *regexp.Regexp) int {
+		var found int
+		err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(path, "_test.go") {
+				return err
+			}
+			data, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return err
+			}
+			for _, match := range keyRegex.FindAllStringSubmatch(string(data), -1) {
+				found++
+				assert.True(t, i18n.Has(i18n.Default, match[1]), "%s uses %q, which is not in the catalog", path, match[1])
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return found
+	}
+	assert.NotZero(t, check(website.TemplateFS, "templates", templateKeyRegex))
+	assert.NotZero(t, check(emailTemplates, "emailtemplates", templateKeyRegex))
+	assert.NotZero(t, check(os.DirFS("."), ".", goKeyRegex))
+}
+
+func TestRequestLocale(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/register/student/confirminfo", nil)
+	req.Header.Set("Accept-Language", "es-MX,es;q=0.9,en;q=0.5")
+	assert.Equal(t, i18n.Spanish, requestLocale(req))
+	req.AddCookie(&http.Cookie{Name: localeCookieName, Value: "en"})
+	assert.Equal(t, i18n.English, requestLocale(req), "the toggle beats the browser")
+	req.URL.RawQuery = "lang=es"
+	assert.Equal(t, i18n.Spanish, requestLocale(req))
+
+	links := localeLinks(httptest.NewRequest(http.MethodGet, "/register/parent/signforms?tok=abc", nil), i18n.English)
+	require.Len(t, links, len(i18n.Locales))
+	assert.True(t, links[0].Active)
+	u, err := url.Parse(links[1].URL)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", u.Query().Get("tok"), "the toggle keeps the token")
+	assert.Equal(t, "es", u.Query().Get("lang"))
+}
+
+func TestLocalizedStudentPages(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	router := a.BuildRouter()
+	addTestStudent(t, a, "student@example.com", 16)
+	link, err := a.getStudentConfirmEmailLink("student@example.com")
+	require.NoError(t, err)
+	path := strings.TrimPrefix(link, a.Config.Domain)
+
+	rec := doRequest(router, http.MethodGet, path+"&lang=es")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<html lang="es">`)
+	assert.Contains(t, rec.Body.String(), "Confirmar inscripción")
+	require.NotEmpty(t, rec.Result().Cookies())
+	assert.Equal(t, "es", rec.Result().Cookies()[0].Value)
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept-Language", "es")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), "Confirmar inscripción")
+	assert.Contains(t, rec.Body.String(), `<option value="es" lang="es" selected>`, "the page's language is suggested for emails")
+
+	// Pages that are not translated stay in English.
+	rec = doRequest(router, http.MethodGet, "/info?lang=es")
+	assert.Contains(t, rec.Body.String(), `<html lang="en">`)
+	assert.Empty(t, rec.Result().Cookies())
+
+	form := url.Values{"confirm-info-correct": {"on"}, "parent-email": {"parent@example.com"}, "language": {"es"}}
+	req = httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	student, err := a.DB.GetStudentByEmail(ctx, "student@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "es", student.Language)
+	assert.True(t, student.EmailConfirmed)
+
+	// The student's language is kept even if they view the page in English.
+	rec = doRequest(router, http.MethodGet, path+"&lang=en")
+	assert.Contains(t, rec.Body.String(), "Confirm Registration")
+	assert.Contains(t, rec.Body.String(), `<option value="es" lang="es" selected>`)
+
+	rec = doRequest(router, http.MethodGet, "/register/parent/signforms?lang=es&tok="+signFormsToken(t, a, student))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Firmar formularios")
+	assert.Contains(t, rec.Body.String(), "Los formularios solo están disponibles en inglés.")
+}
+
+func TestLocalizedEmailTemplates(t *testing.T) {
+	student := &database.Student{Name: "<Ana>"}
+	var forms strings.Builder
+	tmpl := htmltemplate.Must(htmltemplate.New("forms.html").Funcs(i18n.FuncMap).ParseFS(emailTemplates, "emailtemplates/forms.html"))
+	require.NoError(t, tmpl.Execute(&forms, map[string]any{"Locale": i18n.Spanish, "Student": student, "SignURL": "https://example.com"}))
+	assert.Contains(t, forms.String(), `<html lang="es">`)
+	assert.Contains(t, forms.String(), "Para que &lt;Ana&gt; pueda participar")
+
+	var verify strings.Builder
+	tmpl = htmltemplate.Must(htmltemplate.New("studentverify.html").Funcs(i18n.FuncMap).ParseFS(emailTemplates, "emailtemplates/studentverify.html"))
+	require.NoError(t, tmpl.Execute(&verify, map[string]any{"Locale": i18n.Spanish, "Name": "Ana", "TeacherName": "Teacher", "TeamName": "<b>Team</b>", "VerifyURL": "https://example.com"}))
+	assert.Contains(t, verify.String(), "equipo <b>&lt;b&gt;Team&lt;/b&gt;</b>")
+
+	assert.Equal(t, "https://example.com/x?tok=abc&lang=es", withLocaleParam("https://example.com/x?tok=abc", i18n.Spanish))
+	assert.Equal(t, "https://example.com/x?tok=abc", withLocaleParam("https://example.com/x?tok=abc", i18n.English))
+}
@@ -8,8 +8,15 @@ import (
 )
 
 func (a *Application) parseTokenByIssuer(tokenStr string, issuer Issuer) (bool, error) {
+	if _, err := a.parseTokenClaims(tokenStr, issuer); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *Application) parseTokenClaims(tokenStr string, issuer Issuer) (*jwt.RegisteredClaims, error) {
 	if tokenStr == "" {
-		return false, fmt.Errorf("no token")
+		return nil, fmt.Errorf("no token")
 	}
 
 	token, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
@@ -19,19 +26,34 @@ func (a *Application) parseTokenByIssuer(tokenStr string, issuer Issuer) (bool,
 		return a.Config.ReadSecretKey(), nil
 	})
 	if err != nil {
-		return false, fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	claims, ok := token.Claims.(*jwt.RegisteredClaims)
 	if !token.Valid || !ok {
-		return false, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
 	if claims.Issuer != string(issuer) {
-		return false, fmt.Errorf("wrong issuer: got %s, want %s", claims.Issuer, issuer)
+		return nil, fmt.Errorf("wrong issuer: got %s, want %s", claims.Issuer, issuer)
 	}
 
-	return true, nil
+	return claims, nil
+}
+
+// getCookieTokenSubject returns the subject of the token in the given cookie,
+// or an empty string if the cookie does not contain a valid token from the
+// issuer.
+func (a *Application) getCookieTokenSubject(r *http.Request, cookieName string, issuer Issuer) string {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return ""
+	}
+	claims, err := a.parseTokenClaims(cookie.Value, issuer)
+	if err != nil {
+		return ""
+	}
+	return claims.Subject
 }
 
 func (a *Application) AdminAuthMiddleware(next http.Handler) http.Handler {
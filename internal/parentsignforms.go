@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 
@@ -37,7 +38,18 @@ func (a *Application) getStudentBySignFormsToken(ctx context.Context, tokenStr s
 		return nil, fmt.Errorf("invalid sign forms token: %w", err)
 	}
 
-	return a.DB.GetStudentByEmail(ctx, claims.Subject)
+	student, err := a.DB.GetStudentByEmail(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nonce is rotated whenever the parent email changes, so links sent
+	// to a previous parent email address no longer work.
+	if claims.ID != student.SignFormsNonce {
+		return nil, errors.New("sign forms token has been superseded")
+	}
+
+	return student, nil
 }
 
 func (a *Application) GetParentSignFormsTemplate(r *http.Request) map[string]any {
@@ -66,13 +78,19 @@ func (a *Application) GetParentSignFormsTemplate(r *http.Request) map[string]any
 		accepted = accepted && student.ComputerUseWaiverSigned
 	}
 
-	return map[string]any{
+	data := map[string]any{
 		"Accepted":               accepted,
 		"Student":                student,
 		"Teacher":                teacher,
 		"NeedsComputerUseWaiver": team.InPerson,
 		"Token":                  tok,
 	}
+	if a.collectingEmergencyInfo(team) {
+		data["CollectEmergencyInfo"] = true
+		data["EmergencyContactRequired"] = true
+		data["EmergencyInfo"] = a.getStudentEmergencyInfo(ctx, student)
+	}
+	return data
 }
 
 func (a *Application) HandleParentSignForms(w http.ResponseWriter, r *http.Request) {
@@ -120,6 +138,21 @@ func (a *Application) HandleParentSignForms(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// An emergency contact is required for everyone that will be on campus.
+	if a.collectingEmergencyInfo(team) {
+		emergencyInfo := parseEmergencyInfoForm(r, student.Email)
+		if emergencyInfo.ContactName == "" || emergencyInfo.ContactPhone == "" {
+			log.Warn().Msg("emergency contact not provided")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := a.saveEmergencyInfo(ctx, emergencyInfo); err != nil {
+			log.Err(err).Msg("failed to save emergency info")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if err = a.DB.SignFormsForStudent(ctx, student.Email, parentName, team.InPerson); err != nil {
 		log.Err(err).Msg("failed to sign forms for student")
 		w.WriteHeader(http.StatusBadRequest)
@@ -127,6 +160,7 @@ func (a *Application) HandleParentSignForms(w http.ResponseWriter, r *http.Reque
 	}
 
 	log.Info().Any("student", student).Msg("signed forms for student")
+	a.publishStudentEvent(ctx, LiveEventFormsSigned, student.Email, time.Now(), "")
 
 	http.Redirect(w, r, "/register/parent/signforms?tok="+tok, http.StatusSeeOther)
 }
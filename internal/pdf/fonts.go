@@ -0,0 +1,100 @@
+package pdf
+
+import "strings"
+
+// Font is one of the standard fonts that every PDF reader provides, so no font
+// data needs to be embedded.
+type Font string
+
+const (
+	Helvetica     Font = "Helvetica"
+	HelveticaBold Font = "Helvetica-Bold"
+)
+
+var fonts = []Font{Helvetica, HelveticaBold}
+
+func (f Font) resourceName() string {
+	if f == HelveticaBold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// Glyph widths for the printable ASCII characters (0x20 to 0x7e) in thousandths
+// of the font size, from the Adobe font metrics.
+var glyphWidths = map[Font][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// defaultGlyphWidth approximates the width of the Latin-1 characters, most of
+// which are accented letters.
+const defaultGlyphWidth = 556
+
+// TextWidth returns the width of the string in points at the given size.
+func (f Font) TextWidth(size float64, s string) float64 {
+	widths := glyphWidths[f]
+	var total int
+	for _, b := range encodeWinAnsi(s) {
+		if b >= 0x20 && b < 0x7f {
+			total += widths[b-0x20]
+		} else {
+			total += defaultGlyphWidth
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Fit returns the largest size between minSize and maxSize at which the string
+// fits in maxWidth. If the string does not fit even at minSize, it is
+// shortened and an ellipsis is added.
+func (f Font) Fit(maxWidth, maxSize, minSize float64, s string) (float64, string) {
+	width := f.TextWidth(maxSize, s)
+	if width <= maxWidth {
+		return maxSize, s
+	} else if size := maxSize * maxWidth / width; size >= minSize {
+		return size, s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && f.TextWidth(minSize, string(runes)+"...") > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return minSize, string(runes) + "..."
+}
+
+// Wrap splits the string into lines that fit in maxWidth at the given size,
+// breaking between words. A word that is wider than maxWidth on its own is put
+// on its own line.
+func (f Font) Wrap(maxWidth, size float64, s string) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		if line == "" {
+			line = word
+		} else if f.TextWidth(size, line+" "+word) <= maxWidth {
+			line += " " + word
+		} else {
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,284 @@
+// Package pdf is a minimal PDF writer for generating printable documents such
+// as name badges. It supports the standard Helvetica fonts, grayscale images
+// and simple shapes, which is all that the site needs.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// Points per inch. All coordinates are in points from the bottom left corner
+// of the page.
+const Inch = 72.0
+
+// Standard page sizes, in points.
+const (
+	LetterWidth  = 8.5 * Inch
+	LetterHeight = 11 * Inch
+)
+
+// Image is an image that has been added to a Document.
+type Image struct {
+	name          string
+	width, height int
+	data          []byte
+}
+
+// Document is a PDF that is being built. Create one with New.
+type Document struct {
+	pages  []*Page
+	images []*Image
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage appends a new page of the given size to the document.
+func (d *Document) AddPage(width, height float64) *Page {
+	page := &Page{width: width, height: height, images: map[string]*Image{}}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// AddImage converts the image to grayscale and adds it to the document so
+// that it can be drawn on any page.
+func (d *Document) AddImage(img image.Image) (*Image, error) {
+	bounds := img.Bounds()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			row[x-bounds.Min.X] = color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	pdfImage := &Image{
+		name:   fmt.Sprintf("Im%d", len(d.images)+1),
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		data:   buf.Bytes(),
+	}
+	d.images = append(d.images, pdfImage)
+	return pdfImage, nil
+}
+
+// Page is a single page of a Document.
+type Page struct {
+	width, height float64
+	content       bytes.Buffer
+	images        map[string]*Image
+}
+
+func (p *Page) Width() float64  { return p.width }
+func (p *Page) Height() float64 { return p.height }
+
+// Text draws the string with its baseline starting at (x, y).
+func (p *Page) Text(font Font, size, x, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font.resourceName(), size, x, y, escapeString(s))
+}
+
+// TextCentered draws the string with its baseline centered on (x, y).
+func (p *Page) TextCentered(font Font, size, x, y float64, s string) {
+	p.Text(font, size, x-font.TextWidth(size, s)/2, y, s)
+}
+
+// Rect strokes the outline of a rectangle with the given line width.
+func (p *Page) Rect(x, y, width, height, lineWidth float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f %.2f %.2f re S\n", lineWidth, x, y, width, height)
+}
+
+// Line strokes a line with the given line width and dash length. A dash length
+// of zero draws a solid line.
+func (p *Page) Line(x1, y1, x2, y2, lineWidth, dash float64) {
+	if dash > 0 {
+		fmt.Fprintf(&p.content, "q [%.2f] 0 d ", dash)
+	} else {
+		p.content.WriteString("q ")
+	}
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S Q\n", lineWidth, x1, y1, x2, y2)
+}
+
+// Image draws the image scaled to fill the given rectangle.
+func (p *Page) Image(img *Image, x, y, width, height float64) {
+	p.images[img.name] = img
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", width, height, x, y, img.name)
+}
+
+// Rotated calls draw with the page rotated 180 degrees around the center of
+// the given rectangle, so that anything drawn inside of it is upside down.
+func (p *Page) Rotated(x, y, width, height float64, draw func()) {
+	fmt.Fprintf(&p.content, "q -1 0 0 -1 %.2f %.2f cm\n", 2*x+width, 2*y+height)
+	draw()
+	p.content.WriteString("Q\n")
+}
+
+// WriteTo writes the document as a PDF file.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pw := &pdfWriter{w: bufio.NewWriter(w)}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and the page tree, followed by the
+	// fonts, the images and then each page and its content stream.
+	const catalogID, pagesID = 1, 2
+	fontIDs := map[Font]int{}
+	nextID := 3
+	for _, font := range fonts {
+		fontIDs[font] = nextID
+		nextID++
+	}
+	imageIDs := map[string]int{}
+	for _, img := range d.images {
+		imageIDs[img.name] = nextID
+		nextID++
+	}
+	pageIDs := make([]int, len(d.pages))
+	for i := range d.pages {
+		pageIDs[i] = nextID
+		nextID += 2
+	}
+
+	pw.startObject(catalogID)
+	pw.printf("<< /Type /Catalog /Pages %d 0 R >>\n", pagesID)
+	pw.endObject()
+
+	kids := make([]string, len(pageIDs))
+	for i, id := range pageIDs {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	pw.startObject(pagesID)
+	pw.printf("<< /Type /Pages /Kids [%s] /Count %d >>\n", strings.Join(kids, " "), len(pageIDs))
+	pw.endObject()
+
+	var fontResources strings.Builder
+	for _, font := range fonts {
+		pw.startObject(fontIDs[font])
+		pw.printf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\n", font)
+		pw.endObject()
+		fmt.Fprintf(&fontResources, "/%s %d 0 R ", font.resourceName(), fontIDs[font])
+	}
+
+	for _, img := range d.images {
+		pw.startObject(imageIDs[img.name])
+		pw.printf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n",
+			img.width, img.height, len(img.data))
+		pw.write(img.data)
+		pw.printf("\nendstream\n")
+		pw.endObject()
+	}
+
+	for i, page := range d.pages {
+		var xObjects strings.Builder
+		for name := range page.images {
+			fmt.Fprintf(&xObjects, "/%s %d 0 R ", name, imageIDs[name])
+		}
+		pw.startObject(pageIDs[i])
+		pw.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Contents %d 0 R /Resources << /Font << %s>> /XObject << %s>> >> >>\n",
+			pagesID, page.width, page.height, pageIDs[i]+1, fontResources.String(), xObjects.String())
+		pw.endObject()
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		zw.Write(page.content.Bytes())
+		zw.Close()
+		pw.startObject(pageIDs[i] + 1)
+		pw.printf("<< /Filter /FlateDecode /Length %d >>\nstream\n", content.Len())
+		pw.write(content.Bytes())
+		pw.printf("\nendstream\n")
+		pw.endObject()
+	}
+
+	xrefOffset := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", nextID)
+	for id := 1; id < nextID; id++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[id])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", nextID, catalogID, xrefOffset)
+
+	if pw.err == nil {
+		pw.err = pw.w.Flush()
+	}
+	return pw.n, pw.err
+}
+
+// pdfWriter tracks the offset of each object for the cross-reference table.
+type pdfWriter struct {
+	w       *bufio.Writer
+	n       int64
+	err     error
+	offsets map[int]int64
+}
+
+func (pw *pdfWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *pdfWriter) printf(format string, args ...any) {
+	pw.write(fmt.Appendf(nil, format, args...))
+}
+
+func (pw *pdfWriter) startObject(id int) {
+	if pw.offsets == nil {
+		pw.offsets = map[int]int64{}
+	}
+	pw.offsets[id] = pw.n
+	pw.printf("%d 0 obj\n", id)
+}
+
+func (pw *pdfWriter) endObject() {
+	pw.printf("endobj\n")
+}
+
+// encodeWinAnsi converts the string to the WinAnsi encoding used by the
+// standard fonts. Latin-1 characters are kept and anything else is replaced
+// with a question mark.
+func encodeWinAnsi(s string) []byte {
+	encoded := make([]byte, 0, len(s))
+	for _, r := range s {
+		if (r >= 0x20 && r < 0x7f) || (r >= 0xa0 && r <= 0xff) {
+			encoded = append(encoded, byte(r))
+		} else if r == '\t' || r == '\n' {
+			encoded = append(encoded, ' ')
+		} else {
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func escapeString(s string) string {
+	var escaped strings.Builder
+	for _, b := range encodeWinAnsi(s) {
+		switch b {
+		case '\\', '(', ')':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(b)
+		default:
+			if b >= 0x80 {
+				fmt.Fprintf(&escaped, "\\%03o", b)
+			} else {
+				escaped.WriteByte(b)
+			}
+		}
+	}
+	return escaped.String()
+}
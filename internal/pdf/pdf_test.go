@@ -0,0 +1,84 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	doc := New()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.White)
+	pdfImage, err := doc.AddImage(img)
+	require.NoError(t, err)
+
+	page := doc.AddPage(LetterWidth, LetterHeight)
+	page.Text(HelveticaBold, 12, 72, 72, "José (Team \\ 1)")
+	page.Image(pdfImage, 72, 144, 72, 72)
+	doc.AddPage(LetterHeight, LetterWidth).Rotated(0, 0, LetterHeight, LetterWidth/2, func() {})
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), n)
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(out, "%%EOF\n"))
+	assert.Contains(t, out, "/Count 2")
+
+	// Every entry in the cross-reference table must point at its object.
+	startXref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(out)
+	require.NotNil(t, startXref)
+	xrefOffset, err := strconv.Atoi(startXref[1])
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out[xrefOffset:], "xref\n0 "))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out[xrefOffset:], -1)
+	require.NotEmpty(t, entries)
+	for i, entry := range entries {
+		offset, err := strconv.Atoi(entry[1])
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out[offset:], fmt.Sprintf("%d 0 obj\n", i+1)), "object %d", i+1)
+	}
+}
+
+func TestEscapeString(t *testing.T) {
+	assert.Equal(t, `Jos\351 \(Team \\ 1\) ?`, escapeString("José (Team \\ 1) 日"))
+}
+
+func TestFont_Fit(t *testing.T) {
+	assert.InDelta(t, 0.5*667+0.5*556, Helvetica.TextWidth(1, "Ab")*1000/2, 0.001)
+
+	size, text := Helvetica.Fit(1000, 20, 10, "Short")
+	assert.Equal(t, 20.0, size)
+	assert.Equal(t, "Short", text)
+
+	width := Helvetica.TextWidth(20, "Shrink me")
+	size, text = Helvetica.Fit(width/1.5, 20, 10, "Shrink me")
+	assert.InDelta(t, 20/1.5, size, 0.001)
+	assert.Equal(t, "Shrink me", text)
+
+	size, text = Helvetica.Fit(50, 20, 10, "A very long team name that will not fit")
+	assert.Equal(t, 10.0, size)
+	assert.True(t, strings.HasSuffix(text, "..."))
+	assert.LessOrEqual(t, Helvetica.TextWidth(size, text), 50.0)
+}
+
+func TestFont_Wrap(t *testing.T) {
+	width := Helvetica.TextWidth(10, "in the 2030 CS@Mines")
+	lines := Helvetica.Wrap(width, 10, "for competing  in the 2030 CS@Mines High School Programming Competition")
+	assert.Equal(t, []string{"for competing in the", "2030 CS@Mines High", "School Programming", "Competition"}, lines)
+	for _, line := range lines {
+		assert.LessOrEqual(t, Helvetica.TextWidth(10, line), width)
+	}
+	assert.Equal(t, []string{"Supercalifragilistic", "a"}, Helvetica.Wrap(10, 10, "Supercalifragilistic a"))
+	assert.Empty(t, Helvetica.Wrap(100, 10, "  "))
+}
@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/scoreboard"
+)
+
+// maxScoreboardSize is the largest scoreboard file that can be uploaded.
+const maxScoreboardSize = 10 << 20
+
+// resultsStanding is a scoreboard row and the registered team that it was
+// matched to.
+type resultsStanding struct {
+	scoreboard.Row
+	// Team is nil if the row did not match a registered team.
+	Team      *database.TeamWithTeacherName
+	School    string
+	Location  string
+	FirstTime bool
+}
+
+// DisplayName is the registered team's name, or the name on the scoreboard if
+// the row was not matched.
+func (s *resultsStanding) DisplayName() string {
+	if s.Team != nil {
+		return s.Team.Name
+	} else if s.TeamName != "" {
+		return s.TeamName
+	}
+	return "Team " + s.TeamID
+}
+
+// resultsCategory is one of the award categories that the standings are
+// ranked in, such as first-time teams or remote teams.
+type resultsCategory struct {
+	Key     string
+	Name    string
+	Winners []*database.ArchiveWinner
+}
+
+// resultsOptions are the fields that are shared by the preview and publish
+// forms.
+type resultsOptions struct {
+	Year     int
+	Division database.Division
+	Places   int
+}
+
+func parseResultsOptions(r *http.Request) (opts resultsOptions, invalid string) {
+	var err error
+	if opts.Year, err = strconv.Atoi(r.FormValue("year")); err != nil || opts.Year < 1900 || opts.Year > 9999 {
+		return opts, "The year must be a four digit year."
+	}
+	if opts.Places, err = strconv.Atoi(r.FormValue("places")); err != nil || opts.Places < 1 || opts.Places > 20 {
+		return opts, "The number of places must be between 1 and 20."
+	}
+	if divStr := r.FormValue("div"); divStr != "" {
+		if opts.Division, err = database.ParseDivision(divStr); err != nil {
+			return opts, "Invalid division."
+		}
+	}
+	return opts, ""
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// matchScoreboard matches the scoreboard rows to the registered teams. Rows
+// with a judging system team ID are matched using the team IDs from the
+// DOMjudge export, and the rest, or any whose team is no longer registered,
+// are matched by team name.
+func (a *Application) matchScoreboard(ctx context.Context, rows []scoreboard.Row, division database.Division) ([]*resultsStanding, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams: %w", err)
+	}
+	teachers, err := a.DB.GetAllTeachers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teachers: %w", err)
+	}
+	teachersByEmail := map[string]*database.Teacher{}
+	for _, teacher := range teachers {
+		teachersByEmail[teacher.Email] = teacher
+	}
+	teamsByDOMjudgeID := map[string]*database.TeamWithTeacherName{}
+	teamsByName := map[string][]*database.TeamWithTeacherName{}
+	for _, team := range teams {
+		if division == "" || team.Division == division {
+			teamsByDOMjudgeID[domjudgeTeamID(team.ID)] = team
+			name := normalizeName(team.Name)
+			teamsByName[name] = append(teamsByName[name], team)
+		}
+	}
+
+	standings := make([]*resultsStanding, len(rows))
+	for i, row := range rows {
+		standing := &resultsStanding{Row: row}
+		if team, ok := teamsByDOMjudgeID[row.TeamID]; ok && row.TeamID != "" {
+			standing.Team = team
+		} else if matches := teamsByName[normalizeName(row.TeamName)]; len(matches) == 1 {
+			// Ambiguous names are left unmatched rather than guessed.
+			standing.Team = matches[0]
+		}
+		if standing.Team != nil {
+			standing.School = standing.Team.SchoolName
+			if teacher, ok := teachersByEmail[standing.Team.TeacherEmail]; ok {
+				standing.Location = teacher.SchoolCity + ", " + teacher.SchoolState
+			}
+			standing.FirstTime = !slices.ContainsFunc(standing.Team.Members, func(s database.Student) bool { return s.PreviouslyParticipated })
+		}
+		standings[i] = standing
+	}
+	return standings, nil
+}
+
+// computeResultsCategories ranks the standings overall and in each of the
+// award categories. Unmatched teams are only ranked overall because their
+// division, location and experience are unknown. Categories that would have
+// the same teams as the overall ranking are left out.
+func computeResultsCategories(standings []*resultsStanding, opts resultsOptions) []*resultsCategory {
+	prefix := ""
+	if opts.Division != "" {
+		prefix = string(opts.Division) + " "
+	}
+	type categoryDef struct {
+		key, name string
+		include   func(s *resultsStanding) bool
+	}
+	defs := []categoryDef{
+		{"overall", prefix + "Overall Winners", func(s *resultsStanding) bool { return true }},
+		{"first-time", prefix + "First-Time Team Winners", func(s *resultsStanding) bool { return s.Team != nil && s.FirstTime }},
+	}
+	if opts.Division == "" {
+		for _, division := range []database.Division{database.DivisionBeginner, database.DivisionAdvanced} {
+			defs = append(defs, categoryDef{strings.ToLower(string(division)), string(division), func(s *resultsStanding) bool {
+				return s.Team != nil && s.Team.Division == division
+			}})
+		}
+	}
+	defs = append(defs,
+		categoryDef{"in-person", prefix + "In-Person", func(s *resultsStanding) bool { return s.Team != nil && s.Team.InPerson }},
+		categoryDef{"remote", prefix + "Remote", func(s *resultsStanding) bool { return s.Team != nil && !s.Team.InPerson }},
+	)
+
+	var categories []*resultsCategory
+	for _, def := range defs {
+		var ranked []*resultsStanding
+		for _, standing := range standings {
+			if def.include(standing) {
+				ranked = append(ranked, standing)
+			}
+		}
+		if len(ranked) == 0 || (def.key != "overall" && len(ranked) == len(standings)) {
+			continue
+		}
+
+		category := &resultsCategory{Key: def.key, Name: def.name}
+		for i, standing := range ranked {
+			// Teams that are tied on the scoreboard share a place.
+			place := i + 1
+			if i > 0 && standing.Rank == ranked[i-1].Rank {
+				place = category.Winners[i-1].Place
+			}
+			if place > opts.Places {
+				break
+			}
+			winner := &database.ArchiveWinner{
+				Place:    place,
+				TeamName: standing.DisplayName(),
+				School:   standing.School,
+				Location: standing.Location,
+			}
+			if standing.Team != nil {
+				winner.TeamID = standing.Team.ID
+			}
+			category.Winners = append(category.Winners, winner)
+		}
+		categories = append(categories, category)
+	}
+	return categories
+}
+
+func (a *Application) GetAdminResultsTemplate(r *http.Request) map[string]any {
+	return map[string]any{
+		"Formats":   scoreboard.Formats,
+		"Format":    scoreboard.FormatKattisCSV,
+		"Divisions": []database.Division{database.DivisionBeginner, database.DivisionAdvanced},
+		"Division":  database.Division(""),
+		"Year":      time.Now().Year(),
+		"Places":    3,
+	}
+}
+
+// readFormUpload reads the uploaded file with the field name, or the pasted
+// text in the field name with a _text suffix if no file was uploaded.
+func readFormUpload(r *http.Request, name string) ([]byte, error) {
+	file, _, err := r.FormFile(name)
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return []byte(r.FormValue(name + "_text")), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// HandleAdminPreviewResults parses the uploaded scoreboard and shows the
+// matched teams and the winners of each category so that they can be checked
+// before they are published.
+func (a *Application) HandleAdminPreviewResults(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "admin_preview_results").Logger()
+	r.Body = http.MaxBytesReader(w, r.Body, maxScoreboardSize)
+	if err := r.ParseMultipartForm(maxScoreboardSize); err != nil && err != http.ErrNotMultipart {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	renderError := func(message string) {
+		w.WriteHeader(http.StatusBadRequest)
+		a.AdminResultsRenderer(w, r, map[string]any{"Error": message})
+	}
+
+	opts, invalid := parseResultsOptions(r)
+	if invalid != "" {
+		renderError(invalid)
+		return
+	}
+	format, err := scoreboard.ParseFormat(r.FormValue("format"))
+	if err != nil {
+		renderError("Choose a scoreboard format.")
+		return
+	}
+	data, err := readFormUpload(r, "scoreboard")
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read scoreboard upload")
+		renderError("Failed to read the uploaded scoreboard.")
+		return
+	}
+	rows, err := scoreboard.Parse(format, bytes.NewReader(data))
+	if err != nil {
+		renderError("Failed to read the scoreboard: " + err.Error())
+		return
+	}
+	standings, err := a.matchScoreboard(r.Context(), rows, opts.Division)
+	if err != nil {
+		log.Err(err).Msg("failed to match scoreboard")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// The parsed rows are sent back with the publish form so that the
+	// scoreboard does not need to be uploaded again.
+	rowsJSON, err := json.Marshal(rows)
+	if err != nil {
+		log.Err(err).Msg("failed to marshal scoreboard rows")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	unmatched := 0
+	for _, standing := range standings {
+		if standing.Team == nil {
+			unmatched++
+		}
+	}
+	a.AdminResultsRenderer(w, r, map[string]any{
+		"Year":       opts.Year,
+		"Division":   opts.Division,
+		"Places":     opts.Places,
+		"Format":     format,
+		"Standings":  standings,
+		"Unmatched":  unmatched,
+		"Categories": computeResultsCategories(standings, opts),
+		"RowsJSON":   string(rowsJSON),
+	})
+}
+
+// HandleAdminPublishResults adds the chosen categories to the archive.
+func (a *Application) HandleAdminPublishResults(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "admin_publish_results").Logger()
+	if err := r.ParseForm(); err != nil {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	opts, invalid := parseResultsOptions(r)
+	if invalid != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var rows []scoreboard.Row
+	if err := json.Unmarshal([]byte(r.FormValue("rows")), &rows); err != nil || len(rows) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	standings, err := a.matchScoreboard(r.Context(), rows, opts.Division)
+	if err != nil {
+		log.Err(err).Msg("failed to match scoreboard")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var results []*database.ArchiveResult
+	for _, category := range computeResultsCategories(standings, opts) {
+		if !slices.Contains(r.Form["category"], category.Key) {
+			continue
+		}
+		name := strings.TrimSpace(r.FormValue("name-" + category.Key))
+		if name == "" {
+			name = category.Name
+		}
+		results = append(results, &database.ArchiveResult{Name: name, Winners: category.Winners})
+	}
+	if len(results) == 0 {
+		redirectToArchive(w, r, opts.Year, "error", "No results were chosen to publish.")
+		return
+	}
+	if err := a.DB.PublishArchiveResults(r.Context(), opts.Year, results); err != nil {
+		log.Err(err).Msg("failed to publish results")
+		redirectToArchive(w, r, opts.Year, "error", "Failed to publish the results.")
+		return
+	}
+	log.Info().Int("year", opts.Year).Int("results", len(results)).Msg("published results to the archive")
+	redirectToArchive(w, r, opts.Year, "message", fmt.Sprintf("Published %d results to the archive.", len(results)))
+}
@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/scoreboard"
+)
+
+// addTestResultsTeams registers an experienced advanced in-person team, a
+// first-time beginner remote team and a first-time beginner in-person team.
+func addTestResultsTeams(t *testing.T, a *Application) map[string]uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, a.DB.NewTeacher(ctx, "Teacher", "teacher@example.com"))
+	require.NoError(t, a.DB.SetTeacherSchoolInfo(ctx, "teacher@example.com", "School", "Golden", "CO"))
+	teams := map[string]uuid.UUID{}
+	for i, team := range []struct {
+		name      string
+		division  database.Division
+		inPerson  bool
+		returning bool
+	}{
+		{"Code Rats", database.DivisionAdvanced, true, true},
+		{"Lobos 3", database.DivisionBeginner, false, false},
+		{"Cool Cats", database.DivisionBeginner, true, false},
+	} {
+		teams[team.name] = uuid.New()
+		require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", teams[team.name], team.name, team.division, team.inPerson, "", ""))
+		email := "student" + string(rune('a'+i)) + "@example.com"
+		require.NoError(t, a.DB.AddTeamMember(ctx, teams[team.name], "Student", 16, email, team.returning))
+	}
+	return teams
+}
+
+var testResultsRows = []scoreboard.Row{
+	{Rank: 1, TeamName: "Code Rats", Solved: 5},
+	{Rank: 2, TeamName: "Not Registered", Solved: 4},
+	{Rank: 3, TeamName: "Lobos 3", Solved: 3},
+	{Rank: 3, TeamName: "cool  cats", Solved: 3},
+}
+
+func TestComputeResultsCategories(t *testing.T) {
+	a := newTestAppWithDB(t)
+	teams := addTestResultsTeams(t, a)
+	standings, err := a.matchScoreboard(context.Background(), testResultsRows, "")
+	require.NoError(t, err)
+	assert.Equal(t, teams["Code Rats"], standings[0].Team.ID)
+	assert.Nil(t, standings[1].Team)
+	assert.Equal(t, teams["Cool Cats"], standings[3].Team.ID)
+	assert.Equal(t, "Golden, CO", standings[3].Location)
+
+	type placing struct {
+		Place int
+		Name  string
+	}
+	categories := map[string][]placing{}
+	var names []string
+	for _, category := range computeResultsCategories(standings, resultsOptions{Year: 2030, Places: 3}) {
+		names = append(names, category.Name)
+		for _, winner := range category.Winners {
+			categories[category.Key] = append(categories[category.Key], placing{winner.Place, winner.TeamName})
+		}
+	}
+	assert.Equal(t, []string{"Overall Winners", "First-Time Team Winners", "Beginner", "Advanced", "In-Person", "Remote"}, names)
+	assert.Equal(t, []placing{{1, "Code Rats"}, {2, "Not Registered"}, {3, "Lobos 3"}, {3, "Cool Cats"}}, categories["overall"])
+	assert.Equal(t, []placing{{1, "Lobos 3"}, {1, "Cool Cats"}}, categories["first-time"])
+	assert.Equal(t, []placing{{1, "Code Rats"}}, categories["advanced"])
+	assert.Equal(t, []placing{{1, "Code Rats"}, {2, "Cool Cats"}}, categories["in-person"])
+	assert.Equal(t, []placing{{1, "Lobos 3"}}, categories["remote"])
+
+	// Only ranking one division leaves out the division categories and the
+	// categories that are the same as the overall ranking.
+	standings, err = a.matchScoreboard(context.Background(), testResultsRows[2:], database.DivisionBeginner)
+	require.NoError(t, err)
+	names = nil
+	beginnerCategories := computeResultsCategories(standings, resultsOptions{Year: 2030, Places: 1, Division: database.DivisionBeginner})
+	for _, category := range beginnerCategories {
+		names = append(names, category.Name)
+	}
+	assert.Equal(t, []string{"Beginner Overall Winners", "Beginner In-Person", "Beginner Remote"}, names)
+	// Tied teams share the last place that is awarded.
+	assert.Len(t, beginnerCategories[0].Winners, 2)
+}
+
+func TestResults_MatchDOMjudgeIDs(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teams := addTestResultsTeams(t, a)
+	export, err := a.buildDOMjudgeExport(ctx, database.DivisionBeginner)
+	require.NoError(t, err)
+	exportedIDs := map[uuid.UUID]string{}
+	for id, teamID := range export.RegisteredTeams {
+		exportedIDs[teamID] = id
+	}
+	require.Contains(t, exportedIDs, teams["Lobos 3"])
+
+	// The teams changed after the contest export: one was edited, which
+	// resets its registration time, and another withdrew.
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", teams["Lobos 3"], "Lobos 3", database.DivisionBeginner, false, "", ""))
+	require.NoError(t, a.DB.WithdrawTeam(ctx, teams["Cool Cats"]))
+
+	standings, err := a.matchScoreboard(ctx, []scoreboard.Row{
+		{Rank: 1, TeamID: exportedIDs[teams["Lobos 3"]]},
+		{Rank: 2, TeamID: "99"},
+		{Rank: 3, TeamID: exportedIDs[teams["Cool Cats"]], TeamName: "Lobos 3"},
+	}, database.DivisionBeginner)
+	require.NoError(t, err)
+	assert.Equal(t, teams["Lobos 3"], standings[0].Team.ID)
+	assert.Nil(t, standings[1].Team)
+	assert.Equal(t, "Team 99", standings[1].DisplayName())
+	require.NotNil(t, standings[2].Team, "rows for teams that are no longer registered fall back to the name")
+	assert.Equal(t, teams["Lobos 3"], standings[2].Team.ID)
+}
+
+func TestAdminResults(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	teams := addTestResultsTeams(t, a)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range map[string]string{"format": "kattis-csv", "year": "2030", "places": "3"} {
+		require.NoError(t, writer.WriteField(key, value))
+	}
+	file, err := writer.CreateFormFile("scoreboard", "standings.csv")
+	require.NoError(t, err)
+	file.Write([]byte("Rank,Team,Slv.,Time\n1,Code Rats,5,300\n2,Not Registered,4,200\n3,Lobos 3,3,100\n"))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/admin/results/preview", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "1 scoreboard teams did not match")
+	assert.Contains(t, rec.Body.String(), "First-Time Team Winners")
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = post("/admin/results/preview", url.Values{"format": {"kattis-csv"}, "year": {"2030"}, "places": {"3"}, "scoreboard_text": {"Team\nCode Rats\n"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no rank column")
+
+	rows, err := json.Marshal(testResultsRows)
+	require.NoError(t, err)
+	rec = post("/admin/results/publish", url.Values{
+		"rows":            {string(rows)},
+		"year":            {"2030"},
+		"places":          {"3"},
+		"category":        {"overall", "first-time"},
+		"name-overall":    {"Overall Winners"},
+		"name-first-time": {"First-Time Teams"},
+	})
+	assert.Contains(t, rec.Header().Get("Location"), "/admin/archive/2030?message=")
+
+	year, err := a.DB.GetArchiveYear(ctx, 2030)
+	require.NoError(t, err)
+	require.NotNil(t, year)
+	require.Len(t, year.Results, 2)
+	assert.Equal(t, "Overall Winners", year.Results[0].Name)
+	assert.Equal(t, "First-Time Teams", year.Results[1].Name)
+	require.Len(t, year.Results[0].Winners, 4)
+	assert.Equal(t, teams["Code Rats"], year.Results[0].Winners[0].TeamID)
+	assert.Equal(t, "School", year.Results[0].Winners[0].School)
+	assert.Equal(t, uuid.Nil, year.Results[0].Winners[1].TeamID)
+	assert.Equal(t, "Not Registered", year.Results[0].Winners[1].TeamName)
+
+	page := doRequest(router, http.MethodGet, "/archive").Body.String()
+	assert.Contains(t, page, "First-Time Teams")
+}
@@ -104,6 +104,23 @@ func TestRouting_Admin_NoCookie(t *testing.T) {
 		"/admin",
 		"/admin/teams",
 		"/admin/dietaryrestrictions",
+		"/admin/onsite",
+		"/admin/checkins",
+		"/admin/rooms",
+		"/admin/tours",
+		"/admin/chaperones",
+		"/admin/live",
+		"/admin/api/live",
+		"/admin/exports",
+		"/admin/api/export/teams",
+		"/admin/apitokens",
+		"/admin/webhooks",
+		"/admin/archive",
+		"/admin/results",
+		"/admin/participation",
+		"/admin/certificates",
+		"/admin/surveys",
+		"/admin/emergency",
 		"/admin/api/resendstudentemail",
 		"/admin/api/sendqrcodes",
 		"/admin/api/kattis/teams",
@@ -134,6 +151,23 @@ func TestRouting_Admin_ValidToken(t *testing.T) {
 		"/admin/",
 		"/admin/teams",
 		"/admin/dietaryrestrictions",
+		"/admin/onsite",
+		"/admin/checkins",
+		"/admin/rooms",
+		"/admin/tours",
+		"/admin/chaperones",
+		"/admin/live",
+		"/admin/exports",
+		"/admin/api/export/teams",
+		"/admin/apitokens",
+		"/admin/webhooks",
+		"/admin/archive",
+		"/admin/results",
+		"/admin/participation",
+		"/admin/certificates",
+		"/admin/surveys",
+		"/admin/surveys/results",
+		"/admin/emergency",
 		"/admin/api/kattis/teams",
 		"/admin/api/zoom/breakout",
 		"/admin/api/team-list",
@@ -161,6 +195,8 @@ func TestRouting_Volunteer_NoCookie(t *testing.T) {
 	for _, path := range []string{
 		"/volunteer/scan",
 		"/volunteer/checkin",
+		"/volunteer/kiosk",
+		"/volunteer/tours",
 	} {
 		assertRedirectsTo(t, doRequest(router, http.MethodGet, path), "/volunteer/login")
 	}
@@ -185,6 +221,8 @@ func TestRouting_Volunteer_ValidToken(t *testing.T) {
 	for _, path := range []string{
 		"/volunteer/scan",
 		"/volunteer/checkin",
+		"/volunteer/kiosk",
+		"/volunteer/tours",
 	} {
 		rec := doRequest(router, http.MethodGet, path,
 			&http.Cookie{Name: "volunteer_token", Value: volunteerToken(t)})
@@ -200,3 +238,14 @@ func TestRouting_VolunteerPublic_NoCookie(t *testing.T) {
 		assertPassedAuth(t, doRequest(router, http.MethodGet, path), "/volunteer/login")
 	}
 }
+
+// --- Static files ---
+
+func TestRouting_KioskQRDecoder(t *testing.T) {
+	// The kiosk falls back to this decoder when the browser has no
+	// BarcodeDetector, so it must be served with the site.
+	router := newTestAppWithDB(t).BuildRouter()
+	rec := doRequest(router, http.MethodGet, "/static/qrdecode.js")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "global.decodeQR = decodeQR")
+}
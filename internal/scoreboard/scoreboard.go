@@ -0,0 +1,262 @@
+// Package scoreboard reads the final standings from the scoreboards that the
+// contest judging systems export.
+package scoreboard
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Row is one team's line on the scoreboard.
+type Row struct {
+	// Rank is the team's place. Tied teams have the same rank.
+	Rank int `json:"rank"`
+	// TeamID is the judging system's ID for the team, if the scoreboard has
+	// one.
+	TeamID   string `json:"team_id,omitempty"`
+	TeamName string `json:"team_name"`
+	Solved   int    `json:"solved"`
+	// Penalty is the penalty time in minutes.
+	Penalty int `json:"penalty"`
+}
+
+type Format string
+
+const (
+	// FormatKattisCSV is the standings CSV that Kattis exports.
+	FormatKattisCSV Format = "kattis-csv"
+	// FormatCLICSJSON is the scoreboard JSON from the CLICS contest API that
+	// DOMjudge implements, either by itself or as part of an API dump that
+	// also includes the teams.
+	FormatCLICSJSON Format = "clics-json"
+)
+
+var Formats = []Format{FormatKattisCSV, FormatCLICSJSON}
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatKattisCSV, FormatCLICSJSON:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("invalid scoreboard format: %s", s)
+	}
+}
+
+var ErrEmptyScoreboard = errors.New("the scoreboard has no teams")
+
+// Parse reads the scoreboard and returns its rows sorted by rank.
+func Parse(format Format, r io.Reader) ([]Row, error) {
+	var rows []Row
+	var err error
+	switch format {
+	case FormatKattisCSV:
+		rows, err = ParseKattisCSV(r)
+	case FormatCLICSJSON:
+		rows, err = ParseCLICSJSON(r)
+	default:
+		return nil, fmt.Errorf("invalid scoreboard format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	} else if len(rows) == 0 {
+		return nil, ErrEmptyScoreboard
+	}
+	slices.SortStableFunc(rows, func(a, b Row) int { return a.Rank - b.Rank })
+	return rows, nil
+}
+
+// kattisColumns are the header names that Kattis has used for each of the
+// columns that are read. The rest of the columns are the problems.
+var kattisColumns = map[string][]string{
+	"rank":    {"rank", "#", "place"},
+	"team":    {"team", "team name", "name"},
+	"solved":  {"solved", "slv.", "slv", "score"},
+	"penalty": {"time", "penalty", "penalty time"},
+}
+
+// ParseKattisCSV reads a Kattis standings CSV. The columns are found by their
+// headers, so the problem columns and their order do not matter. Kattis leaves
+// the rank blank for teams that are tied with the team above, so a blank rank
+// is the same as the previous row's.
+func ParseKattisCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	} else if len(records) == 0 {
+		return nil, ErrEmptyScoreboard
+	}
+
+	columns := map[string]int{}
+	for i, header := range records[0] {
+		header = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))
+		for column, names := range kattisColumns {
+			if _, ok := columns[column]; !ok && slices.Contains(names, header) {
+				columns[column] = i
+			}
+		}
+	}
+	for _, column := range []string{"rank", "team"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("the CSV has no %s column", column)
+		}
+	}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []Row
+	for i, record := range records[1:] {
+		row := Row{TeamName: field(record, "team")}
+		if row.TeamName == "" {
+			continue
+		}
+		if rank := field(record, "rank"); rank != "" {
+			if row.Rank, err = parseRank(rank); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+2, err)
+			}
+		} else if len(rows) > 0 {
+			row.Rank = rows[len(rows)-1].Rank
+		} else {
+			return nil, fmt.Errorf("line %d: the first team has no rank", i+2)
+		}
+		if solved := field(record, "solved"); solved != "" {
+			if row.Solved, err = strconv.Atoi(solved); err != nil {
+				return nil, fmt.Errorf("line %d: invalid number solved %q", i+2, solved)
+			}
+		}
+		if penalty := field(record, "penalty"); penalty != "" {
+			if row.Penalty, err = strconv.Atoi(penalty); err != nil {
+				return nil, fmt.Errorf("line %d: invalid penalty time %q", i+2, penalty)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseRank reads ranks such as "3", "T3" and "3=".
+func parseRank(s string) (int, error) {
+	rank, err := strconv.Atoi(strings.Trim(s, "T=. "))
+	if err != nil || rank < 1 {
+		return 0, fmt.Errorf("invalid rank %q", s)
+	}
+	return rank, nil
+}
+
+type clicsScore struct {
+	NumSolved int             `json:"num_solved"`
+	TotalTime json.RawMessage `json:"total_time"`
+}
+
+type clicsRow struct {
+	Rank   int        `json:"rank"`
+	TeamID string     `json:"team_id"`
+	Score  clicsScore `json:"score"`
+}
+
+type clicsScoreboard struct {
+	Rows []clicsRow `json:"rows"`
+}
+
+type clicsTeam struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+// clicsDump is the subset of a CLICS API dump that is needed to name the
+// teams on the scoreboard.
+type clicsDump struct {
+	Teams      []clicsTeam      `json:"teams"`
+	Scoreboard *clicsScoreboard `json:"scoreboard"`
+}
+
+// ParseCLICSJSON reads the scoreboard from the CLICS contest API. It accepts
+// the scoreboard endpoint's response, or an object with "teams" and
+// "scoreboard" keys holding the responses of those endpoints. Rows only have
+// team names if the teams are included.
+func ParseCLICSJSON(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var dump clicsDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	scoreboard := dump.Scoreboard
+	if scoreboard == nil {
+		scoreboard = &clicsScoreboard{}
+		if err := json.Unmarshal(data, scoreboard); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	}
+	teamNames := map[string]string{}
+	for _, team := range dump.Teams {
+		teamNames[team.ID] = team.Name
+		if team.DisplayName != "" {
+			teamNames[team.ID] = team.DisplayName
+		}
+	}
+
+	rows := make([]Row, 0, len(scoreboard.Rows))
+	for _, row := range scoreboard.Rows {
+		if row.TeamID == "" {
+			return nil, errors.New("a scoreboard row has no team_id")
+		} else if row.Rank < 1 {
+			return nil, fmt.Errorf("team %s has an invalid rank", row.TeamID)
+		}
+		penalty, err := parseCLICSTime(row.Score.TotalTime)
+		if err != nil {
+			return nil, fmt.Errorf("team %s: %w", row.TeamID, err)
+		}
+		rows = append(rows, Row{
+			Rank:     row.Rank,
+			TeamID:   row.TeamID,
+			TeamName: teamNames[row.TeamID],
+			Solved:   row.Score.NumSolved,
+			Penalty:  penalty,
+		})
+	}
+	return rows, nil
+}
+
+// parseCLICSTime reads the total time in minutes. Older versions of the API
+// use a number of minutes and newer versions use a relative time such as
+// "1:23:45.000".
+func parseCLICSTime(raw json.RawMessage) (int, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return 0, nil
+	}
+	var minutes float64
+	if err := json.Unmarshal(raw, &minutes); err == nil {
+		return int(minutes), nil
+	}
+	var relTime string
+	if err := json.Unmarshal(raw, &relTime); err != nil {
+		return 0, fmt.Errorf("invalid total time %s", raw)
+	}
+	parts := strings.Split(relTime, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid total time %q", relTime)
+	}
+	duration, err := time.ParseDuration(parts[0] + "h" + parts[1] + "m" + parts[2] + "s")
+	if err != nil {
+		return 0, fmt.Errorf("invalid total time %q", relTime)
+	}
+	return int(duration.Minutes()), nil
+}
@@ -0,0 +1,61 @@
+package scoreboard
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKattisCSV(t *testing.T) {
+	csv := "\ufeffRank,Team,Slv.,Time,A,B\n" +
+		"1,\"Code Rats\",2,95,1/20,2/55\n" +
+		"2,Lobos 3,1,30,1/30,\n" +
+		",Runtime Terror,1,30,,1/30\n" +
+		"T4,Cool Cats,0,0,,\n"
+	rows, err := Parse(FormatKattisCSV, strings.NewReader(csv))
+	require.NoError(t, err)
+	assert.Equal(t, []Row{
+		{Rank: 1, TeamName: "Code Rats", Solved: 2, Penalty: 95},
+		{Rank: 2, TeamName: "Lobos 3", Solved: 1, Penalty: 30},
+		{Rank: 2, TeamName: "Runtime Terror", Solved: 1, Penalty: 30},
+		{Rank: 4, TeamName: "Cool Cats"},
+	}, rows)
+
+	_, err = Parse(FormatKattisCSV, strings.NewReader("Team,Solved\nCode Rats,2\n"))
+	assert.ErrorContains(t, err, "rank column")
+	_, err = Parse(FormatKattisCSV, strings.NewReader("Rank,Team\n"))
+	assert.ErrorIs(t, err, ErrEmptyScoreboard)
+	_, err = Parse(FormatKattisCSV, strings.NewReader("Rank,Team\nfirst,Code Rats\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestParseCLICSJSON(t *testing.T) {
+	scoreboard := `{
+		"rows": [
+			{"rank": 2, "team_id": "7", "score": {"num_solved": 3, "total_time": "1:05:30.000"}},
+			{"rank": 1, "team_id": "3", "score": {"num_solved": 4, "total_time": 120}}
+		]
+	}`
+	rows, err := Parse(FormatCLICSJSON, strings.NewReader(scoreboard))
+	require.NoError(t, err)
+	assert.Equal(t, []Row{
+		{Rank: 1, TeamID: "3", Solved: 4, Penalty: 120},
+		{Rank: 2, TeamID: "7", Solved: 3, Penalty: 65},
+	}, rows)
+
+	dump := `{
+		"teams": [{"id": "3", "name": "team3", "display_name": "Code Rats"}, {"id": "7", "name": "Lobos 3"}],
+		"scoreboard": ` + scoreboard + `
+	}`
+	rows, err = Parse(FormatCLICSJSON, strings.NewReader(dump))
+	require.NoError(t, err)
+	assert.Equal(t, "Code Rats", rows[0].TeamName)
+	assert.Equal(t, "Lobos 3", rows[1].TeamName)
+
+	_, err = Parse(FormatCLICSJSON, strings.NewReader(`{"rows": []}`))
+	assert.ErrorIs(t, err, ErrEmptyScoreboard)
+	_, err = Parse(FormatCLICSJSON, strings.NewReader(`{"rows": [{"rank": 1, "team_id": "3", "score": {"total_time": "soon"}}]}`))
+	assert.ErrorContains(t, err, "invalid total time")
+}
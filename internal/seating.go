@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// SchoolSeating is how teams from the same school are seated relative to
+// each other.
+type SchoolSeating string
+
+const (
+	// SchoolSeatingApart interleaves the schools so that teams from the same
+	// school are not seated next to each other when possible.
+	SchoolSeatingApart SchoolSeating = "apart"
+	// SchoolSeatingTogether seats teams from the same school next to each
+	// other.
+	SchoolSeatingTogether SchoolSeating = "together"
+)
+
+type seatSlot struct {
+	room *database.Room
+	seat int
+}
+
+// assignSeats assigns a seat to every in-person team that does not have a
+// manually chosen seat. Teams with accessibility notes are seated in the
+// accessible rooms first, and the accessible rooms are otherwise filled last.
+// Teams that do not fit are returned as unassigned.
+func assignSeats(teams []*database.TeamWithTeacherName, rooms []*database.Room, existing map[uuid.UUID]*database.TeamSeat, schoolSeating SchoolSeating) (seats []*database.TeamSeat, unassigned []*database.TeamWithTeacherName) {
+	taken := map[seatSlot]bool{}
+	var needsAccessible, others []*database.TeamWithTeacherName
+	for _, team := range teams {
+		if !team.InPerson || len(team.Members) == 0 {
+			continue
+		}
+		if seat, ok := existing[team.ID]; ok && seat.Manual {
+			for _, room := range rooms {
+				if room.ID == seat.RoomID {
+					taken[seatSlot{room, seat.Seat}] = true
+				}
+			}
+			continue
+		}
+		if strings.TrimSpace(team.AccessibilityNotes) != "" {
+			needsAccessible = append(needsAccessible, team)
+		} else {
+			others = append(others, team)
+		}
+	}
+
+	var accessibleSlots, otherSlots []seatSlot
+	for _, room := range rooms {
+		for seat := 1; seat <= room.Seats; seat++ {
+			slot := seatSlot{room, seat}
+			if taken[slot] {
+				continue
+			} else if room.Accessible {
+				accessibleSlots = append(accessibleSlots, slot)
+			} else {
+				otherSlots = append(otherSlots, slot)
+			}
+		}
+	}
+
+	assign := func(teams []*database.TeamWithTeacherName, slots []seatSlot) []seatSlot {
+		for _, team := range orderTeamsForSeating(teams, schoolSeating) {
+			if len(slots) == 0 {
+				unassigned = append(unassigned, team)
+				continue
+			}
+			seats = append(seats, &database.TeamSeat{
+				TeamID:   team.ID,
+				RoomID:   slots[0].room.ID,
+				RoomName: slots[0].room.Name,
+				Seat:     slots[0].seat,
+			})
+			slots = slots[1:]
+		}
+		return slots
+	}
+	// Anyone that needs an accessible seat and does not get one falls back to
+	// the other rooms so that they at least have a seat.
+	remaining := assign(needsAccessible, append(accessibleSlots, otherSlots...))
+	assign(others, remaining)
+	return seats, unassigned
+}
+
+// orderTeamsForSeating returns the order in which the teams should fill the
+// seats.
+func orderTeamsForSeating(teams []*database.TeamWithTeacherName, schoolSeating SchoolSeating) []*database.TeamWithTeacherName {
+	bySchool := map[string][]*database.TeamWithTeacherName{}
+	var schools []string
+	for _, team := range teams {
+		school := strings.ToLower(strings.TrimSpace(team.SchoolName))
+		if _, ok := bySchool[school]; !ok {
+			schools = append(schools, school)
+		}
+		bySchool[school] = append(bySchool[school], team)
+	}
+	for _, schoolTeams := range bySchool {
+		slices.SortFunc(schoolTeams, func(a, b *database.TeamWithTeacherName) int {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+	}
+
+	if schoolSeating == SchoolSeatingTogether {
+		slices.Sort(schools)
+		ordered := make([]*database.TeamWithTeacherName, 0, len(teams))
+		for _, school := range schools {
+			ordered = append(ordered, bySchool[school]...)
+		}
+		return ordered
+	}
+
+	// Take one team from each school in turn, starting with the schools that
+	// have the most teams so that they are spread out the most.
+	slices.SortFunc(schools, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(bySchool[b]), len(bySchool[a])), cmp.Compare(a, b))
+	})
+	ordered := make([]*database.TeamWithTeacherName, 0, len(teams))
+	for len(ordered) < len(teams) {
+		for _, school := range schools {
+			if len(bySchool[school]) > 0 {
+				ordered = append(ordered, bySchool[school][0])
+				bySchool[school] = bySchool[school][1:]
+			}
+		}
+	}
+	return ordered
+}
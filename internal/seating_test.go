@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func seatingTestTeam(name, school, accessibilityNotes string) *database.TeamWithTeacherName {
+	return &database.TeamWithTeacherName{Team: &database.Team{
+		ID:                 uuid.New(),
+		Name:               name,
+		SchoolName:         school,
+		InPerson:           true,
+		AccessibilityNotes: accessibilityNotes,
+		Members:            []database.Student{{Name: name + " Student"}},
+	}}
+}
+
+func seatedTeamNames(teams []*database.TeamWithTeacherName, seats []*database.TeamSeat) []string {
+	names := map[uuid.UUID]string{}
+	for _, team := range teams {
+		names[team.ID] = team.Name
+	}
+	var seated []string
+	for _, seat := range seats {
+		seated = append(seated, names[seat.TeamID])
+	}
+	return seated
+}
+
+func TestAssignSeats_SchoolSeating(t *testing.T) {
+	teams := []*database.TeamWithTeacherName{
+		seatingTestTeam("A1", "School A", ""),
+		seatingTestTeam("A2", "School A", ""),
+		seatingTestTeam("A3", "School A", ""),
+		seatingTestTeam("B1", "School B", ""),
+		seatingTestTeam("B2", "School B", ""),
+	}
+	rooms := []*database.Room{{ID: 1, Name: "Room", Seats: 10}}
+
+	seats, unassigned := assignSeats(teams, rooms, nil, SchoolSeatingApart)
+	assert.Empty(t, unassigned)
+	assert.Equal(t, []string{"A1", "B1", "A2", "B2", "A3"}, seatedTeamNames(teams, seats))
+
+	seats, unassigned = assignSeats(teams, rooms, nil, SchoolSeatingTogether)
+	assert.Empty(t, unassigned)
+	assert.Equal(t, []string{"A1", "A2", "A3", "B1", "B2"}, seatedTeamNames(teams, seats))
+	for i, seat := range seats {
+		assert.Equal(t, i+1, seat.Seat)
+	}
+}
+
+func TestAssignSeats_AccessibilityAndManualSeats(t *testing.T) {
+	manual := seatingTestTeam("Manual", "School A", "")
+	accessible := seatingTestTeam("Accessible", "School A", "Wheelchair user")
+	other := seatingTestTeam("Other", "School B", "")
+	overflow := seatingTestTeam("Overflow", "School C", "")
+	remote := seatingTestTeam("Remote", "School D", "")
+	remote.InPerson = false
+	teams := []*database.TeamWithTeacherName{manual, accessible, other, overflow, remote}
+	rooms := []*database.Room{
+		{ID: 1, Name: "Lab", Seats: 2},
+		{ID: 2, Name: "Ramp Room", Seats: 1, Accessible: true},
+	}
+	existing := map[uuid.UUID]*database.TeamSeat{
+		manual.ID: {TeamID: manual.ID, RoomID: 1, Seat: 1, Manual: true},
+	}
+
+	seats, unassigned := assignSeats(teams, rooms, existing, SchoolSeatingApart)
+	require.Len(t, seats, 2)
+	assert.Equal(t, accessible.ID, seats[0].TeamID)
+	assert.Equal(t, int64(2), seats[0].RoomID)
+	assert.Equal(t, other.ID, seats[1].TeamID)
+	assert.Equal(t, int64(1), seats[1].RoomID)
+	assert.Equal(t, 2, seats[1].Seat)
+	require.Len(t, unassigned, 1)
+	assert.Equal(t, overflow.ID, unassigned[0].ID)
+}
+
+func TestAdminRooms(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teamID, _ := addTestStudent(t, a, "student@example.com", 16)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assertRedirectsTo(t, post("/admin/rooms/add", url.Values{"name": {"CTLM 102"}, "seats": {"2"}}), "/admin/rooms")
+	rec := post("/admin/rooms/add", url.Values{"name": {"CTLM 102"}, "seats": {"0"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+	rooms, err := a.DB.GetRooms(ctx)
+	require.NoError(t, err)
+	require.Len(t, rooms, 1)
+
+	rec = post("/admin/rooms/assign", url.Values{"school_seating": {"apart"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "message=")
+	seat, err := a.DB.GetTeamSeat(ctx, teamID)
+	require.NoError(t, err)
+	require.NotNil(t, seat)
+	assert.Equal(t, "CTLM 102", seat.RoomName)
+	assert.Equal(t, 1, seat.Seat)
+	assert.False(t, seat.Manual)
+
+	// Another team cannot be put in a seat that is already taken.
+	otherTeamID := uuid.New()
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", otherTeamID, "Other", database.DivisionAdvanced, true, "", ""))
+	roomID := strconv.FormatInt(rooms[0].ID, 10)
+	rec = post("/admin/rooms/seat", url.Values{"team_id": {otherTeamID.String()}, "room_id": {roomID}, "seat": {"1"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+	assertRedirectsTo(t, post("/admin/rooms/seat", url.Values{"team_id": {otherTeamID.String()}, "room_id": {roomID}, "seat": {"2"}}), "/admin/rooms")
+	seat, err = a.DB.GetTeamSeat(ctx, otherTeamID)
+	require.NoError(t, err)
+	require.NotNil(t, seat)
+	assert.True(t, seat.Manual)
+
+	// Shrinking the room unassigns the team in the seat that was removed.
+	assertRedirectsTo(t, post("/admin/rooms/update", url.Values{"id": {roomID}, "name": {"CTLM 102"}, "seats": {"1"}}), "/admin/rooms")
+	seat, err = a.DB.GetTeamSeat(ctx, otherTeamID)
+	require.NoError(t, err)
+	assert.Nil(t, seat)
+
+	rec = doRequest(router, http.MethodGet, "/admin/rooms", cookie)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "CTLM 102")
+}
@@ -8,12 +8,14 @@ import (
 	"net/http"
 	"strings"
 	texttemplate "text/template"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 
 	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
 )
 
 func (a *Application) getStudentByToken(ctx context.Context, tokenStr string) (*database.Student, error) {
@@ -60,18 +62,39 @@ func (a *Application) GetStudentConfirmInfoTemplate(r *http.Request) map[string]
 		return nil
 	}
 
-	return map[string]any{
+	data := map[string]any{
 		"Confirmed": student.EmailConfirmed,
 		"Student":   student,
 		"Team":      team,
 		"Token":     tok,
+		"Language":  studentLanguage(r, student),
 	}
+	if team.InPerson {
+		data["DietaryOptions"] = a.getDietaryOptions(ctx, student.DietaryCategories)
+		a.setStudentTourData(ctx, data, student)
+	}
+	if a.collectingEmergencyInfo(team) {
+		data["CollectEmergencyInfo"] = true
+		data["EmergencyInfo"] = a.getStudentEmergencyInfo(ctx, student)
+	}
+	return data
+}
+
+// studentLanguage returns the language that the student's emails are sent in.
+// Until the student chooses one, the language that they are viewing the page
+// in is suggested unless their teacher already chose one.
+func studentLanguage(r *http.Request, student *database.Student) i18n.Locale {
+	if locale, ok := i18n.Parse(student.Language); ok && (student.EmailConfirmed || locale != i18n.Default) {
+		return locale
+	}
+	return requestLocale(r)
 }
 
-func (a *Application) getParentSignFormsLink(email string) (string, error) {
+func (a *Application) getParentSignFormsLink(student *database.Student) (string, error) {
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
 		Issuer:  string(IssuerSignForms),
-		Subject: email,
+		Subject: student.Email,
+		ID:      student.SignFormsNonce,
 	})
 	signedTok, err := tok.SignedString(a.Config.ReadSecretKey())
 	if err != nil {
@@ -81,30 +104,38 @@ func (a *Application) getParentSignFormsLink(email string) (string, error) {
 	return fmt.Sprintf("%s/register/parent/signforms?tok=%s", a.Config.Domain, signedTok), nil
 }
 
-func (a *Application) sendParentEmail(ctx context.Context, student *database.Student, isReminder bool) error {
-	log := zerolog.Ctx(ctx).With().Str("action", "sendParentEmail").Logger()
-	toAddress := student.ParentEmail
+// parentFormsRecipient returns the address that the forms are sent to. Adult
+// students sign their own forms.
+func parentFormsRecipient(student *database.Student) string {
 	if student.Age >= 18 {
-		toAddress = student.Email
+		return student.Email
 	}
+	return student.ParentEmail
+}
+
+func (a *Application) sendParentEmail(ctx context.Context, student *database.Student, isReminder bool) error {
+	log := zerolog.Ctx(ctx).With().Str("action", "sendParentEmail").Logger()
+	toAddress := parentFormsRecipient(student)
+	locale := i18n.ParseOrDefault(student.Language)
 
-	signURL, err := a.getParentSignFormsLink(student.Email)
+	signURL, err := a.getParentSignFormsLink(student)
 	if err != nil {
 		log.Err(err).Msg("failed to sign email login token")
 		return err
 	}
 	templateData := map[string]any{
+		"Locale":  locale,
 		"Student": student,
-		"SignURL": signURL,
+		"SignURL": withLocaleParam(signURL, locale),
 	}
 
 	var plainTextContent, htmlContent strings.Builder
-	texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/forms.txt")).Execute(&plainTextContent, templateData)
-	htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/forms.html")).Execute(&htmlContent, templateData)
+	texttemplate.Must(texttemplate.New("forms.txt").Funcs(i18n.FuncMap).ParseFS(emailTemplates, "emailtemplates/forms.txt")).Execute(&plainTextContent, templateData)
+	htmltemplate.Must(htmltemplate.New("forms.html").Funcs(i18n.FuncMap).ParseFS(emailTemplates, "emailtemplates/forms.html")).Execute(&htmlContent, templateData)
 
-	subject := "Sign forms to participate in Mines HSPC"
+	subject := i18n.T(locale, "email.forms.subject")
 	if isReminder {
-		subject = fmt.Sprintf("REMINDER: %s", subject)
+		subject = i18n.T(locale, "email.reminder", subject)
 	}
 
 	err = a.SendEmail(log, subject,
@@ -149,6 +180,7 @@ func (a *Application) HandleStudentConfirmEmail(w http.ResponseWriter, r *http.R
 
 	log.Info().Any("student", student).Msg("confirming email")
 
+	newlyConfirmed := !student.EmailConfirmed
 	if !student.EmailConfirmed {
 		if r.Form.Has("confirm-info-correct") {
 			student.EmailConfirmed = true
@@ -173,8 +205,48 @@ func (a *Application) HandleStudentConfirmEmail(w http.ResponseWriter, r *http.R
 	log.Info().Any("send_email", sendEmail).Any("student", student).Msg("done confirming")
 
 	if team.InPerson {
-		student.CampusTour = r.Form.Has("campus-tour")
+		tourGroups, err := a.DB.GetTourGroups(ctx)
+		if err != nil {
+			log.Err(err).Msg("failed to get tour groups")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(tourGroups) == 0 {
+			student.CampusTour = r.Form.Has("campus-tour")
+		} else {
+			var preferredGroupID int64
+			var ok bool
+			student.CampusTour, preferredGroupID, ok = parseTourChoice(r.FormValue("campus-tour"), tourGroups)
+			if !ok {
+				log.Warn().Str("campus_tour", r.FormValue("campus-tour")).Msg("invalid tour group")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := a.saveStudentTourChoice(ctx, student.Email, student.CampusTour, preferredGroupID); err != nil {
+				log.Err(err).Msg("failed to save tour choice")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
 		student.DietaryRestrictions = r.FormValue("dietary-restrictions")
+		if student.DietaryCategories, _, err = a.parseDietaryForm(r); err != nil {
+			log.Err(err).Msg("failed to parse dietary categories")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err = a.DB.SetStudentDietaryCategories(ctx, student.Email, student.DietaryCategories); err != nil {
+			log.Err(err).Msg("failed to set dietary categories")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if a.collectingEmergencyInfo(team) {
+		if err := a.saveEmergencyInfo(ctx, parseEmergencyInfoForm(r, student.Email)); err != nil {
+			log.Err(err).Msg("failed to save emergency info")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 	}
 
 	if err = a.DB.ConfirmStudent(ctx, student.Email, student.CampusTour, student.DietaryRestrictions, student.ParentEmail); err != nil {
@@ -183,20 +255,44 @@ func (a *Application) HandleStudentConfirmEmail(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if locale, ok := i18n.Parse(r.FormValue("language")); ok && string(locale) != student.Language {
+		if err := a.DB.SetStudentLanguage(ctx, student.Email, string(locale)); err != nil {
+			log.Err(err).Msg("failed to set student language")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		student.Language = string(locale)
+	}
+
 	log.Info().Any("s", student).Msg("student confirmed")
+	if newlyConfirmed {
+		a.publishStudentEvent(ctx, LiveEventConfirmed, student.Email, time.Now(), "")
+	}
 
 	if sendEmail {
-		if err := a.sendParentEmail(ctx, student, false); err != nil {
+		err := a.sendParentEmail(ctx, student, false)
+		a.recordParentFormsSend(ctx, team.TeacherEmail, student, database.EmailSourceStudent, false, err)
+		if err != nil {
 			log.Err(err).Msg("failed to send email")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
 
-	a.StudentConfirmInfoRenderer(w, r, map[string]any{
+	data := map[string]any{
 		"Confirmed": student.EmailConfirmed,
 		"Student":   student,
 		"Team":      team,
 		"Token":     tok,
-	})
+		"Language":  studentLanguage(r, student),
+	}
+	if team.InPerson {
+		data["DietaryOptions"] = a.getDietaryOptions(ctx, student.DietaryCategories)
+		a.setStudentTourData(ctx, data, student)
+	}
+	if a.collectingEmergencyInfo(team) {
+		data["CollectEmergencyInfo"] = true
+		data["EmergencyInfo"] = a.getStudentEmergencyInfo(ctx, student)
+	}
+	a.StudentConfirmInfoRenderer(w, r, data)
 }
@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
+)
+
+func (a *Application) GetStudentProfileTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	tok := r.URL.Query().Get("tok")
+	student, err := a.getStudentByToken(ctx, tok)
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to get student from token")
+		return nil
+	}
+
+	team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get student's team")
+		return nil
+	}
+
+	return map[string]any{
+		"Student":  student,
+		"Team":     team,
+		"Token":    tok,
+		"Language": studentLanguage(r, student),
+	}
+}
+
+func (a *Application) sendStudentWithdrawnEmail(ctx context.Context, teacher *database.Teacher, student *database.Student, team *database.Team) error {
+	log := zerolog.Ctx(ctx).With().Str("action", "sendStudentWithdrawnEmail").Logger()
+
+	templateData := map[string]any{
+		"TeacherName":  teacher.Name,
+		"StudentName":  student.Name,
+		"StudentEmail": student.Email,
+		"TeamName":     team.Name,
+		"TeamURL":      fmt.Sprintf("%s/register/teacher/team/edit?team_id=%s", a.Config.Domain, team.ID),
+	}
+
+	var plainTextContent, htmlContent strings.Builder
+	texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/studentwithdrawn.txt")).Execute(&plainTextContent, templateData)
+	htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/studentwithdrawn.html")).Execute(&htmlContent, templateData)
+
+	err := a.SendEmail(log, fmt.Sprintf("%s has withdrawn from %s", student.Name, team.Name),
+		mail.NewEmail(teacher.Name, teacher.Email),
+		plainTextContent.String(),
+		htmlContent.String())
+	if err != nil {
+		log.Err(err).Msg("failed to send email")
+		return err
+	}
+	log.Info().Msg("sent email")
+	return nil
+}
+
+func (a *Application) HandleStudentProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "student_profile").Logger()
+	tok := r.URL.Query().Get("tok")
+	student, err := a.getStudentByToken(ctx, tok)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get student from token")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log = log.With().Str("student_email", student.Email).Logger()
+
+	if !student.EmailConfirmed {
+		http.Redirect(w, r, "/register/student/confirminfo?tok="+tok, http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("student-name"))
+	if name == "" {
+		a.StudentProfileRenderer(w, r, map[string]any{
+			"Error": i18n.T(requestLocale(r), "profile.error_name"),
+		})
+		return
+	}
+
+	parentEmailChanged := false
+	parentEmail := strings.TrimSpace(r.FormValue("parent-email"))
+	if student.Age < 18 && !student.LiabilitySigned && parentEmail != student.ParentEmail {
+		if !a.EmailRegex.MatchString(parentEmail) {
+			a.StudentProfileRenderer(w, r, map[string]any{
+				"Error": i18n.T(requestLocale(r), "profile.error_parent_email"),
+			})
+			return
+		} else if strings.EqualFold(parentEmail, student.Email) {
+			a.StudentProfileRenderer(w, r, map[string]any{
+				"Error": i18n.T(requestLocale(r), "profile.error_parent_email_same"),
+			})
+			return
+		}
+		parentEmailChanged = true
+	}
+
+	if name != student.Name {
+		log.Info().Str("old_name", student.Name).Str("new_name", name).Msg("updating student name")
+		if err := a.DB.UpdateStudentName(ctx, student.Email, name); err != nil {
+			log.Err(err).Msg("failed to update student name")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		student.Name = name
+	}
+
+	if locale, ok := i18n.Parse(r.FormValue("language")); ok && string(locale) != student.Language {
+		log.Info().Str("language", string(locale)).Msg("updating student language")
+		if err := a.DB.SetStudentLanguage(ctx, student.Email, string(locale)); err != nil {
+			log.Err(err).Msg("failed to update student language")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		student.Language = string(locale)
+	}
+
+	if parentEmailChanged {
+		team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+		if err != nil {
+			log.Err(err).Msg("failed to get student's team")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		log.Info().Str("parent_email", parentEmail).Msg("updating parent email")
+		student.ParentEmail = parentEmail
+		student.SignFormsNonce = uuid.New().String()
+		if err := a.DB.SetStudentParentEmail(ctx, student.Email, student.ParentEmail, student.SignFormsNonce); err != nil {
+			log.Err(err).Msg("failed to update parent email")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ctx := log.WithContext(ctx)
+		err = a.sendParentEmail(ctx, student, false)
+		a.recordParentFormsSend(ctx, team.TeacherEmail, student, database.EmailSourceStudent, false, err)
+		if err != nil {
+			log.Err(err).Msg("failed to send parent email")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	a.StudentProfileRenderer(w, r, map[string]any{
+		"Saved":              true,
+		"ParentEmailChanged": parentEmailChanged,
+	})
+}
+
+func (a *Application) HandleStudentWithdraw(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "student_withdraw").Logger()
+	tok := r.URL.Query().Get("tok")
+	student, err := a.getStudentByToken(ctx, tok)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get student from token")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	log = log.With().Str("student_email", student.Email).Logger()
+
+	if err := r.ParseForm(); err != nil {
+		log.Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !r.Form.Has("confirm-withdraw") {
+		a.StudentProfileRenderer(w, r, map[string]any{
+			"Error": i18n.T(requestLocale(r), "profile.error_withdraw_confirm"),
+		})
+		return
+	}
+
+	team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+	if err != nil {
+		log.Err(err).Msg("failed to get student's team")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	teacher, err := a.DB.GetTeacherForTeam(ctx, student.TeamID)
+	if err != nil {
+		log.Err(err).Msg("failed to get student's teacher")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("team_id", team.ID.String()).Msg("student withdrawing")
+	if err := a.DB.WithdrawStudent(ctx, student.Email); err != nil {
+		log.Err(err).Msg("failed to withdraw student")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The student is already withdrawn at this point, so don't show them an
+	// error for a failed refund or notification.
+	ctx = log.WithContext(ctx)
+	if err := a.refundEmailSends(ctx, teacher.Email, []database.Student{*student}); err != nil {
+		log.Err(err).Msg("failed to refund email sends")
+	}
+	if err := a.sendStudentWithdrawnEmail(ctx, teacher, student, team); err != nil {
+		log.Err(err).Msg("failed to notify teacher of withdrawal")
+	}
+	if err := a.sendWithdrawalNoticeEmail(ctx, student, team, teacher.Name, WithdrawalReasonSelf); err != nil {
+		log.Err(err).Msg("failed to send withdrawal notice")
+	}
+
+	a.StudentProfileRenderer(w, r, map[string]any{
+		"Withdrawn": true,
+		"Student":   nil,
+	})
+}
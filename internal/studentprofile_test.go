@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func addTestStudent(t *testing.T, a *Application, studentEmail string, age int) (uuid.UUID, *database.Student) {
+	t.Helper()
+	ctx := context.Background()
+	teamID := uuid.New()
+	require.NoError(t, a.DB.NewTeacher(ctx, "Teacher", "teacher@example.com"))
+	require.NoError(t, a.DB.SetTeacherSchoolInfo(ctx, "teacher@example.com", "School", "Golden", "CO"))
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", teamID, "Team", database.DivisionBeginner, true, "", ""))
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Student", age, studentEmail, false))
+	student, err := a.DB.GetStudentByEmail(ctx, studentEmail)
+	require.NoError(t, err)
+	return teamID, student
+}
+
+func signFormsToken(t *testing.T, a *Application, student *database.Student) string {
+	t.Helper()
+	link, err := a.getParentSignFormsLink(student)
+	require.NoError(t, err)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.Query().Get("tok")
+}
+
+func TestSignFormsToken_SupersededByParentEmailChange(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	_, student := addTestStudent(t, a, "student@example.com", 16)
+
+	oldTok := signFormsToken(t, a, student)
+	_, err := a.getStudentBySignFormsToken(ctx, oldTok)
+	require.NoError(t, err)
+
+	student.SignFormsNonce = uuid.New().String()
+	require.NoError(t, a.DB.SetStudentParentEmail(ctx, student.Email, "new-parent@example.com", student.SignFormsNonce))
+
+	_, err = a.getStudentBySignFormsToken(ctx, oldTok)
+	assert.Error(t, err)
+
+	got, err := a.getStudentBySignFormsToken(ctx, signFormsToken(t, a, student))
+	require.NoError(t, err)
+	assert.Equal(t, "new-parent@example.com", got.ParentEmail)
+}
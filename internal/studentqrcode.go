@@ -13,15 +13,22 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
 )
 
-func (a *Application) getStudentQRCodeURL(email string) (string, error) {
+// getStudentQRToken returns the token in the student's ticket. The token is
+// deterministic, so it can be regenerated for the offline check-in roster.
+func (a *Application) getStudentQRToken(email string) (string, error) {
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
 		Issuer:  string(IssuerStudentQRCode),
 		Subject: email,
 	})
+	return tok.SignedString(a.Config.ReadSecretKey())
+}
 
-	signedTok, err := tok.SignedString(a.Config.ReadSecretKey())
+func (a *Application) getStudentQRCodeURL(email string) (string, error) {
+	signedTok, err := a.getStudentQRToken(email)
 	if err != nil {
 		return "", err
 	}
@@ -36,7 +43,24 @@ func (a *Application) getStudentQRCodeImage(email string) ([]byte, error) {
 	return qrcode.Encode(url, qrcode.Medium, 256)
 }
 
-func (a *Application) sendQRCodeEmail(ctx context.Context, studentName, email string) error {
+// sendQRCodeEmail sends the student their ticket, along with where their team
+// is seated if it has been assigned a seat.
+func (a *Application) sendQRCodeEmail(ctx context.Context, studentName, email string, seat *database.TeamSeat) error {
+	qrcodeBytes, err := a.getStudentQRCodeImage(email)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get student QR code image")
+		return err
+	}
+	return a.sendTicketEmail(ctx, email, "ticket", qrcodeBytes, map[string]any{
+		"StudentName": studentName,
+		"Seat":        seat,
+	})
+}
+
+// sendTicketEmail sends a ticket email using the text and HTML email templates
+// with the given name. The QR code is attached, and is also available to the
+// templates as QRCodeBase64.
+func (a *Application) sendTicketEmail(ctx context.Context, email, templateName string, qrcodeBytes []byte, templateData map[string]any) error {
 	subject := "Mines HSPC Ticket"
 	log := zerolog.Ctx(ctx).With().
 		Str("component", "send_email").
@@ -46,22 +70,13 @@ func (a *Application) sendQRCodeEmail(ctx context.Context, studentName, email st
 
 	log.Info().Msg("sending email")
 
-	qrcodeBytes, err := a.getStudentQRCodeImage(email)
-	if err != nil {
-		a.Log.Err(err).Msg("failed to get student QR code image")
-		return err
-	}
 	// Base64 encode the qrcodeBytes
 	qrcodeBase64 := base64.StdEncoding.EncodeToString(qrcodeBytes)
-
-	templateData := map[string]any{
-		"StudentName":  studentName,
-		"QRCodeBase64": qrcodeBase64,
-	}
+	templateData["QRCodeBase64"] = qrcodeBase64
 
 	var plainTextContent, htmlContent strings.Builder
-	texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/ticket.txt")).Execute(&plainTextContent, templateData)
-	htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/ticket.html")).Execute(&htmlContent, templateData)
+	texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/"+templateName+".txt")).Execute(&plainTextContent, templateData)
+	htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/"+templateName+".html")).Execute(&htmlContent, templateData)
 
 	from := mail.NewEmail("Mines HSPC Support", "support@mineshspc.com")
 	message := mail.NewSingleEmail(from, subject, mail.NewEmail("", email), plainTextContent.String(), htmlContent.String())
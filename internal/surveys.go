@@ -0,0 +1,769 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// surveyLinkLifetime is how long the emailed survey links work for.
+const surveyLinkLifetime = 60 * 24 * time.Hour
+
+const maxSurveyAnswerLength = 5000
+
+// The values that survey results can be broken down by.
+const (
+	surveyExperienceFirstTime = "First-time"
+	surveyExperienceReturning = "Returning"
+	surveyAttendanceInPerson  = "In-person"
+	surveyAttendanceRemote    = "Remote"
+	surveyGroupNotApplicable  = "Not applicable"
+)
+
+// surveyBreakdown is a way that the survey results can be broken down. Key is
+// the value of the by query parameter.
+type surveyBreakdown struct {
+	Key   string
+	Name  string
+	Value func(invitation *database.SurveyInvitation) string
+}
+
+var surveyBreakdowns = []surveyBreakdown{
+	{"role", "Role", func(i *database.SurveyInvitation) string { return string(i.Role) }},
+	{"division", "Division", func(i *database.SurveyInvitation) string { return string(i.Division) }},
+	{"experience", "First-time status", func(i *database.SurveyInvitation) string { return i.Experience }},
+	{"attendance", "In-person or remote", func(i *database.SurveyInvitation) string { return i.Attendance }},
+}
+
+// surveyClaims identify who a survey link was sent to.
+type surveyClaims struct {
+	jwt.RegisteredClaims
+	Role   database.SurveyRole `json:"role"`
+	Season int                 `json:"season"`
+}
+
+func (a *Application) getSurveyLink(invitation *database.SurveyInvitation) (string, error) {
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, &surveyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(IssuerSurvey),
+			Subject:   invitation.Email,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(surveyLinkLifetime)),
+		},
+		Role:   invitation.Role,
+		Season: invitation.Season,
+	})
+	signedTok, err := tok.SignedString(a.Config.ReadSecretKey())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/survey?tok=%s", a.Config.Domain, signedTok), nil
+}
+
+// getSurveyInvitationByToken returns the invitation that the survey link was
+// sent for.
+func (a *Application) getSurveyInvitationByToken(ctx context.Context, tokenStr string) (*database.SurveyInvitation, error) {
+	if tokenStr == "" {
+		return nil, errors.New("no token")
+	}
+	var claims surveyClaims
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return a.Config.ReadSecretKey(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse survey token: %w", err)
+	} else if !token.Valid {
+		return nil, errors.New("invalid survey token")
+	} else if claims.Issuer != string(IssuerSurvey) {
+		return nil, fmt.Errorf("wrong issuer: got %s, want %s", claims.Issuer, IssuerSurvey)
+	}
+
+	invitation, err := a.DB.GetSurveyInvitation(ctx, claims.Season, claims.Role, claims.Subject)
+	if err != nil {
+		return nil, err
+	} else if invitation == nil {
+		return nil, errors.New("survey invitation not found")
+	}
+	return invitation, nil
+}
+
+// getSurveyRecipients returns who the season's survey should be sent to.
+// In-person students are included if they checked in, and remote students are
+// included if they confirmed their registration. Teachers are included if any
+// of their students are, and volunteers are always included.
+//
+// A teacher's division and attendance are only set if all of their included
+// students have the same one, and they are a first-time teacher if all of
+// their included students are first-time students.
+func (a *Application) getSurveyRecipients(ctx context.Context, season int) ([]*database.SurveyInvitation, error) {
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams: %w", err)
+	}
+	checkedIn, err := a.DB.GetCheckedInStudentEmails(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checked in students: %w", err)
+	}
+	volunteers, err := a.DB.GetAllVolunteers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volunteers: %w", err)
+	}
+
+	var recipients []*database.SurveyInvitation
+	teachers := map[string]*database.SurveyInvitation{}
+	var teacherEmails []string
+	for _, team := range teams {
+		attendance := surveyAttendanceRemote
+		if team.InPerson {
+			attendance = surveyAttendanceInPerson
+		}
+		for _, member := range team.Members {
+			if (team.InPerson && !checkedIn[member.Email]) || (!team.InPerson && !member.EmailConfirmed) {
+				continue
+			}
+			experience := surveyExperienceFirstTime
+			if member.PreviouslyParticipated {
+				experience = surveyExperienceReturning
+			}
+			recipients = append(recipients, &database.SurveyInvitation{
+				Season:     season,
+				Role:       database.SurveyRoleStudent,
+				Email:      member.Email,
+				Name:       member.Name,
+				Division:   team.Division,
+				Experience: experience,
+				Attendance: attendance,
+			})
+
+			teacher, ok := teachers[team.TeacherEmail]
+			if !ok {
+				teacher = &database.SurveyInvitation{
+					Season:     season,
+					Role:       database.SurveyRoleTeacher,
+					Email:      team.TeacherEmail,
+					Name:       team.TeacherName,
+					Division:   team.Division,
+					Experience: experience,
+					Attendance: attendance,
+				}
+				teachers[team.TeacherEmail] = teacher
+				teacherEmails = append(teacherEmails, team.TeacherEmail)
+			}
+			if teacher.Division != team.Division {
+				teacher.Division = ""
+			}
+			if teacher.Attendance != attendance {
+				teacher.Attendance = ""
+			}
+			if experience == surveyExperienceReturning {
+				teacher.Experience = surveyExperienceReturning
+			}
+		}
+	}
+	for _, email := range teacherEmails {
+		recipients = append(recipients, teachers[email])
+	}
+	for _, email := range volunteers {
+		recipients = append(recipients, &database.SurveyInvitation{
+			Season: season,
+			Role:   database.SurveyRoleVolunteer,
+			Email:  email,
+			Name:   email,
+		})
+	}
+	return recipients, nil
+}
+
+// inviteSurveyRecipients records the invitations of the recipients with the
+// given roles and returns the ones that have not been sent, or all of them if
+// resend is true.
+func (a *Application) inviteSurveyRecipients(ctx context.Context, season int, roles []database.SurveyRole, resend bool) ([]*database.SurveyInvitation, error) {
+	recipients, err := a.getSurveyRecipients(ctx, season)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := a.DB.GetSurveyInvitations(ctx, season)
+	if err != nil {
+		return nil, err
+	}
+	sent := map[string]bool{}
+	for _, invitation := range invitations {
+		sent[string(invitation.Role)+"|"+invitation.Email] = !invitation.SentTS.IsZero()
+	}
+
+	var toSend []*database.SurveyInvitation
+	for _, recipient := range recipients {
+		if !slices.Contains(roles, recipient.Role) {
+			continue
+		}
+		if err := a.DB.UpsertSurveyInvitation(ctx, recipient); err != nil {
+			return nil, fmt.Errorf("failed to save survey invitation for %s: %w", recipient.Email, err)
+		}
+		if resend || !sent[string(recipient.Role)+"|"+recipient.Email] {
+			toSend = append(toSend, recipient)
+		}
+	}
+	return toSend, nil
+}
+
+// sendSurveyInvitations emails each recipient their survey link and returns
+// the number that were sent.
+func (a *Application) sendSurveyInvitations(ctx context.Context, invitations []*database.SurveyInvitation) int {
+	log := zerolog.Ctx(ctx).With().Str("action", "send_surveys").Logger()
+	var count int
+	for _, invitation := range invitations {
+		log := log.With().Str("email", invitation.Email).Str("role", string(invitation.Role)).Logger()
+		link, err := a.getSurveyLink(invitation)
+		if err != nil {
+			log.Err(err).Msg("failed to get survey link")
+			continue
+		}
+		templateData := map[string]any{
+			"Name":   invitation.Name,
+			"Role":   invitation.Role,
+			"Season": invitation.Season,
+			"Link":   link,
+		}
+		var plainTextContent, htmlContent strings.Builder
+		texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/survey.txt")).Execute(&plainTextContent, templateData)
+		htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/survey.html")).Execute(&htmlContent, templateData)
+
+		err = a.SendEmail(log, fmt.Sprintf("How was the %d Mines HSPC?", invitation.Season),
+			mail.NewEmail(invitation.Name, invitation.Email),
+			plainTextContent.String(),
+			htmlContent.String())
+		if err != nil {
+			continue
+		}
+		if err := a.DB.MarkSurveyInvitationSent(ctx, invitation.Season, invitation.Role, invitation.Email); err != nil {
+			log.Err(err).Msg("failed to mark survey invitation sent")
+		}
+		count++
+	}
+	return count
+}
+
+// surveyQuestionsForRole returns the questions that are asked of the role.
+func surveyQuestionsForRole(questions []*database.SurveyQuestion, role database.SurveyRole) []*database.SurveyQuestion {
+	return slices.DeleteFunc(slices.Clone(questions), func(q *database.SurveyQuestion) bool {
+		return !q.AsksRole(role)
+	})
+}
+
+// parseSurveyAnswers reads the answers to the questions from the form. Fields
+// are named q-<question ID>. Unanswered questions are left out.
+func parseSurveyAnswers(questions []*database.SurveyQuestion, form url.Values) (map[int64]string, error) {
+	answers := map[int64]string{}
+	for _, question := range questions {
+		value := strings.TrimSpace(form.Get(fmt.Sprintf("q-%d", question.ID)))
+		if value == "" {
+			if question.Required {
+				return nil, fmt.Errorf("Please answer %q.", question.Prompt)
+			}
+			continue
+		}
+		switch question.Kind {
+		case database.SurveyQuestionRating:
+			if rating, err := strconv.Atoi(value); err != nil || rating < 1 || rating > 5 {
+				return nil, fmt.Errorf("The answer to %q must be a rating from 1 to 5.", question.Prompt)
+			}
+		case database.SurveyQuestionChoice:
+			if !slices.Contains(question.Choices, value) {
+				return nil, fmt.Errorf("The answer to %q is not one of the choices.", question.Prompt)
+			}
+		case database.SurveyQuestionText:
+			if utf8.RuneCountInString(value) > maxSurveyAnswerLength {
+				return nil, fmt.Errorf("The answer to %q is too long.", question.Prompt)
+			}
+		}
+		answers[question.ID] = value
+	}
+	return answers, nil
+}
+
+func (a *Application) GetSurveyTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	tok := r.URL.Query().Get("tok")
+	invitation, err := a.getSurveyInvitationByToken(ctx, tok)
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to get survey invitation from token")
+		return map[string]any{"Invalid": true}
+	}
+	questions, err := a.DB.GetSurveyQuestions(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey questions")
+		return nil
+	}
+	response, err := a.DB.GetSurveyResponse(ctx, invitation.Season, invitation.Role, invitation.Email)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey response")
+		return nil
+	}
+	answers := map[int64]string{}
+	if response != nil {
+		answers = response.Answers
+	}
+	return map[string]any{
+		"Invitation": invitation,
+		"Questions":  surveyQuestionsForRole(questions, invitation.Role),
+		"Answers":    answers,
+		"Responded":  response != nil,
+		"Submitted":  r.URL.Query().Get("submitted") == "true",
+		"Token":      tok,
+		"Ratings":    []string{"1", "2", "3", "4", "5"},
+	}
+}
+
+// HandleSurvey saves the respondent's answers. Respondents can change their
+// answers by submitting the survey again.
+func (a *Application) HandleSurvey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "survey").Logger()
+	tok := r.URL.Query().Get("tok")
+	invitation, err := a.getSurveyInvitationByToken(ctx, tok)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get survey invitation from token")
+		a.SurveyRenderer(w, r, nil)
+		return
+	}
+	log = log.With().Str("email", invitation.Email).Str("role", string(invitation.Role)).Logger()
+	if err := r.ParseForm(); err != nil {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	questions, err := a.DB.GetSurveyQuestions(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get survey questions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	answers, err := parseSurveyAnswers(surveyQuestionsForRole(questions, invitation.Role), r.PostForm)
+	if err != nil {
+		// Show the survey again with what they entered so that nothing is
+		// lost.
+		entered := map[int64]string{}
+		for _, question := range questions {
+			entered[question.ID] = r.PostForm.Get(fmt.Sprintf("q-%d", question.ID))
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		a.SurveyRenderer(w, r, map[string]any{"Error": err.Error(), "Answers": entered})
+		return
+	}
+
+	err = a.DB.SaveSurveyResponse(ctx, &database.SurveyResponse{
+		Season:  invitation.Season,
+		Role:    invitation.Role,
+		Email:   invitation.Email,
+		Answers: answers,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to save survey response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int("answers", len(answers)).Msg("saved survey response")
+	http.Redirect(w, r, "/survey?"+url.Values{"tok": {tok}, "submitted": {"true"}}.Encode(), http.StatusSeeOther)
+}
+
+// surveyRoleSummary counts the recipients, invitations and responses of one
+// role.
+type surveyRoleSummary struct {
+	Role       database.SurveyRole
+	Recipients int
+	Sent       int
+	Responses  int
+}
+
+func (a *Application) GetAdminSurveysTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	season := currentSeason()
+	questions, err := a.DB.GetSurveyQuestions(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey questions")
+		return nil
+	}
+	recipients, err := a.getSurveyRecipients(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey recipients")
+		return nil
+	}
+	invitations, err := a.DB.GetSurveyInvitations(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey invitations")
+		return nil
+	}
+	responses, err := a.DB.GetSurveyResponses(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey responses")
+		return nil
+	}
+
+	summaries := make([]*surveyRoleSummary, len(database.SurveyRoles))
+	byRole := map[database.SurveyRole]*surveyRoleSummary{}
+	for i, role := range database.SurveyRoles {
+		summaries[i] = &surveyRoleSummary{Role: role}
+		byRole[role] = summaries[i]
+	}
+	for _, recipient := range recipients {
+		byRole[recipient.Role].Recipients++
+	}
+	for _, invitation := range invitations {
+		if summary, ok := byRole[invitation.Role]; ok && !invitation.SentTS.IsZero() {
+			summary.Sent++
+		}
+	}
+	for _, response := range responses {
+		if summary, ok := byRole[response.Role]; ok {
+			summary.Responses++
+		}
+	}
+
+	return map[string]any{
+		"Season":    season,
+		"Questions": questions,
+		"Kinds":     database.SurveyQuestionKinds,
+		"Roles":     database.SurveyRoles,
+		"Summaries": summaries,
+		"Error":     r.URL.Query().Get("error"),
+		"Message":   r.URL.Query().Get("message"),
+	}
+}
+
+func redirectToSurveys(w http.ResponseWriter, r *http.Request, key, message string) {
+	target := "/admin/surveys"
+	if message != "" {
+		target += "?" + url.Values{key: {message}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// parseSurveyQuestionForm reads a question from the add or update form. If
+// the form is invalid, the user is redirected with an error and ok is false.
+func parseSurveyQuestionForm(w http.ResponseWriter, r *http.Request) (question *database.SurveyQuestion, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	question = &database.SurveyQuestion{
+		Kind:     database.SurveyQuestionKind(r.FormValue("kind")),
+		Prompt:   strings.TrimSpace(r.FormValue("prompt")),
+		Required: r.FormValue("required") == "on",
+	}
+	if idStr := r.FormValue("id"); idStr != "" {
+		var err error
+		if question.ID, err = strconv.ParseInt(idStr, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	for _, choice := range strings.Split(r.FormValue("choices"), "\n") {
+		if choice = strings.TrimSpace(choice); choice != "" && !slices.Contains(question.Choices, choice) {
+			question.Choices = append(question.Choices, choice)
+		}
+	}
+	for _, role := range database.SurveyRoles {
+		if slices.Contains(r.Form["role"], string(role)) {
+			question.Roles = append(question.Roles, role)
+		}
+	}
+
+	var invalid string
+	switch {
+	case question.Prompt == "":
+		invalid = "The question is required."
+	case !slices.Contains(database.SurveyQuestionKinds, question.Kind):
+		invalid = "Choose the type of question."
+	case len(question.Roles) == 0:
+		invalid = "Choose who is asked the question."
+	case question.Kind == database.SurveyQuestionChoice && len(question.Choices) < 2:
+		invalid = "Multiple choice questions need at least two choices, one per line."
+	}
+	if invalid != "" {
+		redirectToSurveys(w, r, "error", invalid)
+		return nil, false
+	}
+	if question.Kind != database.SurveyQuestionChoice {
+		question.Choices = nil
+	}
+	return question, true
+}
+
+func (a *Application) HandleAdminAddSurveyQuestion(w http.ResponseWriter, r *http.Request) {
+	question, ok := parseSurveyQuestionForm(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.AddSurveyQuestion(r.Context(), question); err != nil {
+		a.Log.Err(err).Msg("failed to add survey question")
+		redirectToSurveys(w, r, "error", "Failed to add the question.")
+		return
+	}
+	redirectToSurveys(w, r, "", "")
+}
+
+func (a *Application) HandleAdminUpdateSurveyQuestion(w http.ResponseWriter, r *http.Request) {
+	question, ok := parseSurveyQuestionForm(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.UpdateSurveyQuestion(r.Context(), question); err != nil {
+		a.Log.Err(err).Int64("question_id", question.ID).Msg("failed to update survey question")
+		redirectToSurveys(w, r, "error", "Failed to update the question.")
+		return
+	}
+	redirectToSurveys(w, r, "message", "Saved the question.")
+}
+
+func parseSurveyQuestionID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (a *Application) HandleAdminMoveSurveyQuestion(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSurveyQuestionID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.MoveSurveyQuestion(r.Context(), id, r.FormValue("direction") == "up"); err != nil {
+		a.Log.Err(err).Int64("question_id", id).Msg("failed to move survey question")
+		redirectToSurveys(w, r, "error", "Failed to move the question.")
+		return
+	}
+	redirectToSurveys(w, r, "", "")
+}
+
+func (a *Application) HandleAdminDeleteSurveyQuestion(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseSurveyQuestionID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.DB.DeleteSurveyQuestion(r.Context(), id); err != nil {
+		a.Log.Err(err).Int64("question_id", id).Msg("failed to delete survey question")
+		redirectToSurveys(w, r, "error", "Failed to delete the question.")
+		return
+	}
+	a.Log.Info().Int64("question_id", id).Msg("deleted survey question")
+	redirectToSurveys(w, r, "", "")
+}
+
+// HandleAdminSendSurveys emails the survey links in the background to the
+// chosen roles.
+func (a *Application) HandleAdminSendSurveys(w http.ResponseWriter, r *http.Request) {
+	log := hlog.FromRequest(r).With().Str("action", "send_surveys").Logger()
+	if err := r.ParseForm(); err != nil {
+		log.Warn().Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var roles []database.SurveyRole
+	for _, role := range database.SurveyRoles {
+		if slices.Contains(r.Form["role"], string(role)) {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		redirectToSurveys(w, r, "error", "Choose who to send the survey to.")
+		return
+	}
+
+	if !a.sendingSurveys.CompareAndSwap(false, true) {
+		redirectToSurveys(w, r, "error", "The survey is already being sent. Please wait for that to finish.")
+		return
+	}
+	sending := false
+	defer func() {
+		if !sending {
+			a.sendingSurveys.Store(false)
+		}
+	}()
+
+	invitations, err := a.inviteSurveyRecipients(r.Context(), currentSeason(), roles, r.FormValue("resend") == "on")
+	if err != nil {
+		log.Err(err).Msg("failed to invite survey recipients")
+		redirectToSurveys(w, r, "error", "Failed to get the survey recipients.")
+		return
+	} else if len(invitations) == 0 {
+		redirectToSurveys(w, r, "message", "There is nobody to send the survey to.")
+		return
+	}
+
+	sending = true
+	go func() {
+		defer a.sendingSurveys.Store(false)
+		ctx := log.WithContext(context.Background())
+		sent := a.sendSurveyInvitations(ctx, invitations)
+		log.Info().Int("sent", sent).Int("total", len(invitations)).Msg("finished sending surveys")
+	}()
+	redirectToSurveys(w, r, "message", fmt.Sprintf("Sending the survey to %d people.", len(invitations)))
+}
+
+// surveyResultGroup is the answers to a question from one group of
+// respondents.
+type surveyResultGroup struct {
+	Name      string
+	Responses int
+	// Counts are the number of each answer to rating and multiple choice
+	// questions, in the order of the question's options.
+	Counts  []int
+	Average float64
+	// Answers are the answers to free text questions.
+	Answers []string
+}
+
+// Percent returns the percentage of the group's responses with the option.
+func (g *surveyResultGroup) Percent(option int) int {
+	if g.Responses == 0 {
+		return 0
+	}
+	return g.Counts[option] * 100 / g.Responses
+}
+
+type surveyQuestionResult struct {
+	Question *database.SurveyQuestion
+	// Options are the possible answers to rating and multiple choice
+	// questions.
+	Options []string
+	Total   *surveyResultGroup
+	Groups  []*surveyResultGroup
+}
+
+// computeSurveyResults aggregates the answers to each question overall and for
+// each group of respondents. The group of a response is found with groupOf,
+// and responses without an invitation are only counted in the total.
+func computeSurveyResults(questions []*database.SurveyQuestion, invitations []*database.SurveyInvitation, responses []*database.SurveyResponse, groupOf func(*database.SurveyInvitation) string) []*surveyQuestionResult {
+	invitationsByKey := map[string]*database.SurveyInvitation{}
+	for _, invitation := range invitations {
+		invitationsByKey[string(invitation.Role)+"|"+invitation.Email] = invitation
+	}
+
+	var results []*surveyQuestionResult
+	for _, question := range questions {
+		result := &surveyQuestionResult{Question: question}
+		switch question.Kind {
+		case database.SurveyQuestionRating:
+			result.Options = []string{"1", "2", "3", "4", "5"}
+		case database.SurveyQuestionChoice:
+			result.Options = question.Choices
+		}
+		newGroup := func(name string) *surveyResultGroup {
+			return &surveyResultGroup{Name: name, Counts: make([]int, len(result.Options))}
+		}
+		result.Total = newGroup("All")
+		groups := map[string]*surveyResultGroup{}
+		for _, response := range responses {
+			value, ok := response.Answers[question.ID]
+			if !ok {
+				continue
+			}
+			add := []*surveyResultGroup{result.Total}
+			if invitation := invitationsByKey[string(response.Role)+"|"+response.Email]; invitation != nil {
+				name := groupOf(invitation)
+				if name == "" {
+					name = surveyGroupNotApplicable
+				}
+				if groups[name] == nil {
+					groups[name] = newGroup(name)
+					result.Groups = append(result.Groups, groups[name])
+				}
+				add = append(add, groups[name])
+			}
+			for _, group := range add {
+				group.Responses++
+				if i := slices.Index(result.Options, value); i >= 0 {
+					group.Counts[i]++
+				} else if question.Kind == database.SurveyQuestionText {
+					group.Answers = append(group.Answers, value)
+				}
+			}
+		}
+		if question.Kind == database.SurveyQuestionRating {
+			for _, group := range append(result.Groups, result.Total) {
+				var sum int
+				for i, count := range group.Counts {
+					sum += (i + 1) * count
+				}
+				if group.Responses > 0 {
+					group.Average = float64(sum) / float64(group.Responses)
+				}
+			}
+		}
+		slices.SortFunc(result.Groups, func(a, b *surveyResultGroup) int {
+			return cmp.Or(
+				cmp.Compare(boolToInt(a.Name == surveyGroupNotApplicable), boolToInt(b.Name == surveyGroupNotApplicable)),
+				cmp.Compare(a.Name, b.Name),
+			)
+		})
+		results = append(results, result)
+	}
+	return results
+}
+
+func (a *Application) GetAdminSurveyResultsTemplate(r *http.Request) map[string]any {
+	ctx := r.Context()
+	season := currentSeason()
+	if seasonStr := r.URL.Query().Get("season"); seasonStr != "" {
+		var err error
+		if season, err = strconv.Atoi(seasonStr); err != nil {
+			return map[string]any{"Error": "Invalid season."}
+		}
+	}
+	by := r.URL.Query().Get("by")
+	i := slices.IndexFunc(surveyBreakdowns, func(b surveyBreakdown) bool { return b.Key == by })
+	if i < 0 {
+		i = 0
+	}
+	breakdown := surveyBreakdowns[i]
+
+	questions, err := a.DB.GetSurveyQuestions(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey questions")
+		return nil
+	}
+	invitations, err := a.DB.GetSurveyInvitations(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey invitations")
+		return nil
+	}
+	responses, err := a.DB.GetSurveyResponses(ctx, season)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get survey responses")
+		return nil
+	}
+	return map[string]any{
+		"Season":     season,
+		"By":         breakdown.Key,
+		"ByName":     breakdown.Name,
+		"Breakdowns": surveyBreakdowns,
+		"Responses":  len(responses),
+		"Results":    computeSurveyResults(questions, invitations, responses, breakdown.Value),
+	}
+}
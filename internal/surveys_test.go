@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func addTestSurveyQuestions(t *testing.T, a *Application) (rating, choice, text *database.SurveyQuestion) {
+	t.Helper()
+	ctx := context.Background()
+	rating = &database.SurveyQuestion{Kind: database.SurveyQuestionRating, Prompt: "How was it?", Roles: database.SurveyRoles, Required: true}
+	choice = &database.SurveyQuestion{Kind: database.SurveyQuestionChoice, Prompt: "Favorite part?", Choices: []string{"Problems", "Food"}, Roles: []database.SurveyRole{database.SurveyRoleStudent}}
+	text = &database.SurveyQuestion{Kind: database.SurveyQuestionText, Prompt: "Anything else?", Roles: database.SurveyRoles}
+	for _, question := range []*database.SurveyQuestion{rating, choice, text} {
+		require.NoError(t, a.DB.AddSurveyQuestion(ctx, question))
+	}
+	return
+}
+
+func TestSurveyRecipients(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestResultsTeams(t, a)
+	require.NoError(t, a.DB.AddVolunteer(ctx, "volunteer@example.com"))
+	// Code Rats is in-person and checked in, Lobos 3 is remote and confirmed,
+	// and Cool Cats is in-person but never checked in.
+	_, err := a.DB.CheckInStudent(ctx, "studenta@example.com", time.Now(), "volunteer@example.com", "")
+	require.NoError(t, err)
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "studentb@example.com", false, "", "parent@example.com"))
+
+	recipients, err := a.getSurveyRecipients(ctx, 2026)
+	require.NoError(t, err)
+	byEmail := map[string]*database.SurveyInvitation{}
+	for _, recipient := range recipients {
+		byEmail[recipient.Email] = recipient
+	}
+	require.Len(t, byEmail, 4)
+	assert.NotContains(t, byEmail, "studentc@example.com")
+	assert.Equal(t, database.DivisionAdvanced, byEmail["studenta@example.com"].Division)
+	assert.Equal(t, surveyExperienceReturning, byEmail["studenta@example.com"].Experience)
+	assert.Equal(t, surveyAttendanceRemote, byEmail["studentb@example.com"].Attendance)
+	assert.Equal(t, surveyExperienceFirstTime, byEmail["studentb@example.com"].Experience)
+
+	teacher := byEmail["teacher@example.com"]
+	assert.Equal(t, database.SurveyRoleTeacher, teacher.Role)
+	assert.Empty(t, teacher.Division, "the teacher's students are in different divisions")
+	assert.Empty(t, teacher.Attendance)
+	assert.Equal(t, surveyExperienceReturning, teacher.Experience)
+	assert.Equal(t, database.SurveyRoleVolunteer, byEmail["volunteer@example.com"].Role)
+
+	toSend, err := a.inviteSurveyRecipients(ctx, 2026, []database.SurveyRole{database.SurveyRoleStudent}, false)
+	require.NoError(t, err)
+	assert.Len(t, toSend, 2)
+	a.Config.DevMode = true
+	assert.Equal(t, 2, a.sendSurveyInvitations(ctx, toSend))
+	toSend, err = a.inviteSurveyRecipients(ctx, 2026, []database.SurveyRole{database.SurveyRoleStudent}, false)
+	require.NoError(t, err)
+	assert.Empty(t, toSend, "students are only emailed once")
+}
+
+func TestSurvey(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	rating, choice, text := addTestSurveyQuestions(t, a)
+	invitation := &database.SurveyInvitation{Season: 2026, Role: database.SurveyRoleTeacher, Email: "teacher@example.com", Name: "Teacher"}
+	require.NoError(t, a.DB.UpsertSurveyInvitation(ctx, invitation))
+	link, err := a.getSurveyLink(invitation)
+	require.NoError(t, err)
+	path := strings.TrimPrefix(link, a.Config.Domain)
+
+	rec := doRequest(router, http.MethodGet, path)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), rating.Prompt)
+	assert.NotContains(t, rec.Body.String(), choice.Prompt, "the choice question is only for students")
+	rec = doRequest(router, http.MethodGet, "/survey?tok=bad")
+	assert.Contains(t, rec.Body.String(), "Invalid survey link")
+
+	submit := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = submit(url.Values{fmt.Sprintf("q-%d", text.ID): {"Great!"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the rating is required")
+	assert.Contains(t, rec.Body.String(), "Great!", "answers are kept when there is an error")
+	rec = submit(url.Values{fmt.Sprintf("q-%d", rating.ID): {"6"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = submit(url.Values{fmt.Sprintf("q-%d", rating.ID): {"4"}, fmt.Sprintf("q-%d", text.ID): {"Great!"}})
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = submit(url.Values{fmt.Sprintf("q-%d", rating.ID): {"5"}})
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	response, err := a.DB.GetSurveyResponse(ctx, 2026, database.SurveyRoleTeacher, "teacher@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.Equal(t, map[int64]string{rating.ID: "5"}, response.Answers, "submitting again replaces the answers")
+
+	// Links for people that were never invited don't work.
+	link, err = a.getSurveyLink(&database.SurveyInvitation{Season: 2026, Role: database.SurveyRoleStudent, Email: "teacher@example.com"})
+	require.NoError(t, err)
+	_, err = a.getSurveyInvitationByToken(ctx, strings.TrimPrefix(link, a.Config.Domain+"/survey?tok="))
+	assert.Error(t, err)
+}
+
+func TestComputeSurveyResults(t *testing.T) {
+	rating := &database.SurveyQuestion{ID: 1, Kind: database.SurveyQuestionRating}
+	choice := &database.SurveyQuestion{ID: 2, Kind: database.SurveyQuestionChoice, Choices: []string{"Yes", "No"}}
+	invitations := []*database.SurveyInvitation{
+		{Role: database.SurveyRoleStudent, Email: "a", Division: database.DivisionBeginner},
+		{Role: database.SurveyRoleStudent, Email: "b", Division: database.DivisionAdvanced},
+		{Role: database.SurveyRoleStudent, Email: "c", Division: database.DivisionAdvanced},
+		{Role: database.SurveyRoleVolunteer, Email: "d"},
+	}
+	responses := []*database.SurveyResponse{
+		{Role: database.SurveyRoleStudent, Email: "a", Answers: map[int64]string{1: "2", 2: "Yes"}},
+		{Role: database.SurveyRoleStudent, Email: "b", Answers: map[int64]string{1: "5", 2: "No"}},
+		{Role: database.SurveyRoleStudent, Email: "c", Answers: map[int64]string{1: "4"}},
+		{Role: database.SurveyRoleVolunteer, Email: "d", Answers: map[int64]string{1: "3"}},
+	}
+	results := computeSurveyResults([]*database.SurveyQuestion{rating, choice}, invitations, responses, surveyBreakdowns[1].Value)
+	require.Len(t, results, 2)
+
+	assert.Equal(t, 4, results[0].Total.Responses)
+	assert.Equal(t, 3.5, results[0].Total.Average)
+	require.Len(t, results[0].Groups, 3)
+	assert.Equal(t, string(database.DivisionAdvanced), results[0].Groups[0].Name)
+	assert.Equal(t, 4.5, results[0].Groups[0].Average)
+	assert.Equal(t, []int{0, 0, 0, 1, 1}, results[0].Groups[0].Counts)
+	assert.Equal(t, surveyGroupNotApplicable, results[0].Groups[2].Name, "respondents without a division are last")
+
+	assert.Equal(t, []int{1, 1}, results[1].Total.Counts)
+	assert.Equal(t, 50, results[1].Total.Percent(0))
+}
+
+func TestAdminSurveyQuestions(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/admin/surveys/question/add", url.Values{"prompt": {"Pick one"}, "kind": {"choice"}, "choices": {"Only"}, "role": {"student"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=", "choice questions need two choices")
+	rec = post("/admin/surveys/question/add", url.Values{"prompt": {"Rate it"}, "kind": {"rating"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=", "questions must be asked of someone")
+	post("/admin/surveys/question/add", url.Values{"prompt": {"Rate it"}, "kind": {"rating"}, "role": {"student", "teacher"}, "required": {"on"}})
+	post("/admin/surveys/question/add", url.Values{"prompt": {"Pick one"}, "kind": {"choice"}, "choices": {"A\nB\n\nA"}, "role": {"volunteer"}})
+
+	questions, err := a.DB.GetSurveyQuestions(ctx)
+	require.NoError(t, err)
+	require.Len(t, questions, 2)
+	assert.Equal(t, []database.SurveyRole{database.SurveyRoleStudent, database.SurveyRoleTeacher}, questions[0].Roles)
+	assert.True(t, questions[0].Required)
+	assert.Equal(t, []string{"A", "B"}, questions[1].Choices)
+
+	post("/admin/surveys/question/move", url.Values{"id": {fmt.Sprint(questions[1].ID)}, "direction": {"up"}})
+	post("/admin/surveys/question/delete", url.Values{"id": {fmt.Sprint(questions[0].ID)}})
+	rec = doRequest(router, http.MethodGet, "/admin/surveys", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Pick one")
+	assert.NotContains(t, rec.Body.String(), "Rate it")
+
+	rec = doRequest(router, http.MethodGet, "/admin/surveys/results?by=experience", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Pick one")
+}
+
+func TestAdminSendSurveys_AlreadySending(t *testing.T) {
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	send := func() *httptest.ResponseRecorder {
+		form := url.Values{"role": {string(database.SurveyRoleStudent)}}
+		req := httptest.NewRequest(http.MethodPost, "/admin/surveys/send", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "admin_token", Value: adminToken(t)})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	a.sendingSurveys.Store(true)
+	assert.Contains(t, send().Header().Get("Location"), "already+being+sent")
+
+	a.sendingSurveys.Store(false)
+	assert.Contains(t, send().Header().Get("Location"), "nobody")
+	assert.False(t, a.sendingSurveys.Load(), "the guard should be released if nothing is sent")
+}
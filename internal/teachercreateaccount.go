@@ -1,21 +1,17 @@
 package internal
 
 import (
-	"context"
 	"embed"
-	"encoding/json"
 	"errors"
 	"fmt"
 	htmltemplate "html/template"
 	"net/http"
-	"net/url"
 	"strings"
 	texttemplate "text/template"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/mattn/go-sqlite3"
-	"github.com/rs/zerolog"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
@@ -24,43 +20,10 @@ var emailTemplates embed.FS
 
 func (a *Application) GetTeacherCreateAccountTemplate(r *http.Request) map[string]any {
 	return map[string]any{
-		"ReCaptchaSiteKey": a.Config.Recaptcha.SiteKey,
+		"Captcha": a.Captcha.Widget(),
 	}
 }
 
-type captchaResponse struct {
-	Success     bool      `json:"success"`
-	ChallengeTS time.Time `json:"challenge_ts"`
-	Hostname    string    `json:"hostname"`
-	ErrorCodes  []string  `json:"error-codes"`
-}
-
-func (a *Application) verifyCaptcha(ctx context.Context, response string) error {
-	form := url.Values{}
-	form.Add("secret", a.Config.Recaptcha.SecretKey)
-	form.Add("response", response)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://www.google.com/recaptcha/api/siteverify", strings.NewReader(form.Encode()))
-	if err != nil {
-		return err
-	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	var captchaResponse captchaResponse
-	err = json.NewDecoder(resp.Body).Decode(&captchaResponse)
-	if err != nil {
-		return err
-	}
-	zerolog.Ctx(ctx).Info().Any("resp", captchaResponse).Msg("captcha response")
-	if !captchaResponse.Success {
-		return errors.New("captcha failed")
-	}
-	return nil
-}
-
 func (a *Application) HandleTeacherCreateAccount(w http.ResponseWriter, r *http.Request) {
 	if !a.Config.RegistrationEnabled {
 		http.Redirect(w, r, "/register", http.StatusSeeOther)
@@ -77,8 +40,8 @@ func (a *Application) HandleTeacherCreateAccount(w http.ResponseWriter, r *http.
 	emailAddress := r.FormValue("email-address")
 	name := r.FormValue("your-name")
 
-	captchaResponse := r.FormValue("g-recaptcha-response")
-	if err := a.verifyCaptcha(r.Context(), captchaResponse); err != nil {
+	captchaResponse := r.FormValue(a.Captcha.Widget().ResponseField)
+	if err := a.Captcha.Verify(log.WithContext(r.Context()), captchaResponse); err != nil {
 		log.Warn().Err(err).Msg("failed to verify captcha")
 		w.WriteHeader(http.StatusBadRequest)
 		a.TeacherCreateAccountRenderer(w, r, map[string]any{
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
+)
+
+// StudentEmailSends is the most recent send of each of the registration emails
+// regarding a student.
+type StudentEmailSends struct {
+	StudentVerify *database.EmailSend
+	ParentForms   *database.EmailSend
+}
+
+// getStudentEmailSends returns the latest email sends for each of the
+// teacher's students, keyed by student email. Students without any sends are
+// not in the map, so indexing it yields empty StudentEmailSends.
+func (a *Application) getStudentEmailSends(ctx context.Context, teacherEmail string) (map[string]StudentEmailSends, error) {
+	sends, err := a.DB.GetLatestEmailSendsForTeacher(ctx, teacherEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	studentSends := map[string]StudentEmailSends{}
+	for _, send := range sends {
+		studentSend := studentSends[send.StudentEmail]
+		switch send.Kind {
+		case database.EmailKindStudentVerify:
+			studentSend.StudentVerify = send
+		case database.EmailKindParentForms:
+			studentSend.ParentForms = send
+		}
+		studentSends[send.StudentEmail] = studentSend
+	}
+	return studentSends, nil
+}
+
+func (a *Application) HandleTeacherResendEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !a.Config.RegistrationEnabled {
+		http.Redirect(w, r, "/register", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		a.Log.Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	email := r.FormValue("email")
+	kind := database.EmailKind(r.FormValue("kind"))
+	teamIDStr := r.URL.Query().Get("team_id")
+	log := a.Log.With().
+		Str("page_name", "teacher_resend_email").
+		Str("team_id", teamIDStr).
+		Str("email", email).
+		Str("kind", string(kind)).
+		Logger()
+	user, err := a.GetLoggedInTeacher(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get logged in user")
+		http.Redirect(w, r, "/register/teacher/login", http.StatusSeeOther)
+		return
+	}
+
+	teamID, err := uuid.Parse(teamIDStr)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to parse team id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Ensure the team exists and that the user is the owner
+	team, err := a.DB.GetTeam(ctx, user.Email, teamID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get team")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var student *database.Student
+	for i, member := range team.Members {
+		if member.Email == email {
+			student = &team.Members[i]
+			break
+		}
+	}
+	if student == nil {
+		log.Warn().Msg("Student is not a member of the team")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch kind {
+	case database.EmailKindStudentVerify:
+		if student.EmailConfirmed {
+			log.Warn().Msg("Student has already confirmed their email")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	case database.EmailKindParentForms:
+		if !student.EmailConfirmed || student.LiabilitySigned {
+			log.Warn().Msg("Forms email cannot be resent for student")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	default:
+		log.Warn().Msg("Unknown email kind")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	renderError := func(message string) {
+		a.TeamEditRenderer(w, r, map[string]any{
+			"Error": map[string]any{"General": message},
+		})
+	}
+
+	if err := a.checkEmailBudget(user); err != nil {
+		log.Warn().Err(err).Msg("Teacher cannot send emails")
+		renderError("Sending emails has been paused for your account. Please email support@mineshspc.com if you need an email resent.")
+		return
+	}
+
+	lastSend, err := a.DB.GetLatestEmailSend(ctx, student.Email, kind)
+	if err != nil {
+		log.Err(err).Msg("Failed to get latest email send")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	cooldown := a.Config.EmailBudget.GetResendCooldown()
+	if lastSend != nil && lastSend.Status == database.EmailStatusAccepted && time.Since(lastSend.TS) < cooldown {
+		log.Warn().Time("last_sent", lastSend.TS).Msg("Resend requested too soon")
+		renderError(fmt.Sprintf("That email was sent to %s recently. You can resend it after %s.",
+			student.Name, lastSend.TS.Add(cooldown).Format("15:04 MST")))
+		return
+	}
+
+	ctx = log.WithContext(ctx)
+	send := &database.EmailSend{
+		StudentEmail: student.Email,
+		Kind:         kind,
+		Resend:       true,
+	}
+	var sendErr error
+	if kind == database.EmailKindStudentVerify {
+		send.Recipient = student.Email
+		sendErr = a.sendStudentEmail(ctx, student.Email, student.Name, user.Name, team.Name, i18n.ParseOrDefault(student.Language), false)
+	} else {
+		send.Recipient = parentFormsRecipient(student)
+		sendErr = a.sendParentEmail(ctx, student, false)
+	}
+	if err := a.recordTeacherEmailSend(ctx, user, send, sendErr); err != nil {
+		log.Err(err).Msg("Failed to record email send")
+	}
+	if sendErr != nil {
+		log.Err(sendErr).Msg("Failed to resend email")
+		renderError("Failed to send the email. Please try again later.")
+		return
+	}
+
+	http.Redirect(w, r, "/register/teacher/team/edit?team_id="+teamID.String(), http.StatusSeeOther)
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestTeacherResendEmail_RateLimited(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	a.Config.RegistrationEnabled = true
+	a.Config.EmailBudget.ResendCooldown = time.Hour
+	teamID, _ := addTestStudent(t, a, "student@example.com", 16)
+	router := a.BuildRouter()
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Issuer:    string(IssuerSessionToken),
+		Subject:   "teacher@example.com",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(testSecretKey))
+	require.NoError(t, err)
+
+	resend := func() *httptest.ResponseRecorder {
+		form := url.Values{"email": {"student@example.com"}, "kind": {string(database.EmailKindStudentVerify)}}
+		req := httptest.NewRequest(http.MethodPost, "/register/teacher/team/resend?team_id="+teamID.String(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "tok", Value: tok})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assertRedirectsTo(t, resend(), "/register/teacher/team/edit?team_id="+teamID.String())
+
+	rec := resend()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "You can resend it after")
+
+	_, resends, err := a.DB.CountEmailSends(ctx, "teacher@example.com", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, resends)
+
+	lastSend, err := a.DB.GetLatestEmailSend(ctx, "student@example.com", database.EmailKindStudentVerify)
+	require.NoError(t, err)
+	require.NotNil(t, lastSend)
+	assert.Equal(t, database.EmailStatusAccepted, lastSend.Status)
+	assert.True(t, lastSend.Resend)
+}
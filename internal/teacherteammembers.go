@@ -10,12 +10,16 @@ import (
 	"strconv"
 	"strings"
 	texttemplate "text/template"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/i18n"
 )
 
 func (a *Application) GetTeacherAddMemberTemplate(r *http.Request) map[string]any {
@@ -43,6 +47,8 @@ func (a *Application) GetTeacherAddMemberTemplate(r *http.Request) map[string]an
 	}
 
 	templateData["Team"] = team
+	templateData["Locales"] = i18n.Locales
+	templateData["StudentLanguage"] = i18n.Default
 
 	a.Log.Info().Any("template_data", templateData).Msg("team edit template")
 
@@ -62,7 +68,7 @@ func (a *Application) getStudentConfirmEmailLink(email string) (string, error) {
 	return fmt.Sprintf("%s/register/student/confirminfo?tok=%s", a.Config.Domain, signedTok), nil
 }
 
-func (a *Application) sendStudentEmail(ctx context.Context, studentEmail, studentName, teacherName, teamName string, isReminder bool) error {
+func (a *Application) sendStudentEmail(ctx context.Context, studentEmail, studentName, teacherName, teamName string, locale i18n.Locale, isReminder bool) error {
 	log := zerolog.Ctx(ctx).With().Str("action", "sendStudentEmail").Logger()
 
 	confirmationLink, err := a.getStudentConfirmEmailLink(studentEmail)
@@ -71,19 +77,20 @@ func (a *Application) sendStudentEmail(ctx context.Context, studentEmail, studen
 		return err
 	}
 	templateData := map[string]any{
+		"Locale":      locale,
 		"Name":        studentName,
 		"TeacherName": teacherName,
 		"TeamName":    teamName,
-		"VerifyURL":   confirmationLink,
+		"VerifyURL":   withLocaleParam(confirmationLink, locale),
 	}
 
 	var plainTextContent, htmlContent strings.Builder
-	texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/studentverify.txt")).Execute(&plainTextContent, templateData)
-	htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/studentverify.html")).Execute(&htmlContent, templateData)
+	texttemplate.Must(texttemplate.New("studentverify.txt").Funcs(i18n.FuncMap).ParseFS(emailTemplates, "emailtemplates/studentverify.txt")).Execute(&plainTextContent, templateData)
+	htmltemplate.Must(htmltemplate.New("studentverify.html").Funcs(i18n.FuncMap).ParseFS(emailTemplates, "emailtemplates/studentverify.html")).Execute(&htmlContent, templateData)
 
-	subject := "Confirm Mines HSPC Registration"
+	subject := i18n.T(locale, "email.studentverify.subject")
 	if isReminder {
-		subject = fmt.Sprintf("REMINDER: %s", subject)
+		subject = i18n.T(locale, "email.reminder", subject)
 	}
 
 	err = a.SendEmail(log, subject,
@@ -125,6 +132,7 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 	studentAgeStr := r.FormValue("student-age")
 	studentEmail := r.FormValue("student-email")
 	previouslyParticipated := r.FormValue("previously-participated") == "has"
+	studentLanguage := i18n.ParseOrDefault(r.FormValue("student-language"))
 
 	if studentEmail == user.Email {
 		a.TeamAddMemberRenderer(w, r, map[string]any{
@@ -134,6 +142,7 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 			"StudentName":            studentName,
 			"StudentEmail":           studentEmail,
 			"PreviouslyParticipated": previouslyParticipated,
+			"StudentLanguage":        studentLanguage,
 		})
 		return
 	}
@@ -146,6 +155,7 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 			"StudentName":            studentName,
 			"StudentEmail":           studentEmail,
 			"PreviouslyParticipated": previouslyParticipated,
+			"StudentLanguage":        studentLanguage,
 		})
 		return
 	}
@@ -157,30 +167,6 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if user.EmailAllowance <= 0 {
-		log.Warn().Msg("User has no email allowance")
-		a.TeamAddMemberRenderer(w, r, map[string]any{
-			"Error": map[string]any{
-				"General": htmltemplate.HTML(
-					`You have reached your quota for sent emails. Please email
-					<a href="mailto:support@mineshspc.com">support@mineshspc.com</a>
-					if you need to add more members to any of your teams.`),
-			},
-			"StudentName":            studentName,
-			"StudentAge":             studentAge,
-			"StudentEmail":           studentEmail,
-			"PreviouslyParticipated": previouslyParticipated,
-		})
-		return
-	}
-
-	err = a.DB.DecrementEmailAllowance(ctx, user.Email)
-	if err != nil {
-		log.Err(err).Msg("Failed to decrement email allowance")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	teamIDStr := r.URL.Query().Get("team_id")
 	teamID, err := uuid.Parse(teamIDStr)
 	if err != nil {
@@ -203,6 +189,26 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Only check the email budget once the request has been validated so that
+	// invalid requests never count against it.
+	if err := a.checkEmailBudget(user); err != nil {
+		log.Warn().Err(err).Msg("Teacher cannot send emails")
+		a.TeamAddMemberRenderer(w, r, map[string]any{
+			"Error": map[string]any{
+				"General": htmltemplate.HTML(
+					`Sending emails has been paused for your account. Please email
+					<a href="mailto:support@mineshspc.com">support@mineshspc.com</a>
+					if you need to add more members to any of your teams.`),
+			},
+			"StudentName":            studentName,
+			"StudentAge":             studentAge,
+			"StudentEmail":           studentEmail,
+			"PreviouslyParticipated": previouslyParticipated,
+			"StudentLanguage":        studentLanguage,
+		})
+		return
+	}
+
 	log = log.With().
 		Str("student_name", studentName).
 		Int("student_age", studentAge).
@@ -213,7 +219,8 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 	log.Info().Msg("adding student")
 	if err := a.DB.AddTeamMember(ctx, teamID, studentName, studentAge, studentEmail, previouslyParticipated); err != nil {
 		var sqliteErr sqlite3.Error
-		if errors.As(err, &sqliteErr); sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		if errors.As(err, &sqliteErr); errors.Is(err, database.ErrStudentAlreadyRegistered) ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
 			a.TeamAddMemberRenderer(w, r, map[string]any{
 				"Error": map[string]any{
 					"General": "That email address has already added to a team.",
@@ -222,6 +229,7 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 				"StudentAge":             studentAge,
 				"StudentEmail":           studentEmail,
 				"PreviouslyParticipated": previouslyParticipated,
+				"StudentLanguage":        studentLanguage,
 			})
 			return
 		}
@@ -231,9 +239,32 @@ func (a *Application) HandleTeacherAddMember(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if studentLanguage != i18n.Default {
+		if err := a.DB.SetStudentLanguage(ctx, studentEmail, string(studentLanguage)); err != nil {
+			log.Err(err).Msg("failed to set student language")
+		}
+	}
+
+	if !previouslyParticipated {
+		if err := a.checkStudentParticipationHistory(ctx, studentEmail, studentName, user.SchoolName); err != nil {
+			log.Err(err).Msg("failed to check participation history")
+		}
+	}
+
+	a.publishStudentEvent(ctx, LiveEventRegistered, studentEmail, time.Now(), user.SchoolName)
+
 	// Send email to student
-	if err := a.sendStudentEmail(ctx, studentEmail, studentName, user.Name, team.Name, false); err != nil {
-		log.Err(err).Msg("failed to send student email")
+	sendErr := a.sendStudentEmail(ctx, studentEmail, studentName, user.Name, team.Name, studentLanguage, false)
+	send := &database.EmailSend{
+		StudentEmail: studentEmail,
+		Recipient:    studentEmail,
+		Kind:         database.EmailKindStudentVerify,
+	}
+	if err := a.recordTeacherEmailSend(log.WithContext(ctx), user, send, sendErr); err != nil {
+		log.Err(err).Msg("failed to record email send")
+	}
+	if sendErr != nil {
+		log.Err(sendErr).Msg("failed to send student email")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -275,19 +306,40 @@ func (a *Application) HandleTeacherDeleteMember(w http.ResponseWriter, r *http.R
 	}
 
 	// Ensure the team exists and that the user is the owner
-	_, err = a.DB.GetTeam(ctx, user.Email, teamID)
+	team, err := a.DB.GetTeam(ctx, user.Email, teamID)
 	if err != nil {
 		log.Err(err).Msg("Failed to get team")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if err := a.DB.RemoveTeamMember(ctx, teamID, email); err != nil {
-		log.Err(err).Msg("Failed to delete team member")
+	var student *database.Student
+	for i, member := range team.Members {
+		if member.Email == email {
+			student = &team.Members[i]
+			break
+		}
+	}
+	if student == nil {
+		log.Warn().Msg("Student is not a member of the team")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := a.DB.WithdrawStudent(ctx, email); err != nil {
+		log.Err(err).Msg("Failed to withdraw team member")
 		// TODO report this error to the user and email admin
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	ctx = log.WithContext(ctx)
+	if err := a.refundEmailSends(ctx, user.Email, []database.Student{*student}); err != nil {
+		log.Err(err).Msg("Failed to refund email sends")
+	}
+	if err := a.sendWithdrawalNoticeEmail(ctx, student, team, user.Name, WithdrawalReasonRemoved); err != nil {
+		log.Err(err).Msg("Failed to send withdrawal notice")
+	}
+
 	http.Redirect(w, r, "/register/teacher/team/edit?team_id="+teamID.String(), http.StatusSeeOther)
 }
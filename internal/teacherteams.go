@@ -2,6 +2,9 @@ package internal
 
 import (
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -23,14 +26,30 @@ func (a *Application) GetTeacherTeamsTemplate(r *http.Request) map[string]any {
 		return nil
 	}
 
-	return map[string]any{
-		"Username":         user.Name,
-		"SchoolName":       user.SchoolName,
-		"SchoolCity":       user.SchoolCity,
-		"SchoolState":      user.SchoolState,
-		"Teams":            teams,
-		"AllowanceReached": user.EmailAllowance == 0,
+	certificateSettings, err := a.DB.GetCertificateSettings(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("Failed to get certificate settings")
+		return nil
+	}
+
+	hasInPersonTeam := slices.ContainsFunc(teams, func(t *database.Team) bool { return t.InPerson })
+
+	data := map[string]any{
+		"Username":             user.Name,
+		"SchoolName":           user.SchoolName,
+		"SchoolCity":           user.SchoolCity,
+		"SchoolState":          user.SchoolState,
+		"Teams":                teams,
+		"EmailSuspended":       user.EmailSuspended,
+		"CertificatesReleased": certificateSettings.Released,
+		"HasInPersonTeam":      hasInPersonTeam,
+		"Error":                r.URL.Query().Get("error"),
 	}
+	if err := a.setTeacherAttendanceData(r.Context(), data, user); err != nil {
+		a.Log.Err(err).Msg("Failed to get teacher attendance")
+		return nil
+	}
+	return data
 }
 
 func (a *Application) GetTeacherTeamEditTemplate(r *http.Request) map[string]any {
@@ -64,6 +83,13 @@ func (a *Application) GetTeacherTeamEditTemplate(r *http.Request) map[string]any
 		}
 
 		templateData["Team"] = team
+
+		emailSends, err := a.getStudentEmailSends(r.Context(), user.Email)
+		if err != nil {
+			a.Log.Err(err).Msg("Failed to get student email sends")
+			return nil
+		}
+		templateData["EmailSends"] = emailSends
 	}
 
 	a.Log.Info().Any("template_data", templateData).Msg("team edit template")
@@ -93,6 +119,7 @@ func (a *Application) HandleTeacherTeamEdit(w http.ResponseWriter, r *http.Reque
 	}
 
 	teamName := r.FormValue("team-name")
+	accessibilityNotes := strings.TrimSpace(r.FormValue("team-accessibility-notes"))
 	// inPerson := r.FormValue("team-location") == "in-person"
 	// teamDivision, err := database.ParseDivision(r.FormValue("team-division"))
 	// if err != nil {
@@ -135,12 +162,86 @@ func (a *Application) HandleTeacherTeamEdit(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	if err := a.DB.UpsertTeam(ctx, user.Email, teamID, teamName, teamDivision, inPerson, teamDivisionExplanation); err != nil {
+	if err := a.DB.UpsertTeam(ctx, user.Email, teamID, teamName, teamDivision, inPerson, teamDivisionExplanation, accessibilityNotes); err != nil {
 		log.Err(err).Msg("Failed to upsert team")
 		// TODO report this error to the user and email admin
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	if teamIDStr == "" {
+		team := &database.Team{
+			ID:             teamID,
+			TeacherEmail:   user.Email,
+			Name:           teamName,
+			Division:       teamDivision,
+			InPerson:       inPerson,
+			SchoolName:     user.SchoolName,
+			RegistrationTS: time.Now(),
+		}
+		a.Webhooks.Enqueue(ctx, database.WebhookEventTeamRegistered, team.RegistrationTS, WebhookTeamData{
+			Team: newAPITeam(&exportTeam{TeamWithTeacherName: &database.TeamWithTeacherName{Team: team, TeacherName: user.Name}}),
+		})
+	}
+
 	http.Redirect(w, r, "/register/teacher/team/edit?team_id="+teamID.String(), http.StatusSeeOther)
 }
+
+func (a *Application) HandleTeacherWithdrawTeam(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !a.Config.RegistrationEnabled {
+		http.Redirect(w, r, "/register", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		a.Log.Err(err).Msg("failed to parse form")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	teamIDStr := r.FormValue("team_id")
+	log := a.Log.With().
+		Str("page_name", "teacher_withdraw_team").
+		Str("team_id", teamIDStr).
+		Logger()
+	user, err := a.GetLoggedInTeacher(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to get logged in user")
+		http.Redirect(w, r, "/register/teacher/login", http.StatusSeeOther)
+		return
+	}
+
+	teamID, err := uuid.Parse(teamIDStr)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to parse team id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Ensure the team exists and that the user is the owner
+	team, err := a.DB.GetTeam(ctx, user.Email, teamID)
+	if err != nil {
+		log.Err(err).Msg("Failed to get team")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := a.DB.WithdrawTeam(ctx, teamID); err != nil {
+		log.Err(err).Msg("Failed to withdraw team")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int("member_count", len(team.Members)).Msg("withdrew team")
+
+	ctx = log.WithContext(ctx)
+	if err := a.refundEmailSends(ctx, user.Email, team.Members); err != nil {
+		log.Err(err).Msg("Failed to refund email sends")
+	}
+	for _, member := range team.Members {
+		if err := a.sendWithdrawalNoticeEmail(ctx, &member, team, user.Name, WithdrawalReasonTeam); err != nil {
+			log.Err(err).Str("student_email", member.Email).Msg("Failed to send withdrawal notice")
+		}
+	}
+
+	http.Redirect(w, r, "/register/teacher/teams", http.StatusSeeOther)
+}
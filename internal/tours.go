@@ -0,0 +1,444 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/internal/pdf"
+)
+
+// tourGroupCounts returns how many students are in each tour group.
+func tourGroupCounts(tours []*database.StudentTour) map[int64]int {
+	counts := map[int64]int{}
+	for _, tour := range tours {
+		if !tour.Waitlisted() {
+			counts[tour.GroupID]++
+		}
+	}
+	return counts
+}
+
+// fillTourGroups moves students off of the waitlist into the tour groups that
+// have space, in the order that they asked to go on a tour. Students that
+// chose a group only go in that group, and the others go in whichever group
+// has the most space left. Students that are already in a group are never
+// moved. The tours that were given a group are returned.
+func fillTourGroups(groups []*database.TourGroup, tours []*database.StudentTour) (placed []*database.StudentTour) {
+	counts := tourGroupCounts(tours)
+	spaceLeft := func(group *database.TourGroup) int {
+		return group.Capacity - counts[group.ID]
+	}
+	for _, tour := range tours {
+		if !tour.Waitlisted() {
+			continue
+		}
+		var best *database.TourGroup
+		if i := slices.IndexFunc(groups, func(g *database.TourGroup) bool { return g.ID == tour.PreferredGroupID }); i >= 0 {
+			best = groups[i]
+		} else {
+			for _, group := range groups {
+				if best == nil || spaceLeft(group) > spaceLeft(best) {
+					best = group
+				}
+			}
+		}
+		if best == nil || spaceLeft(best) <= 0 {
+			continue
+		}
+		tour.GroupID = best.ID
+		counts[best.ID]++
+		placed = append(placed, tour)
+	}
+	return placed
+}
+
+// assignTourGroups fills the tour groups from the waitlist and saves the
+// result. It returns how many students were placed and how many are still on
+// the waitlist.
+func (a *Application) assignTourGroups(ctx context.Context) (placed, waitlisted int, err error) {
+	a.tourLock.Lock()
+	defer a.tourLock.Unlock()
+	groups, err := a.DB.GetTourGroups(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	tours, err := a.DB.GetStudentTours(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	newlyPlaced := fillTourGroups(groups, tours)
+	if err := a.DB.SetStudentTourGroups(ctx, newlyPlaced); err != nil {
+		return 0, 0, err
+	}
+	for _, tour := range tours {
+		if tour.Waitlisted() {
+			waitlisted++
+		}
+	}
+	if len(newlyPlaced) > 0 {
+		zerolog.Ctx(ctx).Info().Int("placed", len(newlyPlaced)).Int("waitlisted", waitlisted).Msg("filled tour groups")
+	}
+	return len(newlyPlaced), waitlisted, nil
+}
+
+// tourOption is a tour group that a student can choose.
+type tourOption struct {
+	*database.TourGroup
+	SpotsLeft int
+	Chosen    bool
+}
+
+// setStudentTourData adds the student's tour choices and their place on a
+// tour to the data for the student confirmation page. The old campus tour
+// checkbox is shown instead if there are no tour groups.
+func (a *Application) setStudentTourData(ctx context.Context, data map[string]any, student *database.Student) {
+	groups, err := a.DB.GetTourGroups(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get tour groups")
+		return
+	} else if len(groups) == 0 {
+		return
+	}
+	tours, err := a.DB.GetStudentTours(ctx)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get student tours")
+		return
+	}
+	i := slices.IndexFunc(tours, func(t *database.StudentTour) bool { return t.StudentEmail == student.Email })
+	var tour *database.StudentTour
+	if i >= 0 {
+		tour = tours[i]
+		data["Tour"] = tour
+	}
+
+	counts := tourGroupCounts(tours)
+	options := make([]tourOption, len(groups))
+	for i, group := range groups {
+		options[i] = tourOption{
+			TourGroup: group,
+			SpotsLeft: max(group.Capacity-counts[group.ID], 0),
+			Chosen:    tour != nil && tour.PreferredGroupID == group.ID,
+		}
+		if tour != nil && tour.GroupID == group.ID {
+			data["TourGroup"] = group
+		}
+	}
+	data["TourOptions"] = options
+}
+
+// parseTourChoice reads the campus tour choice of the student confirmation
+// form. It is empty for no tour, "any" or "on" for any group, or the ID of the
+// chosen group.
+func parseTourChoice(value string, groups []*database.TourGroup) (wantsTour bool, preferredGroupID int64, ok bool) {
+	switch value {
+	case "":
+		return false, 0, true
+	case "any", "on":
+		return true, 0, true
+	}
+	groupID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || !slices.ContainsFunc(groups, func(g *database.TourGroup) bool { return g.ID == groupID }) {
+		return false, 0, false
+	}
+	return true, groupID, true
+}
+
+// saveStudentTourChoice saves whether the student wants to go on a tour and
+// which group they would like to be in, and then fills the tour groups.
+func (a *Application) saveStudentTourChoice(ctx context.Context, studentEmail string, wantsTour bool, preferredGroupID int64) error {
+	var err error
+	if wantsTour {
+		err = a.DB.RequestStudentTour(ctx, studentEmail, preferredGroupID)
+	} else {
+		err = a.DB.CancelStudentTour(ctx, studentEmail)
+	}
+	if err != nil {
+		return err
+	}
+	_, _, err = a.assignTourGroups(ctx)
+	return err
+}
+
+// getStudentTourGroup returns the tour group that the student is in. If the
+// student asked to go on a tour but is still on the waitlist, the group is nil
+// and waitlisted is true.
+func (a *Application) getStudentTourGroup(ctx context.Context, studentEmail string) (group *database.TourGroup, waitlisted bool, err error) {
+	tour, err := a.DB.GetStudentTour(ctx, studentEmail)
+	if err != nil || tour == nil {
+		return nil, false, err
+	} else if tour.Waitlisted() {
+		return nil, true, nil
+	}
+	groups, err := a.DB.GetTourGroups(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if i := slices.IndexFunc(groups, func(g *database.TourGroup) bool { return g.ID == tour.GroupID }); i >= 0 {
+		return groups[i], false, nil
+	}
+	return nil, true, nil
+}
+
+type tourRosterStudent struct {
+	*database.Student
+	Team *database.TeamWithTeacherName
+}
+
+type tourChaperone struct {
+	Name   string
+	Email  string
+	School string
+}
+
+// tourRoster is everyone going on a tour group. The teachers of the students
+// in the group go along as chaperones.
+type tourRoster struct {
+	Group      *database.TourGroup
+	Students   []tourRosterStudent
+	Chaperones []tourChaperone
+}
+
+func (r *tourRoster) SpotsLeft() int {
+	return r.Group.Capacity - len(r.Students)
+}
+
+// getTourRosters returns the roster of every tour group along with the
+// students on the waitlist.
+func (a *Application) getTourRosters(ctx context.Context) (rosters []*tourRoster, waitlist []tourRosterStudent, err error) {
+	groups, err := a.DB.GetTourGroups(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tours, err := a.DB.GetStudentTours(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	teams, err := a.DB.GetAdminTeamsWithTeacherName(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	students := map[string]tourRosterStudent{}
+	for _, team := range teams {
+		for i := range team.Members {
+			students[team.Members[i].Email] = tourRosterStudent{Student: &team.Members[i], Team: team}
+		}
+	}
+
+	byGroup := map[int64]*tourRoster{}
+	for _, group := range groups {
+		byGroup[group.ID] = &tourRoster{Group: group}
+		rosters = append(rosters, byGroup[group.ID])
+	}
+	for _, tour := range tours {
+		student, ok := students[tour.StudentEmail]
+		if !ok {
+			continue
+		} else if roster, ok := byGroup[tour.GroupID]; ok {
+			roster.Students = append(roster.Students, student)
+		} else {
+			waitlist = append(waitlist, student)
+		}
+	}
+
+	for _, roster := range rosters {
+		slices.SortFunc(roster.Students, func(a, b tourRosterStudent) int {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+		for _, student := range roster.Students {
+			if !slices.ContainsFunc(roster.Chaperones, func(c tourChaperone) bool { return c.Email == student.Team.TeacherEmail }) {
+				roster.Chaperones = append(roster.Chaperones, tourChaperone{
+					Name:   student.Team.TeacherName,
+					Email:  student.Team.TeacherEmail,
+					School: student.Team.SchoolName,
+				})
+			}
+		}
+		slices.SortFunc(roster.Chaperones, func(a, b tourChaperone) int {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		})
+	}
+	return rosters, waitlist, nil
+}
+
+// GetVolunteerToursTemplate shows the volunteer the rosters of the tour
+// groups that they lead.
+func (a *Application) GetVolunteerToursTemplate(r *http.Request) map[string]any {
+	volunteerEmail := a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin)
+	rosters, _, err := a.getTourRosters(r.Context())
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get tour rosters")
+		return nil
+	}
+	rosters = slices.DeleteFunc(rosters, func(roster *tourRoster) bool {
+		return !slices.Contains(roster.Group.Guides, volunteerEmail)
+	})
+	return map[string]any{
+		"Rosters": rosters,
+	}
+}
+
+// tourExportRow is a student or chaperone on a tour, or a student on the
+// waitlist if the group is nil.
+type tourExportRow struct {
+	Group  *database.TourGroup
+	Role   string
+	Name   string
+	Email  string
+	Team   string
+	School string
+}
+
+func (r *tourExportRow) group(value func(*database.TourGroup) string) any {
+	if r.Group == nil {
+		return ""
+	}
+	return value(r.Group)
+}
+
+func (a *Application) toursExportDataset() *exportDataset[*tourExportRow] {
+	return &exportDataset[*tourExportRow]{
+		name:  "tours",
+		title: "Campus Tours",
+		columns: []exportColumn[*tourExportRow]{
+			column("group", "Tour Group", func(r *tourExportRow) any { return r.group(func(g *database.TourGroup) string { return g.Name }) }),
+			column("time", "Time", func(r *tourExportRow) any { return r.group(func(g *database.TourGroup) string { return g.Time }) }),
+			column("guides", "Guides", func(r *tourExportRow) any {
+				return r.group(func(g *database.TourGroup) string { return strings.Join(g.Guides, ", ") })
+			}),
+			column("role", "Role", func(r *tourExportRow) any { return r.Role }),
+			column("name", "Name", func(r *tourExportRow) any { return r.Name }),
+			column("email", "Email", func(r *tourExportRow) any { return r.Email }),
+			column("team", "Team", func(r *tourExportRow) any { return r.Team }),
+			column("school", "School", func(r *tourExportRow) any { return r.School }),
+			column("waitlisted", "Waitlisted", func(r *tourExportRow) any { return r.Group == nil }),
+		},
+		filters: []exportFilter[*tourExportRow]{
+			{
+				ExportFilter: ExportFilter{Key: "role", Title: "Role", Options: []string{"student", "chaperone"}},
+				Match:        func(r *tourExportRow, v string) bool { return strings.EqualFold(r.Role, v) },
+			},
+			yesNoFilter("waitlisted", "Waitlisted", func(r *tourExportRow) bool { return r.Group == nil }),
+		},
+		rows: func(ctx context.Context) ([]*tourExportRow, error) {
+			rosters, waitlist, err := a.getTourRosters(ctx)
+			if err != nil {
+				return nil, err
+			}
+			var rows []*tourExportRow
+			studentRow := func(group *database.TourGroup, student tourRosterStudent) *tourExportRow {
+				return &tourExportRow{
+					Group:  group,
+					Role:   "Student",
+					Name:   student.Name,
+					Email:  student.Email,
+					Team:   student.Team.Name,
+					School: student.Team.SchoolName,
+				}
+			}
+			for _, roster := range rosters {
+				for _, chaperone := range roster.Chaperones {
+					rows = append(rows, &tourExportRow{
+						Group:  roster.Group,
+						Role:   "Chaperone",
+						Name:   chaperone.Name,
+						Email:  chaperone.Email,
+						School: chaperone.School,
+					})
+				}
+				for _, student := range roster.Students {
+					rows = append(rows, studentRow(roster.Group, student))
+				}
+			}
+			for _, student := range waitlist {
+				rows = append(rows, studentRow(nil, student))
+			}
+			return rows, nil
+		},
+	}
+}
+
+// HandleTourRostersExport renders a printable roster for every tour group for
+// the guides to take attendance with.
+func (a *Application) HandleTourRostersExport(w http.ResponseWriter, r *http.Request) {
+	log := a.Log.With().Str("page_name", "admin_tour_rosters_export").Logger()
+
+	rosters, _, err := a.getTourRosters(r.Context())
+	if err != nil {
+		log.Err(err).Msg("failed to get tour rosters")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	doc := pdf.New()
+	for _, roster := range rosters {
+		drawTourRoster(doc, roster)
+	}
+	if len(rosters) == 0 {
+		doc.AddPage(pdf.LetterWidth, pdf.LetterHeight)
+	}
+
+	if err := writePDF(w, "tour-rosters.pdf", doc); err != nil {
+		log.Err(err).Msg("failed to write tour rosters")
+	}
+}
+
+// drawTourRoster draws the roster of one tour group starting on a new page,
+// with a box next to each student to check off.
+func drawTourRoster(doc *pdf.Document, roster *tourRoster) {
+	const margin = 0.75 * pdf.Inch
+	const lineHeight = 20.0
+	page := doc.AddPage(pdf.LetterWidth, pdf.LetterHeight)
+	width := page.Width() - 2*margin
+	y := page.Height() - margin
+	line := func(font pdf.Font, size float64, s string) {
+		for _, wrapped := range font.Wrap(width, size, s) {
+			y -= size + 6
+			page.Text(font, size, margin, y, wrapped)
+		}
+	}
+
+	title := "Campus Tour: " + roster.Group.Name
+	if roster.Group.Time != "" {
+		title += " · " + roster.Group.Time
+	}
+	titleSize, title := pdf.HelveticaBold.Fit(width, 22, 12, title)
+	line(pdf.HelveticaBold, titleSize, title)
+	if roster.Group.Notes != "" {
+		line(pdf.Helvetica, 12, roster.Group.Notes)
+	}
+	if len(roster.Group.Guides) > 0 {
+		line(pdf.Helvetica, 12, "Guides: "+strings.Join(roster.Group.Guides, ", "))
+	}
+	chaperones := make([]string, len(roster.Chaperones))
+	for i, chaperone := range roster.Chaperones {
+		chaperones[i] = fmt.Sprintf("%s (%s)", chaperone.Name, chaperone.School)
+	}
+	if len(chaperones) > 0 {
+		line(pdf.Helvetica, 12, "Chaperones: "+strings.Join(chaperones, ", "))
+	}
+	line(pdf.Helvetica, 12, fmt.Sprintf("%d of %d students", len(roster.Students), roster.Group.Capacity))
+	y -= lineHeight / 2
+
+	for _, student := range roster.Students {
+		if y-lineHeight < margin {
+			page = doc.AddPage(pdf.LetterWidth, pdf.LetterHeight)
+			y = page.Height() - margin
+			line(pdf.HelveticaBold, 12, fmt.Sprintf("Campus Tour: %s (continued)", roster.Group.Name))
+			y -= lineHeight / 2
+		}
+		y -= lineHeight
+		page.Rect(margin, y-2, 12, 12, 1)
+		_, name := pdf.Helvetica.Fit(width*0.45, 12, 12, student.Name)
+		page.Text(pdf.Helvetica, 12, margin+24, y, name)
+		_, team := pdf.Helvetica.Fit(width*0.5, 10, 10, student.Team.Name+" · "+student.Team.SchoolName)
+		page.Text(pdf.Helvetica, 10, margin+24+width*0.45, y, team)
+	}
+}
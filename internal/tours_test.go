@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestFillTourGroups(t *testing.T) {
+	groups := []*database.TourGroup{
+		{ID: 1, Name: "A", Capacity: 3},
+		{ID: 2, Name: "B", Capacity: 1},
+	}
+	tours := []*database.StudentTour{
+		{StudentEmail: "in-a@example.com", GroupID: 1},
+		{StudentEmail: "any1@example.com"},
+		{StudentEmail: "wants-b1@example.com", PreferredGroupID: 2},
+		{StudentEmail: "wants-b2@example.com", PreferredGroupID: 2},
+		{StudentEmail: "any2@example.com"},
+		{StudentEmail: "any3@example.com"},
+	}
+
+	placed := fillTourGroups(groups, tours)
+	groupOf := map[string]int64{}
+	for _, tour := range tours {
+		groupOf[tour.StudentEmail] = tour.GroupID
+	}
+	assert.Equal(t, map[string]int64{
+		"in-a@example.com":     1,
+		"any1@example.com":     1,
+		"wants-b1@example.com": 2,
+		"wants-b2@example.com": 0,
+		"any2@example.com":     1,
+		"any3@example.com":     0,
+	}, groupOf, "students that chose a full group wait for it")
+	assert.Len(t, placed, 3)
+}
+
+func addTestTourGroup(t *testing.T, a *Application, name string, capacity int) *database.TourGroup {
+	t.Helper()
+	group := &database.TourGroup{Name: name, Time: "3:00 PM", Capacity: capacity}
+	require.NoError(t, a.DB.AddTourGroup(context.Background(), group))
+	return group
+}
+
+func TestStudentTourChoice(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.DevMode = true
+	router := a.BuildRouter()
+	addTestResultsTeams(t, a)
+	confirm := func(email, choice string) *httptest.ResponseRecorder {
+		link, err := a.getStudentConfirmEmailLink(email)
+		require.NoError(t, err)
+		form := url.Values{"confirm-info-correct": {"on"}, "parent-email": {"parent@example.com"}, "campus-tour": {choice}}
+		req := httptest.NewRequest(http.MethodPost, strings.TrimPrefix(link, a.Config.Domain), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	groupOf := func(email string) (int64, bool) {
+		tour, err := a.DB.GetStudentTour(ctx, email)
+		require.NoError(t, err)
+		if tour == nil {
+			return 0, false
+		}
+		return tour.GroupID, true
+	}
+
+	// Without any tour groups, it is just a checkbox.
+	rec := confirm("studenta@example.com", "on")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `type="checkbox" id="campus-tour"`)
+	_, requested := groupOf("studenta@example.com")
+	assert.False(t, requested)
+
+	group := addTestTourGroup(t, a, "Group A", 1)
+	groupID := strconv.FormatInt(group.ID, 10)
+	assert.Equal(t, http.StatusBadRequest, confirm("studenta@example.com", "12345").Code)
+
+	rec = confirm("studenta@example.com", groupID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "You are in the <b>Group A</b> campus tour group.")
+	studentAGroup, _ := groupOf("studenta@example.com")
+	assert.Equal(t, group.ID, studentAGroup)
+
+	rec = confirm("studentc@example.com", "any")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "You are on the waitlist for a campus tour.")
+	studentCGroup, requested := groupOf("studentc@example.com")
+	assert.True(t, requested)
+	assert.Zero(t, studentCGroup)
+
+	// Saving the same choice again keeps the student's place.
+	require.Equal(t, http.StatusOK, confirm("studenta@example.com", groupID).Code)
+	studentAGroup, _ = groupOf("studenta@example.com")
+	assert.Equal(t, group.ID, studentAGroup)
+
+	// Giving up a spot moves the next student off of the waitlist.
+	require.Equal(t, http.StatusOK, confirm("studenta@example.com", "").Code)
+	_, requested = groupOf("studenta@example.com")
+	assert.False(t, requested)
+	studentCGroup, _ = groupOf("studentc@example.com")
+	assert.Equal(t, group.ID, studentCGroup)
+	student, err := a.DB.GetStudentByEmail(ctx, "studentc@example.com")
+	require.NoError(t, err)
+	assert.True(t, student.CampusTour)
+}
+
+func TestAdminTours(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	addTestResultsTeams(t, a)
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// These students asked for a tour before there were any groups.
+	for _, email := range []string{"studenta@example.com", "studentb@example.com", "studentc@example.com"} {
+		require.NoError(t, a.DB.ConfirmStudent(ctx, email, true, "", "parent@example.com"))
+	}
+	assert.Contains(t, post("/admin/tours/add", url.Values{"name": {"Group A"}, "capacity": {"0"}}).Header().Get("Location"), "error=")
+	post("/admin/tours/add", url.Values{"name": {"Group A"}, "time": {"3:00 PM"}, "capacity": {"1"}, "notes": {"Meet at CTLM"}})
+	groups, err := a.DB.GetTourGroups(ctx)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	groupID := strconv.FormatInt(groups[0].ID, 10)
+
+	rec := post("/admin/tours/assign", nil)
+	assert.Contains(t, rec.Header().Get("Location"), "no+space+for+1+students", "the remote student is left out")
+	post("/admin/tours/update", url.Values{"id": {groupID}, "name": {"Group A"}, "time": {"3:00 PM"}, "capacity": {"2"}})
+	tours, err := a.DB.GetStudentTours(ctx)
+	require.NoError(t, err)
+	require.Len(t, tours, 2)
+	for _, tour := range tours {
+		assert.Equal(t, groups[0].ID, tour.GroupID, "raising the capacity fills the group")
+	}
+
+	assert.Contains(t, post("/admin/tours/guides", url.Values{"id": {groupID}, "guide": {"test@example.com"}}).Header().Get("Location"), "error=")
+	require.NoError(t, a.DB.AddVolunteer(ctx, "test@example.com"))
+	assertRedirectsTo(t, post("/admin/tours/guides", url.Values{"id": {groupID}, "guide": {"test@example.com"}}), "/admin/tours")
+
+	rec = doRequest(router, http.MethodGet, "/admin/api/export/tours?column=role&column=name&column=team", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Role,Name,Team\nChaperone,Teacher,\nStudent,Student,Code Rats\nStudent,Student,Cool Cats\n", rec.Body.String())
+	rec = doRequest(router, http.MethodGet, "/admin/api/tourrosters", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+	rec = doRequest(router, http.MethodGet, "/admin/tours", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Teacher (School)")
+
+	volunteerCookie := &http.Cookie{Name: "volunteer_token", Value: volunteerToken(t)}
+	rec = doRequest(router, http.MethodGet, "/volunteer/tours", volunteerCookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Cool Cats")
+	qrTok, err := a.getStudentQRToken("studentc@example.com")
+	require.NoError(t, err)
+	rec = doRequest(router, http.MethodGet, "/volunteer/scan?tok="+qrTok, volunteerCookie)
+	assert.Contains(t, rec.Body.String(), "Campus tour: <b>Group A</b>, 3:00 PM")
+
+	assertRedirectsTo(t, post("/admin/tours/student", url.Values{"email": {"studentc@example.com"}, "group_id": {""}}), "/admin/tours")
+	tour, err := a.DB.GetStudentTour(ctx, "studentc@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, tour)
+	student, err := a.DB.GetStudentByEmail(ctx, "studentc@example.com")
+	require.NoError(t, err)
+	assert.False(t, student.CampusTour, "removed students are not added back when the groups are filled")
+	post("/admin/tours/assign", nil)
+	tour, err = a.DB.GetStudentTour(ctx, "studentc@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, tour)
+
+	post("/admin/tours/delete", url.Values{"id": {groupID}})
+	tour, err = a.DB.GetStudentTour(ctx, "studenta@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, tour)
+	assert.True(t, tour.Waitlisted(), "students in a deleted group go back on the waitlist")
+}
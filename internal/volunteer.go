@@ -9,6 +9,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 
 	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
@@ -105,6 +106,11 @@ func (a *Application) GetVolunteerScanTemplate(r *http.Request) map[string]any {
 	}
 
 	studentCheckInToken := r.URL.Query().Get("tok")
+	if chaperone, err := a.getChaperoneByQRToken(ctx, studentCheckInToken); err == nil {
+		a.setChaperoneScanData(ctx, res, chaperone)
+		res["Token"] = studentCheckInToken
+		return res
+	}
 	student, err := a.getStudentByQRToken(ctx, studentCheckInToken)
 	if err != nil {
 		a.Log.Warn().Err(err).Msg("failed to get student by token")
@@ -120,24 +126,61 @@ func (a *Application) GetVolunteerScanTemplate(r *http.Request) map[string]any {
 
 	res["TeamName"] = team.Name
 
+	seat, err := a.DB.GetTeamSeat(ctx, team.ID)
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to get team seat")
+	}
+	res["Seat"] = seat
+
 	if !team.InPerson {
 		res["NotInPerson"] = true
 		return res
 	}
 
-	res["AllGood"] = student.EmailConfirmed &&
-		student.LiabilitySigned &&
-		student.ComputerUseWaiverSigned
+	res["AllGood"] = completedCheckInSteps(student)
+
+	tourGroup, tourWaitlisted, err := a.getStudentTourGroup(ctx, student.Email)
+	if err != nil {
+		a.Log.Warn().Err(err).Msg("failed to get student tour group")
+	}
+	res["TourGroup"] = tourGroup
+	res["TourWaitlisted"] = tourWaitlisted
 
 	res["Student"] = student
 
+	// The emergency information is shown so that it is at hand if something
+	// happens to the student. Every time it is shown is logged.
+	emergencyInfo, err := a.DB.GetEmergencyInfo(ctx, student.Email)
+	if err != nil {
+		a.Log.Err(err).Msg("failed to get emergency info")
+	} else if emergencyInfo != nil {
+		hlog.FromRequest(r).Info().
+			Str("volunteer_email", a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin)).
+			Str("student_email", student.Email).
+			Msg("showing emergency info to volunteer")
+	}
+	res["EmergencyInfo"] = emergencyInfo
+
 	return res
 }
 
+// completedCheckInSteps reports whether the student has completed everything
+// that is required before they can be checked in.
+func completedCheckInSteps(student *database.Student) bool {
+	return student.EmailConfirmed &&
+		student.LiabilitySigned &&
+		student.ComputerUseWaiverSigned
+}
+
 func (a *Application) HandleVolunteerCheckIn(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	studentSignInToken := r.URL.Query().Get("tok")
+	if chaperone, err := a.getChaperoneByQRToken(ctx, studentSignInToken); err == nil {
+		a.checkInChaperone(r, chaperone)
+		http.Redirect(w, r, fmt.Sprintf("/volunteer/scan?tok=%s", studentSignInToken), http.StatusSeeOther)
+		return
+	}
 	student, err := a.getStudentByQRToken(ctx, studentSignInToken)
 	if err != nil {
 		a.Log.Warn().Err(err).Msg("failed to get student by token")
@@ -146,15 +189,22 @@ func (a *Application) HandleVolunteerCheckIn(w http.ResponseWriter, r *http.Requ
 	}
 
 	if !student.CheckedIn {
-		a.DB.CheckInStudent(ctx, student.Email)
+		now := time.Now()
+		if recorded, err := a.DB.CheckInStudent(ctx, student.Email, now, a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin), checkInStationScan); err != nil {
+			a.Log.Err(err).Msg("failed to check in student")
+		} else if recorded {
+			a.publishStudentEvent(ctx, LiveEventCheckedIn, student.Email, now, checkInStationScan)
+		}
 	}
 
 	http.Redirect(w, r, fmt.Sprintf("/volunteer/scan?tok=%s", studentSignInToken), http.StatusSeeOther)
 }
 
-func (a *Application) getStudentByQRToken(ctx context.Context, tokenStr string) (*database.Student, error) {
+// parseQRToken parses the token in a ticket's QR code and checks that it is
+// from the given issuer. The subject of the token is returned.
+func (a *Application) parseQRToken(tokenStr string, issuer Issuer) (string, error) {
 	if tokenStr == "" {
-		return nil, errors.New("no token")
+		return "", errors.New("no token")
 	}
 
 	token, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
@@ -166,17 +216,25 @@ func (a *Application) getStudentByQRToken(ctx context.Context, tokenStr string)
 		return a.Config.ReadSecretKey(), nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse student confirmation token: %w", err)
+		return "", fmt.Errorf("failed to parse QR code token: %w", err)
 	}
 
 	claims, ok := token.Claims.(*jwt.RegisteredClaims)
 	if !token.Valid || !ok {
-		return nil, fmt.Errorf("failed to validate token: %w", err)
+		return "", fmt.Errorf("failed to validate token: %w", err)
 	}
 
-	if claims.Issuer != string(IssuerStudentQRCode) {
-		return nil, fmt.Errorf("invalid student verify token: %w", err)
+	if claims.Issuer != string(issuer) {
+		return "", fmt.Errorf("invalid QR code token issuer %q", claims.Issuer)
 	}
 
-	return a.DB.GetStudentByEmail(ctx, claims.Subject)
+	return claims.Subject, nil
+}
+
+func (a *Application) getStudentByQRToken(ctx context.Context, tokenStr string) (*database.Student, error) {
+	email, err := a.parseQRToken(tokenStr, IssuerStudentQRCode)
+	if err != nil {
+		return nil, err
+	}
+	return a.DB.GetStudentByEmail(ctx, email)
 }
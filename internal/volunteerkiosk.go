@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+type CheckInAPIRequest struct {
+	// Token is either the student's QR code token, or the whole URL that is
+	// encoded in the QR code.
+	Token string `json:"token"`
+	// Direction is whether the student is arriving or leaving. It defaults to
+	// arriving.
+	Direction database.CheckInDirection `json:"direction"`
+	// Station identifies the kiosk or door that the student was scanned at.
+	Station string `json:"station"`
+}
+
+type CheckInAPIStudent struct {
+	Name                    string `json:"name"`
+	Email                   string `json:"email"`
+	EmailConfirmed          bool   `json:"email_confirmed"`
+	LiabilitySigned         bool   `json:"liability_signed"`
+	ComputerUseWaiverSigned bool   `json:"computer_use_waiver_signed"`
+	// Minor is true if the student is under 18, in which case they should
+	// only leave early with the permission of their teacher or parent.
+	Minor bool `json:"minor"`
+}
+
+type CheckInAPITeam struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Room and Seat are where the team is seated, if it has been assigned a
+	// seat.
+	Room string `json:"room,omitempty"`
+	Seat int    `json:"seat,omitempty"`
+}
+
+// CheckInAPIChaperone is a teacher or chaperone whose ticket was scanned.
+type CheckInAPIChaperone struct {
+	Name        string `json:"name"`
+	IsTeacher   bool   `json:"is_teacher"`
+	TeacherName string `json:"teacher_name"`
+	SchoolName  string `json:"school_name"`
+}
+
+type CheckInAPIResponse struct {
+	Error   string             `json:"error,omitempty"`
+	Student *CheckInAPIStudent `json:"student,omitempty"`
+	Team    *CheckInAPITeam    `json:"team,omitempty"`
+	// Chaperone is set instead of Student and Team if a chaperone's ticket
+	// was scanned. Chaperones are only checked in, never out.
+	Chaperone   *CheckInAPIChaperone `json:"chaperone,omitempty"`
+	NotInPerson bool                 `json:"not_in_person,omitempty"`
+	// AllGood is true if the student has completed all of the steps required
+	// to check in.
+	AllGood bool `json:"all_good"`
+	// CheckedIn is true if the student is checked in after this request.
+	CheckedIn bool `json:"checked_in"`
+	// AlreadyCheckedIn is true if the student was checked in before this
+	// request.
+	AlreadyCheckedIn bool `json:"already_checked_in"`
+	// CheckedOut is true if the student was checked out by this request.
+	CheckedOut bool `json:"checked_out,omitempty"`
+	// NotOnSite is true if the student was being checked out but was not
+	// checked in.
+	NotOnSite bool `json:"not_on_site,omitempty"`
+}
+
+func writeJSON(log zerolog.Logger, w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Err(err).Msg("failed to write JSON response")
+	}
+}
+
+// extractQRToken returns the token from the scanned value, which may be the
+// full check-in URL.
+func extractQRToken(scanned string) string {
+	scanned = strings.TrimSpace(scanned)
+	if u, err := url.Parse(scanned); err == nil && u.Query().Has("tok") {
+		return u.Query().Get("tok")
+	}
+	return scanned
+}
+
+func (a *Application) GetVolunteerKioskTemplate(r *http.Request) map[string]any {
+	return map[string]any{
+		"RosterPublicKey": a.rosterPublicKey(),
+	}
+}
+
+// checkInStation returns the station to record for a kiosk, defaulting to a
+// generic kiosk station if the volunteer did not name it.
+func checkInStation(station string) string {
+	station = strings.TrimSpace(station)
+	if station == "" {
+		return checkInStationKiosk
+	}
+	return station
+}
+
+// HandleVolunteerCheckInAPI checks in the student identified by the scanned QR
+// code if they have completed all of the required steps, or checks them out
+// if they are leaving.
+func (a *Application) HandleVolunteerCheckInAPI(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := a.Log.With().Str("page_name", "volunteer_checkin_api").Logger()
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSON(log, w, http.StatusUnsupportedMediaType, CheckInAPIResponse{Error: "Expected a JSON request."})
+		return
+	}
+
+	var req CheckInAPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn().Err(err).Msg("failed to decode request")
+		writeJSON(log, w, http.StatusBadRequest, CheckInAPIResponse{Error: "Invalid request."})
+		return
+	}
+	if req.Direction == "" {
+		req.Direction = database.CheckInDirectionIn
+	} else if req.Direction != database.CheckInDirectionIn && req.Direction != database.CheckInDirectionOut {
+		writeJSON(log, w, http.StatusBadRequest, CheckInAPIResponse{Error: "Invalid direction."})
+		return
+	}
+
+	token := extractQRToken(req.Token)
+	if chaperone, err := a.getChaperoneByQRToken(ctx, token); err == nil {
+		a.handleChaperoneCheckInAPI(w, r, log, chaperone, req.Direction)
+		return
+	}
+	student, err := a.getStudentByQRToken(ctx, token)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to get student by token")
+		writeJSON(log, w, http.StatusNotFound, CheckInAPIResponse{Error: "Invalid ticket. Please send the student to the help desk."})
+		return
+	}
+	log = log.With().
+		Str("student_email", student.Email).
+		Str("direction", string(req.Direction)).
+		Logger()
+
+	team, err := a.DB.GetTeamNoMembers(ctx, student.TeamID)
+	if err != nil {
+		log.Err(err).Msg("failed to get team")
+		writeJSON(log, w, http.StatusInternalServerError, CheckInAPIResponse{Error: "Failed to find the student's team."})
+		return
+	}
+	seat, err := a.DB.GetTeamSeat(ctx, team.ID)
+	if err != nil {
+		log.Err(err).Msg("failed to get team seat")
+		writeJSON(log, w, http.StatusInternalServerError, CheckInAPIResponse{Error: "Failed to find the student's seat."})
+		return
+	}
+
+	resp := CheckInAPIResponse{
+		Student: &CheckInAPIStudent{
+			Name:                    student.Name,
+			Email:                   student.Email,
+			EmailConfirmed:          student.EmailConfirmed,
+			LiabilitySigned:         student.LiabilitySigned,
+			ComputerUseWaiverSigned: student.ComputerUseWaiverSigned,
+			Minor:                   student.Age < 18,
+		},
+		Team: &CheckInAPITeam{
+			ID:   team.ID.String(),
+			Name: team.Name,
+		},
+		NotInPerson:      !team.InPerson,
+		AllGood:          team.InPerson && completedCheckInSteps(student),
+		CheckedIn:        student.CheckedIn,
+		AlreadyCheckedIn: student.CheckedIn,
+	}
+
+	volunteerEmail := a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin)
+	station := checkInStation(req.Station)
+	now := time.Now()
+	if seat != nil {
+		resp.Team.Room = seat.RoomName
+		resp.Team.Seat = seat.Seat
+	}
+
+	if req.Direction == database.CheckInDirectionOut {
+		resp.AlreadyCheckedIn = false
+		if !student.CheckedIn {
+			resp.NotOnSite = true
+		} else if recorded, err := a.DB.CheckOutStudent(ctx, student.Email, now, volunteerEmail, station); err != nil {
+			log.Err(err).Msg("failed to check out student")
+			resp.Error = "Failed to check out the student. Please try again."
+			writeJSON(log, w, http.StatusInternalServerError, resp)
+			return
+		} else {
+			log.Info().Msg("checked out student")
+			if recorded {
+				a.publishStudentEvent(ctx, LiveEventCheckedOut, student.Email, now, station)
+			}
+			resp.CheckedIn = false
+			resp.CheckedOut = true
+		}
+	} else if resp.AllGood && !student.CheckedIn {
+		recorded, err := a.DB.CheckInStudent(ctx, student.Email, now, volunteerEmail, station)
+		if err != nil {
+			log.Err(err).Msg("failed to check in student")
+			resp.Error = "Failed to check in the student. Please try again."
+			writeJSON(log, w, http.StatusInternalServerError, resp)
+			return
+		}
+		log.Info().Msg("checked in student")
+		if recorded {
+			a.publishStudentEvent(ctx, LiveEventCheckedIn, student.Email, now, station)
+		}
+		resp.CheckedIn = true
+	}
+
+	writeJSON(log, w, http.StatusOK, resp)
+}
+
+// handleChaperoneCheckInAPI checks in a teacher or chaperone whose ticket was
+// scanned at a kiosk. Scanning them when they are leaving does nothing.
+func (a *Application) handleChaperoneCheckInAPI(w http.ResponseWriter, r *http.Request, log zerolog.Logger, chaperone *database.Chaperone, direction database.CheckInDirection) {
+	ctx := r.Context()
+	log = log.With().
+		Int64("chaperone_id", chaperone.ID).
+		Str("direction", string(direction)).
+		Logger()
+
+	teacher, err := a.DB.GetTeacherByEmail(ctx, chaperone.TeacherEmail)
+	if err != nil {
+		log.Err(err).Msg("failed to get chaperone's teacher")
+		writeJSON(log, w, http.StatusInternalServerError, CheckInAPIResponse{Error: "Failed to find the chaperone's teacher."})
+		return
+	}
+	resp := CheckInAPIResponse{
+		Chaperone: &CheckInAPIChaperone{
+			Name:        chaperone.Name,
+			IsTeacher:   chaperone.IsTeacher,
+			TeacherName: teacher.Name,
+			SchoolName:  teacher.SchoolName,
+		},
+		CheckedIn:        chaperone.CheckedIn,
+		AlreadyCheckedIn: chaperone.CheckedIn,
+	}
+	if chaperone.Season != currentSeason() {
+		resp.Error = "This ticket is not for this year's competition. Please send them to the help desk."
+		writeJSON(log, w, http.StatusNotFound, resp)
+		return
+	}
+	resp.AllGood = true
+	if direction == database.CheckInDirectionOut || chaperone.CheckedIn {
+		writeJSON(log, w, http.StatusOK, resp)
+		return
+	}
+
+	volunteerEmail := a.getCookieTokenSubject(r, "volunteer_token", IssuerVolunteerLogin)
+	if _, err = a.DB.CheckInChaperone(ctx, chaperone.ID, time.Now(), volunteerEmail); err != nil {
+		log.Err(err).Msg("failed to check in chaperone")
+		resp.Error = "Failed to check in the chaperone. Please try again."
+		writeJSON(log, w, http.StatusInternalServerError, resp)
+		return
+	}
+	log.Info().Str("volunteer_email", volunteerEmail).Msg("checked in chaperone")
+	resp.CheckedIn = true
+	writeJSON(log, w, http.StatusOK, resp)
+}
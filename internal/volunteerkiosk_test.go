@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolunteerCheckInAPI(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	addTestStudent(t, a, "student@example.com", 18)
+	router := a.BuildRouter()
+
+	qrURL, err := a.getStudentQRCodeURL("student@example.com")
+	require.NoError(t, err)
+
+	checkIn := func() CheckInAPIResponse {
+		body, err := json.Marshal(CheckInAPIRequest{Token: qrURL})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/volunteer/api/checkin", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "volunteer_token", Value: volunteerToken(t)})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp CheckInAPIResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp
+	}
+
+	resp := checkIn()
+	assert.False(t, resp.AllGood)
+	assert.False(t, resp.CheckedIn, "students with incomplete forms should not be checked in")
+	assert.Equal(t, "Team", resp.Team.Name)
+
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "student@example.com", false, "", ""))
+	require.NoError(t, a.DB.SignFormsForStudent(ctx, "student@example.com", "Student", true))
+
+	resp = checkIn()
+	assert.True(t, resp.AllGood)
+	assert.True(t, resp.CheckedIn)
+	assert.False(t, resp.AlreadyCheckedIn)
+
+	resp = checkIn()
+	assert.True(t, resp.AlreadyCheckedIn)
+}
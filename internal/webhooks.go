@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+// Webhooks let other systems, such as the Discord bot and the judging system,
+// react to registration and check-in activity. Each event is saved as a
+// delivery for every webhook that subscribes to it, and the deliveries are
+// sent in the background so that a slow receiver never slows down the request
+// that caused the event.
+//
+// Every delivery is a POST of a JSON WebhookPayload. Receivers should verify
+// the X-HSPC-Signature header, which is "sha256=" followed by the hex-encoded
+// HMAC-SHA256 of the X-HSPC-Timestamp header, a period and the request body,
+// keyed with the webhook's secret.
+
+const (
+	webhookSignatureHeader = "X-HSPC-Signature"
+	webhookTimestampHeader = "X-HSPC-Timestamp"
+	webhookEventHeader     = "X-HSPC-Event"
+	webhookDeliveryHeader  = "X-HSPC-Delivery"
+
+	// webhookPollInterval is how often the dispatcher checks for deliveries
+	// that are due to be retried.
+	webhookPollInterval = 15 * time.Second
+	webhookBatchSize    = 50
+	webhookTimeout      = 10 * time.Second
+	// webhookMaxErrorLength limits how much of a failed response is kept in
+	// the delivery log.
+	webhookMaxErrorLength = 500
+)
+
+// webhookRetryDelays are the delays before each retry of a failed delivery.
+// Once they are used up, the delivery is marked as failed.
+var webhookRetryDelays = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+}
+
+type WebhookPayload struct {
+	ID   string                    `json:"id"`
+	Type database.WebhookEventType `json:"type"`
+	// OccurredAt is when the event happened, which may be before the payload
+	// was created, for example when an offline kiosk syncs its check-ins.
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+type WebhookStudentData struct {
+	Student APIStudentWithTeam `json:"student"`
+	// Station is where the student was scanned, for check-in events.
+	Station string `json:"station,omitempty"`
+}
+
+type WebhookTeamData struct {
+	Team APITeam `json:"team"`
+}
+
+type WebhookDispatcher struct {
+	db     *database.Database
+	log    zerolog.Logger
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewWebhookDispatcher(log *zerolog.Logger, db *database.Database) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:     db,
+		log:    log.With().Str("component", "webhooks").Logger(),
+		client: &http.Client{Timeout: webhookTimeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// signWebhookPayload returns the signature of the payload that was sent at the
+// given Unix timestamp.
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue saves a delivery of the event for every enabled webhook that
+// subscribes to it. Errors are logged rather than returned since the event has
+// already happened.
+func (d *WebhookDispatcher) Enqueue(ctx context.Context, eventType database.WebhookEventType, occurredAt time.Time, data any) {
+	webhooks, err := d.db.GetWebhooks(ctx)
+	if err != nil {
+		d.log.Err(err).Str("event_type", string(eventType)).Msg("failed to get webhooks")
+		return
+	}
+	var subscribed []*database.Webhook
+	for _, webhook := range webhooks {
+		if !webhook.Disabled() && webhook.Subscribed(eventType) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	if len(subscribed) > 0 {
+		d.enqueue(ctx, subscribed, eventType, occurredAt, data)
+	}
+}
+
+// Ping sends a ping event to the webhook, even if it is disabled, so that
+// admins can check that the receiver works.
+func (d *WebhookDispatcher) Ping(ctx context.Context, webhook *database.Webhook) {
+	d.enqueue(ctx, []*database.Webhook{webhook}, database.WebhookEventPing, time.Now(), map[string]any{
+		"webhook_id": webhook.ID,
+		"events":     webhook.Events,
+	})
+}
+
+func (d *WebhookDispatcher) enqueue(ctx context.Context, webhooks []*database.Webhook, eventType database.WebhookEventType, occurredAt time.Time, data any) {
+	log := d.log.With().Str("event_type", string(eventType)).Logger()
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	payload := WebhookPayload{ID: uuid.NewString(), Type: eventType, OccurredAt: occurredAt, Data: data}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.Err(err).Msg("failed to marshal webhook payload")
+		return
+	}
+	for _, webhook := range webhooks {
+		delivery := &database.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   payload.ID,
+			EventType: eventType,
+			Payload:   string(payloadJSON),
+		}
+		if err := d.db.AddWebhookDelivery(ctx, delivery); err != nil {
+			log.Err(err).Int64("webhook_id", webhook.ID).Msg("failed to save webhook delivery")
+		}
+	}
+	d.Wake()
+}
+
+// Wake makes the dispatcher check for due deliveries now rather than at the
+// next poll.
+func (d *WebhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends deliveries as they become due until the context is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.deliverDue(ctx, time.Now()); err != nil {
+			d.log.Err(err).Msg("failed to send due webhook deliveries")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends all of the deliveries that are due at the given time.
+func (d *WebhookDispatcher) deliverDue(ctx context.Context, now time.Time) error {
+	for {
+		deliveries, err := d.db.GetDueWebhookDeliveries(ctx, now, webhookBatchSize)
+		if err != nil {
+			return err
+		} else if len(deliveries) == 0 {
+			return nil
+		}
+		webhooks, err := d.db.GetWebhooks(ctx)
+		if err != nil {
+			return err
+		}
+		secrets := map[int64]string{}
+		for _, webhook := range webhooks {
+			secrets[webhook.ID] = webhook.Secret
+		}
+		for _, delivery := range deliveries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if secret, ok := secrets[delivery.WebhookID]; ok {
+				d.attempt(ctx, delivery, secret, now)
+			} else {
+				// The webhook was deleted while the delivery was being read.
+				delivery.Status = database.WebhookDeliveryFailed
+				delivery.LastError = "webhook was deleted"
+			}
+			if err := d.db.UpdateWebhookDeliveryAttempt(ctx, delivery); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return nil
+		}
+	}
+}
+
+// attempt sends the delivery and updates it with the result. If the attempt
+// fails, the delivery is scheduled to be retried after the next delay.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *database.WebhookDelivery, secret string, now time.Time) {
+	log := d.log.With().
+		Int64("delivery_id", delivery.ID).
+		Int64("webhook_id", delivery.WebhookID).
+		Str("event_type", string(delivery.EventType)).
+		Logger()
+	delivery.Attempts++
+	delivery.LastAttemptTS = now
+	delivery.ResponseStatus = 0
+	delivery.LastError = ""
+
+	err := d.send(ctx, delivery, secret)
+	if err == nil {
+		delivery.Status = database.WebhookDeliveryDelivered
+		log.Info().Int("attempts", delivery.Attempts).Msg("delivered webhook")
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > webhookMaxErrorLength {
+		delivery.LastError = delivery.LastError[:webhookMaxErrorLength]
+	}
+	if delivery.Attempts > len(webhookRetryDelays) {
+		delivery.Status = database.WebhookDeliveryFailed
+		log.Warn().Err(err).Int("attempts", delivery.Attempts).Msg("giving up on webhook delivery")
+	} else {
+		delivery.NextAttemptTS = now.Add(webhookRetryDelays[delivery.Attempts-1])
+		log.Warn().Err(err).Int("attempts", delivery.Attempts).Time("next_attempt", delivery.NextAttemptTS).Msg("webhook delivery failed, will retry")
+	}
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *database.WebhookDelivery, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.WebhookURL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mineshspc.com-webhooks")
+	req.Header.Set(webhookEventHeader, string(delivery.EventType))
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	delivery.ResponseStatus = resp.StatusCode
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorLength))
+		return fmt.Errorf("receiver responded with %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// liveEventWebhookTypes are the webhook event types of the live dashboard
+// events about students.
+var liveEventWebhookTypes = map[LiveEventKind]database.WebhookEventType{
+	LiveEventRegistered:  database.WebhookEventStudentRegistered,
+	LiveEventConfirmed:   database.WebhookEventStudentConfirmed,
+	LiveEventFormsSigned: database.WebhookEventStudentFormsSigned,
+	LiveEventCheckedIn:   database.WebhookEventStudentCheckedIn,
+	LiveEventCheckedOut:  database.WebhookEventStudentCheckedOut,
+}
@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+type receivedWebhook struct {
+	Header  http.Header
+	Body    []byte
+	Payload WebhookPayload
+}
+
+// webhookReceiver is a local webhook receiver that responds with the given
+// statuses in order, and then with 200.
+type webhookReceiver struct {
+	*httptest.Server
+	lock     sync.Mutex
+	received []receivedWebhook
+	statuses []int
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{statuses: statuses}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var payload WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+
+		receiver.lock.Lock()
+		defer receiver.lock.Unlock()
+		receiver.received = append(receiver.received, receivedWebhook{Header: r.Header, Body: body, Payload: payload})
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) Received() []receivedWebhook {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.received)
+}
+
+func addTestWebhook(t *testing.T, a *Application, webhookURL string, events ...database.WebhookEventType) *database.Webhook {
+	t.Helper()
+	webhook := &database.Webhook{URL: webhookURL, Events: events, Secret: "secret", CreatedBy: "admin@example.com"}
+	require.NoError(t, a.DB.AddWebhook(context.Background(), webhook))
+	return webhook
+}
+
+func TestWebhooks_Delivery(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.RegistrationEnabled = true
+	router := a.BuildRouter()
+	addTestStudent(t, a, "student@example.com", 16)
+
+	receiver := newWebhookReceiver(t)
+	addTestWebhook(t, a, receiver.URL, database.WebhookEventStudentCheckedIn, database.WebhookEventTeamRegistered)
+	disabledReceiver := newWebhookReceiver(t)
+	disabled := addTestWebhook(t, a, disabledReceiver.URL, database.WebhookEventStudentCheckedIn)
+	require.NoError(t, a.DB.SetWebhookDisabled(ctx, disabled.ID, true))
+
+	checkInTS := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	recorded, err := a.DB.CheckInStudent(ctx, "student@example.com", checkInTS, "volunteer@example.com", "kiosk-1")
+	require.NoError(t, err)
+	require.True(t, recorded)
+	a.publishCheckInEvent(ctx, &database.CheckInEvent{StudentEmail: "student@example.com", Direction: database.CheckInDirectionIn, TS: checkInTS, Station: "kiosk-1"})
+	// Nobody subscribes to confirmations.
+	a.publishStudentEvent(ctx, LiveEventConfirmed, "student@example.com", time.Now(), "")
+
+	// Registering a new team sends a team.registered event.
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Issuer:    string(IssuerSessionToken),
+		Subject:   "teacher@example.com",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte(testSecretKey))
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/register/teacher/team/edit", strings.NewReader(url.Values{"team-name": {"New Team"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "tok", Value: tok})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+
+	require.NoError(t, a.Webhooks.deliverDue(ctx, time.Now()))
+	assert.Empty(t, disabledReceiver.Received())
+	received := receiver.Received()
+	require.Len(t, received, 2)
+
+	checkIn := received[0]
+	assert.Equal(t, database.WebhookEventStudentCheckedIn, checkIn.Payload.Type)
+	assert.True(t, checkInTS.Equal(checkIn.Payload.OccurredAt))
+	assert.Equal(t, "student.checked_in", checkIn.Header.Get(webhookEventHeader))
+	assert.Equal(t, signWebhookPayload("secret", checkIn.Header.Get(webhookTimestampHeader), checkIn.Body), checkIn.Header.Get(webhookSignatureHeader))
+	var studentData struct {
+		Data WebhookStudentData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(checkIn.Body, &studentData))
+	assert.Equal(t, "student@example.com", studentData.Data.Student.Email)
+	assert.Equal(t, "Team", studentData.Data.Student.TeamName)
+	assert.Equal(t, "School", studentData.Data.Student.School)
+	assert.Equal(t, "kiosk-1", studentData.Data.Station)
+
+	teamRegistered := received[1]
+	assert.Equal(t, database.WebhookEventTeamRegistered, teamRegistered.Payload.Type)
+	var teamData struct {
+		Data WebhookTeamData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(teamRegistered.Body, &teamData))
+	assert.Equal(t, "New Team", teamData.Data.Team.Name)
+	assert.Equal(t, "teacher@example.com", teamData.Data.Team.TeacherEmail)
+
+	deliveries, err := a.DB.GetRecentWebhookDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	for _, delivery := range deliveries {
+		assert.Equal(t, database.WebhookDeliveryDelivered, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusOK, delivery.ResponseStatus)
+	}
+}
+
+func TestWebhooks_Retry(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	webhook := addTestWebhook(t, a, receiver.URL, database.WebhookEventStudentRegistered)
+	a.Webhooks.Ping(ctx, webhook)
+
+	now := time.Now()
+	require.NoError(t, a.Webhooks.deliverDue(ctx, now))
+	deliveries, err := a.DB.GetRecentWebhookDeliveries(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.Equal(t, database.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, delivery.ResponseStatus)
+	assert.Contains(t, delivery.LastError, "500")
+	assert.WithinDuration(t, now.Add(webhookRetryDelays[0]), delivery.NextAttemptTS, time.Second)
+
+	// The retry is not due yet.
+	require.NoError(t, a.Webhooks.deliverDue(ctx, now.Add(time.Second)))
+	assert.Len(t, receiver.Received(), 1)
+
+	require.NoError(t, a.Webhooks.deliverDue(ctx, now.Add(webhookRetryDelays[0]+time.Second)))
+	received := receiver.Received()
+	require.Len(t, received, 2)
+	assert.Equal(t, received[0].Payload.ID, received[1].Payload.ID, "retries should resend the same event")
+	deliveries, err = a.DB.GetRecentWebhookDeliveries(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, database.WebhookDeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Empty(t, deliveries[0].LastError)
+
+	// A receiver that never succeeds is given up on after the last retry.
+	failing := newWebhookReceiver(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway,
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	failingWebhook := addTestWebhook(t, a, failing.URL, database.WebhookEventStudentRegistered)
+	a.Webhooks.Ping(ctx, failingWebhook)
+	now = time.Now()
+	for range len(webhookRetryDelays) + 1 {
+		require.NoError(t, a.Webhooks.deliverDue(ctx, now))
+		now = now.Add(3 * time.Hour)
+	}
+	deliveries, err = a.DB.GetRecentWebhookDeliveries(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, database.WebhookDeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, len(webhookRetryDelays)+1, deliveries[0].Attempts)
+	require.NoError(t, a.Webhooks.deliverDue(ctx, now))
+	assert.Len(t, failing.Received(), len(webhookRetryDelays)+1)
+}
+
+func TestAdminWebhooks(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	cookie := &http.Cookie{Name: "admin_token", Value: adminToken(t)}
+	receiver := newWebhookReceiver(t, http.StatusTeapot)
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/admin/webhooks/add", url.Values{"url": {"ftp://example.com"}, "event": {"student.checked_in"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+	rec = post("/admin/webhooks/add", url.Values{"url": {receiver.URL}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+	rec = post("/admin/webhooks/add", url.Values{"url": {receiver.URL}, "event": {"ping"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=")
+
+	rec = post("/admin/webhooks/add", url.Values{"url": {receiver.URL}, "description": {"Discord"}, "event": {"student.checked_in", "student.confirmed"}})
+	assert.Contains(t, rec.Header().Get("Location"), "message=")
+	webhooks, err := a.DB.GetWebhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	webhook := webhooks[0]
+	assert.Equal(t, []database.WebhookEventType{database.WebhookEventStudentCheckedIn, database.WebhookEventStudentConfirmed}, webhook.Events)
+	assert.True(t, strings.HasPrefix(webhook.Secret, "whsec_"))
+	assert.Equal(t, "test@example.com", webhook.CreatedBy)
+
+	rec = post("/admin/webhooks/ping", url.Values{"id": {"1"}})
+	assert.Contains(t, rec.Header().Get("Location"), "message=")
+	require.NoError(t, a.Webhooks.deliverDue(ctx, time.Now()))
+	require.Len(t, receiver.Received(), 1)
+	assert.Equal(t, database.WebhookEventPing, receiver.Received()[0].Payload.Type)
+
+	page := doRequest(router, http.MethodGet, "/admin/webhooks", cookie)
+	require.Equal(t, http.StatusOK, page.Code)
+	assert.Contains(t, page.Body.String(), "Discord")
+	assert.Contains(t, page.Body.String(), "418")
+
+	// Redelivering starts a fresh set of retries right away.
+	rec = post("/admin/webhooks/redeliver", url.Values{"id": {"1"}})
+	assert.Contains(t, rec.Header().Get("Location"), "message=")
+	require.NoError(t, a.Webhooks.deliverDue(ctx, time.Now()))
+	require.Len(t, receiver.Received(), 2)
+	deliveries, err := a.DB.GetRecentWebhookDeliveries(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, database.WebhookDeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+
+	assertRedirectsTo(t, post("/admin/webhooks/disable", url.Values{"id": {"1"}, "disabled": {"true"}}), "/admin/webhooks")
+	webhook, err = a.DB.GetWebhook(ctx, webhook.ID)
+	require.NoError(t, err)
+	assert.True(t, webhook.Disabled())
+
+	assertRedirectsTo(t, post("/admin/webhooks/delete", url.Values{"id": {"1"}}), "/admin/webhooks")
+	webhooks, err = a.DB.GetWebhooks(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, webhooks)
+	deliveries, err = a.DB.GetRecentWebhookDeliveries(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+}
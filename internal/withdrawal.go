@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/rs/zerolog"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+type WithdrawalReason string
+
+const (
+	WithdrawalReasonSelf    WithdrawalReason = "self"
+	WithdrawalReasonRemoved WithdrawalReason = "removed"
+	WithdrawalReasonTeam    WithdrawalReason = "team"
+)
+
+// refundEmailSends stops the emails sent to the withdrawn students from
+// counting against the teacher's email send budget.
+func (a *Application) refundEmailSends(ctx context.Context, teacherEmail string, students []database.Student) error {
+	if !a.Config.Withdrawal.RefundSends {
+		return nil
+	}
+
+	for _, student := range students {
+		if student.EmailConfirmed && !a.Config.Withdrawal.RefundConfirmed {
+			continue
+		}
+		zerolog.Ctx(ctx).Info().
+			Str("teacher_email", teacherEmail).
+			Str("student_email", student.Email).
+			Msg("refunding email sends for withdrawn student")
+		if err := a.DB.RefundEmailSends(ctx, teacherEmail, student.Email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendWithdrawalNoticeEmail lets the student (and their parent, if we have
+// their email) know that the student is no longer registered.
+func (a *Application) sendWithdrawalNoticeEmail(ctx context.Context, student *database.Student, team *database.Team, teacherName string, reason WithdrawalReason) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("action", "sendWithdrawalNoticeEmail").
+		Str("reason", string(reason)).
+		Logger()
+
+	templateData := map[string]any{
+		"StudentName": student.Name,
+		"TeamName":    team.Name,
+		"TeacherName": teacherName,
+		"Reason":      string(reason),
+	}
+
+	var plainTextContent, htmlContent strings.Builder
+	texttemplate.Must(texttemplate.ParseFS(emailTemplates, "emailtemplates/withdrawn.txt")).Execute(&plainTextContent, templateData)
+	htmltemplate.Must(htmltemplate.ParseFS(emailTemplates, "emailtemplates/withdrawn.html")).Execute(&htmlContent, templateData)
+
+	recipients := []*mail.Email{mail.NewEmail(student.Name, student.Email)}
+	if student.ParentEmail != "" && student.Age < 18 {
+		recipients = append(recipients, mail.NewEmail("", student.ParentEmail))
+	}
+
+	for _, to := range recipients {
+		err := a.SendEmail(log, "Mines HSPC Registration Withdrawn",
+			to,
+			plainTextContent.String(),
+			htmlContent.String())
+		if err != nil {
+			log.Err(err).Msg("failed to send email")
+			return err
+		}
+	}
+	log.Info().Msg("sent withdrawal notice emails")
+	return nil
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ColoradoSchoolOfMines/mineshspc.com/database"
+)
+
+func TestWithdrawStudent_ReleasesSeatAndCanBeReadded(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teamID, student := addTestStudent(t, a, "student@example.com", 16)
+
+	require.NoError(t, a.DB.WithdrawStudent(ctx, student.Email))
+
+	team, err := a.DB.GetTeam(ctx, "teacher@example.com", teamID)
+	require.NoError(t, err)
+	assert.Empty(t, team.Members)
+
+	_, err = a.DB.GetStudentByEmail(ctx, student.Email)
+	assert.Error(t, err, "withdrawn students should not be usable by token flows")
+
+	withdrawn, err := a.DB.GetWithdrawnStudents(ctx)
+	require.NoError(t, err)
+	require.Len(t, withdrawn, 1)
+	assert.Equal(t, student.Email, withdrawn[0].Email)
+
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Student", 16, student.Email, false))
+	assert.ErrorIs(t, a.DB.AddTeamMember(ctx, teamID, "Student", 16, student.Email, false), database.ErrStudentAlreadyRegistered)
+}
+
+func TestWithdrawTeam_RefundsEmailSends(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	a.Config.Withdrawal.RefundSends = true
+	teamID, _ := addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Confirmed", 17, "confirmed@example.com", false))
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "confirmed@example.com", false, "", "parent@example.com"))
+	for _, email := range []string{"student@example.com", "confirmed@example.com"} {
+		require.NoError(t, a.DB.RecordEmailSend(ctx, &database.EmailSend{
+			TeacherEmail: "teacher@example.com",
+			StudentEmail: email,
+			Recipient:    email,
+			Kind:         database.EmailKindStudentVerify,
+			Source:       database.EmailSourceTeacher,
+			Status:       database.EmailStatusAccepted,
+		}))
+	}
+
+	team, err := a.DB.GetTeam(ctx, "teacher@example.com", teamID)
+	require.NoError(t, err)
+	require.NoError(t, a.DB.WithdrawTeam(ctx, teamID))
+	require.NoError(t, a.refundEmailSends(ctx, "teacher@example.com", team.Members))
+
+	firstSends, _, err := a.DB.CountEmailSends(ctx, "teacher@example.com", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, firstSends, "only the unconfirmed student should be refunded")
+
+	teams, err := a.DB.GetTeacherTeams(ctx, "teacher@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, teams)
+}
+
+func TestWithdrawStudent_ExcludedFromDietaryRestrictions(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	router := a.BuildRouter()
+	teamID, withdrawn := addTestStudent(t, a, "withdrawn@example.com", 16)
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Staying", 17, "staying@example.com", false))
+	require.NoError(t, a.DB.ConfirmStudent(ctx, withdrawn.Email, false, "No peanuts", "parent@example.com"))
+	require.NoError(t, a.DB.ConfirmStudent(ctx, "staying@example.com", false, "Vegan", "parent@example.com"))
+	require.NoError(t, a.DB.WithdrawStudent(ctx, withdrawn.Email))
+
+	rec := doRequest(router, http.MethodGet, "/admin/api/dietaryrestrictions", &http.Cookie{Name: "admin_token", Value: adminToken(t)})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Dietary Restriction\nVegan\n", rec.Body.String())
+}
+
+func TestWithdraw_DeletesEmergencyInfo(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAppWithDB(t)
+	teamID, student := addTestStudent(t, a, "student@example.com", 16)
+	require.NoError(t, a.DB.AddTeamMember(ctx, teamID, "Teammate", 16, "teammate@example.com", false))
+	for _, email := range []string{student.Email, "teammate@example.com"} {
+		require.NoError(t, a.DB.SaveEmergencyInfo(ctx, &database.EmergencyInfo{
+			StudentEmail: email,
+			ContactName:  "Parent",
+			ContactPhone: "555-0100",
+			MedicalNotes: "Asthma",
+		}))
+	}
+
+	require.NoError(t, a.DB.WithdrawStudent(ctx, student.Email))
+	info, err := a.DB.GetEmergencyInfo(ctx, student.Email)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+	info, err = a.DB.GetEmergencyInfo(ctx, "teammate@example.com")
+	require.NoError(t, err)
+	assert.NotNil(t, info, "only the withdrawn student's info should be deleted")
+
+	require.NoError(t, a.DB.WithdrawTeam(ctx, teamID))
+	info, err = a.DB.GetEmergencyInfo(ctx, "teammate@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	// Info that was saved while the student was withdrawn doesn't come back
+	// when they are added to a team again.
+	require.NoError(t, a.DB.SaveEmergencyInfo(ctx, &database.EmergencyInfo{StudentEmail: student.Email, MedicalNotes: "Asthma"}))
+	otherTeamID := uuid.New()
+	require.NoError(t, a.DB.UpsertTeam(ctx, "teacher@example.com", otherTeamID, "Other", database.DivisionBeginner, true, "", ""))
+	require.NoError(t, a.DB.AddTeamMember(ctx, otherTeamID, "Student", 16, student.Email, false))
+	info, err = a.DB.GetEmergencyInfo(ctx, student.Email)
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
@@ -0,0 +1,1187 @@
+// qrdecode.js decodes QR codes in camera frames. The volunteer kiosk uses it
+// in browsers that do not have the BarcodeDetector API, such as Safari and
+// Firefox. It is served with the site so that the kiosk keeps working
+// offline and does not load any third-party scripts.
+//
+// The decoder follows the approach of ZXing: the image is binarized with a
+// local threshold, the three finder patterns (and the alignment pattern, if
+// there is one) are located, the modules are sampled through a perspective
+// transform, and the codewords are error corrected and decoded.
+//
+// Usage: decodeQR(imageData.data, imageData.width, imageData.height) returns
+// the text of the first QR code that is found, or null.
+(function (global) {
+  "use strict";
+
+  // --- Binarization ---------------------------------------------------------
+
+  const BLOCK_SIZE = 8;
+  const MIN_DYNAMIC_RANGE = 24;
+
+  // BitImage is a binarized image where true is a dark pixel.
+  function BitImage(width, height, bits) {
+    this.width = width;
+    this.height = height;
+    this.bits = bits;
+  }
+
+  BitImage.prototype.get = function (x, y) {
+    return x >= 0 && y >= 0 && x < this.width && y < this.height && this.bits[y * this.width + x] === 1;
+  };
+
+  function luminances(rgba, width, height) {
+    const lum = new Uint8ClampedArray(width * height);
+    for (let i = 0, p = 0; i < lum.length; i++, p += 4) {
+      lum[i] = (rgba[p] * 299 + rgba[p + 1] * 587 + rgba[p + 2] * 114) / 1000;
+    }
+    return lum;
+  }
+
+  // binarize thresholds each 8x8 block of pixels against the average of the
+  // 5x5 blocks around it, which copes with uneven lighting.
+  function binarize(lum, width, height) {
+    const bits = new Uint8Array(width * height);
+    if (width < BLOCK_SIZE * 5 || height < BLOCK_SIZE * 5) {
+      let sum = 0;
+      for (let i = 0; i < lum.length; i++) sum += lum[i];
+      const threshold = sum / lum.length;
+      for (let i = 0; i < lum.length; i++) bits[i] = lum[i] <= threshold ? 1 : 0;
+      return new BitImage(width, height, bits);
+    }
+
+    const subWidth = Math.ceil(width / BLOCK_SIZE);
+    const subHeight = Math.ceil(height / BLOCK_SIZE);
+    const blackPoints = new Float64Array(subWidth * subHeight);
+    for (let by = 0; by < subHeight; by++) {
+      const yOffset = Math.min(by * BLOCK_SIZE, height - BLOCK_SIZE);
+      for (let bx = 0; bx < subWidth; bx++) {
+        const xOffset = Math.min(bx * BLOCK_SIZE, width - BLOCK_SIZE);
+        let sum = 0;
+        let min = 255;
+        let max = 0;
+        for (let y = 0; y < BLOCK_SIZE; y++) {
+          const row = (yOffset + y) * width + xOffset;
+          for (let x = 0; x < BLOCK_SIZE; x++) {
+            const value = lum[row + x];
+            sum += value;
+            if (value < min) min = value;
+            if (value > max) max = value;
+          }
+        }
+        let average = sum / (BLOCK_SIZE * BLOCK_SIZE);
+        if (max - min <= MIN_DYNAMIC_RANGE) {
+          // A flat block is assumed to be light, unless it is darker than
+          // its neighbors, in which case it is inside a dark area.
+          average = min / 2;
+          if (bx > 0 && by > 0) {
+            const neighbors = (blackPoints[(by - 1) * subWidth + bx] + 2 * blackPoints[by * subWidth + bx - 1] +
+              blackPoints[(by - 1) * subWidth + bx - 1]) / 4;
+            if (min < neighbors) average = neighbors;
+          }
+        }
+        blackPoints[by * subWidth + bx] = average;
+      }
+    }
+
+    for (let by = 0; by < subHeight; by++) {
+      const yOffset = Math.min(by * BLOCK_SIZE, height - BLOCK_SIZE);
+      const top = Math.min(Math.max(by, 2), subHeight - 3);
+      for (let bx = 0; bx < subWidth; bx++) {
+        const xOffset = Math.min(bx * BLOCK_SIZE, width - BLOCK_SIZE);
+        const left = Math.min(Math.max(bx, 2), subWidth - 3);
+        let sum = 0;
+        for (let dy = -2; dy <= 2; dy++) {
+          const row = Math.min(Math.max(top + dy, 0), subHeight - 1) * subWidth;
+          for (let dx = -2; dx <= 2; dx++) {
+            sum += blackPoints[row + Math.min(Math.max(left + dx, 0), subWidth - 1)];
+          }
+        }
+        const threshold = sum / 25;
+        for (let y = 0; y < BLOCK_SIZE; y++) {
+          const row = (yOffset + y) * width + xOffset;
+          for (let x = 0; x < BLOCK_SIZE; x++) {
+            bits[row + x] = lum[row + x] <= threshold ? 1 : 0;
+          }
+        }
+      }
+    }
+    return new BitImage(width, height, bits);
+  }
+
+  // --- Finder patterns ------------------------------------------------------
+
+  function distance(a, b) {
+    return Math.hypot(a.x - b.x, a.y - b.y);
+  }
+
+  function sum(counts) {
+    let total = 0;
+    for (let i = 0; i < counts.length; i++) total += counts[i];
+    return total;
+  }
+
+  // isFinderRatio reports whether the run lengths are close to the 1:1:3:1:1
+  // ratio of a line through the middle of a finder pattern.
+  function isFinderRatio(counts, strict) {
+    const total = sum(counts);
+    if (total < 7 || counts.indexOf(0) !== -1) return false;
+    const moduleSize = total / 7;
+    const maxVariance = strict ? moduleSize / 1.333 : moduleSize / 2;
+    return Math.abs(moduleSize - counts[0]) < maxVariance &&
+      Math.abs(moduleSize - counts[1]) < maxVariance &&
+      Math.abs(3 * moduleSize - counts[2]) < 3 * maxVariance &&
+      Math.abs(moduleSize - counts[3]) < maxVariance &&
+      Math.abs(moduleSize - counts[4]) < maxVariance;
+  }
+
+  function centerFromEnd(counts, end) {
+    return end - counts[4] - counts[3] - counts[2] / 2;
+  }
+
+  function FinderPatternFinder(image) {
+    this.image = image;
+    this.centers = [];
+  }
+
+  FinderPatternFinder.prototype.crossCheckVertical = function (startY, centerX, maxCount, originalTotal) {
+    const image = this.image;
+    const counts = [0, 0, 0, 0, 0];
+    let y = startY;
+    while (y >= 0 && image.get(centerX, y)) { counts[2]++; y--; }
+    if (y < 0) return NaN;
+    while (y >= 0 && !image.get(centerX, y) && counts[1] <= maxCount) { counts[1]++; y--; }
+    if (y < 0 || counts[1] > maxCount) return NaN;
+    while (y >= 0 && image.get(centerX, y) && counts[0] <= maxCount) { counts[0]++; y--; }
+    if (counts[0] > maxCount) return NaN;
+
+    y = startY + 1;
+    while (y < image.height && image.get(centerX, y)) { counts[2]++; y++; }
+    if (y === image.height) return NaN;
+    while (y < image.height && !image.get(centerX, y) && counts[3] < maxCount) { counts[3]++; y++; }
+    if (y === image.height || counts[3] >= maxCount) return NaN;
+    while (y < image.height && image.get(centerX, y) && counts[4] < maxCount) { counts[4]++; y++; }
+    if (counts[4] >= maxCount) return NaN;
+
+    if (5 * Math.abs(sum(counts) - originalTotal) >= 2 * originalTotal) return NaN;
+    return isFinderRatio(counts) ? centerFromEnd(counts, y) : NaN;
+  };
+
+  FinderPatternFinder.prototype.crossCheckHorizontal = function (startX, centerY, maxCount, originalTotal) {
+    const image = this.image;
+    const counts = [0, 0, 0, 0, 0];
+    let x = startX;
+    while (x >= 0 && image.get(x, centerY)) { counts[2]++; x--; }
+    if (x < 0) return NaN;
+    while (x >= 0 && !image.get(x, centerY) && counts[1] <= maxCount) { counts[1]++; x--; }
+    if (x < 0 || counts[1] > maxCount) return NaN;
+    while (x >= 0 && image.get(x, centerY) && counts[0] <= maxCount) { counts[0]++; x--; }
+    if (counts[0] > maxCount) return NaN;
+
+    x = startX + 1;
+    while (x < image.width && image.get(x, centerY)) { counts[2]++; x++; }
+    if (x === image.width) return NaN;
+    while (x < image.width && !image.get(x, centerY) && counts[3] < maxCount) { counts[3]++; x++; }
+    if (x === image.width || counts[3] >= maxCount) return NaN;
+    while (x < image.width && image.get(x, centerY) && counts[4] < maxCount) { counts[4]++; x++; }
+    if (counts[4] >= maxCount) return NaN;
+
+    if (5 * Math.abs(sum(counts) - originalTotal) >= originalTotal) return NaN;
+    return isFinderRatio(counts) ? centerFromEnd(counts, x) : NaN;
+  };
+
+  // crossCheckDiagonal checks that there is also a finder pattern along the
+  // diagonal through the center, which rules out most false positives.
+  FinderPatternFinder.prototype.crossCheckDiagonal = function (centerX, centerY) {
+    const image = this.image;
+    const counts = [0, 0, 0, 0, 0];
+    let i = 0;
+    while (centerX >= i && centerY >= i && image.get(centerX - i, centerY - i)) { counts[2]++; i++; }
+    if (counts[2] === 0) return false;
+    while (centerX >= i && centerY >= i && !image.get(centerX - i, centerY - i)) { counts[1]++; i++; }
+    if (counts[1] === 0) return false;
+    while (centerX >= i && centerY >= i && image.get(centerX - i, centerY - i)) { counts[0]++; i++; }
+    if (counts[0] === 0) return false;
+
+    i = 1;
+    while (centerX + i < image.width && centerY + i < image.height && image.get(centerX + i, centerY + i)) {
+      counts[2]++;
+      i++;
+    }
+    while (centerX + i < image.width && centerY + i < image.height && !image.get(centerX + i, centerY + i)) {
+      counts[3]++;
+      i++;
+    }
+    if (counts[3] === 0) return false;
+    while (centerX + i < image.width && centerY + i < image.height && image.get(centerX + i, centerY + i)) {
+      counts[4]++;
+      i++;
+    }
+    if (counts[4] === 0) return false;
+    return isFinderRatio(counts, true);
+  };
+
+  FinderPatternFinder.prototype.handlePossibleCenter = function (counts, y, endX) {
+    const total = sum(counts);
+    let centerX = centerFromEnd(counts, endX);
+    const centerY = this.crossCheckVertical(y, Math.floor(centerX), counts[2], total);
+    if (isNaN(centerY)) return false;
+    centerX = this.crossCheckHorizontal(Math.floor(centerX), Math.floor(centerY), counts[2], total);
+    if (isNaN(centerX) || !this.crossCheckDiagonal(Math.floor(centerX), Math.floor(centerY))) return false;
+
+    const moduleSize = total / 7;
+    for (let i = 0; i < this.centers.length; i++) {
+      const center = this.centers[i];
+      if (Math.abs(centerY - center.y) <= moduleSize && Math.abs(centerX - center.x) <= moduleSize) {
+        const sizeDiff = Math.abs(moduleSize - center.moduleSize);
+        if (sizeDiff <= 1 || sizeDiff <= center.moduleSize) {
+          const count = center.count + 1;
+          this.centers[i] = {
+            x: (center.count * center.x + centerX) / count,
+            y: (center.count * center.y + centerY) / count,
+            moduleSize: (center.count * center.moduleSize + moduleSize) / count,
+            count: count,
+          };
+          return true;
+        }
+      }
+    }
+    this.centers.push({ x: centerX, y: centerY, moduleSize: moduleSize, count: 1 });
+    return true;
+  };
+
+  // find scans the rows of the image for finder patterns.
+  FinderPatternFinder.prototype.find = function () {
+    const image = this.image;
+    const skip = Math.max(2, Math.floor((3 * image.height) / (4 * 177)));
+    for (let y = skip - 1; y < image.height; y += skip) {
+      const counts = [0, 0, 0, 0, 0];
+      let state = 0;
+      for (let x = 0; x < image.width; x++) {
+        if (image.get(x, y)) {
+          // Odd states count light pixels.
+          if ((state & 1) === 1) state++;
+          counts[state]++;
+        } else if ((state & 1) === 0) {
+          if (state === 4) {
+            if (isFinderRatio(counts) && this.handlePossibleCenter(counts, y, x)) {
+              state = 0;
+              counts.fill(0);
+            } else {
+              counts[0] = counts[2];
+              counts[1] = counts[3];
+              counts[2] = counts[4];
+              counts[3] = 1;
+              counts[4] = 0;
+              state = 3;
+            }
+          } else {
+            counts[++state]++;
+          }
+        } else {
+          counts[state]++;
+        }
+      }
+      if (isFinderRatio(counts)) this.handlePossibleCenter(counts, y, image.width);
+    }
+    return this.centers;
+  };
+
+  // orderPatterns returns the three finder patterns as the bottom left, top
+  // left and top right ones.
+  function orderPatterns(patterns) {
+    const d01 = distance(patterns[0], patterns[1]);
+    const d12 = distance(patterns[1], patterns[2]);
+    const d02 = distance(patterns[0], patterns[2]);
+    let a, b, c;
+    // The top left pattern is opposite the longest side.
+    if (d12 >= d01 && d12 >= d02) {
+      b = patterns[0]; a = patterns[1]; c = patterns[2];
+    } else if (d02 >= d12 && d02 >= d01) {
+      b = patterns[1]; a = patterns[0]; c = patterns[2];
+    } else {
+      b = patterns[2]; a = patterns[0]; c = patterns[1];
+    }
+    if ((c.x - b.x) * (a.y - b.y) - (c.y - b.y) * (a.x - b.x) < 0) {
+      const tmp = a;
+      a = c;
+      c = tmp;
+    }
+    return { bottomLeft: a, topLeft: b, topRight: c };
+  }
+
+  // candidateTriples returns the sets of three finder patterns that could be
+  // a QR code, best first.
+  function candidateTriples(centers) {
+    centers = centers.slice().sort(function (a, b) { return b.count - a.count; }).slice(0, 12);
+    const triples = [];
+    for (let i = 0; i < centers.length; i++) {
+      for (let j = i + 1; j < centers.length; j++) {
+        for (let k = j + 1; k < centers.length; k++) {
+          const patterns = [centers[i], centers[j], centers[k]];
+          const sizes = patterns.map(function (p) { return p.moduleSize; });
+          const minSize = Math.min.apply(null, sizes);
+          const maxSize = Math.max.apply(null, sizes);
+          if (maxSize > minSize * 1.6) continue;
+          const sides = [distance(patterns[0], patterns[1]), distance(patterns[1], patterns[2]),
+            distance(patterns[0], patterns[2])].sort(function (a, b) { return a - b; });
+          // The patterns should form a right isosceles triangle (allowing for
+          // perspective), at least 14 modules apart. Module sizes measured
+          // along a row are up to 1.4 times too large in rotated codes.
+          if (sides[0] < 9 * minSize) continue;
+          const sideRatio = sides[1] / sides[0];
+          const hypotenuseRatio = sides[2] / Math.hypot(sides[0], sides[1]);
+          if (sideRatio > 2 || hypotenuseRatio < 0.8 || hypotenuseRatio > 1.2) continue;
+          const score = (sideRatio - 1) + Math.abs(hypotenuseRatio - 1) * 2 + (maxSize / minSize - 1) -
+            0.05 * Math.min(patterns[0].count + patterns[1].count + patterns[2].count, 12);
+          triples.push({ patterns: patterns, score: score });
+        }
+      }
+    }
+    triples.sort(function (a, b) { return a.score - b.score; });
+    return triples.map(function (t) { return orderPatterns(t.patterns); });
+  }
+
+  // --- Geometry -------------------------------------------------------------
+
+  // sizeOfRun measures, from the center of a finder pattern towards a point,
+  // the dark, light and dark runs up to the edge of the pattern.
+  function sizeOfRun(image, fromX, fromY, toX, toY) {
+    const steep = Math.abs(toY - fromY) > Math.abs(toX - fromX);
+    if (steep) {
+      let tmp = fromX; fromX = fromY; fromY = tmp;
+      tmp = toX; toX = toY; toY = tmp;
+    }
+    const dx = Math.abs(toX - fromX);
+    const dy = Math.abs(toY - fromY);
+    let error = -dx / 2;
+    const xStep = fromX < toX ? 1 : -1;
+    const yStep = fromY < toY ? 1 : -1;
+    let state = 0;
+    const xLimit = toX + xStep;
+    for (let x = fromX, y = fromY; x !== xLimit; x += xStep) {
+      const realX = steep ? y : x;
+      const realY = steep ? x : y;
+      if ((state === 1) === image.get(realX, realY)) {
+        if (state === 2) return Math.hypot(x - fromX, y - fromY);
+        state++;
+      }
+      error += dy;
+      if (error > 0) {
+        if (y === toY) break;
+        y += yStep;
+        error -= dx;
+      }
+    }
+    if (state === 2) return Math.hypot(toX + xStep - fromX, toY - fromY);
+    return NaN;
+  }
+
+  function sizeOfRunBothWays(image, fromX, fromY, toX, toY) {
+    let result = sizeOfRun(image, fromX, fromY, toX, toY);
+    let scale = 1;
+    let otherToX = fromX - (toX - fromX);
+    if (otherToX < 0) {
+      scale = fromX / (fromX - otherToX);
+      otherToX = 0;
+    } else if (otherToX >= image.width) {
+      scale = (image.width - 1 - fromX) / (otherToX - fromX);
+      otherToX = image.width - 1;
+    }
+    let otherToY = Math.floor(fromY - (toY - fromY) * scale);
+    scale = 1;
+    if (otherToY < 0) {
+      scale = fromY / (fromY - otherToY);
+      otherToY = 0;
+    } else if (otherToY >= image.height) {
+      scale = (image.height - 1 - fromY) / (otherToY - fromY);
+      otherToY = image.height - 1;
+    }
+    otherToX = Math.floor(fromX + (otherToX - fromX) * scale);
+    result += sizeOfRun(image, fromX, fromY, otherToX, otherToY);
+    return result - 1;
+  }
+
+  function moduleSizeOneWay(image, pattern, other) {
+    const a = sizeOfRunBothWays(image, Math.floor(pattern.x), Math.floor(pattern.y), Math.floor(other.x), Math.floor(other.y));
+    const b = sizeOfRunBothWays(image, Math.floor(other.x), Math.floor(other.y), Math.floor(pattern.x), Math.floor(pattern.y));
+    if (isNaN(a)) return b / 7;
+    if (isNaN(b)) return a / 7;
+    return (a + b) / 14;
+  }
+
+  function estimateModuleSize(image, patterns) {
+    const size = (moduleSizeOneWay(image, patterns.topLeft, patterns.topRight) +
+      moduleSizeOneWay(image, patterns.topLeft, patterns.bottomLeft)) / 2;
+    if (isNaN(size) || size < 1) {
+      return (patterns.topLeft.moduleSize + patterns.topRight.moduleSize + patterns.bottomLeft.moduleSize) / 3;
+    }
+    return size;
+  }
+
+  // candidateDimensions returns the likely sizes of the code in modules.
+  function candidateDimensions(patterns, moduleSize) {
+    const tltr = Math.round(distance(patterns.topLeft, patterns.topRight) / moduleSize);
+    const tlbl = Math.round(distance(patterns.topLeft, patterns.bottomLeft) / moduleSize);
+    let dimension = ((tltr + tlbl) >> 1) + 7;
+    const candidates = [];
+    switch (dimension & 3) {
+      case 0: candidates.push(dimension + 1, dimension - 3); break;
+      case 2: candidates.push(dimension - 1, dimension + 3); break;
+      case 3: candidates.push(dimension + 2, dimension - 2); break;
+      default: candidates.push(dimension, dimension + 4, dimension - 4);
+    }
+    return candidates.filter(function (d) { return d >= 21 && d <= 177; });
+  }
+
+  // A perspective transform as a 3x3 matrix that maps (u, v, 1) to
+  // homogeneous image coordinates.
+  function squareToQuad(x0, y0, x1, y1, x2, y2, x3, y3) {
+    const dx3 = x0 - x1 + x2 - x3;
+    const dy3 = y0 - y1 + y2 - y3;
+    if (dx3 === 0 && dy3 === 0) {
+      return [x1 - x0, x2 - x1, x0, y1 - y0, y2 - y1, y0, 0, 0, 1];
+    }
+    const dx1 = x1 - x2;
+    const dx2 = x3 - x2;
+    const dy1 = y1 - y2;
+    const dy2 = y3 - y2;
+    const denominator = dx1 * dy2 - dx2 * dy1;
+    const a13 = (dx3 * dy2 - dx2 * dy3) / denominator;
+    const a23 = (dx1 * dy3 - dx3 * dy1) / denominator;
+    return [
+      x1 - x0 + a13 * x1, x3 - x0 + a23 * x3, x0,
+      y1 - y0 + a13 * y1, y3 - y0 + a23 * y3, y0,
+      a13, a23, 1,
+    ];
+  }
+
+  function adjugate(m) {
+    return [
+      m[4] * m[8] - m[5] * m[7], m[2] * m[7] - m[1] * m[8], m[1] * m[5] - m[2] * m[4],
+      m[5] * m[6] - m[3] * m[8], m[0] * m[8] - m[2] * m[6], m[2] * m[3] - m[0] * m[5],
+      m[3] * m[7] - m[4] * m[6], m[1] * m[6] - m[0] * m[7], m[0] * m[4] - m[1] * m[3],
+    ];
+  }
+
+  function multiply(a, b) {
+    const result = new Array(9);
+    for (let row = 0; row < 3; row++) {
+      for (let col = 0; col < 3; col++) {
+        result[row * 3 + col] = a[row * 3] * b[col] + a[row * 3 + 1] * b[3 + col] + a[row * 3 + 2] * b[6 + col];
+      }
+    }
+    return result;
+  }
+
+  // quadToQuad returns the transform that maps the first quadrilateral onto
+  // the second.
+  function quadToQuad(src, dst) {
+    const toDst = squareToQuad.apply(null, dst);
+    const fromSrc = adjugate(squareToQuad.apply(null, src));
+    return multiply(toDst, fromSrc);
+  }
+
+  function transformPoint(m, u, v) {
+    const w = m[6] * u + m[7] * v + m[8];
+    return { x: (m[0] * u + m[1] * v + m[2]) / w, y: (m[3] * u + m[4] * v + m[5]) / w };
+  }
+
+  // --- Alignment patterns ---------------------------------------------------
+
+  function isAlignmentRatio(counts, moduleSize) {
+    const maxVariance = moduleSize / 2;
+    for (let i = 0; i < 3; i++) {
+      if (Math.abs(moduleSize - counts[i]) >= maxVariance) return false;
+    }
+    return true;
+  }
+
+  function alignmentCrossCheckVertical(image, startY, centerX, maxCount, originalTotal, moduleSize) {
+    const counts = [0, 0, 0];
+    let y = startY;
+    while (y >= 0 && image.get(centerX, y) && counts[1] <= maxCount) { counts[1]++; y--; }
+    if (y < 0 || counts[1] > maxCount) return NaN;
+    while (y >= 0 && !image.get(centerX, y) && counts[0] <= maxCount) { counts[0]++; y--; }
+    if (counts[0] > maxCount) return NaN;
+    y = startY + 1;
+    while (y < image.height && image.get(centerX, y) && counts[1] <= maxCount) { counts[1]++; y++; }
+    if (y === image.height || counts[1] > maxCount) return NaN;
+    while (y < image.height && !image.get(centerX, y) && counts[2] <= maxCount) { counts[2]++; y++; }
+    if (counts[2] > maxCount) return NaN;
+    if (5 * Math.abs(sum(counts) - originalTotal) >= 2 * originalTotal) return NaN;
+    return isAlignmentRatio(counts, moduleSize) ? y - counts[2] - counts[1] / 2 : NaN;
+  }
+
+  // findAlignment looks for the light-dark-light middle of the alignment
+  // pattern near where it is expected. It returns the center if it was seen
+  // on more than one row, or else all the possible centers, nearest first.
+  function findAlignment(image, moduleSize, estimateX, estimateY, allowanceFactor) {
+    const allowance = Math.floor(allowanceFactor * moduleSize);
+    const left = Math.max(0, estimateX - allowance);
+    const right = Math.min(image.width - 1, estimateX + allowance);
+    const top = Math.max(0, estimateY - allowance);
+    const bottom = Math.min(image.height - 1, estimateY + allowance);
+    if (right - left < moduleSize * 3 || bottom - top < moduleSize * 3) return null;
+
+    const possible = [];
+    const middleY = Math.floor((top + bottom) / 2);
+    const handle = function (counts, y, endX) {
+      const total = sum(counts);
+      const centerX = endX - counts[2] - counts[1] / 2;
+      const centerY = alignmentCrossCheckVertical(image, y, Math.floor(centerX), 2 * counts[1], total, moduleSize);
+      if (isNaN(centerY)) return null;
+      const size = total / 3;
+      for (let i = 0; i < possible.length; i++) {
+        const center = possible[i];
+        if (Math.abs(centerY - center.y) <= moduleSize && Math.abs(centerX - center.x) <= moduleSize &&
+          Math.abs(size - center.moduleSize) <= Math.max(1, center.moduleSize)) {
+          return { x: (center.x + centerX) / 2, y: (center.y + centerY) / 2 };
+        }
+      }
+      possible.push({ x: centerX, y: centerY, moduleSize: size });
+      return null;
+    };
+
+    for (let i = 0; i <= bottom - top; i++) {
+      const y = middleY + ((i & 1) === 0 ? (i + 1) >> 1 : -((i + 1) >> 1));
+      if (y < top || y > bottom) continue;
+      const counts = [0, 0, 0];
+      let x = left;
+      while (x <= right && !image.get(x, y)) x++;
+      let state = 0;
+      while (x <= right) {
+        if (image.get(x, y)) {
+          if (state === 1) {
+            counts[1]++;
+          } else if (state === 2) {
+            if (isAlignmentRatio(counts, moduleSize)) {
+              const confirmed = handle(counts, y, x);
+              if (confirmed) return [confirmed];
+            }
+            counts[0] = counts[2];
+            counts[1] = 1;
+            counts[2] = 0;
+            state = 1;
+          } else {
+            counts[++state]++;
+          }
+        } else {
+          if (state === 1) state++;
+          counts[state]++;
+        }
+        x++;
+      }
+      if (isAlignmentRatio(counts, moduleSize)) {
+        const confirmed = handle(counts, y, right + 1);
+        if (confirmed) return [confirmed];
+      }
+    }
+    return possible.sort(function (a, b) {
+      return Math.hypot(a.x - estimateX, a.y - estimateY) - Math.hypot(b.x - estimateX, b.y - estimateY);
+    });
+  }
+
+  // --- Sampling -------------------------------------------------------------
+
+  function ModuleGrid(dimension) {
+    this.dimension = dimension;
+    this.bits = new Uint8Array(dimension * dimension);
+  }
+
+  ModuleGrid.prototype.get = function (x, y) {
+    return this.bits[y * this.dimension + x] === 1;
+  };
+
+  ModuleGrid.prototype.set = function (x, y, value) {
+    this.bits[y * this.dimension + x] = value ? 1 : 0;
+  };
+
+  ModuleGrid.prototype.setRegion = function (left, top, width, height) {
+    for (let y = top; y < top + height; y++) {
+      for (let x = left; x < left + width; x++) this.set(x, y, true);
+    }
+  };
+
+  function sampleGrid(image, transform, dimension) {
+    const grid = new ModuleGrid(dimension);
+    for (let y = 0; y < dimension; y++) {
+      for (let x = 0; x < dimension; x++) {
+        const point = transformPoint(transform, x + 0.5, y + 0.5);
+        let px = Math.floor(point.x);
+        let py = Math.floor(point.y);
+        if (isNaN(px) || isNaN(py) || px < -1 || py < -1 || px > image.width || py > image.height) return null;
+        px = Math.min(Math.max(px, 0), image.width - 1);
+        py = Math.min(Math.max(py, 0), image.height - 1);
+        grid.set(x, y, image.get(px, py));
+      }
+    }
+    return grid;
+  }
+
+  // gridTransform maps module coordinates onto the image, using the centers
+  // of the finder patterns and a point near the bottom right corner: the
+  // center of the alignment pattern, or of where a fourth finder pattern
+  // would be.
+  function gridTransform(patterns, bottomRight, isAlignment, dimension) {
+    const dimMinusThree = dimension - 3.5;
+    const sourceBottomRight = isAlignment ? dimMinusThree - 3 : dimMinusThree;
+    return quadToQuad(
+      [3.5, 3.5, dimMinusThree, 3.5, sourceBottomRight, sourceBottomRight, 3.5, dimMinusThree],
+      [patterns.topLeft.x, patterns.topLeft.y, patterns.topRight.x, patterns.topRight.y,
+        bottomRight.x, bottomRight.y, patterns.bottomLeft.x, patterns.bottomLeft.y],
+    );
+  }
+
+  // --- Versions and format information --------------------------------------
+
+  // EC_BLOCKS has, for each version and error correction level (L, M, Q, H),
+  // the number of error correction codewords per block followed by pairs of
+  // the number of blocks and the number of data codewords in each block.
+  const EC_BLOCKS = [
+    [[7, 1, 19], [10, 1, 16], [13, 1, 13], [17, 1, 9]],
+    [[10, 1, 34], [16, 1, 28], [22, 1, 22], [28, 1, 16]],
+    [[15, 1, 55], [26, 1, 44], [18, 2, 17], [22, 2, 13]],
+    [[20, 1, 80], [18, 2, 32], [26, 2, 24], [16, 4, 9]],
+    [[26, 1, 108], [24, 2, 43], [18, 2, 15, 2, 16], [22, 2, 11, 2, 12]],
+    [[18, 2, 68], [16, 4, 27], [24, 4, 19], [28, 4, 15]],
+    [[20, 2, 78], [18, 4, 31], [18, 2, 14, 4, 15], [26, 4, 13, 1, 14]],
+    [[24, 2, 97], [22, 2, 38, 2, 39], [22, 4, 18, 2, 19], [26, 4, 14, 2, 15]],
+    [[30, 2, 116], [22, 3, 36, 2, 37], [20, 4, 16, 4, 17], [24, 4, 12, 4, 13]],
+    [[18, 2, 68, 2, 69], [26, 4, 43, 1, 44], [24, 6, 19, 2, 20], [28, 6, 15, 2, 16]],
+    [[20, 4, 81], [30, 1, 50, 4, 51], [28, 4, 22, 4, 23], [24, 3, 12, 8, 13]],
+    [[24, 2, 92, 2, 93], [22, 6, 36, 2, 37], [26, 4, 20, 6, 21], [28, 7, 14, 4, 15]],
+    [[26, 4, 107], [22, 8, 37, 1, 38], [24, 8, 20, 4, 21], [22, 12, 11, 4, 12]],
+    [[30, 3, 115, 1, 116], [24, 4, 40, 5, 41], [20, 11, 16, 5, 17], [24, 11, 12, 5, 13]],
+    [[22, 5, 87, 1, 88], [24, 5, 41, 5, 42], [30, 5, 24, 7, 25], [24, 11, 12, 7, 13]],
+    [[24, 5, 98, 1, 99], [28, 7, 45, 3, 46], [24, 15, 19, 2, 20], [30, 3, 15, 13, 16]],
+    [[28, 1, 107, 5, 108], [28, 10, 46, 1, 47], [28, 1, 22, 15, 23], [28, 2, 14, 17, 15]],
+    [[30, 5, 120, 1, 121], [26, 9, 43, 4, 44], [28, 17, 22, 1, 23], [28, 2, 14, 19, 15]],
+    [[28, 3, 113, 4, 114], [26, 3, 44, 11, 45], [26, 17, 21, 4, 22], [26, 9, 13, 16, 14]],
+    [[28, 3, 107, 5, 108], [26, 3, 41, 13, 42], [30, 15, 24, 5, 25], [28, 15, 15, 10, 16]],
+    [[28, 4, 116, 4, 117], [26, 17, 42], [28, 17, 22, 6, 23], [30, 19, 16, 6, 17]],
+    [[28, 2, 111, 7, 112], [28, 17, 46], [30, 7, 24, 16, 25], [24, 34, 13]],
+    [[30, 4, 121, 5, 122], [28, 4, 47, 14, 48], [30, 11, 24, 14, 25], [30, 16, 15, 14, 16]],
+    [[30, 6, 117, 4, 118], [28, 6, 45, 14, 46], [30, 11, 24, 16, 25], [30, 30, 16, 2, 17]],
+    [[26, 8, 106, 4, 107], [28, 8, 47, 13, 48], [30, 7, 24, 22, 25], [30, 22, 15, 13, 16]],
+    [[28, 10, 114, 2, 115], [28, 19, 46, 4, 47], [28, 28, 22, 6, 23], [30, 33, 16, 4, 17]],
+    [[30, 8, 122, 4, 123], [28, 22, 45, 3, 46], [30, 8, 23, 26, 24], [30, 12, 15, 28, 16]],
+    [[30, 3, 117, 10, 118], [28, 3, 45, 23, 46], [30, 4, 24, 31, 25], [30, 11, 15, 31, 16]],
+    [[30, 7, 116, 7, 117], [28, 21, 45, 7, 46], [30, 1, 23, 37, 24], [30, 19, 15, 26, 16]],
+    [[30, 5, 115, 10, 116], [28, 19, 47, 10, 48], [30, 15, 24, 25, 25], [30, 23, 15, 25, 16]],
+    [[30, 13, 115, 3, 116], [28, 2, 46, 29, 47], [30, 42, 24, 1, 25], [30, 23, 15, 28, 16]],
+    [[30, 17, 115], [28, 10, 46, 23, 47], [30, 10, 24, 35, 25], [30, 19, 15, 35, 16]],
+    [[30, 17, 115, 1, 116], [28, 14, 46, 21, 47], [30, 29, 24, 19, 25], [30, 11, 15, 46, 16]],
+    [[30, 13, 115, 6, 116], [28, 14, 46, 23, 47], [30, 44, 24, 7, 25], [30, 59, 16, 1, 17]],
+    [[30, 12, 121, 7, 122], [28, 12, 47, 26, 48], [30, 39, 24, 14, 25], [30, 22, 15, 41, 16]],
+    [[30, 6, 121, 14, 122], [28, 6, 47, 34, 48], [30, 46, 24, 10, 25], [30, 2, 15, 64, 16]],
+    [[30, 17, 122, 4, 123], [28, 29, 46, 14, 47], [30, 49, 24, 10, 25], [30, 24, 15, 46, 16]],
+    [[30, 4, 122, 18, 123], [28, 13, 46, 32, 47], [30, 48, 24, 14, 25], [30, 42, 15, 32, 16]],
+    [[30, 20, 117, 4, 118], [28, 40, 47, 7, 48], [30, 43, 24, 22, 25], [30, 10, 15, 67, 16]],
+    [[30, 19, 118, 6, 119], [28, 18, 47, 31, 48], [30, 34, 24, 34, 25], [30, 20, 15, 61, 16]],
+  ];
+
+  // The error correction level of each value of the format information's
+  // level bits, as an index into EC_BLOCKS.
+  const FORMAT_EC_LEVELS = [1, 0, 3, 2];
+
+  function alignmentCenters(version) {
+    if (version === 1) return [];
+    const count = Math.floor(version / 7) + 2;
+    const step = version === 32 ? 26 : Math.ceil((version * 4 + 4) / (count * 2 - 2)) * 2;
+    const centers = [6];
+    for (let pos = version * 4 + 10; centers.length < count; pos -= step) centers.splice(1, 0, pos);
+    return centers;
+  }
+
+  function bchRemainder(value, generator) {
+    const generatorBits = 32 - Math.clz32(generator);
+    while (32 - Math.clz32(value) >= generatorBits) {
+      value ^= generator << (32 - Math.clz32(value) - generatorBits);
+    }
+    return value;
+  }
+
+  function bitCount(value) {
+    let count = 0;
+    for (; value; value &= value - 1) count++;
+    return count;
+  }
+
+  const FORMAT_INFOS = [];
+  for (let data = 0; data < 32; data++) {
+    FORMAT_INFOS.push({ bits: ((data << 10) | bchRemainder(data << 10, 0x537)) ^ 0x5412, data: data });
+  }
+
+  const VERSION_INFOS = [];
+  for (let version = 7; version <= 40; version++) {
+    VERSION_INFOS.push({ bits: (version << 12) | bchRemainder(version << 12, 0x1f25), version: version });
+  }
+
+  // closest returns the value of the entry with the fewest bits different
+  // from either of the read values, if it is close enough to correct.
+  function closest(table, key, readValues) {
+    let best = null;
+    let bestDiff = 4;
+    for (let i = 0; i < table.length; i++) {
+      for (let j = 0; j < readValues.length; j++) {
+        const diff = bitCount(table[i].bits ^ readValues[j]);
+        if (diff < bestDiff) {
+          best = table[i][key];
+          bestDiff = diff;
+        }
+      }
+    }
+    return best;
+  }
+
+  function readFormat(grid) {
+    const dimension = grid.dimension;
+    let bits1 = 0;
+    const copy = function (bits, x, y) { return (bits << 1) | (grid.get(x, y) ? 1 : 0); };
+    for (let x = 0; x < 6; x++) bits1 = copy(bits1, x, 8);
+    bits1 = copy(bits1, 7, 8);
+    bits1 = copy(bits1, 8, 8);
+    bits1 = copy(bits1, 8, 7);
+    for (let y = 5; y >= 0; y--) bits1 = copy(bits1, 8, y);
+    let bits2 = 0;
+    for (let y = dimension - 1; y >= dimension - 7; y--) bits2 = copy(bits2, 8, y);
+    for (let x = dimension - 8; x < dimension; x++) bits2 = copy(bits2, x, 8);
+    const data = closest(FORMAT_INFOS, "data", [bits1, bits2]);
+    if (data === null) return null;
+    return { ecLevel: FORMAT_EC_LEVELS[(data >> 3) & 3], mask: data & 7 };
+  }
+
+  function readVersion(grid) {
+    const dimension = grid.dimension;
+    const provisional = (dimension - 17) / 4;
+    if (provisional <= 6) return provisional;
+    let bits1 = 0;
+    let bits2 = 0;
+    for (let j = 5; j >= 0; j--) {
+      for (let i = dimension - 9; i >= dimension - 11; i--) {
+        bits1 = (bits1 << 1) | (grid.get(i, j) ? 1 : 0);
+        bits2 = (bits2 << 1) | (grid.get(j, i) ? 1 : 0);
+      }
+    }
+    // If the version information is unreadable, the size of the grid is the
+    // best guess; error correction will tell whether it was right.
+    const version = closest(VERSION_INFOS, "version", [bits1, bits2]);
+    return version === null ? provisional : version;
+  }
+
+  function isMasked(mask, i, j) {
+    switch (mask) {
+      case 0: return ((i + j) & 1) === 0;
+      case 1: return (i & 1) === 0;
+      case 2: return j % 3 === 0;
+      case 3: return (i + j) % 3 === 0;
+      case 4: return ((Math.floor(i / 2) + Math.floor(j / 3)) & 1) === 0;
+      case 5: return ((i * j) & 1) + (i * j) % 3 === 0;
+      case 6: return ((((i * j) & 1) + (i * j) % 3) & 1) === 0;
+      default: return ((((i + j) & 1) + (i * j) % 3) & 1) === 0;
+    }
+  }
+
+  function functionPatterns(version) {
+    const dimension = version * 4 + 17;
+    const grid = new ModuleGrid(dimension);
+    grid.setRegion(0, 0, 9, 9);
+    grid.setRegion(dimension - 8, 0, 8, 9);
+    grid.setRegion(0, dimension - 8, 9, 8);
+    const centers = alignmentCenters(version);
+    const max = centers.length;
+    for (let x = 0; x < max; x++) {
+      for (let y = 0; y < max; y++) {
+        if ((x === 0 && (y === 0 || y === max - 1)) || (x === max - 1 && y === 0)) continue;
+        grid.setRegion(centers[x] - 2, centers[y] - 2, 5, 5);
+      }
+    }
+    grid.setRegion(6, 9, 1, dimension - 17);
+    grid.setRegion(9, 6, dimension - 17, 1);
+    if (version > 6) {
+      grid.setRegion(dimension - 11, 0, 3, 6);
+      grid.setRegion(0, dimension - 11, 6, 3);
+    }
+    return grid;
+  }
+
+  function readCodewords(grid, version, mask) {
+    const dimension = grid.dimension;
+    const reserved = functionPatterns(version);
+    const codewords = [];
+    let current = 0;
+    let bitsRead = 0;
+    let readingUp = true;
+    for (let j = dimension - 1; j > 0; j -= 2) {
+      if (j === 6) j--;
+      for (let count = 0; count < dimension; count++) {
+        const i = readingUp ? dimension - 1 - count : count;
+        for (let col = 0; col < 2; col++) {
+          const x = j - col;
+          if (reserved.get(x, i)) continue;
+          current = (current << 1) | (grid.get(x, i) !== isMasked(mask, i, x) ? 1 : 0);
+          if (++bitsRead === 8) {
+            codewords.push(current);
+            current = 0;
+            bitsRead = 0;
+          }
+        }
+      }
+      readingUp = !readingUp;
+    }
+    return codewords;
+  }
+
+  // dataBlocks splits the interleaved codewords into their blocks.
+  function dataBlocks(codewords, version, ecLevel) {
+    const ecBlocks = EC_BLOCKS[version - 1][ecLevel];
+    const ecPerBlock = ecBlocks[0];
+    const blocks = [];
+    for (let i = 1; i < ecBlocks.length; i += 2) {
+      for (let j = 0; j < ecBlocks[i]; j++) {
+        blocks.push({ numData: ecBlocks[i + 1], codewords: new Array(ecBlocks[i + 1] + ecPerBlock) });
+      }
+    }
+    const total = blocks.reduce(function (n, b) { return n + b.codewords.length; }, 0);
+    if (codewords.length < total) return null;
+
+    const shorterTotal = blocks[0].codewords.length;
+    let longerStart = blocks.length - 1;
+    while (longerStart >= 0 && blocks[longerStart].codewords.length !== shorterTotal) longerStart--;
+    longerStart++;
+    const shorterData = shorterTotal - ecPerBlock;
+    let offset = 0;
+    for (let i = 0; i < shorterData; i++) {
+      for (let j = 0; j < blocks.length; j++) blocks[j].codewords[i] = codewords[offset++];
+    }
+    for (let j = longerStart; j < blocks.length; j++) blocks[j].codewords[shorterData] = codewords[offset++];
+    const max = blocks[0].codewords.length;
+    for (let i = shorterData; i < max; i++) {
+      for (let j = 0; j < blocks.length; j++) {
+        blocks[j].codewords[j < longerStart ? i : i + 1] = codewords[offset++];
+      }
+    }
+    blocks.ecPerBlock = ecPerBlock;
+    return blocks;
+  }
+
+  // --- Reed-Solomon error correction ----------------------------------------
+
+  const GF_EXP = new Uint8Array(512);
+  const GF_LOG = new Uint8Array(256);
+  (function () {
+    let x = 1;
+    for (let i = 0; i < 255; i++) {
+      GF_EXP[i] = x;
+      GF_LOG[x] = i;
+      x <<= 1;
+      if (x & 0x100) x ^= 0x11d;
+    }
+    for (let i = 255; i < 512; i++) GF_EXP[i] = GF_EXP[i - 255];
+  })();
+
+  function gfMul(a, b) {
+    return a === 0 || b === 0 ? 0 : GF_EXP[GF_LOG[a] + GF_LOG[b]];
+  }
+
+  function gfDiv(a, b) {
+    return a === 0 ? 0 : GF_EXP[(GF_LOG[a] + 255 - GF_LOG[b]) % 255];
+  }
+
+  // Polynomials are arrays of coefficients, lowest degree first.
+  function polyEval(poly, x) {
+    let result = 0;
+    for (let i = poly.length - 1; i >= 0; i--) result = gfMul(result, x) ^ poly[i];
+    return result;
+  }
+
+  // correctErrors fixes up to half as many errors as there are error
+  // correction codewords in place, and reports whether it succeeded.
+  function correctErrors(codewords, numEc) {
+    const n = codewords.length;
+    // The received polynomial has the first codeword as its highest degree.
+    const received = codewords.slice().reverse();
+    const syndromes = new Array(numEc);
+    let hasErrors = false;
+    for (let i = 0; i < numEc; i++) {
+      syndromes[i] = polyEval(received, GF_EXP[i]);
+      if (syndromes[i] !== 0) hasErrors = true;
+    }
+    if (!hasErrors) return true;
+
+    // Berlekamp-Massey finds the error locator polynomial.
+    let locator = [1];
+    let previous = [1];
+    let errors = 0;
+    let shift = 1;
+    let previousDiscrepancy = 1;
+    for (let k = 0; k < numEc; k++) {
+      let discrepancy = syndromes[k];
+      for (let i = 1; i <= errors; i++) discrepancy ^= gfMul(locator[i] || 0, syndromes[k - i]);
+      if (discrepancy === 0) {
+        shift++;
+        continue;
+      }
+      const scale = gfDiv(discrepancy, previousDiscrepancy);
+      const next = locator.slice();
+      for (let i = 0; i < previous.length; i++) {
+        next[i + shift] = (next[i + shift] || 0) ^ gfMul(scale, previous[i]);
+      }
+      if (2 * errors <= k) {
+        previous = locator;
+        errors = k + 1 - errors;
+        previousDiscrepancy = discrepancy;
+        shift = 1;
+      } else {
+        shift++;
+      }
+      locator = next;
+    }
+    while (locator.length > 1 && locator[locator.length - 1] === 0) locator.pop();
+    if (locator.length - 1 !== errors || 2 * errors > numEc) return false;
+
+    // The roots of the locator are the inverses of the error locations.
+    const positions = [];
+    for (let i = 0; i < n; i++) {
+      if (polyEval(locator, GF_EXP[(255 - i) % 255]) === 0) positions.push(i);
+    }
+    if (positions.length !== errors) return false;
+
+    // Forney's algorithm finds the error values from the error evaluator.
+    const evaluator = new Array(numEc).fill(0);
+    for (let i = 0; i < numEc; i++) {
+      for (let j = 0; j < locator.length && i + j < numEc; j++) {
+        evaluator[i + j] ^= gfMul(syndromes[i], locator[j]);
+      }
+    }
+    const derivative = [];
+    for (let i = 1; i < locator.length; i += 2) {
+      derivative[i - 1] = locator[i];
+      derivative[i] = 0;
+    }
+    for (let p = 0; p < positions.length; p++) {
+      const xInverse = GF_EXP[(255 - positions[p]) % 255];
+      const denominator = polyEval(derivative, xInverse);
+      if (denominator === 0) return false;
+      // With the generator's roots starting at a^0, the value is scaled by X.
+      const value = gfMul(GF_EXP[positions[p] % 255], gfDiv(polyEval(evaluator, xInverse), denominator));
+      received[positions[p]] ^= value;
+    }
+    for (let i = 0; i < numEc; i++) {
+      if (polyEval(received, GF_EXP[i]) !== 0) return false;
+    }
+    for (let i = 0; i < n; i++) codewords[i] = received[n - 1 - i];
+    return true;
+  }
+
+  // --- Bit stream -----------------------------------------------------------
+
+  function BitReader(bytes) {
+    this.bytes = bytes;
+    this.offset = 0;
+  }
+
+  BitReader.prototype.available = function () {
+    return this.bytes.length * 8 - this.offset;
+  };
+
+  BitReader.prototype.read = function (count) {
+    let result = 0;
+    for (let i = 0; i < count; i++, this.offset++) {
+      const bit = (this.bytes[this.offset >> 3] >> (7 - (this.offset & 7))) & 1;
+      result = (result << 1) | bit;
+    }
+    return result;
+  };
+
+  const ALPHANUMERIC = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:";
+
+  function decodeBytes(bytes, encoding) {
+    const array = new Uint8Array(bytes);
+    if (typeof TextDecoder !== "undefined") {
+      try {
+        return new TextDecoder(encoding || "utf-8", { fatal: true }).decode(array);
+      } catch (err) {
+        // Fall back to ISO-8859-1, the default encoding of QR codes.
+      }
+    }
+    let result = "";
+    for (let i = 0; i < array.length; i++) result += String.fromCharCode(array[i]);
+    return result;
+  }
+
+  function decodeSegments(bytes, version) {
+    const reader = new BitReader(bytes);
+    const sizeClass = version <= 9 ? 0 : version <= 26 ? 1 : 2;
+    let result = "";
+    let encoding = null;
+    while (reader.available() >= 4) {
+      const mode = reader.read(4);
+      if (mode === 0) break;
+      if (mode === 1) {
+        let count = reader.read([10, 12, 14][sizeClass]);
+        while (count >= 3) {
+          const value = reader.read(10);
+          if (value >= 1000) return null;
+          result += String(value).padStart(3, "0");
+          count -= 3;
+        }
+        if (count === 2) {
+          const value = reader.read(7);
+          if (value >= 100) return null;
+          result += String(value).padStart(2, "0");
+        } else if (count === 1) {
+          const value = reader.read(4);
+          if (value >= 10) return null;
+          result += String(value);
+        }
+      } else if (mode === 2) {
+        let count = reader.read([9, 11, 13][sizeClass]);
+        while (count >= 2) {
+          const value = reader.read(11);
+          if (value >= 45 * 45) return null;
+          result += ALPHANUMERIC[Math.floor(value / 45)] + ALPHANUMERIC[value % 45];
+          count -= 2;
+        }
+        if (count === 1) {
+          const value = reader.read(6);
+          if (value >= 45) return null;
+          result += ALPHANUMERIC[value];
+        }
+      } else if (mode === 4) {
+        const count = reader.read([8, 16, 16][sizeClass]);
+        if (reader.available() < count * 8) return null;
+        const segment = [];
+        for (let i = 0; i < count; i++) segment.push(reader.read(8));
+        result += decodeBytes(segment, encoding);
+      } else if (mode === 8) {
+        const count = reader.read([8, 10, 12][sizeClass]);
+        const segment = [];
+        for (let i = 0; i < count; i++) {
+          const value = reader.read(13);
+          let assembled = (Math.floor(value / 0xc0) << 8) | (value % 0xc0);
+          assembled += assembled < 0x1f00 ? 0x8140 : 0xc140;
+          segment.push(assembled >> 8, assembled & 0xff);
+        }
+        result += decodeBytes(segment, "shift_jis");
+      } else if (mode === 7) {
+        // ECI designator; only UTF-8 changes how bytes are decoded.
+        const first = reader.read(8);
+        let value;
+        if ((first & 0x80) === 0) value = first;
+        else if ((first & 0xc0) === 0x80) value = ((first & 0x3f) << 8) | reader.read(8);
+        else value = ((first & 0x1f) << 16) | reader.read(16);
+        encoding = value === 26 ? "utf-8" : value === 20 ? "shift_jis" : null;
+      } else if (mode === 3) {
+        reader.read(16);
+      } else if (mode === 5 || mode === 9) {
+        if (mode === 9) reader.read(8);
+      } else {
+        return null;
+      }
+    }
+    return result;
+  }
+
+  // --- Decoding -------------------------------------------------------------
+
+  function decodeGrid(grid) {
+    const version = readVersion(grid);
+    if (version * 4 + 17 !== grid.dimension) return { version: version };
+    const format = readFormat(grid);
+    if (!format) return null;
+    const blocks = dataBlocks(readCodewords(grid, version, format.mask), version, format.ecLevel);
+    if (!blocks) return null;
+    const data = [];
+    for (let i = 0; i < blocks.length; i++) {
+      if (!correctErrors(blocks[i].codewords, blocks.ecPerBlock)) return null;
+      for (let j = 0; j < blocks[i].numData; j++) data.push(blocks[i].codewords[j]);
+    }
+    const text = decodeSegments(data, version);
+    return text === null ? null : { text: text };
+  }
+
+  // BOTTOM_RIGHT_OFFSETS are the offsets, in modules, from the estimated
+  // bottom right corner that are tried when there is no alignment pattern to
+  // go by. The estimate assumes there is no perspective, so it can be off.
+  const BOTTOM_RIGHT_OFFSETS = [];
+  for (let dy = -3; dy <= 3; dy++) {
+    for (let dx = -3; dx <= 3; dx++) BOTTOM_RIGHT_OFFSETS.push([dx, dy]);
+  }
+  BOTTOM_RIGHT_OFFSETS.sort(function (a, b) { return Math.hypot(a[0], a[1]) - Math.hypot(b[0], b[1]); });
+
+  function decodeAt(image, patterns, moduleSize, dimension) {
+    const estimate = {
+      x: patterns.topRight.x - patterns.topLeft.x + patterns.bottomLeft.x,
+      y: patterns.topRight.y - patterns.topLeft.y + patterns.bottomLeft.y,
+    };
+    let result = null;
+    const attempt = function (bottomRight, isAlignment) {
+      const grid = sampleGrid(image, gridTransform(patterns, bottomRight, isAlignment, dimension), dimension);
+      if (!grid) return false;
+      const decoded = decodeGrid(grid);
+      if (decoded && (!result || decoded.text !== undefined)) result = decoded;
+      return decoded !== null && decoded.text !== undefined;
+    };
+
+    if (dimension > 21) {
+      const correction = 1 - 3 / (dimension - 7);
+      const estimateX = Math.floor(patterns.topLeft.x + correction * (estimate.x - patterns.topLeft.x));
+      const estimateY = Math.floor(patterns.topLeft.y + correction * (estimate.y - patterns.topLeft.y));
+      // Perspective can move the alignment pattern several modules from the
+      // estimate, so look further out until one of the candidates decodes.
+      const tried = [];
+      for (let allowance = 4; allowance <= 16; allowance <<= 1) {
+        const candidates = findAlignment(image, moduleSize, estimateX, estimateY, allowance);
+        for (let i = 0, attempts = 0; i < candidates.length && attempts < 8; i++) {
+          const candidate = candidates[i];
+          const seen = tried.some(function (other) {
+            return Math.abs(other.x - candidate.x) < moduleSize && Math.abs(other.y - candidate.y) < moduleSize;
+          });
+          if (seen) continue;
+          tried.push(candidate);
+          attempts++;
+          if (attempt(candidate, true)) return result;
+        }
+      }
+    }
+
+    const unitX = (patterns.topRight.x - patterns.topLeft.x) / (dimension - 7);
+    const unitY = (patterns.topRight.y - patterns.topLeft.y) / (dimension - 7);
+    const downX = (patterns.bottomLeft.x - patterns.topLeft.x) / (dimension - 7);
+    const downY = (patterns.bottomLeft.y - patterns.topLeft.y) / (dimension - 7);
+    for (let i = 0; i < BOTTOM_RIGHT_OFFSETS.length; i++) {
+      const dx = BOTTOM_RIGHT_OFFSETS[i][0];
+      const dy = BOTTOM_RIGHT_OFFSETS[i][1];
+      const bottomRight = { x: estimate.x + dx * unitX + dy * downX, y: estimate.y + dx * unitY + dy * downY };
+      if (attempt(bottomRight, false)) return result;
+    }
+    return result;
+  }
+
+  function decodeImage(image) {
+    const triples = candidateTriples(new FinderPatternFinder(image).find());
+    for (let t = 0; t < triples.length && t < 5; t++) {
+      const patterns = triples[t];
+      const moduleSize = estimateModuleSize(image, patterns);
+      const tried = {};
+      const dimensions = candidateDimensions(patterns, moduleSize);
+      for (let d = 0; d < dimensions.length; d++) {
+        const dimension = dimensions[d];
+        if (tried[dimension]) continue;
+        tried[dimension] = true;
+        const result = decodeAt(image, patterns, moduleSize, dimension);
+        if (result && result.text !== undefined) return result.text;
+        // The version information of large codes tells us the real size.
+        if (result && result.version && !tried[result.version * 4 + 17]) dimensions.push(result.version * 4 + 17);
+      }
+    }
+    return null;
+  }
+
+  function decodeQR(rgba, width, height) {
+    return decodeImage(binarize(luminances(rgba, width, height), width, height));
+  }
+
+  global.decodeQR = decodeQR;
+})(window);